@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// activationPage serves the page confirming the activation of the token, with the code of the email.
+// Invalid tokens fail straight away.
+func (app *App) activationPage(c *gin.Context) {
+	t := c.Param("token")
+	if _, f := app.checkActivationToken(t); f != nil {
+		app.activationResult(c, nil, f)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.HTML(http.StatusOK, "activate.html", gin.H{"Token": t})
+}
+
+// activateForm activates the token with the code posted by the activation page.
+func (app *App) activateForm(c *gin.Context) {
+	h := strings.ToUpper(strings.TrimSpace(c.PostForm("hash")))
+	a, f := app.activateToken(c.Request.Context(), c.Param("token"), h, app.clientMeta(c))
+	if f != nil {
+		app.activationResult(c, nil, f)
+		return
+	}
+	app.activationResult(c, &a, nil)
+}
+
+// activationResult redirects to the success URL with the address of a, or to the error URL with the reason of f.
+// Without URL, the result is rendered.
+func (app *App) activationResult(c *gin.Context, a *activation, f *activationFailure) {
+	switch {
+	case f != nil && app.errorURL == "":
+		app.activationFailed(c, f)
+	case f != nil:
+		if f.err != nil {
+			app.logInternal(c, f.err)
+		}
+		app.redirect(c, app.errorURL, "reason", f.reason)
+	case app.successURL == "":
+		app.activated(c, *a)
+	default:
+		app.redirect(c, app.successURL, "address", a.Address)
+	}
+}
+
+// redirect redirects to target with the query parameter k set to v.
+func (app *App) redirect(c *gin.Context, target, k, v string) {
+	u, err := url.Parse(target) // validated by setup
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	q := u.Query()
+	q.Set(k, v)
+	u.RawQuery = q.Encode()
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, u.String())
+}
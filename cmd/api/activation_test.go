@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/crypto"
+	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+)
+
+func TestActivationPage(t *testing.T) {
+	used := "44DFptZSiuQSJBF9LemyMcqz6jei5EiVzkX7cdGxFW15"
+	app := newTestApp(data.NewMockDBContent([]string{sponsor, used}))
+	app.successURL, app.errorURL = "https://unleak.trade/activated?lang=en", "https://unleak.trade/activation-failed"
+	r := setupRouter(app)
+	address := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	token := func(address string, at time.Time) string {
+		tk, _ := app.jwt.Create(&data.User{Address: address, Email: "john.doe@mailservice.com", Sponsor: sponsor}, at)
+		return tk
+	}
+	valid, expired, usedToken := token(address, time.Now()), token(address, time.Now().Add(-time.Hour)), token(used, time.Now())
+
+	t.Run("page", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/activate/"+valid, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `action="/activate/`+valid+`"`) {
+			t.Errorf("incorrect page, got %d %s", w.Code, w.Body.String())
+			t.FailNow()
+		}
+	})
+
+	tt := []struct {
+		name     string
+		method   string
+		token    string
+		hash     string
+		location string
+	}{
+		{"malformed page", "GET", "n0t-a-t0k3n", "", "https://unleak.trade/activation-failed?reason=invalid_token"},
+		{"expired page", "GET", expired, "", "https://unleak.trade/activation-failed?reason=expired_token"},
+		{"malformed", "POST", "n0t-a-t0k3n", "hA5h", "https://unleak.trade/activation-failed?reason=invalid_token"},
+		{"wrong code", "POST", valid, "hA5h", "https://unleak.trade/activation-failed?reason=invalid_token"},
+		{"expired", "POST", expired, app.jwt.Hash(expired), "https://unleak.trade/activation-failed?reason=expired_token"},
+		{"already used", "POST", usedToken, app.jwt.Hash(usedToken), "https://unleak.trade/activation-failed?reason=already_used"},
+		{"success", "POST", valid, " " + strings.ToLower(app.jwt.Hash(valid)) + "\n", "https://unleak.trade/activated?address=" + address + "&lang=en"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tc.method, "/activate/"+tc.token, strings.NewReader(url.Values{"hash": {tc.hash}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusFound || w.Header().Get("Location") != tc.location {
+				t.Errorf("incorrect redirection, got %d %q, want %q", w.Code, w.Header().Get("Location"), tc.location)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestWelcomeEmail(t *testing.T) {
+	for _, delay := range []time.Duration{0, 48 * time.Hour} {
+		db := data.NewMockDBContent([]string{sponsor})
+		app := newTestApp(db)
+		app.outbox = mailer.NewOutboxWorker(db, mailer.NewMockSmtpMailer(0), app.metrics, time.Hour, time.Minute).WithUsers(db)
+		app.welcomeDelay = delay
+		address := solana.NewWallet().PublicKey().String()
+		if w := activate(app, setupRouter(app), address); w.Code != http.StatusCreated {
+			t.Errorf("Status code is incorrect, got %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+			t.FailNow()
+		}
+		var welcome []*data.OutboxEmail
+		l, _ := db.Pending()
+		for _, e := range l {
+			if e.Template == mailer.TemplateWelcome {
+				welcome = append(welcome, e)
+			}
+		}
+		if delay == 0 {
+			if len(welcome) != 0 {
+				t.Errorf("the welcome email must be disabled, got %v", welcome)
+				t.FailNow()
+			}
+			continue
+		}
+		if len(welcome) != 1 || welcome[0].User != address || welcome[0].Payload["referral"] != generateReferralLink(address) {
+			t.Errorf("the welcome email must be scheduled with the referral link, got %v", welcome)
+			t.FailNow()
+		}
+		if due := time.UnixMilli(welcome[0].SendAt); time.Until(due) < delay-time.Minute || time.Until(due) > delay {
+			t.Errorf("the welcome email must be due %v after the activation, got %v", delay, due)
+			t.FailNow()
+		}
+	}
+}
+
+func TestActivateExpiredToken(t *testing.T) {
+	app := newTestApp(data.NewMockDBContent([]string{sponsor}))
+	r := setupRouter(app)
+	u := &data.User{Address: "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", Email: "john.doe@mailservice.com", Sponsor: sponsor}
+	expired, _ := app.jwt.Create(u, time.Now().Add(-time.Hour))
+	k, _ := cipher.GenerateKey(32)
+	forged, _ := crypto.NewJWTHS256(k).Create(u, time.Now())
+	forgedExpired, _ := crypto.NewJWTHS256(k).Create(u, time.Now().Add(-time.Hour))
+
+	tt := []struct {
+		name   string
+		token  string
+		status int
+		body   string
+	}{
+		{"expired", expired, http.StatusGone, `{"error":{"code":"activation_expired","message":"activation link expired, register again to receive a new one"}}`},
+		{"forged", forged, http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"Unauthorized"}}`},
+		{"forged and expired", forgedExpired, http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"Unauthorized"}}`},
+		{"malformed", "n0t.a.t0k3n!", http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"Unauthorized"}}`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/activate/"+url.PathEscape(tc.token)+"/"+app.jwt.Hash(tc.token), nil)
+			r.ServeHTTP(w, req)
+			if w.Code != tc.status || errorJSON(w) != tc.body {
+				t.Errorf("got %d %s, want %d %s", w.Code, errorJSON(w), tc.status, tc.body)
+				t.FailNow()
+			}
+		})
+	}
+}
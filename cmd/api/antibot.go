@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/unleaktrade/waitlist/internal/captcha"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// Headers carrying the proof-of-work of a registration, for a challenge from GET /challenge.
+const (
+	powChallengeHeader = "UNLK-POW-Challenge"
+	powSolutionHeader  = "UNLK-POW-Solution"
+)
+
+// captchaTimeout bounds the verification of a CAPTCHA token, the registration waiting for it.
+const captchaTimeout = 3 * time.Second
+
+// registerTimeout bounds register by the fast timeout, extended by captchaTimeout when a CAPTCHA is verified:
+// a slow verifier then fails open, or closed, within the deadline of the DB calls that follow.
+func (app *App) registerTimeout(c *gin.Context) {
+	d := app.fastTimeout
+	if d > 0 && app.captcha != nil {
+		d += captchaTimeout
+	}
+	app.timeout(d)(c)
+}
+
+// registerRequest is the body of register: the user, and the proofs it is not a bot and owns the wallet.
+type registerRequest struct {
+	data.User
+	Website      string `json:"website"` // honeypot, hidden from humans
+	CaptchaToken string `json:"captcha_token"`
+	Signature    string `json:"signature"` // of a nonce from GET /nonce/:address, in base58
+}
+
+// trapped returns whether r is from a bot, answering it as if it was registered.
+func (app *App) trapped(c *gin.Context, r *registerRequest) bool {
+	if !app.honeypot || r.Website == "" {
+		return false
+	}
+	app.logger.Info("🍯 honeypot filled, registration ignored", "address", r.Address)
+	c.JSON(http.StatusAccepted, gin.H{"hash": app.jwt.Hash(uuid.NewString())})
+	return true
+}
+
+// challenge issues a proof-of-work challenge to solve before registering.
+func (app *App) challenge(c *gin.Context) {
+	if app.pow == nil {
+		app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, app.pow.Issue())
+}
+
+// solved returns whether the request carries the solution of a challenge, failing it otherwise.
+func (app *App) solved(c *gin.Context) bool {
+	if app.pow == nil {
+		return true
+	}
+	if err := app.pow.Verify(c.GetHeader(powChallengeHeader), c.GetHeader(powSolutionHeader)); err != nil {
+		app.fail(c, http.StatusBadRequest, codePoWFailed, err.Error())
+		return false
+	}
+	return true
+}
+
+// human returns whether the CAPTCHA token of r is valid, failing the request otherwise.
+// When the verifier is unavailable, the registration goes on if app.captchaFailOpen is set.
+func (app *App) human(c *gin.Context, r *registerRequest) bool {
+	if app.captcha == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), captchaTimeout)
+	defer cancel()
+	err := app.captcha.Verify(ctx, r.CaptchaToken, c.ClientIP())
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, captcha.ErrUnavailable):
+		app.logger.Warn("⚠️ cannot verify the captcha", "address", r.Address, "fail_open", app.captchaFailOpen, slog.Any("error", err))
+		if app.captchaFailOpen {
+			return true
+		}
+		app.fail(c, http.StatusBadRequest, codeCaptchaFailed, captcha.ErrUnavailable.Error())
+	case errors.Is(err, captcha.ErrMissingToken):
+		app.fail(c, http.StatusBadRequest, codeCaptchaFailed, err.Error(), fieldError{"captcha_token", "required"})
+	default:
+		app.fail(c, http.StatusBadRequest, codeCaptchaFailed, captcha.ErrRejected.Error())
+	}
+	return false
+}
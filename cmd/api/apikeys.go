@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes of the API keys, each route requiring at most one.
+const (
+	scopeRegister = "register"
+	scopeCheck    = "check"
+	scopeAdmin    = "admin"
+	scopeExport   = "export"
+	scopePII      = "pii" // with export, to list the emails in clear
+)
+
+// allScopes are the scopes of the legacy UNLEAKTRADE_WAITLIST_API_KEY.
+var allScopes = []string{scopeRegister, scopeCheck, scopeAdmin, scopeExport, scopePII}
+
+// scopesKey is the key of the scopes of the request's API key in the gin context.
+const scopesKey = "scopes"
+
+// apiKey is the configuration of a key, given as the array of its scopes or as an object.
+type apiKey struct {
+	Scopes []string `json:"scopes"`
+	Signed bool     `json:"signed"` // requests signed with Secret, see client.Sign
+	Secret string   `json:"secret"`
+}
+
+func (k *apiKey) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		return json.Unmarshal(b, &k.Scopes)
+	}
+	type plain apiKey
+	return json.Unmarshal(b, (*plain)(k))
+}
+
+// parseAPIKeys parses the keys, as a JSON object like
+// {"key": ["register", "check"], "other": {"scopes": ["check"], "signed": true, "secret": "s3cr3t"}}.
+func parseAPIKeys(b []byte) (map[string]apiKey, error) {
+	var keys map[string]apiKey
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("invalid API keys: %w", err)
+	}
+	for k, v := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("invalid API keys: empty key")
+		}
+		if v.Signed && v.Secret == "" {
+			return nil, fmt.Errorf("invalid API keys: signed key without secret")
+		}
+		for _, s := range v.Scopes {
+			if !slices.Contains(allScopes, s) {
+				return nil, fmt.Errorf("invalid API keys: unknown scope %q", s)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// loadAPIKeys returns the keys of the JSON v, or of the JSON file f when v is empty, none when both are.
+func loadAPIKeys(v, f string) (map[string]apiKey, error) {
+	if v == "" && f != "" {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		v = string(b)
+	}
+	if v == "" {
+		return map[string]apiKey{}, nil
+	}
+	return parseAPIKeys([]byte(v))
+}
+
+// authenticate returns the API key of c, checking the signature of the signed keys, failing c otherwise.
+func (app *App) authenticate(c *gin.Context) (apiKey, bool) {
+	k, ok := app.apiKeys[c.GetHeader("UNLK-API-KEY")]
+	if !ok {
+		app.fail(c, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+		return k, false
+	}
+	if !k.Signed {
+		return k, true
+	}
+	if err := app.signatures.verify(c.Request, k.Secret); err != nil {
+		var mb *http.MaxBytesError
+		if errors.As(err, &mb) {
+			app.failBinding(c, err)
+			return k, false
+		}
+		app.fail(c, http.StatusUnauthorized, codeUnauthorized, err.Error())
+		return k, false
+	}
+	return k, true
+}
+
+func (app *App) requireAPIKey(c *gin.Context) {
+	k, ok := app.authenticate(c)
+	if !ok {
+		return
+	}
+	c.Set(scopesKey, k.Scopes)
+	c.Next()
+}
+
+// requireScope lets the requests through when their API key, checked by requireAPIKey, has the scope s.
+func (app *App) requireScope(s string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !app.scoped(c, c.GetStringSlice(scopesKey), s) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// optionalScope requires the scope s of the requests with an API key, the others going through,
+// as the public routes are called by the browsers without key.
+func (app *App) optionalScope(s string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("UNLK-API-KEY") == "" {
+			c.Next()
+			return
+		}
+		k, ok := app.authenticate(c)
+		if !ok || !app.scoped(c, k.Scopes, s) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// scoped returns whether scopes has s, failing c otherwise.
+func (app *App) scoped(c *gin.Context, scopes []string, s string) bool {
+	if !slices.Contains(scopes, s) {
+		app.fail(c, http.StatusForbidden, codeInsufficientScope, fmt.Sprintf("API key without the %s scope", s))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	tt := []struct {
+		name  string
+		keys  string
+		valid bool
+	}{
+		{"scopes", `{"partner": ["register", "check"], "ops": ["admin", "export"]}`, true},
+		{"no scope", `{"partner": []}`, true},
+		{"unknown scope", `{"partner": ["delete"]}`, false},
+		{"empty key", `{"": ["check"]}`, false},
+		{"signed", `{"partner": {"scopes": ["check"], "signed": true, "secret": "s3cr3t"}}`, true},
+		{"signed without secret", `{"partner": {"scopes": ["check"], "signed": true}}`, false},
+		{"not an object", `["partner"]`, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseAPIKeys([]byte(tc.keys))
+			if (err == nil) != tc.valid {
+				t.Errorf("incorrect parsing of %s, got %v", tc.keys, err)
+				t.FailNow()
+			}
+		})
+	}
+
+	f := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(f, []byte(`{"partner": ["check"]}`), 0o600)
+	keys, err := loadAPIKeys("", f)
+	if err != nil || !slices.Equal(keys["partner"].Scopes, []string{scopeCheck}) {
+		t.Errorf("incorrect keys of %s, got %v, %v", f, keys, err)
+		t.FailNow()
+	}
+	keys, err = loadAPIKeys(`{"ops": ["admin"]}`, f)
+	if err != nil || len(keys) != 1 || keys["ops"].Scopes == nil {
+		t.Errorf("the env variable must win over the file, got %v, %v", keys, err)
+		t.FailNow()
+	}
+	if keys, err := loadAPIKeys("", ""); err != nil || len(keys) != 0 {
+		t.Errorf("no keys must be configured, got %v, %v", keys, err)
+		t.FailNow()
+	}
+}
+
+func TestScopes(t *testing.T) {
+	app := newTestApp(data.MockDB)
+	app.apiKeys = map[string]apiKey{
+		"none":     {},
+		"register": {Scopes: []string{scopeRegister}},
+		"check":    {Scopes: []string{scopeCheck}},
+		"admin":    {Scopes: []string{scopeAdmin}},
+		"export":   {Scopes: []string{scopeExport}},
+		"partner":  {Scopes: []string{scopeRegister, scopeCheck}},
+		"all":      {Scopes: allScopes},
+	}
+	r := setupRouter(app)
+
+	routes := []struct {
+		method, path, body string
+		scope              string // none when any key is enough
+	}{
+		{"POST", "/register", "{}", scopeRegister},
+		{"GET", "/check-wallet/5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "", scopeCheck},
+		{"GET", "/path1/path2/list", "", scopeExport},
+		{"POST", "/path1/path2/exports", "{}", scopeExport},
+		{"GET", "/path1/path2/cache", "", scopeAdmin},
+		{"GET", "/path1/path2/limits", "", scopeAdmin},
+		{"GET", "/path1/path2/token/a.b.c", "", scopeAdmin},
+		{"GET", "/path1/path2/users/5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF/events", "", scopeAdmin},
+		{"POST", "/path1/path2/users/5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF/restore", "", scopeAdmin},
+		{"DELETE", "/path1/path2/users/5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "", scopeAdmin},
+		{"POST", "/path1/path2/invites", "{}", scopeAdmin},
+		{"POST", "/path1/path2/seed", "{}", scopeAdmin},
+		{"POST", "/path1/path2/import", "[]", scopeAdmin},
+		{"GET", "/health", "", ""},
+	}
+	for _, rt := range routes {
+		for k, key := range app.apiKeys {
+			t.Run(rt.method+" "+rt.path+" "+k, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest(rt.method, rt.path, strings.NewReader(rt.body))
+				req.Header.Set("UNLK-API-KEY", k)
+				r.ServeHTTP(w, req)
+				if rt.scope == "" || slices.Contains(key.Scopes, rt.scope) {
+					if w.Code == http.StatusForbidden || w.Code == http.StatusUnauthorized {
+						t.Errorf("key %s must be allowed, got %d %s", k, w.Code, w.Body.String())
+						t.FailNow()
+					}
+					return
+				}
+				want := `{"error":{"code":"insufficient_scope","message":"API key without the ` + rt.scope + ` scope"}}`
+				if w.Code != http.StatusForbidden || errorJSON(w) != want {
+					t.Errorf("key %s must be forbidden, got %d %s", k, w.Code, errorJSON(w))
+					t.FailNow()
+				}
+			})
+		}
+	}
+
+	for key, status := range map[string]int{"": http.StatusBadRequest, "unknown": http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/register", strings.NewReader("{}"))
+		if key != "" {
+			req.Header.Set("UNLK-API-KEY", key)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("incorrect status of a registration with key %q, got %d, want %d", key, w.Code, status)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/pkg/client"
+)
+
+func TestClient(t *testing.T) {
+	app := newTestApp(data.NewMockDBContent([]string{sponsor}))
+	app.apiKeys["partner"] = apiKey{Scopes: []string{scopeRegister, scopeCheck}, Signed: true, Secret: "s3cr3t"}
+	s := httptest.NewServer(setupRouter(app))
+	defer s.Close()
+	ctx := context.Background()
+	admin, _ := app.jwt.CreateAdmin("alice", time.Now())
+	c := client.New(s.URL, testApiKey, client.WithAdminToken(admin), client.WithRetries(0, 0))
+	a := solana.NewWallet().PublicKey().String()
+
+	u := data.NewUser(a, "john.doe@mailservice.com", sponsor)
+	h, err := c.Register(ctx, u)
+	if err != nil || h == "" {
+		t.Errorf("cannot register, got %q, %v", h, err)
+		t.FailNow()
+	}
+	if _, err := c.Register(ctx, data.NewUser("n0t-an-address", "john.doe@mailservice.com", sponsor)); !errors.Is(err, client.ErrInvalid) {
+		t.Errorf("an invalid registration must fail with ErrInvalid, got %v", err)
+		t.FailNow()
+	}
+
+	tk, _ := app.jwt.Create(u, time.Now())
+	got, err := c.Activate(ctx, tk, app.jwt.Hash(tk))
+	if err != nil || got.Address != a || got.Sponsor != sponsor {
+		t.Errorf("cannot activate, got %+v, %v", got, err)
+		t.FailNow()
+	}
+	if _, err := c.Activate(ctx, tk, "WR0NG"); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("a wrong hash must fail with ErrUnauthorized, got %v", err)
+		t.FailNow()
+	}
+
+	app.c.Add(a, time.Now().UnixMilli())
+	ok, at, err := c.CheckWallet(ctx, a)
+	if err != nil || !ok || at.IsZero() {
+		t.Errorf("incorrect wallet, got %v %v %v", ok, at, err)
+		t.FailNow()
+	}
+
+	if _, err := c.List(ctx, client.ListOptions{}); err != nil {
+		t.Errorf("cannot list, got %v", err)
+		t.FailNow()
+	}
+	if _, err := client.New(s.URL, testApiKey).List(ctx, client.ListOptions{}); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("listing without admin token must fail with ErrUnauthorized, got %v", err)
+		t.FailNow()
+	}
+
+	partner := client.New(s.URL, "partner", client.WithSecret("s3cr3t"), client.WithRetries(0, 0))
+	if _, _, err := partner.CheckWallet(ctx, a); err != nil {
+		t.Errorf("cannot check a wallet with a signed key, got %v", err)
+		t.FailNow()
+	}
+	if _, err := partner.List(ctx, client.ListOptions{}); !errors.Is(err, client.ErrUnauthorized) && !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("the partner must not list, got %v", err)
+		t.FailNow()
+	}
+}
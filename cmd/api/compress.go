@@ -0,0 +1,80 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// gzipWriter compresses the body as it is written, so streamed responses are never buffered whole.
+// Responses without body, like 304, are left untouched.
+type gzipWriter struct {
+	gin.ResponseWriter
+	z *gzip.Writer // nil until the first write
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.z == nil {
+		h := w.Header()
+		h.Del("Content-Length") // of the uncompressed body, net/http sets the one of the compressed body
+		h.Set("Content-Encoding", "gzip")
+		w.z = gzipWriters.Get().(*gzip.Writer)
+		w.z.Reset(w.ResponseWriter)
+	}
+	return w.z.Write(b)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Flush() {
+	if w.z != nil {
+		w.z.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipWriter) close() {
+	if w.z != nil {
+		w.z.Close()
+		gzipWriters.Put(w.z)
+		w.z = nil
+	}
+}
+
+// acceptsGzip returns whether the Accept-Encoding header h allows gzip.
+func acceptsGzip(h string) bool {
+	for _, e := range strings.Split(h, ",") {
+		name, params, _ := strings.Cut(e, ";")
+		if name = strings.TrimSpace(name); name != "gzip" && name != "*" {
+			continue
+		}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(v, 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// compress gzips the responses of the clients accepting it.
+func compress(c *gin.Context) {
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(c.GetHeader("Accept-Encoding")) || c.Request.Method == http.MethodHead {
+		c.Next()
+		return
+	}
+	w := &gzipWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer w.close()
+	c.Next()
+}
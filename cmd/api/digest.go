@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+)
+
+// digestLock is the lock held by the replica sending the digests.
+const digestLock = "digest"
+
+// digest is the summary of the referrals of a sponsor.
+type digest struct {
+	sponsor *data.User
+	mailer.Digest
+}
+
+// selectDigests returns the digests due at now: the sponsors whose last digest, in last, is at least interval old
+// and who referred someone since. The sponsors never sent one count their referrals of the last interval.
+// The sponsors without an email, as the genesis users, are left out.
+func selectDigests(users []*data.User, last map[string]int64, now time.Time, interval time.Duration) []digest {
+	l := append([]*data.User{}, users...)
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Timestamp != l[j].Timestamp {
+			return l[i].Timestamp < l[j].Timestamp
+		}
+		return l[i].Address < l[j].Address
+	})
+	positions := make(map[string]int, len(l))
+	for i, u := range l {
+		positions[u.Address] = i + 1
+	}
+
+	due := now.Add(-interval).UnixMilli()
+	digests := map[string]*digest{}
+	for _, u := range l {
+		p, ok := positions[u.Sponsor]
+		if !ok {
+			continue
+		}
+		sp := l[p-1]
+		if sp.Genesis || sp.Email == "" {
+			continue
+		}
+		since, sent := last[sp.Address]
+		if sent && since > due {
+			continue // too early
+		}
+		if !sent {
+			since = due
+		}
+		d := digests[sp.Address]
+		if d == nil {
+			d = &digest{sp, mailer.Digest{Position: p, ReferralUrl: generateReferralLink(sp.Address)}}
+			digests[sp.Address] = d
+		}
+		d.Total++
+		if u.Timestamp > since {
+			d.New++
+		}
+	}
+
+	var res []digest
+	for _, d := range digests {
+		if d.New > 0 {
+			res = append(res, *d)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Position < res[j].Position })
+	return res
+}
+
+// sendDigests enqueues the digests due at now, returning how many were sent.
+// The last digest of a sponsor is recorded first, so a failure never sends it twice.
+func (app *App) sendDigests(now time.Time) (int, error) {
+	users, err := app.db.List()
+	if err != nil {
+		return 0, err
+	}
+	last, err := app.db.LastDigests()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, d := range selectDigests(users, last, now, app.digestInterval) {
+		if d.sponsor.Anonymized() {
+			continue
+		}
+		e, l, md := d.sponsor.Email, d.sponsor.Lang, d.Digest
+		if suppressed, err := app.db.IsSuppressed(e); err != nil || suppressed {
+			continue
+		}
+		if err := app.db.SetLastDigest(d.sponsor.Address, now.UnixMilli()); err != nil {
+			app.logger.Warn("⚠️ cannot record the digest", "address", d.sponsor.Address, slog.Any("error", err))
+			continue
+		}
+		m := data.NewOutboxEmail(e, mailer.TemplateDigest, md.Payload(l)).Schedule(d.sponsor.Address, now)
+		app.enqueueEmail(context.Background(), m, func() error { return app.mailer.SendDigestEmail(e, md, l) })
+		n++
+	}
+	return n, nil
+}
+
+// runDigest sends the due digests when this replica holds the digest lock, for twice the check period d
+// so that another replica takes over when it stops.
+func (app *App) runDigest(now time.Time, d time.Duration) {
+	ok, err := app.db.AcquireLock(digestLock, app.replica, 2*d)
+	if err != nil {
+		app.logger.Warn("⚠️ cannot acquire the digest lock", slog.Any("error", err))
+		return
+	}
+	if !ok {
+		return // sent by another replica
+	}
+	n, err := app.sendDigests(now)
+	if err != nil {
+		app.logger.Warn("⚠️ cannot send the digests", slog.Any("error", err))
+		return
+	}
+	if n > 0 {
+		app.logger.Info("📰 digests sent", "count", n)
+	}
+}
+
+// runDigests checks the due digests every d until ctx is done.
+func (app *App) runDigests(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			app.runDigest(now, d)
+		}
+	}
+}
+
+// digests sends the due digests now, whichever replica holds the digest lock.
+func (app *App) digests(c *gin.Context) {
+	if app.digestInterval <= 0 {
+		app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	n, err := app.sendDigests(time.Now())
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sent": n})
+}
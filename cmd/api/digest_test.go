@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+)
+
+func TestSelectDigests(t *testing.T) {
+	now := time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+	at := func(d time.Duration) int64 { return now.Add(-d).UnixMilli() }
+	users := []*data.User{
+		{Address: "genesis", Genesis: true, Timestamp: at(30 * 24 * time.Hour)},
+		{Address: "alice", Email: "alice@mailservice.com", Sponsor: "genesis", Timestamp: at(20 * 24 * time.Hour)},
+		{Address: "bob", Email: "bob@mailservice.com", Sponsor: "genesis", Timestamp: at(19 * 24 * time.Hour)},
+		{Address: "carol", Email: "carol@mailservice.com", Sponsor: "genesis", Timestamp: at(18 * 24 * time.Hour)},
+		{Address: "a1", Email: "a1@mailservice.com", Sponsor: "alice", Timestamp: at(10 * 24 * time.Hour)},
+		{Address: "a2", Email: "a2@mailservice.com", Sponsor: "alice", Timestamp: at(2 * 24 * time.Hour)},
+		{Address: "a3", Email: "a3@mailservice.com", Sponsor: "alice", Timestamp: at(time.Hour)},
+		{Address: "b1", Email: "b1@mailservice.com", Sponsor: "bob", Timestamp: at(10 * 24 * time.Hour)},
+		{Address: "c1", Email: "c1@mailservice.com", Sponsor: "carol", Timestamp: at(2 * 24 * time.Hour)},
+		{Address: "d1", Email: "d1@mailservice.com", Sponsor: "deleted", Timestamp: at(time.Hour)},
+	}
+
+	tt := []struct {
+		name string
+		last map[string]int64
+		want map[string]mailer.Digest // by sponsor
+	}{
+		{"never sent", nil, map[string]mailer.Digest{
+			"alice": {New: 2, Total: 3, Position: 2},
+			"carol": {New: 1, Total: 1, Position: 4},
+		}},
+		{"sent a week ago", map[string]int64{"alice": at(week), "bob": at(week + time.Hour), "carol": at(week)}, map[string]mailer.Digest{
+			"alice": {New: 2, Total: 3, Position: 2},
+			"carol": {New: 1, Total: 1, Position: 4},
+		}},
+		{"sent 3 days ago", map[string]int64{"alice": at(3 * 24 * time.Hour)}, map[string]mailer.Digest{
+			"carol": {New: 1, Total: 1, Position: 4},
+		}},
+		{"sent 9 days ago", map[string]int64{"alice": at(9 * 24 * time.Hour), "bob": at(11 * 24 * time.Hour)}, map[string]mailer.Digest{
+			"alice": {New: 2, Total: 3, Position: 2},
+			"bob":   {New: 1, Total: 1, Position: 3},
+			"carol": {New: 1, Total: 1, Position: 4},
+		}},
+		{"sent just before the referrals", map[string]int64{"alice": at(11 * 24 * time.Hour)}, map[string]mailer.Digest{
+			"alice": {New: 3, Total: 3, Position: 2},
+			"carol": {New: 1, Total: 1, Position: 4},
+		}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l := selectDigests(users, tc.last, now, week)
+			if len(l) != len(tc.want) {
+				t.Errorf("incorrect digests, got %d, want %d: %v", len(l), len(tc.want), l)
+				t.FailNow()
+			}
+			for i, d := range l {
+				want, ok := tc.want[d.sponsor.Address]
+				want.ReferralUrl = generateReferralLink(d.sponsor.Address)
+				if !ok || d.Digest != want {
+					t.Errorf("incorrect digest of %s, got %+v, want %+v", d.sponsor.Address, d.Digest, want)
+					t.FailNow()
+				}
+				if i > 0 && l[i-1].Position > d.Position {
+					t.Error("the digests must be sorted by position")
+					t.FailNow()
+				}
+			}
+		})
+	}
+}
+
+// newDigestApp returns an app of db sending the digests as replica.
+func newDigestApp(db interface {
+	data.DB
+	data.Outbox
+}, replica string) *App {
+	app := newTestApp(db)
+	app.outbox = mailer.NewOutboxWorker(db, mailer.NewMockSmtpMailer(0), app.metrics, time.Hour, time.Minute).WithUsers(db)
+	app.digestInterval = 7 * 24 * time.Hour
+	app.replica = replica
+	return app
+}
+
+// digestsOf returns the pending digest emails of db, by due time.
+func digestsOf(db data.Outbox) []*data.OutboxEmail {
+	var digests []*data.OutboxEmail
+	l, _ := db.Pending()
+	for _, e := range l {
+		if e.Template == mailer.TemplateDigest {
+			digests = append(digests, e)
+		}
+	}
+	sort.SliceStable(digests, func(i, j int) bool { return digests[i].SendAt < digests[j].SendAt })
+	return digests
+}
+
+// refer saves n users referred by sponsor sp.
+func refer(t *testing.T, db data.DB, sp string, n int) {
+	for i := 0; i < n; i++ {
+		a := solana.NewWallet().PublicKey().String()
+		if err := db.Save(&data.User{Address: a, Email: fmt.Sprintf("john.doe+%s@mailservice.com", a), Sponsor: sp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDigestLeaderLock(t *testing.T) {
+	db := data.NewMemoryDB()
+	sp := &data.User{Address: solana.NewWallet().PublicKey().String(), Email: "jane.doe@mailservice.com", Sponsor: solana.NewWallet().PublicKey().String(), Lang: "fr"}
+	if err := db.Save(sp); err != nil {
+		t.Fatal(err)
+	}
+	refer(t, db, sp.Address, 2)
+	a, b := newDigestApp(db, "replica-a"), newDigestApp(db, "replica-b")
+
+	now := time.Now()
+	a.runDigest(now, time.Hour)
+	l := digestsOf(db)
+	if len(l) != 1 || l[0].Recipient != sp.Email || l[0].Payload["new"] != "2" || l[0].Payload["lang"] != "fr" || l[0].User != sp.Address {
+		t.Errorf("the leader must send the digest, got %v", l)
+		t.FailNow()
+	}
+	if m, _ := db.LastDigests(); m[sp.Address] != now.UnixMilli() {
+		t.Errorf("the last digest must be recorded, got %v", m)
+		t.FailNow()
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	refer(t, db, sp.Address, 1)
+	later := now.Add(a.digestInterval + time.Minute)
+	b.runDigest(later, time.Hour)
+	if l := digestsOf(db); len(l) != 1 {
+		t.Errorf("only the leader must send the digests, got %d", len(l))
+		t.FailNow()
+	}
+	a.runDigest(later, time.Hour)
+	if l := digestsOf(db); len(l) != 2 || l[1].Payload["new"] != "1" || l[1].Payload["total"] != "3" {
+		t.Errorf("the leader must send the next digest, got %v", l)
+		t.FailNow()
+	}
+
+	a.runDigest(time.Now(), time.Millisecond) // lock held for 2ms now
+	time.Sleep(5 * time.Millisecond)          // the leader stopped
+	sp2 := &data.User{Address: solana.NewWallet().PublicKey().String(), Email: "jim.doe@mailservice.com", Sponsor: sp.Address}
+	if err := db.Save(sp2); err != nil {
+		t.Fatal(err)
+	}
+	refer(t, db, sp2.Address, 1)
+	b.runDigest(time.Now().Add(time.Minute), time.Hour)
+	if l := digestsOf(db); len(l) != 3 || l[1].Recipient != sp2.Email { // due before the second one
+		t.Errorf("another replica must take over the expired lock, got %v", l)
+		t.FailNow()
+	}
+}
+
+func TestDigestsEndpoint(t *testing.T) {
+	db := data.NewMemoryDB()
+	sp := &data.User{Address: solana.NewWallet().PublicKey().String(), Email: "jane.doe@mailservice.com", Sponsor: solana.NewWallet().PublicKey().String()}
+	if err := db.Save(sp); err != nil {
+		t.Fatal(err)
+	}
+	refer(t, db, sp.Address, 2)
+	suppressed := &data.User{Address: solana.NewWallet().PublicKey().String(), Email: "jim.doe@mailservice.com", Sponsor: sp.Address}
+	if err := db.Save(suppressed); err != nil {
+		t.Fatal(err)
+	}
+	db.Suppress(suppressed.Email)
+	refer(t, db, suppressed.Address, 1)
+
+	app := newDigestApp(db, "replica-a")
+	db.AcquireLock(digestLock, "replica-b", time.Hour) // a manual run ignores the lock
+	r := setupRouter(app)
+	for _, want := range []int{1, 0} { // the second run is too early
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/path1/path2/digests", nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		var res struct {
+			Sent int `json:"sent"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&res); w.Code != http.StatusOK || err != nil || res.Sent != want {
+			t.Errorf("incorrect run, got %d %d, want %d sent", w.Code, res.Sent, want)
+			t.FailNow()
+		}
+	}
+	if l := digestsOf(db); len(l) != 1 || l[0].Recipient != sp.Email || l[0].Payload["total"] != "3" {
+		t.Errorf("the digest of the suppressed sponsor must not be sent, got %v", l)
+		t.FailNow()
+	}
+
+	app.digestInterval = 0
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/path1/path2/digests", nil)
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("the digests must be disabled, got %d", w.Code)
+		t.FailNow()
+	}
+
+	app.db = data.NewMemoryDB().FailOn("LastDigests", "")
+	app.digestInterval = 7 * 24 * time.Hour
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/path1/path2/digests", nil)
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("a DB failure must fail the run, got %d", w.Code)
+		t.FailNow()
+	}
+}
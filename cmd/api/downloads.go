@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/cache"
+)
+
+// downloadTTL is the lifetime of the download links of the list.
+const downloadTTL = 10 * time.Minute
+
+var (
+	errDownloadLink    = errors.New("invalid download link")
+	errDownloadExpired = errors.New("download link expired")
+	errDownloadUsed    = errors.New("download link already used")
+)
+
+// download is the list a download link gives, signed in the link.
+type download struct {
+	listQuery
+	Format  string `json:"format"`
+	By      string `json:"by"`  // requester of the link, as recorded in the audit events
+	Expires int64  `json:"exp"` // unix seconds
+	Nonce   string `json:"nonce"`
+}
+
+// downloadLinks signs the download links of the list and verifies them, each one being used once.
+// Links sharing the secret are accepted by every replica; the links used are kept in memory,
+// a link used on a replica being accepted once more on another one until it expires.
+type downloadLinks struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu   sync.Mutex
+	used *cache.Cache[bool] // nonces of the links used, until they expire
+}
+
+func newDownloadLinks(secret []byte, ttl time.Duration) *downloadLinks {
+	return &downloadLinks{secret: secret, ttl: ttl, now: time.Now, used: cache.NewOf[bool](cache.WithTTL(ttl))}
+}
+
+func (l *downloadLinks) sign(payload string) string {
+	m := hmac.New(sha256.New, l.secret)
+	m.Write([]byte(payload))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// issue returns the signature of the download of q in format f for by, in the path of its link, and its expiry.
+func (l *downloadLinks) issue(q listQuery, f, by string) (string, time.Time) {
+	r := make([]byte, 16)
+	rand.Read(r)
+	exp := l.now().Add(l.ttl)
+	b, _ := json.Marshal(download{q, f, by, exp.Unix(), hex.EncodeToString(r)})
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + l.sign(payload), exp.Truncate(time.Second)
+}
+
+// verify checks the signature and expiry of sig, then burns it.
+func (l *downloadLinks) verify(sig string) (download, error) {
+	var d download
+	payload, mac, ok := strings.Cut(sig, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(l.sign(payload))) {
+		return d, errDownloadLink
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(b, &d) != nil {
+		return d, errDownloadLink
+	}
+	if !l.now().Before(time.Unix(d.Expires, 0)) {
+		return d, errDownloadExpired
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.used.IsPresent(d.Nonce) {
+		return d, errDownloadUsed
+	}
+	l.used.Add(d.Nonce, true)
+	return d, nil
+}
+
+func generateDownloadLink(sig string) string {
+	return fmt.Sprintf("https://unleak.trade/download/%s", sig)
+}
+
+// listLink returns a link downloading the list selected as by list, in CSV unless set by mime,
+// usable once by a browser without the API key until it expires.
+func (app *App) listLink(c *gin.Context) {
+	q, ok := app.listQuery(c)
+	if !ok {
+		return
+	}
+	mime := c.Query("mime")
+	if mime == "" {
+		mime = "csv"
+	}
+	f, ok := negotiateList(mime, "")
+	if !ok {
+		app.fail(c, http.StatusBadRequest, codeValidation, "invalid mime, supported formats: json, csv, ndjson", fieldError{"mime", "oneof=json csv ndjson"})
+		return
+	}
+	by := requester(c)
+	sig, exp := app.downloads.issue(q, f.name, by)
+	app.logger.Info("🔗 download link issued", "format", f.name, "pii", q.PII, "by", by, "expires_at", exp)
+	c.JSON(http.StatusCreated, gin.H{"url": generateDownloadLink(sig), "expires_at": exp.UTC()})
+}
+
+// downloadList responds with the list of a download link, once.
+func (app *App) downloadList(c *gin.Context) {
+	d, err := app.downloads.verify(c.Param("sig"))
+	switch {
+	case errors.Is(err, errDownloadLink):
+		app.fail(c, http.StatusForbidden, codeForbidden, err.Error())
+		return
+	case err != nil:
+		app.fail(c, http.StatusGone, codeLinkExpired, err.Error())
+		return
+	}
+	f, ok := negotiateList(d.Format, "")
+	if !ok {
+		app.fail(c, http.StatusForbidden, codeForbidden, errDownloadLink.Error())
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	app.writeList(c, d.listQuery, f, d.By+" through a download link")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// requestLink returns the path of the download link of the list selected by query.
+func requestLink(t *testing.T, app *App, query string) string {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/path1/path2/list/links?"+query, nil)
+	addAPIKey(req)
+	setupRouter(app).ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("cannot create download link, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	var r struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &r)
+	if !strings.HasPrefix(r.URL, "https://unleak.trade/download/") || time.Until(r.ExpiresAt) > downloadTTL {
+		t.Errorf("incorrect download link, got %s", w.Body)
+		t.FailNow()
+	}
+	return strings.TrimPrefix(r.URL, "https://unleak.trade")
+}
+
+// fetchLink gets path without the API key, as a browser.
+func fetchLink(app *App, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	setupRouter(app).ServeHTTP(w, req)
+	return w
+}
+
+func TestDownloadLink(t *testing.T) {
+	db := data.NewMemoryDB()
+	sp := solana.NewWallet().PublicKey().String()
+	db.Save(data.NewUser(solana.NewWallet().PublicKey().String(), "john.doe@mailservice.com", sp))
+	db.Save(data.NewUser(solana.NewWallet().PublicKey().String(), "jane.doe@mailservice.com", sponsor))
+	app := newTestApp(db)
+
+	path := requestLink(t, app, "include_pii=true")
+	w := fetchLink(app, path)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" || strings.Count(w.Body.String(), "@mailservice.com") != 2 {
+		t.Errorf("the link must download the CSV list, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if events, _ := db.ListEvents(data.ListAddress, 0); len(events) != 1 || !strings.Contains(events[0].Detail, "through a download link") {
+		t.Errorf("the download of the emails must be audited, got %v", events)
+		t.FailNow()
+	}
+
+	// single-use
+	if w := fetchLink(app, path); w.Code != http.StatusGone || errorJSON(w) != `{"error":{"code":"link_expired","message":"download link already used"}}` {
+		t.Errorf("a used link must not download again, got %d: %s", w.Code, errorJSON(w))
+		t.FailNow()
+	}
+
+	// bound to its parameters: a link for a sponsor gives its referrals only
+	path = requestLink(t, app, "sponsor="+sp+"&mime=ndjson")
+	sig := strings.TrimPrefix(path, "/download/")
+	payload, mac, _ := strings.Cut(sig, ".")
+	b, _ := base64.RawURLEncoding.DecodeString(payload)
+	var d map[string]any
+	json.Unmarshal(b, &d)
+	delete(d, "sponsor")
+	b, _ = json.Marshal(d)
+	if w := fetchLink(app, "/download/"+base64.RawURLEncoding.EncodeToString(b)+"."+mac); w.Code != http.StatusForbidden || errorJSON(w) != `{"error":{"code":"forbidden","message":"invalid download link"}}` {
+		t.Errorf("a tampered link must be rejected, got %d: %s", w.Code, errorJSON(w))
+		t.FailNow()
+	}
+	if w := fetchLink(app, "/download/"+payload+"."+strings.Repeat("0", len(mac))); w.Code != http.StatusForbidden {
+		t.Errorf("a link with a wrong signature must be rejected, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	w = fetchLink(app, path)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != http.StatusOK || len(lines) != 1 || !strings.Contains(lines[0], sp) || !strings.Contains(lines[0], "j***@m***.com") {
+		t.Errorf("the link must download the redacted referrals of the sponsor only, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+}
+
+func TestDownloadLinkExpiry(t *testing.T) {
+	app := newTestApp(data.NewMemoryDB())
+	now := time.Now()
+	app.downloads.now = func() time.Time { return now }
+	path := requestLink(t, app, "mime=json")
+	now = now.Add(downloadTTL)
+	if w := fetchLink(app, path); w.Code != http.StatusGone || errorJSON(w) != `{"error":{"code":"link_expired","message":"download link expired"}}` {
+		t.Errorf("an expired link must not download, got %d: %s", w.Code, errorJSON(w))
+		t.FailNow()
+	}
+	if w := fetchLink(app, "/download/garbage"); w.Code != http.StatusForbidden {
+		t.Errorf("a malformed link must be rejected, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+}
+
+func TestDownloadLinkScopes(t *testing.T) {
+	app := newTestApp(data.NewMemoryDB())
+	app.apiKeys["export"] = apiKey{Scopes: []string{scopeExport}}
+	r := setupRouter(app)
+	for query, status := range map[string]int{
+		"include_pii=true": http.StatusForbidden,
+		"mime=xlsx":        http.StatusBadRequest,
+		"sponsor=nope":     http.StatusBadRequest,
+		"max=2":            http.StatusCreated,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/path1/path2/list/links?"+query, nil)
+		req.Header.Set("UNLK-API-KEY", "export")
+		r.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("incorrect status of a link for %s, got %d, want %d: %s", query, w.Code, status, w.Body)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/cache"
+)
+
+// walletFoundKey is set by check-wallet to whether the wallet checked is registered, whatever the status
+// (304 included, the ETag of an unknown wallet being easy to guess).
+const walletFoundKey = "wallet_found"
+
+// walletMisses are the consecutive checks of an IP of unknown wallets, the last address being counted once
+// so the clients polling a wallet until it is registered are not taken for an enumeration.
+type walletMisses struct {
+	n    int
+	last string
+}
+
+// enumerationGuard protects check-wallet from the IPs walking the keyspace to map the registered wallets:
+// past slowAfter consecutive misses the checks are delayed at random, past blockAfter they fail with 429,
+// whatever the rate limiter. A registered wallet found, or window without miss, clears the IP.
+type enumerationGuard struct {
+	slowAfter, blockAfter int           // consecutive misses, none when 0
+	maxDelay              time.Duration // of the slowed down checks
+	window                time.Duration // of the misses, since the last one
+	sleep                 func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	misses *cache.Cache[walletMisses] // by IP
+}
+
+func newEnumerationGuard(slowAfter, blockAfter int, maxDelay, window time.Duration) *enumerationGuard {
+	return &enumerationGuard{
+		slowAfter:  slowAfter,
+		blockAfter: blockAfter,
+		maxDelay:   maxDelay,
+		window:     window,
+		sleep:      sleep,
+		misses:     cache.NewOf[walletMisses](cache.WithTTL(window)),
+	}
+}
+
+// sleep pauses for d, returning the error of ctx when it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (g *enumerationGuard) count(ip string) int {
+	m, _ := g.misses.Get(ip)
+	return m.n
+}
+
+// blocked reports whether the checks of ip must fail.
+func (g *enumerationGuard) blocked(ip string) bool {
+	return g.blockAfter > 0 && g.count(ip) >= g.blockAfter
+}
+
+// delay returns the pause before the next check of ip, random up to maxDelay once slowed down.
+func (g *enumerationGuard) delay(ip string) time.Duration {
+	if g.slowAfter <= 0 || g.maxDelay <= 0 || g.count(ip) < g.slowAfter {
+		return 0
+	}
+	return rand.N(g.maxDelay) + 1
+}
+
+// record counts the check of address a by ip, found when registered.
+func (g *enumerationGuard) record(ip, a string, found bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if found {
+		g.misses.Remove(ip)
+		return
+	}
+	m, _ := g.misses.Get(ip)
+	if m.last != a || m.n == 0 {
+		m.n++
+	}
+	m.last = a
+	g.misses.Add(ip, m)
+}
+
+// guardEnumeration slows down, then refuses, the check-wallet requests of the IPs enumerating the wallets.
+func (app *App) guardEnumeration(c *gin.Context) {
+	g := app.enumeration
+	if g == nil {
+		c.Next()
+		return
+	}
+	ip := c.ClientIP()
+	if g.blocked(ip) {
+		c.Header("Retry-After", strconv.Itoa(int(g.window.Seconds())))
+		app.fail(c, http.StatusTooManyRequests, codeTooManyRequests, "too many unknown wallets checked, try again later")
+		return
+	}
+	if d := g.delay(ip); d > 0 {
+		if err := g.sleep(c.Request.Context(), d); err != nil {
+			c.Abort() // the client is gone
+			return
+		}
+	}
+	c.Next()
+	if found, ok := c.Get(walletFoundKey); ok { // not set on the invalid checks
+		g.record(ip, c.Param("address"), found.(bool))
+	}
+}
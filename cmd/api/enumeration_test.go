@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestEnumerationGuard(t *testing.T) {
+	sponsor, registered := solana.NewWallet().PublicKey().String(), solana.NewWallet().PublicKey().String()
+	app := newTestApp(data.NewMockDBContent([]string{sponsor, registered}))
+	app.enumeration = newEnumerationGuard(3, 6, 50*time.Millisecond, time.Hour)
+	var delays []time.Duration
+	app.enumeration.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	r := setupRouter(app)
+	check := func(ip, a string, etag ...string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/check-wallet/"+a, nil)
+		req.RemoteAddr = ip + ":1234"
+		addAPIKey(req)
+		if len(etag) > 0 {
+			req.Header.Set("If-None-Match", etag[0])
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("polling", func(t *testing.T) {
+		delays = nil
+		a := solana.NewWallet().PublicKey().String() // until registered
+		for range 20 {
+			if code := check("10.0.0.1", a); code != http.StatusNotFound {
+				t.Errorf("an unknown wallet must not be found, got %d", code)
+				t.FailNow()
+			}
+		}
+		if len(delays) != 0 || app.enumeration.count("10.0.0.1") != 1 {
+			t.Errorf("a wallet checked again must not be taken for an enumeration, got %d delays", len(delays))
+			t.FailNow()
+		}
+	})
+
+	t.Run("enumeration", func(t *testing.T) {
+		delays = nil
+		var codes []int
+		for range 8 {
+			codes = append(codes, check("10.0.0.2", solana.NewWallet().PublicKey().String()))
+		}
+		for i, code := range codes {
+			want := http.StatusNotFound
+			if i >= 6 {
+				want = http.StatusTooManyRequests
+			}
+			if code != want {
+				t.Errorf("incorrect status of the check %d, got %d, want %d", i+1, code, want)
+				t.FailNow()
+			}
+		}
+		if len(delays) != 3 {
+			t.Errorf("the checks past the threshold must be delayed, got %d delays", len(delays))
+			t.FailNow()
+		}
+		for _, d := range delays {
+			if d <= 0 || d > 50*time.Millisecond {
+				t.Errorf("incorrect delay %v", d)
+				t.FailNow()
+			}
+		}
+		if code := check("10.0.0.2", registered); code != http.StatusTooManyRequests {
+			t.Errorf("a blocked IP must be refused whatever the wallet, got %d", code)
+			t.FailNow()
+		}
+		if code := check("10.0.0.3", registered); code != http.StatusOK {
+			t.Errorf("the other IPs must be served, got %d", code)
+			t.FailNow()
+		}
+	})
+
+	t.Run("with If-None-Match", func(t *testing.T) {
+		for ip, etag := range map[string]func(a string) string{
+			"10.0.0.5": func(string) string { return "*" },
+			"10.0.0.6": func(a string) string { return weakETag(a, "false") }, // of an unknown wallet, computed by the client
+		} {
+			for i := range 8 {
+				a := solana.NewWallet().PublicKey().String()
+				want := http.StatusNotModified
+				if i >= 6 {
+					want = http.StatusTooManyRequests
+				}
+				if code := check(ip, a, etag(a)); code != want {
+					t.Errorf("incorrect status of the check %d from %s, got %d, want %d", i+1, ip, code, want)
+					t.FailNow()
+				}
+			}
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		for range 5 {
+			check("10.0.0.4", solana.NewWallet().PublicKey().String())
+		}
+		if code := check("10.0.0.4", registered); code != http.StatusOK || app.enumeration.count("10.0.0.4") != 0 {
+			t.Errorf("a registered wallet found must clear the misses, got %d", code)
+			t.FailNow()
+		}
+		delays = nil
+		if check("10.0.0.4", solana.NewWallet().PublicKey().String()); len(delays) != 0 {
+			t.Errorf("the checks must not be delayed once cleared")
+			t.FailNow()
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// Codes of the error responses, stable for the clients to branch on.
+const (
+	codeBadRequest          = "bad_request"
+	codeValidation          = "validation_failed"
+	codeUnauthorized        = "unauthorized"
+	codeForbidden           = "forbidden"
+	codeInsufficientScope   = "insufficient_scope"
+	codeNotFound            = "not_found"
+	codeNotAcceptable       = "not_acceptable"
+	codeMethodNotAllowed    = "method_not_allowed"
+	codeConflict            = "conflict"
+	codeWaitlistFull        = "waitlist_full"
+	codeActivationExpired   = "activation_expired"
+	codeLinkExpired         = "link_expired" // download link expired or already used
+	codeWaitlistClosed      = "waitlist_closed"
+	codePayloadTooLarge     = "payload_too_large"
+	codeIdempotencyConflict = "idempotency_conflict"
+	codeTooManyRequests     = "too_many_requests"
+	codePoWFailed           = "pow_failed"
+	codeCaptchaFailed       = "captcha_failed"
+	codeOwnershipFailed     = "ownership_failed"
+	codeSponsorUnresolvable = "sponsor_unresolvable"
+	codeTimeout             = "timeout"
+	codeMaintenance         = "maintenance"
+	codeInternal            = "internal_error"
+)
+
+// requestIDHeader carries the ID of the request, the client's one when valid, echoed in the error responses.
+const requestIDHeader = "X-Request-ID"
+
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func init() {
+	// fields named as in the JSON bodies
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
+
+type fieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+}
+
+type apiError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Error     apiError `json:"error"`
+	RequestID string   `json:"request_id,omitempty"`
+}
+
+// requestID identifies the request for the error responses and the logs.
+func (app *App) requestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !requestIDRegexp.MatchString(id) {
+		id = uuid.NewString()
+	}
+	c.Set(requestIDHeader, id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+// fail aborts c with the error envelope, or the legacy {"error": message} when app.legacyErrors is set.
+func (app *App) fail(c *gin.Context, status int, code, message string, fields ...fieldError) {
+	if app.legacyErrors {
+		c.AbortWithStatusJSON(status, gin.H{"error": message})
+		return
+	}
+	c.AbortWithStatusJSON(status, errorResponse{
+		Error:     apiError{code, message, fields},
+		RequestID: c.GetString(requestIDHeader),
+	})
+}
+
+// methodNotAllowed responds to the routes called with another method than theirs, listed by gin in the Allow header.
+func (app *App) methodNotAllowed(c *gin.Context) {
+	app.fail(c, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+}
+
+// errInternal is all the clients know of internal errors.
+var errInternal = errors.New("internal error")
+
+// internal logs err, returning errInternal.
+func (app *App) internal(err error) error {
+	app.logger.Error("🔥 internal error", slog.Any("error", err))
+	return errInternal
+}
+
+// logInternal logs the internal error err of the request c, reported once the request is served.
+func (app *App) logInternal(c *gin.Context, err error) {
+	_ = c.Error(err)
+	app.logger.Error("🔥 request failed", "method", c.Request.Method, "route", c.FullPath(), "request_id", c.GetString(requestIDHeader), slog.Any("error", err))
+}
+
+// failInternal logs err and fails with a generic message, not to disclose internal details.
+// The request failing once its deadline is exceeded, its DB calls being cancelled, times out instead.
+func (app *App) failInternal(c *gin.Context, err error) {
+	app.logInternal(c, err)
+	if timedOut(c) {
+		app.fail(c, http.StatusGatewayTimeout, codeTimeout, errTimeout.Error())
+		return
+	}
+	app.fail(c, http.StatusInternalServerError, codeInternal, errInternal.Error())
+}
+
+// failBinding fails with the error of decoding or validating a request body.
+func (app *App) failBinding(c *gin.Context, err error) {
+	var mb *http.MaxBytesError
+	if errors.As(err, &mb) {
+		app.fail(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("request body larger than %d bytes", mb.Limit))
+		return
+	}
+	if fields := invalidFields(err); fields != nil {
+		app.fail(c, http.StatusBadRequest, codeValidation, invalidMessage(fields, addressReasons(err)), fields...)
+		return
+	}
+	app.fail(c, http.StatusBadRequest, codeBadRequest, "malformed JSON body")
+}
+
+// invalidFields returns the fields of the validation or JSON decoding error err, nil for other errors.
+func invalidFields(err error) []fieldError {
+	var ve validator.ValidationErrors
+	var te *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &ve):
+		fields := make([]fieldError, len(ve))
+		for i, fe := range ve {
+			fields[i] = fieldError{fe.Field(), fe.Tag()}
+		}
+		return fields
+	case errors.As(err, &te):
+		return []fieldError{{te.Field, "type"}}
+	}
+	if f, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return []fieldError{{strings.Trim(f, `"`), "unknown"}}
+	}
+	return nil
+}
+
+// invalidMessage names the invalid fields, with their reason when known.
+func invalidMessage(fields []fieldError, reasons map[string]string) string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Field
+		if r, ok := reasons[f.Field]; ok {
+			names[i] += " (" + r + ")"
+		}
+	}
+	return "invalid " + strings.Join(names, ", ")
+}
+
+// addressReasons returns why the Solana addresses of the validation error err are invalid, by field.
+func addressReasons(err error) map[string]string {
+	var ve validator.ValidationErrors
+	if !errors.As(err, &ve) {
+		return nil
+	}
+	reasons := map[string]string{}
+	for _, fe := range ve {
+		if a, ok := fe.Value().(string); ok && fe.Tag() == "solana_addr" {
+			if err := data.ValidateSolanaAddress(a); err != nil {
+				reasons[fe.Field()] = err.Error()
+			}
+		}
+	}
+	return reasons
+}
+
+// describe returns the message of err for a client, err being a validation error or a message of this package.
+// Without fields to carry them, the rules of the invalid fields are in the message.
+func describe(err error) string {
+	fields := invalidFields(err)
+	if fields == nil {
+		return err.Error()
+	}
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = fmt.Sprintf("%s (%s)", f.Field, f.Rule)
+	}
+	return "invalid " + strings.Join(names, ", ")
+}
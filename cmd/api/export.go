@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// listFormat is a representation of the list, selected by the mime query parameter or the Accept header.
+type listFormat struct {
+	name       string // value of the mime query parameter
+	mediaType  string
+	attachment bool // downloaded as a file
+	// write writes the full records of the users, with the client metadata of their activation when meta
+	write func(w io.Writer, users []*data.User, l *time.Location, meta bool) error
+	// writePublic writes the public users, nil when the format lists the full records only
+	writePublic func(w io.Writer, users []PublicUser) error
+}
+
+var listFormats = []listFormat{
+	{"json", "application/json; charset=utf-8", false, writeListJSON, writePublicListJSON}, // default
+	{"csv", "text/csv", true, writeListCSV, nil},
+	{"ndjson", "application/x-ndjson", false, writeListNDJSON, nil},
+}
+
+// negotiateList returns the format named by the query parameter mime, else the one preferred by the Accept
+// header, JSON when the client accepts anything.
+func negotiateList(mime, accept string) (listFormat, bool) {
+	if mime != "" {
+		for _, f := range listFormats {
+			if f.name == mime {
+				return f, true
+			}
+		}
+		return listFormat{}, false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return listFormats[0], true
+	}
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var as []accepted
+	for _, e := range strings.Split(accept, ",") {
+		mt, params, _ := strings.Cut(e, ";")
+		a := accepted{strings.ToLower(strings.TrimSpace(mt)), 1}
+		for _, p := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					a.q = q
+				}
+			}
+		}
+		if a.q > 0 {
+			as = append(as, a)
+		}
+	}
+	sort.SliceStable(as, func(i, j int) bool { return as[i].q > as[j].q })
+	for _, a := range as {
+		if a.mediaType == "*/*" || a.mediaType == "application/*" {
+			return listFormats[0], true
+		}
+		for _, f := range listFormats {
+			if mt, _, _ := strings.Cut(f.mediaType, ";"); mt == a.mediaType {
+				return f, true
+			}
+		}
+	}
+	return listFormat{}, false
+}
+
+// listedUser is a user of the list with the client metadata of its activation.
+type listedUser struct {
+	*data.User
+	Meta *data.ClientMeta `json:"meta"`
+}
+
+// listed returns the users to write, with their client metadata when meta.
+func listed(users []*data.User, meta bool) any {
+	if !meta {
+		return users
+	}
+	l := make([]listedUser, len(users))
+	for i, u := range users {
+		l[i] = listedUser{u, u.Meta}
+	}
+	return l
+}
+
+func writeListJSON(w io.Writer, users []*data.User, _ *time.Location, meta bool) error {
+	return writeJSON(w, gin.H{
+		"users": listed(users, meta),
+		"count": len(users),
+	})
+}
+
+// writeJSON writes v in JSON, at once.
+func writeJSON(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// writeListCSV writes a row per user, the timestamps in RFC 3339 in the time zone l.
+func writeListCSV(w io.Writer, users []*data.User, l *time.Location, meta bool) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader(meta))
+	for _, u := range users {
+		if err := cw.Write(csvRow(u, l, meta)); err != nil {
+			break
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvHeader returns the header of the CSV list, with the columns of the client metadata when meta.
+func csvHeader(meta bool) []string {
+	header := []string{"address", "email", "uuid", "timestamp", "sponsor", "registered_at", "activated_at"}
+	if meta {
+		header = append(header, "ip_hash", "user_agent", "country")
+	}
+	return header
+}
+
+// csvRow returns the row of u in the CSV list, its times in the time zone l, no registration time for the old records.
+func csvRow(u *data.User, l *time.Location, meta bool) []string {
+	registered := ""
+	if u.RegisteredAt != 0 {
+		registered = time.UnixMilli(u.RegisteredAt).In(l).Format(time.RFC3339)
+	}
+	row := []string{u.Address, u.Email, u.UUID, time.UnixMilli(u.Timestamp).In(l).Format(time.RFC3339), u.Sponsor, registered, time.UnixMilli(u.Activated()).In(l).Format(time.RFC3339)}
+	if meta {
+		m := u.Meta
+		if m == nil {
+			m = &data.ClientMeta{}
+		}
+		row = append(row, m.IPHash, m.UserAgent, m.Country)
+	}
+	return row
+}
+
+// writeListNDJSON writes a JSON user per line.
+func writeListNDJSON(w io.Writer, users []*data.User, _ *time.Location, meta bool) error {
+	e := json.NewEncoder(w)
+	for _, u := range users {
+		var v any = u
+		if meta {
+			v = listedUser{u, u.Meta}
+		}
+		if err := e.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
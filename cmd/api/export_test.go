@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestNegotiateList(t *testing.T) {
+	tt := []struct {
+		name         string
+		mime, accept string
+		want         string // format, none when not acceptable
+	}{
+		{"default", "", "", "json"},
+		{"header csv", "", "text/csv", "csv"},
+		{"header ndjson", "", "application/x-ndjson", "ndjson"},
+		{"header json", "", "application/json", "json"},
+		{"header wildcard", "", "*/*", "json"},
+		{"header preferences", "", "application/json;q=0.5, text/csv", "csv"},
+		{"header refused", "", "text/csv;q=0, application/x-ndjson;q=0.1", "ndjson"},
+		{"header unsupported", "", "application/xml", ""},
+		{"query", "csv", "", "csv"},
+		{"query over header", "ndjson", "text/csv", "ndjson"},
+		{"query unsupported", "xml", "text/csv", ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, ok := negotiateList(tc.mime, tc.accept)
+			if ok != (tc.want != "") || f.name != tc.want {
+				t.Errorf("incorrect format, got %q (%v), want %q", f.name, ok, tc.want)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestListWriters(t *testing.T) {
+	users := []*data.User{
+		{Address: "a", Email: "a@mailservice.com", UUID: "u1", Timestamp: 2 * 3600000, Sponsor: "s", RegisteredAt: 3600000, ActivatedAt: 2 * 3600000},
+		{Address: "b", Email: "b@mailservice.com", UUID: "u2", Timestamp: 1, Sponsor: "a"}, // saved before ActivatedAt
+	}
+	t.Run("json", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := writeListJSON(&b, users, time.UTC, false); err != nil {
+			t.Fatal(err)
+		}
+		var res struct {
+			Users []data.User `json:"users"`
+			Count int         `json:"count"`
+		}
+		if err := json.Unmarshal(b.Bytes(), &res); err != nil || res.Count != 2 || res.Users[1].Address != "b" || res.Users[0].RegisteredAt != 3600000 || res.Users[0].ActivatedAt != 2*3600000 {
+			t.Errorf("incorrect JSON, got %s", b.String())
+			t.FailNow()
+		}
+	})
+	t.Run("csv", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := writeListCSV(&b, users, time.UTC, false); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		if len(lines) != 3 || lines[0] != "address,email,uuid,timestamp,sponsor,registered_at,activated_at" || lines[1] != "a,a@mailservice.com,u1,1970-01-01T02:00:00Z,s,1970-01-01T01:00:00Z,1970-01-01T02:00:00Z" || lines[2] != "b,b@mailservice.com,u2,1970-01-01T00:00:00Z,a,,1970-01-01T00:00:00Z" {
+			t.Errorf("incorrect CSV, got %s", b.String())
+			t.FailNow()
+		}
+	})
+	t.Run("csv time zone", func(t *testing.T) {
+		l, _ := time.LoadLocation("America/New_York")
+		var b bytes.Buffer
+		if err := writeListCSV(&b, []*data.User{{Address: "a", Timestamp: time.Date(2026, 7, 14, 12, 0, 0, 0, time.UTC).UnixMilli()}}, l, false); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(b.String(), ",2026-07-14T08:00:00-04:00,") {
+			t.Errorf("incorrect CSV timestamp, got %s", b.String())
+			t.FailNow()
+		}
+	})
+	t.Run("ndjson", func(t *testing.T) {
+		var b bytes.Buffer
+		if err := writeListNDJSON(&b, users, time.UTC, false); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		var u data.User
+		if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &u) != nil || u.Address != "b" {
+			t.Errorf("incorrect NDJSON, got %s", b.String())
+			t.FailNow()
+		}
+	})
+}
+
+func TestListNegotiation(t *testing.T) {
+	app := newTestApp(data.MockDB)
+	r := setupRouter(app)
+	tt := []struct {
+		name         string
+		mime, accept string
+		status       int
+		ctype        string
+	}{
+		{"header only", "", "application/x-ndjson", http.StatusOK, "application/x-ndjson"},
+		{"query only", "csv", "", http.StatusOK, "text/csv"},
+		{"both", "json", "text/csv", http.StatusOK, "application/json; charset=utf-8"},
+		{"not acceptable header", "", "application/xml", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{"not acceptable query", "xml", "", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			u := fmt.Sprintf("/%s/%s/list", app.secpath1, app.secpath2)
+			if tc.mime != "" {
+				u += "?mime=" + tc.mime
+			}
+			req, _ := http.NewRequest("GET", u, nil)
+			addAPIKey(req)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			r.ServeHTTP(w, req)
+			if w.Code != tc.status || w.Header().Get("Content-Type") != tc.ctype {
+				t.Errorf("incorrect response, got %d %q, want %d %q", w.Code, w.Header().Get("Content-Type"), tc.status, tc.ctype)
+				t.FailNow()
+			}
+			if tc.status == http.StatusNotAcceptable && !strings.Contains(w.Body.String(), `"code":"not_acceptable"`) {
+				t.Errorf("incorrect error, got %s", w.Body.String())
+				t.FailNow()
+			}
+		})
+	}
+}
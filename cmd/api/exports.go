@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// exportLock is the lock held by the replica running the exports.
+const exportLock = "exports"
+
+// errExportCancelled interrupts the upload of an export cancelled while it runs.
+var errExportCancelled = errors.New("export cancelled")
+
+// exportContentTypes are the media types of the export formats.
+var exportContentTypes = map[string]string{
+	"csv":   "text/csv",
+	"jsonl": "application/x-ndjson",
+}
+
+type exportRequest struct {
+	Format string `json:"format" binding:"omitempty,oneof=csv jsonl"` // csv when empty
+	PII    bool   `json:"include_pii"`
+}
+
+// requester returns who made the admin request of c, as recorded in the audit events.
+func requester(c *gin.Context) string {
+	if sub := c.GetString(adminKey); sub != "" {
+		return "admin " + sub
+	}
+	return "secret paths"
+}
+
+// createExport queues a full export of the users, run in the background by the export worker.
+func (app *App) createExport(c *gin.Context) {
+	if app.uploader == nil {
+		app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	var req exportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	if req.PII && !app.scoped(c, c.GetStringSlice(scopesKey), scopePII) {
+		return
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	j := data.NewExportJob(req.Format, req.PII, requester(c))
+	if err := app.exports.CreateExport(j); err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	app.logger.Info("📦 export queued", "id", j.ID, "format", j.Format, "pii", j.PII, "by", j.By)
+	c.JSON(http.StatusAccepted, j)
+}
+
+// export returns the status of an export, with the link downloading it during app.exportURLTTL once done.
+func (app *App) export(c *gin.Context) {
+	j, ok := app.exportJob(c)
+	if !ok {
+		return
+	}
+	r := gin.H{"export": j}
+	if j.Status == data.ExportDone {
+		u, err := app.uploader.URL(j.Key, app.exportURLTTL)
+		if err != nil {
+			app.failInternal(c, err)
+			return
+		}
+		r["url"] = u
+		r["url_expires_at"] = time.Now().Add(app.exportURLTTL).UTC()
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// cancelExport cancels an export queued or running, the worker stopping at its next page.
+func (app *App) cancelExport(c *gin.Context) {
+	j, ok := app.exportJob(c)
+	if !ok {
+		return
+	}
+	j.Status, j.UpdatedAt = data.ExportCancelled, time.Now().UnixMilli()
+	err := app.exports.UpdateExport(j)
+	switch {
+	case errors.Is(err, data.ErrExportFinished):
+		app.fail(c, http.StatusConflict, codeConflict, "export already finished")
+		return
+	case err != nil:
+		app.failInternal(c, err)
+		return
+	}
+	app.logger.Info("🛑 export cancelled", "id", j.ID, "by", requester(c))
+	c.JSON(http.StatusOK, j)
+}
+
+// exportJob returns the export of the id parameter, failing the request when the exports are disabled or it is absent.
+func (app *App) exportJob(c *gin.Context) (*data.ExportJob, bool) {
+	if app.uploader == nil {
+		app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+		return nil, false
+	}
+	j, err := app.exports.GetExport(c.Param("id"))
+	switch {
+	case errors.Is(err, data.ErrExportNotFound):
+		app.fail(c, http.StatusNotFound, codeNotFound, "export not found")
+		return nil, false
+	case err != nil:
+		app.failInternal(c, err)
+		return nil, false
+	}
+	return j, true
+}
+
+// runExport runs the pending exports when this replica holds the export lock, for twice the check period d
+// so that another replica takes over when it stops. A job left running by a stopped replica starts over.
+func (app *App) runExport(ctx context.Context, d time.Duration) {
+	ok, err := app.db.AcquireLock(exportLock, app.replica, 2*d)
+	if err != nil {
+		app.logger.Warn("⚠️ cannot acquire the export lock", slog.Any("error", err))
+		return
+	}
+	if !ok {
+		return // run by another replica
+	}
+	jobs, err := app.exports.PendingExports()
+	if err != nil {
+		app.logger.Warn("⚠️ cannot read the pending exports", slog.Any("error", err))
+		return
+	}
+	for _, j := range jobs {
+		if ctx.Err() != nil {
+			return // resumed on the next start
+		}
+		app.runExportJob(ctx, j, d)
+	}
+}
+
+// runExportJob writes the users to the object of j, extending the export lock held for d at each page.
+func (app *App) runExportJob(ctx context.Context, j *data.ExportJob, d time.Duration) {
+	j.Status, j.Rows, j.UpdatedAt = data.ExportRunning, 0, time.Now().UnixMilli()
+	if err := app.exports.UpdateExport(j); err != nil {
+		if !errors.Is(err, data.ErrExportFinished) {
+			app.logger.Warn("⚠️ cannot start the export", "id", j.ID, slog.Any("error", err))
+		}
+		return
+	}
+	app.logger.Info("📦 export started", "id", j.ID, "format", j.Format)
+
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := app.writeExport(pw, j, d)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	err := app.uploader.Upload(ctx, j.Key, exportContentTypes[j.Format], pr)
+	pr.CloseWithError(err) // the writer stops when the upload does
+	if werr := <-written; werr != nil && !errors.Is(werr, io.ErrClosedPipe) {
+		err = werr // the cause of the upload failure
+	}
+	switch {
+	case errors.Is(err, errExportCancelled):
+		app.logger.Info("🛑 export stopped", "id", j.ID, "rows", j.Rows)
+		return
+	case ctx.Err() != nil:
+		return // still running, resumed on the next start
+	}
+	j.UpdatedAt = time.Now().UnixMilli()
+	if err != nil {
+		j.Status, j.Error = data.ExportFailed, err.Error()
+		app.logger.Warn("⚠️ export failed", "id", j.ID, slog.Any("error", err))
+	} else {
+		j.Status, j.CompletedAt = data.ExportDone, j.UpdatedAt
+		app.logger.Info("📦 export done", "id", j.ID, "rows", j.Rows)
+		if j.PII {
+			app.audit(context.Background(), data.NewEvent(data.EventPIIExported, data.ListAddress, "", fmt.Sprintf("%d emails in %s export %s by %s", j.Rows, j.Format, j.ID, j.By)))
+		}
+	}
+	if err := app.exports.UpdateExport(j); err != nil && !errors.Is(err, data.ErrExportFinished) {
+		app.logger.Warn("⚠️ cannot record the export", "id", j.ID, "status", j.Status, slog.Any("error", err))
+	}
+}
+
+// writeExport writes the users of j to w page by page, stopping with errExportCancelled once j is cancelled.
+func (app *App) writeExport(w io.Writer, j *data.ExportJob, d time.Duration) error {
+	var cw *csv.Writer
+	if j.Format == "csv" {
+		cw = csv.NewWriter(w)
+		cw.Write(csvHeader(false))
+	}
+	return app.exports.ScanUsers(func(users []*data.User) error {
+		if s, err := app.exports.GetExport(j.ID); err != nil {
+			return err
+		} else if s.Status == data.ExportCancelled {
+			return errExportCancelled
+		}
+		if _, err := app.db.AcquireLock(exportLock, app.replica, 2*d); err != nil {
+			return err
+		}
+		if j.PII {
+			users = withoutAnonymized(users)
+		} else {
+			for _, u := range users {
+				u.Email = data.RedactEmail(u.Email)
+			}
+		}
+		if cw == nil {
+			if err := writeListNDJSON(w, users, app.exportTZ, false); err != nil {
+				return err
+			}
+		} else {
+			for _, u := range users {
+				cw.Write(csvRow(u, app.exportTZ, false))
+			}
+			if cw.Flush(); cw.Error() != nil {
+				return cw.Error()
+			}
+		}
+		j.Rows += len(users)
+		return nil
+	})
+}
+
+// runExports runs the pending exports every d until ctx is done.
+func (app *App) runExports(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			app.runExport(ctx, d)
+		}
+	}
+}
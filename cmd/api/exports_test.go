@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// bucket is an Uploader keeping the objects in memory, calling block once the first bytes of an upload are read.
+type bucket struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+	block   func() // called after the first page is read
+	fail    error
+}
+
+func newBucket() *bucket {
+	return &bucket{objects: map[string][]byte{}, types: map[string]string{}}
+}
+
+func (b *bucket) Upload(ctx context.Context, key, contentType string, r io.Reader) error {
+	if b.fail != nil {
+		return b.fail
+	}
+	var buf bytes.Buffer
+	p := make([]byte, 64)
+	for first := true; ; first = false {
+		n, err := r.Read(p)
+		buf.Write(p[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first && b.block != nil {
+			b.block()
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key], b.types[key] = buf.Bytes(), contentType
+	return nil
+}
+
+func (b *bucket) URL(key string, ttl time.Duration) (string, error) {
+	return "https://bucket.s3.amazonaws.com/exports/" + key + "?X-Amz-Expires=" + ttl.String(), nil
+}
+
+func newExportApp(t *testing.T, users int) (*App, *bucket) {
+	db := data.NewMemoryDB()
+	for i := 0; i < users; i++ {
+		u := data.NewUser(solana.NewWallet().PublicKey().String(), "john.doe@mailservice.com", sponsor)
+		if err := db.Save(u); err != nil {
+			t.Errorf("cannot save user: %v", err)
+			t.FailNow()
+		}
+	}
+	app := newTestApp(db)
+	b := newBucket()
+	app.exports, app.uploader, app.exportURLTTL = db, b, 15*time.Minute
+	app.replica = "test"
+	return app, b
+}
+
+func createExport(t *testing.T, app *App, body string) *data.ExportJob {
+	r := setupRouter(app)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/path1/path2/exports", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("cannot create export, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	j := &data.ExportJob{}
+	json.Unmarshal(w.Body.Bytes(), j)
+	if j.ID == "" || j.Status != data.ExportQueued {
+		t.Errorf("the export must be queued, got %s", w.Body)
+		t.FailNow()
+	}
+	return j
+}
+
+func TestExport(t *testing.T) {
+	app, b := newExportApp(t, 3)
+	r := setupRouter(app)
+	j := createExport(t, app, `{"format":"csv","include_pii":true}`)
+
+	get := func() (int, map[string]json.RawMessage, *data.ExportJob) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/path1/path2/exports/"+j.ID, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		m := map[string]json.RawMessage{}
+		json.Unmarshal(w.Body.Bytes(), &m)
+		s := &data.ExportJob{}
+		json.Unmarshal(m["export"], s)
+		return w.Code, m, s
+	}
+	if code, m, s := get(); code != http.StatusOK || s.Status != data.ExportQueued || m["url"] != nil {
+		t.Errorf("the export must be queued without a link, got %d: %v", code, m)
+		t.FailNow()
+	}
+
+	app.runExport(context.Background(), time.Minute)
+	code, m, s := get()
+	if code != http.StatusOK || s.Status != data.ExportDone || s.Rows != 3 || s.CompletedAt == 0 {
+		t.Errorf("the export must be done, got %d: %v", code, m)
+		t.FailNow()
+	}
+	var u string
+	json.Unmarshal(m["url"], &u)
+	if !strings.Contains(u, j.Key) {
+		t.Errorf("the link must download the export, got %s", u)
+		t.FailNow()
+	}
+	rows := strings.Split(strings.TrimSpace(string(b.objects[j.Key])), "\n")
+	if len(rows) != 4 || rows[0] != "address,email,uuid,timestamp,sponsor,registered_at,activated_at" || !strings.Contains(rows[1], "john.doe@mailservice.com") || b.types[j.Key] != "text/csv" {
+		t.Errorf("incorrect CSV export, got %q (%s)", rows, b.types[j.Key])
+		t.FailNow()
+	}
+	if events, _ := app.db.ListEvents(data.ListAddress, 0); len(events) != 1 || events[0].Type != data.EventPIIExported {
+		t.Errorf("the export of the emails must be audited, got %v", events)
+		t.FailNow()
+	}
+
+	// finished, neither run again nor cancelled
+	app.runExport(context.Background(), time.Minute)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/path1/path2/exports/"+j.ID, nil)
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("a finished export must not be cancelled, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/path1/path2/exports/unknown", nil)
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("an unknown export must not be found, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	app, b := newExportApp(t, 2)
+	app.apiKeys["export"] = apiKey{Scopes: []string{scopeExport}}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/path1/path2/exports", strings.NewReader(`{"format":"jsonl","include_pii":true}`))
+	req.Header.Set("UNLK-API-KEY", "export")
+	setupRouter(app).ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("the emails must not be exported without the pii scope, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	j := createExport(t, app, `{"format":"jsonl"}`)
+	app.runExport(context.Background(), time.Minute)
+	lines := strings.Split(strings.TrimSpace(string(b.objects[j.Key])), "\n")
+	if len(lines) != 2 || b.types[j.Key] != "application/x-ndjson" {
+		t.Errorf("incorrect JSONL export, got %q", lines)
+		t.FailNow()
+	}
+	for _, l := range lines {
+		u := data.User{}
+		if err := json.Unmarshal([]byte(l), &u); err != nil || u.Email == "john.doe@mailservice.com" {
+			t.Errorf("the emails must be redacted without include_pii, got %s", l)
+			t.FailNow()
+		}
+	}
+}
+
+func TestExportCancel(t *testing.T) {
+	app, b := newExportApp(t, 1200) // 3 pages
+	r := setupRouter(app)
+	j := createExport(t, app, `{}`)
+	b.block = func() {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/path1/path2/exports/"+j.ID, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("cannot cancel the export, got %d: %s", w.Code, w.Body)
+		}
+	}
+	app.runExport(context.Background(), time.Minute)
+	if _, ok := b.objects[j.Key]; ok {
+		t.Error("a cancelled export must not be uploaded")
+		t.FailNow()
+	}
+	s, _ := app.exports.GetExport(j.ID)
+	if s.Status != data.ExportCancelled {
+		t.Errorf("the export must stay cancelled, got %+v", s)
+		t.FailNow()
+	}
+}
+
+func TestExportRestart(t *testing.T) {
+	app, b := newExportApp(t, 2)
+	j := createExport(t, app, `{}`)
+	b.fail = errors.New("S3 unavailable")
+	app.runExport(context.Background(), time.Minute)
+	if s, _ := app.exports.GetExport(j.ID); s.Status != data.ExportFailed || s.Error == "" {
+		t.Errorf("the export must fail, got %+v", s)
+		t.FailNow()
+	}
+
+	// interrupted by a stop, left running
+	j = createExport(t, app, `{}`)
+	j.Status = data.ExportRunning
+	app.exports.UpdateExport(j)
+	b.fail = nil
+	app.runExport(context.Background(), time.Minute)
+	if s, _ := app.exports.GetExport(j.ID); s.Status != data.ExportDone || s.Rows != 2 {
+		t.Errorf("the running export must start over, got %+v", s)
+		t.FailNow()
+	}
+}
+
+func TestExportDisabled(t *testing.T) {
+	app := newTestApp(data.NewMemoryDB())
+	r := setupRouter(app)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/path1/path2/exports", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || errorJSON(w) != notFound {
+		t.Errorf("the exports must be disabled without a bucket, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+}
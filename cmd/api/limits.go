@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/limiter"
+)
+
+// maxTopKeys bounds the keys listed by limiter in limits.
+const maxTopKeys = 100
+
+// namedLimiter is a rate limiter of the app, its idle keys dropped after ttl.
+type namedLimiter struct {
+	name string
+	l    limiter.Limiter
+	ttl  time.Duration
+}
+
+// limiters returns the rate limiters of the app.
+func (app *App) limiters() []namedLimiter {
+	return []namedLimiter{
+		{"ip", app.rl, 10 * time.Minute},
+		{"wallet", app.walletRL, time.Hour},
+		{"email", app.emailRL, time.Hour},
+	}
+}
+
+// registerLimiterMetrics exposes the keys tracked by each rate limiter, read at scrape time.
+func (app *App) registerLimiterMetrics() {
+	for _, nl := range app.limiters() {
+		l := nl.l
+		app.metrics.GaugeFunc(fmt.Sprintf("waitlist_rate_limiter_keys{limiter=%q}", nl.name), "Keys tracked by the rate limiter", func() float64 {
+			return float64(l.Len())
+		})
+	}
+}
+
+// limits shows the keys tracked by each rate limiter and the n top talkers, 10 by default.
+func (app *App) limits(c *gin.Context) {
+	n := 10
+	if v := c.Query("n"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 || i > maxTopKeys {
+			app.fail(c, http.StatusBadRequest, codeValidation, fmt.Sprintf("invalid n, must be between 1 and %d", maxTopKeys), fieldError{"n", "max=100"})
+			return
+		}
+		n = i
+	}
+	l := []gin.H{}
+	for _, nl := range app.limiters() {
+		l = append(l, gin.H{"name": nl.name, "keys": nl.l.Len(), "top": nl.l.TopN(n)})
+	}
+	c.JSON(http.StatusOK, gin.H{"limiters": l})
+}
+
+// cleanupLimiters drops the idle keys of the rate limiters.
+func (app *App) cleanupLimiters() {
+	for _, nl := range app.limiters() {
+		nl.l.Cleanup(nl.ttl)
+	}
+}
+
+// runLimiterCleanup drops the idle keys of the rate limiters every d until ctx is done.
+func (app *App) runLimiterCleanup(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			app.cleanupLimiters()
+		}
+	}
+}
+
+// restoreLimiters restores the rate limiters from their snapshots in dir, so a deploy does not reset them.
+func (app *App) restoreLimiters(dir string) {
+	for _, nl := range app.limiters() {
+		path := filepath.Join(dir, nl.name+".gob")
+		f, err := os.Open(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				app.logger.Warn("⚠️ cannot read limiter snapshot", "path", path, slog.Any("error", err))
+			}
+			continue
+		}
+		if err := nl.l.Restore(f, nl.ttl); err != nil {
+			app.logger.Warn("⚠️ cannot restore limiter snapshot", "path", path, slog.Any("error", err))
+		}
+		f.Close()
+	}
+	app.logger.Info("🚧 rate limiters restored", "dir", dir)
+}
+
+// snapshotLimiters writes the rate limiters to dir, through temporary files so a crash never leaves a partial snapshot.
+func (app *App) snapshotLimiters(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	for _, nl := range app.limiters() {
+		path := filepath.Join(dir, nl.name+".gob")
+		tmp := path + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		if err := nl.l.Snapshot(f); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
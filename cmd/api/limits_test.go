@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/limiter"
+)
+
+func TestLimiterSnapshot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "limiters")
+	a := solana.NewWallet().PublicKey().String()
+	register := func(app *App) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/register", strings.NewReader(`{"address":"`+a+`","email":"john.doe@mailservice.com","sponsor":"`+sponsor+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		setupRouter(app).ServeHTTP(w, req)
+		return w.Code
+	}
+	newApp := func() *App {
+		app := newTestApp(data.MockDB)
+		app.rl = limiter.New(0.1, 10)
+		app.walletRL, app.emailRL = hourly(1), hourly(5)
+		return app
+	}
+
+	app := newApp()
+	if got := register(app); got != http.StatusAccepted {
+		t.Errorf("incorrect status, got %d, want %d", got, http.StatusAccepted)
+		t.FailNow()
+	}
+	if got := register(app); got != http.StatusTooManyRequests {
+		t.Errorf("the wallet must be throttled, got %d", got)
+		t.FailNow()
+	}
+	if err := app.snapshotLimiters(dir); err != nil {
+		t.Errorf("cannot write the limiter snapshots: %v", err)
+		t.FailNow()
+	}
+	for _, n := range []string{"ip", "wallet", "email"} {
+		if _, err := os.Stat(filepath.Join(dir, n+".gob")); err != nil {
+			t.Errorf("the %s limiter must be saved: %v", n, err)
+			t.FailNow()
+		}
+	}
+
+	restarted := newApp()
+	restarted.restoreLimiters(dir)
+	if got := register(restarted); got != http.StatusTooManyRequests {
+		t.Errorf("the wallet throttled before the restart must remain throttled, got %d", got)
+		t.FailNow()
+	}
+
+	os.WriteFile(filepath.Join(dir, "wallet.gob"), []byte("garbage"), 0o600)
+	fresh := newApp()
+	fresh.restoreLimiters(dir) // logged, the limiter starts empty
+	if got := register(fresh); got != http.StatusAccepted {
+		t.Errorf("a corrupted snapshot must be ignored, got %d", got)
+		t.FailNow()
+	}
+}
+
+func TestLimits(t *testing.T) {
+	app := newTestApp(data.MockDB)
+	app.rl = limiter.New(0.001, 5) // enough for the admin requests below
+	app.registerLimiterMetrics()
+	r := setupRouter(app)
+	for i := 0; i < 6; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/check-wallet/"+sponsor, nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/path1/path2/limits?n=1", nil)
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	var res struct {
+		Limiters []struct {
+			Name string             `json:"name"`
+			Keys int                `json:"keys"`
+			Top  []limiter.KeyStats `json:"top"`
+		} `json:"limiters"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusOK || len(res.Limiters) != 3 || res.Limiters[0].Name != "ip" || res.Limiters[0].Keys != 2 { // with the client of limits
+		t.Errorf("incorrect limits, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if top := res.Limiters[0].Top; len(top) != 1 || top[0] != (limiter.KeyStats{Key: "203.0.113.7", Allowed: 5, Denied: 1}) {
+		t.Errorf("incorrect top keys, got %v", top)
+		t.FailNow()
+	}
+
+	for _, n := range []string{"0", "101", "ten"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/path1/path2/limits?n="+n, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("n=%s must be rejected, got %d: %s", n, w.Code, w.Body)
+			t.FailNow()
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	for _, want := range []string{`waitlist_rate_limiter_keys{limiter="ip"} 2`, `waitlist_rate_limiter_keys{limiter="wallet"} 0`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("metrics must contain %q, got %s", want, w.Body.String())
+			t.FailNow()
+		}
+	}
+}
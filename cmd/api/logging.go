@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logger is the logger shared by the packages, set up by setup.
+var logger = slog.Default()
+
+// logLevels are the levels of UNLEAKTRADE_LOG_LEVEL.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// newLogger returns the logger writing to w the records of level at least, in JSON when format is json, as text otherwise.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	if level == "" {
+		level = "info"
+	}
+	l, ok := logLevels[level]
+	if !ok {
+		return nil, fmt.Errorf("unknown level %q, want debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, want json or text", format)
+	}
+}
+
+// logRequests logs every request once served, as the default logger of gin did.
+// The path is the route, not to log the tokens of the activation and unsubscribe links.
+// The successful health checks are skipped when app.quietHealth is set.
+func (app *App) logRequests(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	path := c.FullPath()
+	if path == "" {
+		path = "unknown"
+	}
+	if app.quietHealth && path == "/health" && c.Writer.Status() < 400 {
+		return
+	}
+	l := slog.LevelInfo
+	if c.Writer.Status() >= 500 {
+		l = slog.LevelError
+	}
+	app.logger.LogAttrs(c.Request.Context(), l, "request",
+		slog.String("method", c.Request.Method),
+		slog.String("route", path),
+		slog.Int("status", c.Writer.Status()),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("ip", c.ClientIP()),
+		slog.String("request_id", c.GetString(requestIDHeader)),
+	)
+}
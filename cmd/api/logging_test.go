@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// records returns the JSON log records written to buf.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var l []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Errorf("incorrect JSON record %q: %v", line, err)
+			t.FailNow()
+		}
+		l = append(l, r)
+	}
+	return l
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("🔄 cache refreshed", "entries", 3)
+	l.Warn("⚠️ cannot refresh cache", slog.Any("error", errors.New("boom")))
+	rs := records(t, &buf)
+	if len(rs) != 1 {
+		t.Errorf("the records below the level must be dropped, got %v", rs)
+		t.FailNow()
+	}
+	if r := rs[0]; r["level"] != "WARN" || r["msg"] != "⚠️ cannot refresh cache" || r["error"] != "boom" || r["time"] == nil {
+		t.Errorf("incorrect record, got %v", r)
+		t.FailNow()
+	}
+
+	buf.Reset()
+	if l, err = newLogger(&buf, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("dropped")
+	l.Info("💾 cache saved", "path", "cache.snapshot")
+	if s := buf.String(); strings.Contains(s, "dropped") || !strings.Contains(s, "level=INFO") || !strings.Contains(s, "path=cache.snapshot") {
+		t.Errorf("the default must be text at the info level, got %q", s)
+		t.FailNow()
+	}
+
+	for _, tc := range [][2]string{{"verbose", "json"}, {"info", "xml"}} {
+		if _, err := newLogger(&buf, tc[0], tc[1]); err == nil {
+			t.Errorf("level %q and format %q must be rejected", tc[0], tc[1])
+			t.FailNow()
+		}
+	}
+}
+
+func TestQuietHealth(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApp(data.MockDB)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	app.quietHealth = true
+	r := setupRouter(app)
+	for _, path := range []string{"/health", "/ready"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/health", nil) // without the API key
+	r.ServeHTTP(w, req)
+	rs := records(t, &buf)
+	if len(rs) != 2 || rs[0]["route"] != "/ready" || rs[1]["route"] != "/health" || rs[1]["status"] != float64(http.StatusUnauthorized) {
+		t.Errorf("only the successful health checks must be skipped, got %v", rs)
+		t.FailNow()
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApp(data.MockDB)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	r := setupRouter(app)
+	r.GET("/boom", func(c *gin.Context) { app.failInternal(c, errors.New("boom")) })
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/unsubscribe/s3cr3t-t0k3n", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	r.ServeHTTP(w, req)
+	rs := records(t, &buf)
+	if len(rs) == 0 {
+		t.Error("the request must be logged")
+		t.FailNow()
+	}
+	rec := rs[len(rs)-1]
+	if rec["msg"] != "request" || rec["method"] != "GET" || rec["route"] != "/unsubscribe/:token" || rec["request_id"] != "req-1" || rec["status"] != float64(w.Code) {
+		t.Errorf("incorrect request record, got %v", rec)
+		t.FailNow()
+	}
+	if strings.Contains(buf.String(), "s3cr3t-t0k3n") {
+		t.Errorf("the tokens of the path must not be logged, got %q", buf.String())
+		t.FailNow()
+	}
+
+	buf.Reset()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/boom", nil)
+	req.Header.Set(requestIDHeader, "req-2")
+	r.ServeHTTP(w, req)
+	rs = records(t, &buf)
+	if len(rs) != 2 {
+		t.Errorf("the failure and the request must be logged, got %v", rs)
+		t.FailNow()
+	}
+	if f := rs[0]; f["level"] != "ERROR" || f["error"] != "boom" || f["route"] != "/boom" || f["request_id"] != "req-2" {
+		t.Errorf("incorrect failure record, got %v", f)
+		t.FailNow()
+	}
+	if rs[1]["level"] != "ERROR" || rs[1]["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("a server error must be logged as an error, got %v", rs[1])
+		t.FailNow()
+	}
+}
@@ -3,20 +3,44 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	_ "time/tzdata" // time zones of UNLEAKTRADE_EXPORT_TZ without the tzdata of the container
 
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"github.com/unleaktrade/waitlist/internal/cache"
+	"github.com/unleaktrade/waitlist/internal/captcha"
 	"github.com/unleaktrade/waitlist/internal/crypto"
 	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
+	"github.com/unleaktrade/waitlist/internal/crypto/envelope"
 	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/events"
+	"github.com/unleaktrade/waitlist/internal/geoip"
+	"github.com/unleaktrade/waitlist/internal/health"
 	"github.com/unleaktrade/waitlist/internal/limiter"
 	"github.com/unleaktrade/waitlist/internal/mailer"
+	"github.com/unleaktrade/waitlist/internal/metrics"
+	"github.com/unleaktrade/waitlist/internal/pow"
+	"github.com/unleaktrade/waitlist/internal/reporting"
+	"github.com/unleaktrade/waitlist/internal/storage"
+	"github.com/unleaktrade/waitlist/internal/tracing"
+	"github.com/unleaktrade/waitlist/internal/webhook"
+	"golang.org/x/time/rate"
 )
 
 type App struct {
@@ -24,146 +48,1184 @@ type App struct {
 	jwt                crypto.Token
 	mailer             mailer.Mailer
 	wg                 sync.WaitGroup
-	rl                 *limiter.RateLimiter
+	rl                 limiter.Limiter
+	walletRL, emailRL  limiter.Limiter // registrations by wallet and by email, whatever the IP
 	secpath1, secpath2 string
-	c                  *cache.Cache
-	apiKey             string
+	c                  *cache.Timestamps
+	cacheWarmup        time.Duration                    // of the retries loading the cache at startup, before serving degraded
+	degraded           atomic.Bool                      // cache not loaded from the DB yet, check-wallet falling through to it
+	revision           atomic.Uint64                    // of the users, bumped on their writes through dbOf
+	maintenance        atomic.Pointer[data.Maintenance] // nil when never set, the public routes refused while enabled
+	persistMaintenance bool                             // maintenance mode kept in DB, restored at startup and refreshed with the cache
+	apiKeys            map[string]apiKey
+	signatures         *requestSignatures // of the signed API keys
+	downloads          *downloadLinks     // of the list
+	metrics            *metrics.Registry
+	outbox             *mailer.OutboxWorker
+	dispatcher         *mailer.Dispatcher
+	recorder           mailer.Recorder // set in log mode only
+	blocklist          *data.Blocklist // nil when disposable emails are allowed
+	resolver           data.Resolver   // of the .sol sponsors, nil when the sponsors must be addresses
+	geo                geoip.Locator   // country of the activations, nil when not located
+	referralLimit      int             // activations a sponsor can claim, no limit when 0
+	referrals          *cache.Cache[int]
+	waitlistCap        int                        // activated users closing the waitlist, no cap when 0
+	schedule           *schedule                  // nil when the waitlist is always open
+	genesis            map[string]bool            // sponsors valid even when absent from the DB
+	webhooks           *webhook.Notifier          // nil when no webhook is configured
+	sinks              map[string]events.Sink     // of the events of the users by name, none when not published
+	importMaxRows      int                        // records of an import, no limit when 0
+	mailerHealth       *health.Monitor            // nil when the mailer is not monitored
+	waveSize           int                        // users activated per wave
+	idempotency        *cache.Cache[registration] // registrations by Idempotency-Key, nil when not supported
+	pending            *cache.Cache[registration] // registrations awaiting activation by address, nil when each one mints a token
+	enumeration        *enumerationGuard          // of check-wallet, nil when the enumerations are not slowed down
+	registerMaxBytes   int64                      // size of a register body, no limit when 0
+	fastTimeout        time.Duration              // of the register, activate and check-wallet requests, no bound when 0
+	slowTimeout        time.Duration              // of the list and download requests, no bound when 0
+	legacyErrors       bool                       // errors as {"error": message}, for the clients not migrated yet
+	exposeToken        bool                       // activation token in the register responses, for QA only
+	quietHealth        bool                       // successful health checks not logged
+	honeypot           bool                       // registrations filling the website field ignored
+	pow                *pow.Issuer                // nil when registering needs no proof-of-work
+	captcha            captcha.Verifier           // nil when registering needs no CAPTCHA
+	captchaFailOpen    bool                       // registrations accepted when the CAPTCHA cannot be verified
+	ownership          *ownershipProofs           // nil when registering needs no proof of the wallet ownership
+	successURL         string                     // where the activation page redirects, with ?address=, rendered when empty
+	errorURL           string                     // where the activation page redirects on failure, with ?reason=, rendered when empty
+	supportEmail       string                     // shown on the pages, none when empty
+	welcomeDelay       time.Duration              // of the welcome email after the activation, none sent when 0
+	digestInterval     time.Duration              // between the digests of a sponsor, none sent when 0
+	deleteRetention    time.Duration              // of the deleted users until purged, never purged when 0
+	replica            string                     // unique holder of the locks
+	secretPaths        bool                       // admin routes also under /:path1/:path2, deprecated for the admin tokens
+	exportTZ           *time.Location             // of the timestamps of the CSV list
+	exports            data.Exports               // jobs of the full exports
+	uploader           storage.Uploader           // of the full exports, nil when disabled
+	exportURLTTL       time.Duration              // of the download links of the exports
+	every              periods                    // of the background tasks
+	stop               context.CancelFunc         // of the background tasks, set by StartBackground
+	srv                *server                    // stopped first by Shutdown, nil when not serving
+	adminSrv           *server                    // of the admin routes, stopped with srv, nil when srv serves them
+	logger             *slog.Logger
+	mailProvider       string             // in the spans of the emails
+	reporter           reporting.Reporter // of the 5xx responses and the panics
 }
 
 var (
 	jwts               = map[string]crypto.Token{}
+	dbDriver           string
+	dbDir              = "data"
 	tableName          = "Waitlist"
 	ek                 string
 	secpath1, secpath2 string
-	apiKey             string
+	apiKeys            map[string]apiKey
+	audience           = crypto.DefaultAudience
+	mailConfig         mailer.Config
+	outboxInterval     = 5 * time.Second
+	outboxStaleAfter   = time.Minute
+	welcomeEmail       bool
+	welcomeDelay       = 48 * time.Hour
+	digestEnabled      bool
+	digestInterval     = 7 * 24 * time.Hour
+	digestCheck        = time.Hour
+	deleteRetention    = 30 * 24 * time.Hour
+	purgeCheck         = time.Hour
+	mailWorkers        = 4
+	mailQueueSize      = 100
+	disposableCheck    = true
+	disposableDomains  []string
+	disposableURL      string
+	cacheRefresh       = 5 * time.Minute
+	cacheNegativeTTL   = 30 * time.Second
+	cacheWarmup        = 30 * time.Second
+	persistMaintenance bool
+	cacheSnapshot      string
+	cacheSnapshotAge   = time.Hour
+	limiterSnapshot    string // directory
+	limiterCleanup     = 5 * time.Minute
+	referralLimit      = 50
+	waitlistCap        int
+	openWindows        []window
+	activationGrace    = 10 * time.Minute // the lifetime of the activation tokens
+	genesisSponsors    []string
+	webhookURLs        []string
+	webhookSecret      string
+	eventsARN          string
+	natsURL            string
+	natsSubject        = "waitlist.events"
+	kafkaBrokers       []string
+	kafkaTopic         = "waitlist.events"
+	eventsTableName    string
+	ddbCheck           = true
+	ddbAutocreate      bool
+	ddbRetry           = data.DefaultRetryPolicy
+	importMaxRows      = 1000
+	kmsKeyARN          string
+	kmsRotation        = envelope.DefaultRotation
+	mailerHealthWindow = 5 * time.Minute
+	mailerDownPercent  = 90
+	waveSize           = 500
+	shutdownTimeout    = 10 * time.Second
+	idempotencyWindow  = 10 * time.Minute
+	pendingTTL         time.Duration
+	registerMaxBytes   = 4 << 10
+	fastTimeout        = 2 * time.Second
+	slowTimeout        = 30 * time.Second
+	rateLimiter        = "token_bucket"
+	ipRatePerMinute    = 10 // of the sliding windows
+	walletRegisterRate = 3  // per hour
+	emailRegisterRate  = 5  // per hour
+	enumSlowAfter      = 20 // consecutive unknown wallets checked by an IP
+	enumBlockAfter     = 100
+	enumMaxDelay       = 2 * time.Second
+	enumWindow         = time.Hour
+	legacyErrors       bool
+	exposeToken        bool
+	quietHealth        bool
+	tlsCertFile        string
+	tlsKeyFile         string
+	autocertHosts      []string
+	autocertCacheDir   = "autocert"
+	autocertHTTPAddr   = ":80"
+	adminAddr          string
+	honeypot           bool
+	powDifficulty      int
+	powTTL             = 2 * time.Minute
+	powSecret          string
+	captchaEnabled     bool
+	turnstileSecret    string
+	captchaFailOpen    bool
+	ownershipProof     bool
+	ownershipNonceTTL  = 5 * time.Minute
+	successURL         string
+	errorURL           string
+	supportEmail       string
+	secretPaths        = true
+	exportTZ           = time.UTC
+	sentryDSN          string
+	allowOffCurve      bool
+	openWave           bool
+	snsRPCURL          string
+	snsCacheTTL        = time.Hour
+	geoIPDB            string
+	downloadSecret     string
+	exportBucket       string
+	exportPrefix       = "exports/"
+	exportKMSKey       string
+	exportURLTTL       = 15 * time.Minute
+	exportCheck        = 10 * time.Second
 )
 
+// mailerHealthMinCalls is the number of sends in the window below which the mailer is considered healthy.
+const mailerHealthMinCalls = 5
+
+// referralsTTL is how long a sponsor's referral count is trusted before being read again.
+const referralsTTL = 30 * time.Second
+
 func setup() {
+	gin.SetMode(ginMode(os.Getenv("UNLEAKTRADE_ENV")))
+	// JSON in production, for the log collectors
+	logFormat := os.Getenv("UNLEAKTRADE_LOG_FORMAT")
+	if logFormat == "" && gin.Mode() == gin.ReleaseMode {
+		logFormat = "json"
+	}
+	l, err := newLogger(os.Stderr, os.Getenv("UNLEAKTRADE_LOG_LEVEL"), logFormat)
+	if err != nil {
+		panic(fmt.Sprintf("logger: %v", err))
+	}
+	logger = l
+	slog.SetDefault(logger)
+	data.SetLogger(logger)
+	mailer.SetLogger(logger)
+	limiter.SetLogger(logger)
+
+	if aud := os.Getenv("UNLEAKTRADE_JWT_AUDIENCE"); aud != "" {
+		audience = aud
+	}
 	k, _ := cipher.GenerateKey(32)
-	jwts["HS512"] = crypto.NewJWTHS512(k)
+	jwts["HS512"] = crypto.NewJWTHS512(k).WithAudience(audience)
 	k, _ = cipher.GenerateKey(16)
-	jwts["HS256"] = crypto.NewJWTHS256(k)
-	jwts["ES256"], _ = crypto.NewJWTES256()
-	jwts["ES512"], _ = crypto.NewJWTES512()
-	log.Println("🔐 JWT Services: OK")
+	jwts["HS256"] = crypto.NewJWTHS256(k).WithAudience(audience)
+	es256, _ := crypto.NewJWTES256()
+	if pem := os.Getenv("UNLEAKTRADE_JWT_ES256_KEY"); pem != "" {
+		// shared with the replicas and waitlistctl, which can then verify the tokens
+		var err error
+		if es256, err = crypto.NewJWTECDSA(pem, jwt.SigningMethodES256); err != nil {
+			panic(fmt.Sprintf("UNLEAKTRADE_JWT_ES256_KEY: %v", err))
+		}
+	}
+	jwts["ES256"] = es256.WithAudience(audience)
+	es512, _ := crypto.NewJWTES512()
+	jwts["ES512"] = es512.WithAudience(audience)
+	for name, j := range jwts {
+		if err := crypto.SelfCheck(j); err != nil {
+			panic(fmt.Sprintf("JWT %s: %v", name, err))
+		}
+	}
+	// the replicas activating the tokens of each other must log the same fingerprint, also shown by /ready
+	logger.Info("🔐 JWT services: OK", "audience", audience, "fingerprint", jwts["ES256"].Fingerprint())
+
+	if dbDriver = os.Getenv("UNLEAKTRADE_DB_DRIVER"); dbDriver == "" {
+		dbDriver = "dynamodb"
+	}
+	switch dbDriver {
+	case "dynamodb":
+	case "memory": // for the ephemeral deployments and the load tests
+		logger.Info("💾 DB in memory, lost on exit")
+	case "file":
+		if v := os.Getenv("UNLEAKTRADE_DB_DIR"); v != "" {
+			dbDir = v
+		}
+		logger.Info("💾 DB in file store", "dir", dbDir)
+	default:
+		panic(fmt.Sprintf("UNLEAKTRADE_DB_DRIVER: unknown driver %q, want dynamodb, memory or file", dbDriver))
+	}
 
 	tn := os.Getenv("UNLEAKTRADE_WAITLIST_TABLE_NAME")
 	if tn != "" {
 		tableName = tn
 	}
-	log.Printf("💾 DynamoDB Table is %q\n", tableName)
+	logger.Info("💾 DynamoDB table", "table", tableName)
+	eventsTableName = os.Getenv("UNLEAKTRADE_EVENTS_TABLE_NAME")
+	// off for the IAM policies without dynamodb:DescribeTable
+	ddbCheck = os.Getenv("UNLEAKTRADE_DDB_CHECK") != "false"
+	if ddbAutocreate = os.Getenv("UNLEAKTRADE_DDB_AUTOCREATE") == "true"; ddbAutocreate {
+		ddbCheck = true
+		logger.Info("💾 DynamoDB table created when missing", "table", tableName)
+	}
+	ddbRetry.Attempts = intEnv("UNLEAKTRADE_DDB_RETRY_ATTEMPTS", ddbRetry.Attempts)
+	ddbRetry.Backoff = durationEnv("UNLEAKTRADE_DDB_RETRY_BACKOFF", ddbRetry.Backoff)
+	ddbRetry.Budget = durationEnv("UNLEAKTRADE_DDB_RETRY_BUDGET", ddbRetry.Budget)
 
 	ek = os.Getenv("UNLEAKTRADE_ENCRYPTION_KEY")
-	if ek == "" {
+	kmsKeyARN = os.Getenv("UNLEAKTRADE_KMS_KEY_ARN")
+	kmsRotation = durationEnv("UNLEAKTRADE_KMS_DATA_KEY_ROTATION", kmsRotation)
+	switch {
+	case kmsKeyARN != "":
+		logger.Info("🔑 encryption key: KMS", "key", kmsKeyARN, "rotation", kmsRotation)
+	case dbDriver == "memory":
+		logger.Info("🔑 encryption key: generated for the memory DB")
+	case ek == "":
 		panic("encryption key is missing")
+	default:
+		logger.Info("🔑 encryption key: OK")
 	}
-	log.Println("🔑 Encryption Key: OK")
 
-	secpath1 = os.Getenv("UNLEAKTRADE_API_SECURE_PATH1")
-	if secpath1 == "" {
-		panic("secure path #1 must be set")
-	}
-	secpath2 = os.Getenv("UNLEAKTRADE_API_SECURE_PATH2")
-	if secpath2 == "" {
-		panic("secure path #1 must be set")
+	// deprecated, the admin routes are under /admin with an admin token
+	if secretPaths = os.Getenv("UNLEAKTRADE_SECRET_PATHS") != "false"; secretPaths {
+		secpath1 = os.Getenv("UNLEAKTRADE_API_SECURE_PATH1")
+		if secpath1 == "" {
+			panic("secure path #1 must be set")
+		}
+		secpath2 = os.Getenv("UNLEAKTRADE_API_SECURE_PATH2")
+		if secpath2 == "" {
+			panic("secure path #1 must be set")
+		}
+		logger.Warn("⚠️ admin routes under the secret paths, deprecated")
 	}
 
-	apiKey = os.Getenv("UNLEAKTRADE_WAITLIST_API_KEY")
-	if apiKey == "" {
+	if apiKeys, err = loadAPIKeys(os.Getenv("UNLEAKTRADE_API_KEYS"), os.Getenv("UNLEAKTRADE_API_KEYS_FILE")); err != nil {
+		panic(err)
+	}
+	if k := os.Getenv("UNLEAKTRADE_WAITLIST_API_KEY"); k != "" {
+		apiKeys[k] = apiKey{Scopes: allScopes}
+	}
+	if len(apiKeys) == 0 {
 		panic("waitlist api-key must be set")
 	}
+
+	mailConfig = mailer.Config{
+		Provider:    os.Getenv("UNLEAKTRADE_MAIL_PROVIDER"),
+		User:        os.Getenv("UNLEAKTRADE_MAIL_USER"),
+		Password:    os.Getenv("UNLEAKTRADE_MAIL_PASSWORD"),
+		Host:        "live.smtp.mailtrap.io",
+		Port:        587,
+		SendGridKey: os.Getenv("UNLEAKTRADE_SENDGRID_API_KEY"),
+		LogDir:      os.Getenv("UNLEAKTRADE_MAIL_LOG_DIR"),
+		Options: mailer.Options{
+			FromName:            os.Getenv("UNLEAKTRADE_MAIL_FROM_NAME"),
+			FromAddress:         os.Getenv("UNLEAKTRADE_MAIL_FROM"),
+			ReplyTo:             os.Getenv("UNLEAKTRADE_MAIL_REPLY_TO"),
+			Product:             os.Getenv("UNLEAKTRADE_PRODUCT_NAME"),
+			ActivationSubject:   os.Getenv("UNLEAKTRADE_MAIL_ACTIVATION_SUBJECT"),
+			ConfirmationSubject: os.Getenv("UNLEAKTRADE_MAIL_CONFIRMATION_SUBJECT"),
+			WelcomeSubject:      os.Getenv("UNLEAKTRADE_MAIL_WELCOME_SUBJECT"),
+			DigestSubject:       os.Getenv("UNLEAKTRADE_MAIL_DIGEST_SUBJECT"),
+		},
+	}
+	logger.Info("📮 mail provider", "provider", mailConfig.Provider)
+
+	outboxInterval = durationEnv("UNLEAKTRADE_OUTBOX_INTERVAL", outboxInterval)
+	outboxStaleAfter = durationEnv("UNLEAKTRADE_OUTBOX_STALE_AFTER", outboxStaleAfter)
+	logger.Info("📬 outbox", "interval", outboxInterval, "stale_after", outboxStaleAfter)
+	if welcomeEmail = os.Getenv("UNLEAKTRADE_WELCOME_EMAIL") == "true"; welcomeEmail {
+		welcomeDelay = durationEnv("UNLEAKTRADE_WELCOME_EMAIL_DELAY", welcomeDelay)
+		logger.Info("👋 welcome email sent after the activation", "delay", welcomeDelay)
+	}
+	if digestEnabled = os.Getenv("UNLEAKTRADE_DIGEST") == "true"; digestEnabled {
+		digestInterval = durationEnv("UNLEAKTRADE_DIGEST_INTERVAL", digestInterval)
+		digestCheck = durationEnv("UNLEAKTRADE_DIGEST_CHECK_INTERVAL", digestCheck)
+		logger.Info("📰 digest sent to the sponsors", "interval", digestInterval, "check", digestCheck)
+	}
+
+	// the deletions stay reversible during the retention
+	deleteRetention = durationEnv("UNLEAKTRADE_DELETE_RETENTION", deleteRetention)
+	purgeCheck = durationEnv("UNLEAKTRADE_PURGE_CHECK_INTERVAL", purgeCheck)
+	logger.Info("🗑️ deleted users purged", "retention", deleteRetention, "check", purgeCheck)
+
+	mailWorkers = intEnv("UNLEAKTRADE_MAIL_WORKERS", mailWorkers)
+	mailQueueSize = intEnv("UNLEAKTRADE_MAIL_QUEUE_SIZE", mailQueueSize)
+	logger.Info("👷 mail dispatcher", "workers", mailWorkers, "queue", mailQueueSize)
+
+	disposableCheck = os.Getenv("UNLEAKTRADE_DISPOSABLE_CHECK") != "false"
+	if d := os.Getenv("UNLEAKTRADE_DISPOSABLE_DOMAINS"); d != "" {
+		disposableDomains = strings.Split(d, ",")
+	}
+	disposableURL = os.Getenv("UNLEAKTRADE_DISPOSABLE_LIST_URL")
+
+	cacheRefresh = durationEnv("UNLEAKTRADE_CACHE_REFRESH_INTERVAL", cacheRefresh)
+	logger.Info("🔄 cache refreshed periodically", "interval", cacheRefresh)
+	cacheNegativeTTL = durationEnv("UNLEAKTRADE_CACHE_NEGATIVE_TTL", cacheNegativeTTL)
+	cacheWarmup = durationEnv("UNLEAKTRADE_CACHE_WARMUP_TIMEOUT", cacheWarmup)
+	persistMaintenance = os.Getenv("UNLEAKTRADE_MAINTENANCE_PERSIST") == "true"
+	referralLimit = nonNegativeIntEnv("UNLEAKTRADE_REFERRAL_LIMIT", referralLimit)
+	logger.Info("🤝 referral limit per sponsor", "limit", referralLimit)
+	waitlistCap = nonNegativeIntEnv("UNLEAKTRADE_WAITLIST_CAP", 0)
+	if waitlistCap > 0 {
+		logger.Info("🚪 waitlist capped", "users", waitlistCap)
+	}
+	openWindows = nil
+	if v := os.Getenv("UNLEAKTRADE_REGISTRATION_WINDOWS"); v != "" {
+		l, err := parseWindows(v)
+		if err != nil {
+			panic(fmt.Sprintf("UNLEAKTRADE_REGISTRATION_WINDOWS: %v", err))
+		}
+		openWindows = l
+		logger.Info("🗓️ waitlist open in windows", "windows", len(l))
+	}
+	activationGrace = durationEnv("UNLEAKTRADE_ACTIVATION_GRACE", activationGrace)
+	importMaxRows = intEnv("UNLEAKTRADE_IMPORT_MAX_ROWS", importMaxRows)
+	waveSize = intEnv("UNLEAKTRADE_WAVE_SIZE", waveSize)
+	logger.Info("🌊 waves", "users", waveSize)
+
+	genesisSponsors = nil
+	if g := os.Getenv("UNLEAKTRADE_GENESIS_SPONSORS"); g != "" {
+		for _, a := range strings.Split(g, ",") {
+			a = strings.TrimSpace(a)
+			if err := data.NewGenesisUser(a).Validate(); err != nil {
+				panic(fmt.Sprintf("UNLEAKTRADE_GENESIS_SPONSORS: invalid address %q: %v", a, err))
+			}
+			genesisSponsors = append(genesisSponsors, a)
+		}
+		logger.Info("🌱 genesis sponsors", "count", len(genesisSponsors))
+	}
+
+	webhookURLs = nil
+	if u := os.Getenv("UNLEAKTRADE_WEBHOOK_URLS"); u != "" {
+		webhookURLs = strings.Split(u, ",")
+		webhookSecret = os.Getenv("UNLEAKTRADE_WEBHOOK_SECRET")
+		if webhookSecret == "" {
+			panic("webhook secret must be set")
+		}
+		logger.Info("🪝 webhooks", "count", len(webhookURLs))
+	}
+	// the sinks of the events, each one paused by its flag set to false without losing its settings
+	enabled := func(sink string) bool {
+		return os.Getenv("UNLEAKTRADE_EVENTS_"+sink+"_ENABLED") != "false"
+	}
+	// for the airdrop service, an SNS topic or an SQS queue
+	if eventsARN = os.Getenv("UNLEAKTRADE_EVENTS_ARN"); eventsARN != "" && enabled("AWS") {
+		a, err := events.ParseARN(eventsARN)
+		if err != nil {
+			panic(err)
+		}
+		logger.Info("📣 events published to AWS", "service", a.Service, "resource", a.Resource)
+	} else {
+		eventsARN = ""
+	}
+	// for the analytics, NATS JetStream
+	if natsURL = os.Getenv("UNLEAKTRADE_EVENTS_NATS_URL"); natsURL != "" && enabled("NATS") {
+		if v := os.Getenv("UNLEAKTRADE_EVENTS_NATS_SUBJECT"); v != "" {
+			natsSubject = v
+		}
+		logger.Info("📣 events published to NATS", "subject", natsSubject)
+	} else {
+		natsURL = ""
+	}
+	kafkaBrokers = nil
+	if b := os.Getenv("UNLEAKTRADE_EVENTS_KAFKA_BROKERS"); b != "" && enabled("KAFKA") {
+		kafkaBrokers = strings.Split(b, ",")
+		if v := os.Getenv("UNLEAKTRADE_EVENTS_KAFKA_TOPIC"); v != "" {
+			kafkaTopic = v
+		}
+		logger.Info("📣 events published to Kafka", "brokers", len(kafkaBrokers), "topic", kafkaTopic)
+	}
+
+	mailerHealthWindow = durationEnv("UNLEAKTRADE_MAILER_HEALTH_WINDOW", mailerHealthWindow)
+	mailerDownPercent = intEnv("UNLEAKTRADE_MAILER_DOWN_PERCENT", mailerDownPercent)
+	logger.Info("🩺 mailer health", "window", mailerHealthWindow, "down_percent", mailerDownPercent)
+
+	cacheSnapshot = os.Getenv("UNLEAKTRADE_CACHE_SNAPSHOT")
+	cacheSnapshotAge = durationEnv("UNLEAKTRADE_CACHE_SNAPSHOT_MAX_AGE", cacheSnapshotAge)
+	limiterSnapshot = os.Getenv("UNLEAKTRADE_LIMITER_SNAPSHOT_DIR")
+	limiterCleanup = durationEnv("UNLEAKTRADE_LIMITER_CLEANUP_INTERVAL", limiterCleanup)
+
+	shutdownTimeout = durationEnv("UNLEAKTRADE_SHUTDOWN_TIMEOUT", shutdownTimeout)
+	idempotencyWindow = durationEnv("UNLEAKTRADE_IDEMPOTENCY_WINDOW", idempotencyWindow)
+	// for QA, the activation links staying the first emailed
+	if pendingTTL = durationEnv("UNLEAKTRADE_PENDING_REGISTRATION_TTL", 0); pendingTTL > 0 {
+		logger.Info("⏳ pending registrations answered with their hash", "ttl", pendingTTL)
+	}
+	registerMaxBytes = intEnv("UNLEAKTRADE_REGISTER_MAX_BYTES", registerMaxBytes)
+	fastTimeout = nonNegativeDurationEnv("UNLEAKTRADE_FAST_TIMEOUT", fastTimeout)
+	slowTimeout = nonNegativeDurationEnv("UNLEAKTRADE_SLOW_TIMEOUT", slowTimeout)
+	logger.Info("⏱️ request timeouts", "fast", fastTimeout, "slow", slowTimeout)
+	if v := os.Getenv("UNLEAKTRADE_RATE_LIMITER"); v != "" {
+		rateLimiter = v
+	}
+	switch rateLimiter {
+	case "token_bucket":
+	case "sliding_window": // strict, without the bursts of the token buckets
+		ipRatePerMinute = intEnv("UNLEAKTRADE_RATE_LIMIT_PER_MINUTE", ipRatePerMinute)
+		logger.Info("🚧 requests limited per IP over any minute", "limit", ipRatePerMinute)
+	default:
+		panic(fmt.Sprintf("UNLEAKTRADE_RATE_LIMITER: unknown limiter %q, want token_bucket or sliding_window", rateLimiter))
+	}
+	walletRegisterRate = intEnv("UNLEAKTRADE_REGISTER_WALLET_LIMIT", walletRegisterRate)
+	emailRegisterRate = intEnv("UNLEAKTRADE_REGISTER_EMAIL_LIMIT", emailRegisterRate)
+	logger.Info("🚧 registrations limited an hour", "wallet", walletRegisterRate, "email", emailRegisterRate)
+	enumSlowAfter = nonNegativeIntEnv("UNLEAKTRADE_ENUMERATION_SLOW_AFTER", enumSlowAfter)
+	enumBlockAfter = nonNegativeIntEnv("UNLEAKTRADE_ENUMERATION_BLOCK_AFTER", enumBlockAfter)
+	enumMaxDelay = durationEnv("UNLEAKTRADE_ENUMERATION_MAX_DELAY", enumMaxDelay)
+	enumWindow = durationEnv("UNLEAKTRADE_ENUMERATION_WINDOW", enumWindow)
+	if enumSlowAfter > 0 || enumBlockAfter > 0 {
+		logger.Info("🕵️ check-wallet enumerations slowed down", "after", enumSlowAfter, "blocked_after", enumBlockAfter, "window", enumWindow)
+	}
+	// deprecated, to be removed in the next release
+	if legacyErrors = os.Getenv("UNLEAKTRADE_LEGACY_ERRORS") == "true"; legacyErrors {
+		logger.Warn("⚠️ legacy error responses, deprecated")
+	}
+	if exposeToken = os.Getenv("UNLEAKTRADE_EXPOSE_TOKEN") == "true"; exposeToken {
+		logger.Warn("⚠️ activation tokens exposed in the register responses, for QA only")
+	}
+	// the load balancer probes
+	quietHealth = os.Getenv("UNLEAKTRADE_HEALTH_ACCESS_LOG") == "false"
+
+	tlsCertFile = os.Getenv("UNLEAKTRADE_TLS_CERT_FILE")
+	tlsKeyFile = os.Getenv("UNLEAKTRADE_TLS_KEY_FILE")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		panic("TLS cert and key files must be set together")
+	}
+	autocertHosts = nil
+	if h := os.Getenv("UNLEAKTRADE_AUTOCERT_HOSTS"); h != "" {
+		if tlsCertFile != "" {
+			panic("TLS cert files and autocert are exclusive")
+		}
+		autocertHosts = strings.Split(h, ",")
+		if d := os.Getenv("UNLEAKTRADE_AUTOCERT_CACHE_DIR"); d != "" {
+			autocertCacheDir = d
+		}
+		if a := os.Getenv("UNLEAKTRADE_AUTOCERT_HTTP_ADDR"); a != "" {
+			autocertHTTPAddr = a
+		}
+		logger.Info("🔏 Let's Encrypt certificates", "hosts", autocertHosts, "cache", autocertCacheDir)
+	}
+	// admin routes, metrics and pprof kept off the public listener, on a private network
+	if adminAddr = os.Getenv("UNLEAKTRADE_ADMIN_ADDR"); adminAddr != "" {
+		logger.Info("🛡️ admin routes served on their own listener", "addr", adminAddr)
+	}
+
+	honeypot = os.Getenv("UNLEAKTRADE_HONEYPOT") == "true"
+	powDifficulty = intEnv("UNLEAKTRADE_POW_DIFFICULTY", 0)
+	if powDifficulty > 0 {
+		powTTL = durationEnv("UNLEAKTRADE_POW_TTL", powTTL)
+		// shared with the replicas, which then accept each other's challenges
+		if powSecret = os.Getenv("UNLEAKTRADE_POW_SECRET"); powSecret == "" {
+			powSecret, _ = cipher.GenerateKey(32)
+		}
+		logger.Info("⛏️ proof-of-work", "bits", powDifficulty, "ttl", powTTL)
+	}
+
+	if captchaEnabled = os.Getenv("UNLEAKTRADE_CAPTCHA") == "true"; captchaEnabled {
+		turnstileSecret = os.Getenv("UNLEAKTRADE_TURNSTILE_SECRET_KEY")
+		if turnstileSecret == "" {
+			panic("turnstile secret key must be set")
+		}
+		captchaFailOpen = os.Getenv("UNLEAKTRADE_CAPTCHA_FAIL_OPEN") == "true"
+		logger.Info("🤖 Turnstile CAPTCHA on register", "fail_open", captchaFailOpen)
+	}
+
+	// the PDAs of the multisigs, which cannot prove their ownership
+	if allowOffCurve = os.Getenv("UNLEAKTRADE_ALLOW_OFF_CURVE") == "true"; allowOffCurve {
+		data.AllowOffCurve(true)
+		logger.Info("🧩 addresses off the ed25519 curve accepted")
+	}
+
+	// the public launch wave, registered without sponsor
+	if openWave = os.Getenv("UNLEAKTRADE_OPEN_WAVE") == "true"; openWave {
+		data.OpenWave(true)
+		logger.Info("🌊 open wave, registrations without sponsor accepted")
+	}
+
+	// a GeoLite2-Country database, say
+	geoIPDB = os.Getenv("UNLEAKTRADE_GEOIP_DB")
+
+	// sponsors given as their .sol name
+	if snsRPCURL = os.Getenv("UNLEAKTRADE_SNS_RPC_URL"); snsRPCURL != "" {
+		snsCacheTTL = durationEnv("UNLEAKTRADE_SNS_CACHE_TTL", snsCacheTTL)
+		logger.Info("🏷️ .sol sponsors resolved", "ttl", snsCacheTTL) // the URL may hold an API key
+	}
+
+	if ownershipProof = os.Getenv("UNLEAKTRADE_OWNERSHIP_PROOF") == "true"; ownershipProof {
+		ownershipNonceTTL = durationEnv("UNLEAKTRADE_OWNERSHIP_NONCE_TTL", ownershipNonceTTL)
+		logger.Info("✍️ wallet ownership proven at registration", "nonce_ttl", ownershipNonceTTL)
+	}
+
+	successURL = urlEnv("UNLEAKTRADE_ACTIVATION_SUCCESS_URL", successURL)
+	errorURL = urlEnv("UNLEAKTRADE_ACTIVATION_ERROR_URL", errorURL)
+	exportTZ = locationEnv("UNLEAKTRADE_EXPORT_TZ", exportTZ)
+	// shared with the replicas, which then accept each other's download links
+	if downloadSecret = os.Getenv("UNLEAKTRADE_DOWNLOAD_SECRET"); downloadSecret == "" {
+		downloadSecret, _ = cipher.GenerateKey(32)
+	}
+	// the full exports, too long for the list behind the load balancers
+	if exportBucket = os.Getenv("UNLEAKTRADE_EXPORT_BUCKET"); exportBucket != "" {
+		if p, ok := os.LookupEnv("UNLEAKTRADE_EXPORT_PREFIX"); ok {
+			exportPrefix = p
+		}
+		exportKMSKey = os.Getenv("UNLEAKTRADE_EXPORT_KMS_KEY_ARN")
+		exportURLTTL = durationEnv("UNLEAKTRADE_EXPORT_URL_TTL", exportURLTTL)
+		exportCheck = durationEnv("UNLEAKTRADE_EXPORT_CHECK_INTERVAL", exportCheck)
+		logger.Info("📦 full exports to S3", "bucket", exportBucket, "prefix", exportPrefix, "kms", exportKMSKey != "", "url_ttl", exportURLTTL)
+	}
+	supportEmail = os.Getenv("UNLEAKTRADE_SUPPORT_EMAIL")
+
+	if sentryDSN = os.Getenv("UNLEAKTRADE_SENTRY_DSN"); sentryDSN != "" {
+		logger.Info("🐛 internal errors reported to Sentry")
+	}
 }
 
-func (app *App) initCache() {
-	// fill cache
-	users, err := app.db.List()
+// ginMode returns the gin mode of the environment env, release unless dev.
+func ginMode(env string) string {
+	if env == "dev" {
+		return gin.DebugMode
+	}
+	return gin.ReleaseMode
+}
+
+// durationEnv returns the positive duration set in the env variable k, or d when unset.
+func durationEnv(k string, d time.Duration) time.Duration {
+	return minDurationEnv(k, d, 1)
+}
+
+// nonNegativeDurationEnv is durationEnv accepting 0, for the bounds it disables.
+func nonNegativeDurationEnv(k string, d time.Duration) time.Duration {
+	return minDurationEnv(k, d, 0)
+}
+
+// minDurationEnv returns the duration, at least m, set in the env variable k, or d when unset.
+func minDurationEnv(k string, d, m time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return d
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < m {
+		panic(fmt.Sprintf("%s: invalid duration %q", k, v))
+	}
+	return d
+}
+
+// urlEnv returns the absolute URL set in the env variable k, or u when unset.
+func urlEnv(k, u string) string {
+	v := os.Getenv(k)
+	if v == "" {
+		return u
+	}
+	if p, err := url.Parse(v); err != nil || !p.IsAbs() {
+		panic(fmt.Sprintf("%s: invalid URL %q", k, v))
+	}
+	return v
+}
+
+// locationEnv returns the time zone named in the env variable k, like Europe/Paris, or l when unset.
+func locationEnv(k string, l *time.Location) *time.Location {
+	v := os.Getenv(k)
+	if v == "" {
+		return l
+	}
+	tz, err := time.LoadLocation(v)
 	if err != nil {
-		panic("error loading users list from DB")
+		panic(fmt.Sprintf("%s: invalid time zone %q: %v", k, v, err))
+	}
+	return tz
+}
+
+// intEnv returns the positive integer set in the env variable k, or i when unset.
+func intEnv(k string, i int) int {
+	return minIntEnv(k, i, 1)
+}
+
+// nonNegativeIntEnv is intEnv accepting 0, for the settings it disables.
+func nonNegativeIntEnv(k string, i int) int {
+	return minIntEnv(k, i, 0)
+}
+
+// minIntEnv returns the integer, at least m, set in the env variable k, or i when unset.
+func minIntEnv(k string, i, m int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return i
 	}
-	m := make(map[string]int64, len(users))
-	for _, u := range users {
-		m[u.Address] = u.Timestamp
+	i, err := strconv.Atoi(v)
+	if err != nil || i < m {
+		panic(fmt.Sprintf("%s: invalid number %q", k, v))
 	}
+	return i
+}
 
-	c := cache.New()
-	c.Fill(m)
+// ipLimiter returns the rate limiter of the IPs of the clients.
+func ipLimiter() limiter.Limiter {
+	if rateLimiter == "sliding_window" {
+		return limiter.NewSlidingWindow(ipRatePerMinute, time.Minute)
+	}
+	return limiter.New(0.1, 10)
+}
+
+// hourly returns a rate limiter of n accesses an hour, all at once at most for the token buckets.
+func hourly(n int) limiter.Limiter {
+	if rateLimiter == "sliding_window" {
+		return limiter.NewSlidingWindow(n, time.Hour)
+	}
+	return limiter.New(rate.Every(time.Hour/time.Duration(n)), n)
+}
+
+func (app *App) initCache() {
+	c := cache.New(cache.WithNegativeTTL(cacheNegativeTTL))
 	app.c = c
+	if app.restoreCache(cacheSnapshot, cacheSnapshotAge) {
+		// reconcile with the DB without blocking the startup
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.refreshCache()
+		}()
+		return
+	}
+
+	// fill cache, serving degraded if the DB stays unavailable so the registrations go on
+	m, err := app.warmCache()
+	if err != nil {
+		app.degraded.Store(true)
+		app.logger.Error("🚧 cannot load the cache, serving degraded until refreshed", "timeout", app.cacheWarmup, slog.Any("error", err))
+		return
+	}
+	c.Fill(m)
+}
+
+// Pauses between the attempts to load the cache, doubled up to the max.
+const (
+	warmupBackoff    = 100 * time.Millisecond
+	warmupMaxBackoff = 5 * time.Second
+)
+
+// warmCache loads the cache, retrying with backoff during app.cacheWarmup.
+func (app *App) warmCache() (map[string]int64, error) {
+	deadline := time.Now().Add(app.cacheWarmup)
+	for d := warmupBackoff; ; d = min(2*d, warmupMaxBackoff) {
+		m, err := app.loadCache()
+		if err == nil {
+			return m, nil
+		}
+		if time.Now().Add(d).After(deadline) {
+			return nil, err
+		}
+		app.logger.Warn("⚠️ cannot load the cache, retrying", "in", d, slog.Any("error", err))
+		time.Sleep(d)
+	}
+}
+
+// restoreCache fills the cache from the snapshot at path if it is younger than maxAge.
+func (app *App) restoreCache(path string, maxAge time.Duration) bool {
+	if path == "" {
+		return false
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			app.logger.Warn("⚠️ cannot read cache snapshot", "path", path, slog.Any("error", err))
+		}
+		return false
+	}
+	if age := time.Since(fi.ModTime()); age > maxAge {
+		app.logger.Info("🕰️ cache snapshot too old, loading from DB", "path", path, "age", age.Round(time.Second))
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		app.logger.Warn("⚠️ cannot read cache snapshot", "path", path, slog.Any("error", err))
+		return false
+	}
+	defer f.Close()
+	if err := app.c.Restore(f); err != nil {
+		app.logger.Warn("⚠️ cannot restore cache snapshot, loading from DB", "path", path, slog.Any("error", err))
+		return false
+	}
+	app.logger.Info("💾 cache restored", "path", path, "entries", app.c.Len())
+	return true
+}
+
+// snapshotCache writes the cache to path, through a temporary file so a crash never leaves a partial snapshot.
+func (app *App) snapshotCache(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := app.c.Snapshot(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadCache returns the registration timestamps of the users by address, without decrypting their emails.
+func (app *App) loadCache() (map[string]int64, error) {
+	return app.db.ListAddresses()
+}
+
+// refreshCache reloads the cache from the DB, so activations processed by other replicas are seen,
+// with the maintenance mode they set.
+func (app *App) refreshCache() {
+	app.loadMaintenance()
+	m, err := app.loadCache()
+	if err != nil {
+		app.logger.Warn("⚠️ cannot refresh cache", slog.Any("error", err))
+		return
+	}
+	added, removed := app.c.Refresh(m)
+	app.logger.Info("🔄 cache refreshed", "entries", len(m), "added", added, "removed", removed)
+	if app.degraded.CompareAndSwap(true, false) {
+		app.logger.Info("✅ cache loaded, degraded mode over")
+	}
+}
+
+// runCacheRefresher refreshes the cache every d until ctx is done, retrying within warmupMaxBackoff while degraded.
+func (app *App) runCacheRefresher(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(app.refreshDelay(d))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			app.refreshCache()
+			t.Reset(app.refreshDelay(d))
+		}
+	}
+}
+
+// refreshDelay returns the pause before the next refresh of the cache, every d unless degraded.
+func (app *App) refreshDelay(d time.Duration) time.Duration {
+	if app.degraded.Load() {
+		return min(d, warmupMaxBackoff)
+	}
+	return d
+}
+
+// periods are the intervals of the background tasks of the app.
+type periods struct {
+	limiterCleanup, cacheRefresh, digestCheck, exportCheck, purgeCheck time.Duration
 }
 
 func newApp() *App {
-	db, err := data.NewDynamoDB(tableName, ek)
+	reg := metrics.NewRegistry()
+	var db interface {
+		data.DB
+		data.Outbox
+		data.Exports
+	}
+	switch dbDriver {
+	case "memory":
+		db = data.NewMemoryDB()
+	case "file":
+		fs, err := data.NewFileStore(dbDir, ek)
+		if err != nil {
+			panic(err)
+		}
+		db = fs
+	default:
+		opts := []data.Option{data.WithRetry(ddbRetry, reg), data.EventsTable(eventsTableName)}
+		if ddbCheck { // fails the startup on a missing or different table
+			opts = append(opts, data.EnsureTable(ddbAutocreate))
+		}
+		var err error
+		if kmsKeyARN != "" { // ek becomes optional
+			env := envelope.New(kms.New(session.Must(session.NewSession())), kmsKeyARN, kmsRotation)
+			db, err = data.NewDynamoDBWithEnvelope(tableName, ek, env, opts...)
+		} else {
+			db, err = data.NewDynamoDB(tableName, ek, opts...)
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	m, err := mailer.NewProvider(mailConfig)
 	if err != nil {
 		panic(err)
 	}
+	provider := mailConfig.Provider
+	if provider == "" {
+		provider = mailer.ProviderSMTP
+	}
+	mh := health.NewMonitor("mailer", health.NewWindow(mailerHealthWindow, 10), mailerHealthMinCalls, float64(mailerDownPercent)/100)
+	// every attempt tracked, for the support to see whether the provider accepted it
+	rm := mailer.NewMonitored(mailer.NewRetrying(mailer.NewTracked(m, db), 3, 500*time.Millisecond), mh.Record)
 
-	return &App{
+	app := &App{
 		db:       db,
 		jwt:      jwts["ES256"],
-		mailer:   mailer.New(os.Getenv("UNLEAKTRADE_MAIL_USER"), os.Getenv("UNLEAKTRADE_MAIL_PASSWORD"), "live.smtp.mailtrap.io", 587),
+		mailer:   rm,
 		wg:       sync.WaitGroup{},
-		rl:       limiter.New(0.1, 10),
+		rl:       ipLimiter(),
+		walletRL: hourly(walletRegisterRate),
+		emailRL:  hourly(emailRegisterRate),
 		secpath1: secpath1,
 		secpath2: secpath2,
-		apiKey:   apiKey,
+		apiKeys:  apiKeys,
+		metrics:  reg,
+		outbox:   mailer.NewOutboxWorker(db, rm, reg, outboxInterval, outboxStaleAfter).WithUsers(db).WithProvider(provider),
+		every:    periods{limiterCleanup, cacheRefresh, digestCheck, exportCheck, purgeCheck},
+
+		cacheWarmup:        cacheWarmup,
+		persistMaintenance: persistMaintenance,
+		referralLimit:      referralLimit,
+		referrals:          cache.NewOf[int](cache.WithTTL(referralsTTL)),
+		waitlistCap:        waitlistCap,
+		genesis:            make(map[string]bool, len(genesisSponsors)),
+		importMaxRows:      importMaxRows,
+		mailerHealth:       mh,
+		waveSize:           waveSize,
+		idempotency:        cache.NewOf[registration](cache.WithTTL(idempotencyWindow)),
+		registerMaxBytes:   int64(registerMaxBytes),
+		fastTimeout:        fastTimeout,
+		slowTimeout:        slowTimeout,
+		legacyErrors:       legacyErrors,
+		exposeToken:        exposeToken,
+		quietHealth:        quietHealth,
+		honeypot:           honeypot,
+		captchaFailOpen:    captchaFailOpen,
+		successURL:         successURL,
+		errorURL:           errorURL,
+		supportEmail:       supportEmail,
+		secretPaths:        secretPaths,
+		exportTZ:           exportTZ,
+		signatures:         newRequestSignatures(),
+		downloads:          newDownloadLinks([]byte(downloadSecret), downloadTTL),
+		logger:             logger,
+		mailProvider:       provider,
+		reporter:           reporting.Noop{},
+	}
+	if welcomeEmail {
+		app.welcomeDelay = welcomeDelay
+	}
+	if digestEnabled {
+		app.digestInterval = digestInterval
+	}
+	app.deleteRetention = deleteRetention
+	host, _ := os.Hostname()
+	app.replica = host + "/" + uuid.NewString()
+	if powDifficulty > 0 {
+		app.pow = pow.New([]byte(powSecret), powDifficulty, powTTL)
+	}
+	if captchaEnabled {
+		app.captcha = captcha.NewTurnstile(turnstileSecret)
+	}
+	if sentryDSN != "" {
+		if app.reporter, err = reporting.NewSentry(sentryDSN, nil); err != nil {
+			panic(fmt.Sprintf("UNLEAKTRADE_SENTRY_DSN: %v", err))
+		}
+	}
+	if geoIPDB != "" {
+		// the activations are not failed for a missing database, only not located
+		if db, err := geoip.Open(geoIPDB); err != nil {
+			logger.Warn("⚠️ cannot open the GeoIP database, activations not located", "path", geoIPDB, slog.Any("error", err))
+		} else {
+			logger.Info("🌍 activations located", "path", geoIPDB)
+			app.geo = db
+		}
+	}
+	if exportBucket != "" {
+		app.exports = db
+		app.uploader = storage.NewS3(session.Must(session.NewSession()), exportBucket, exportPrefix, exportKMSKey)
+		app.exportURLTTL = exportURLTTL
+	}
+	if enumSlowAfter > 0 || enumBlockAfter > 0 {
+		app.enumeration = newEnumerationGuard(enumSlowAfter, enumBlockAfter, enumMaxDelay, enumWindow)
+	}
+	if pendingTTL > 0 {
+		app.pending = cache.NewOf[registration](cache.WithTTL(pendingTTL))
 	}
+	if snsRPCURL != "" {
+		app.resolver = data.NewSNS(snsRPCURL, snsCacheTTL)
+	}
+	if ownershipProof {
+		app.ownership = newOwnershipProofs(ownershipNonceTTL)
+	}
+	if len(openWindows) > 0 {
+		app.schedule = newSchedule(openWindows, activationGrace)
+	}
+	for _, a := range genesisSponsors {
+		app.genesis[a] = true
+	}
+	if disposableCheck {
+		bl := data.NewBlocklist(disposableDomains...)
+		if disposableURL != "" {
+			if n, err := bl.Refresh(disposableURL); err != nil {
+				logger.Warn("⚠️ cannot refresh disposable domains", "url", disposableURL, slog.Any("error", err))
+			} else {
+				logger.Info("🗑️ disposable domains loaded", "count", n, "url", disposableURL)
+			}
+		}
+		logger.Info("🚫 disposable emails blocked", "domains", bl.Len())
+		app.blocklist = bl
+	}
+	if r, ok := m.(mailer.Recorder); ok {
+		app.recorder = r
+	}
+	app.dispatcher = mailer.NewDispatcher(mailWorkers, mailQueueSize, &app.wg)
+	if len(webhookURLs) > 0 {
+		if app.webhooks, err = webhook.New(webhookURLs, webhookSecret, app.dispatcher); err != nil {
+			panic(err)
+		}
+	}
+	app.sinks = map[string]events.Sink{}
+	if eventsARN != "" {
+		if app.sinks[mailer.SinkAWS], err = events.NewAWS(session.Must(session.NewSession()), eventsARN); err != nil {
+			panic(err)
+		}
+	}
+	if natsURL != "" {
+		if app.sinks["nats"], err = events.NewNATS(natsURL, natsSubject); err != nil {
+			panic(err)
+		}
+	}
+	if kafkaBrokers != nil {
+		app.sinks["kafka"] = events.NewKafka(events.NewKafkaWriter(kafkaBrokers, kafkaTopic))
+	}
+	for name, s := range app.sinks {
+		app.outbox.WithSink(name, s)
+	}
+	reg.GaugeFunc("waitlist_mail_queue_depth", "Emails waiting for a mail worker", func() float64 {
+		return float64(app.dispatcher.Len())
+	})
+	app.registerCacheMetrics()
+	app.registerLimiterMetrics()
+	return app
+}
+
+// registerCacheMetrics exposes the check-wallet cache usage, read from app.c at scrape time.
+func (app *App) registerCacheMetrics() {
+	stats := func() cache.Stats {
+		if app.c == nil { // not loaded yet
+			return cache.Stats{}
+		}
+		return app.c.Stats()
+	}
+	app.metrics.GaugeFunc("waitlist_cache_size", "Wallets in the check-wallet cache", func() float64 {
+		return float64(stats().Size)
+	})
+	app.metrics.CounterFunc("waitlist_cache_hits_total", "Check-wallet cache hits", func() float64 {
+		return float64(stats().Hits)
+	})
+	app.metrics.CounterFunc("waitlist_cache_misses_total", "Check-wallet cache misses", func() float64 {
+		return float64(stats().Misses)
+	})
+}
+
+// StartBackground runs the periodic tasks of the app, each one tracked by app.wg,
+// until ctx is done or Shutdown stops them.
+func (app *App) StartBackground(ctx context.Context) {
+	ctx, app.stop = context.WithCancel(ctx)
+	app.background(ctx, func(ctx context.Context) { app.runLimiterCleanup(ctx, app.every.limiterCleanup) })
+	app.background(ctx, func(ctx context.Context) { app.runCacheRefresher(ctx, app.every.cacheRefresh) })
+	app.background(ctx, app.outbox.Run)
+	if app.digestInterval > 0 {
+		app.background(ctx, func(ctx context.Context) { app.runDigests(ctx, app.every.digestCheck) })
+	}
+	if app.uploader != nil {
+		app.background(ctx, func(ctx context.Context) { app.runExports(ctx, app.every.exportCheck) })
+	}
+	if app.deleteRetention > 0 {
+		app.background(ctx, func(ctx context.Context) { app.runPurges(ctx, app.every.purgeCheck) })
+	}
+}
+
+// background runs f with ctx in a goroutine tracked by app.wg.
+func (app *App) background(ctx context.Context, f func(context.Context)) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		f(ctx)
+	}()
+}
+
+// Shutdown stops app.srv, then the background tasks, then saves the snapshots, all before ctx is done.
+// The in-flight requests complete first, so the emails they submit are drained with the queued ones.
+// It returns the number of background tasks abandoned at the deadline.
+func (app *App) Shutdown(ctx context.Context) int {
+	var servers sync.WaitGroup
+	for name, s := range map[string]*server{"public": app.srv, "admin": app.adminSrv} {
+		if s == nil {
+			continue
+		}
+		servers.Go(func() {
+			if err := s.Shutdown(ctx); err != nil {
+				// Error from closing listeners, or context timeout:
+				app.logger.Warn("⚠️ HTTP server shutdown", "listener", name, slog.Any("error", err))
+			}
+		})
+	}
+	servers.Wait()
+
+	if app.stop != nil {
+		app.stop() // stop background workers
+	}
+	app.logger.Info("⏳ waiting the end of all go-routines")
+	abandoned := app.dispatcher.Shutdown(ctx) // no more emails, queued ones are drained until the deadline
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait() // wait for all go-routines
+		close(done)
+	}()
+	select {
+	case <-done:
+		app.logger.Info("👍 go-routines are over")
+	case <-ctx.Done():
+		app.logger.Warn("⚠️ go-routines still running", slog.Any("error", ctx.Err()))
+	}
+	if len(abandoned) > 0 {
+		app.logger.Warn("🪦 background tasks abandoned", "count", len(abandoned), "tasks", strings.Join(abandoned, ", "))
+	}
+
+	for name, s := range app.sinks {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				app.logger.Warn("⚠️ cannot close the events sink", "sink", name, slog.Any("error", err))
+			}
+		}
+	}
+
+	if cacheSnapshot != "" {
+		if err := app.snapshotCache(cacheSnapshot); err != nil {
+			app.logger.Warn("⚠️ cannot write cache snapshot", "path", cacheSnapshot, slog.Any("error", err))
+		} else {
+			app.logger.Info("💾 cache saved", "path", cacheSnapshot)
+		}
+	}
+	if limiterSnapshot != "" {
+		if err := app.snapshotLimiters(limiterSnapshot); err != nil {
+			app.logger.Warn("⚠️ cannot write limiter snapshots", "dir", limiterSnapshot, slog.Any("error", err))
+		} else {
+			app.logger.Info("💾 rate limiters saved", "dir", limiterSnapshot)
+		}
+	}
+	return len(abandoned)
 }
 
 func main() {
 	setup()
+	stopTracing := func(context.Context) error { return nil }
+	if tracing.Enabled() {
+		var err error
+		if stopTracing, err = tracing.Setup(context.Background(), tracingService); err != nil {
+			panic(err)
+		}
+		logger.Info("🔭 traces exported over OTLP")
+	}
 	app := newApp()
+	app.loadMaintenance()
 	app.initCache()
-	r := setupRouter(app)
+	if limiterSnapshot != "" {
+		app.restoreLimiters(limiterSnapshot)
+	}
+	routes := allRoutes
+	if adminAddr != "" {
+		routes = publicRoutes // the admin routes served on their own listener
+	}
+	r := newRouter(app, routes)
 
 	var addr string
-	if p := os.Getenv("PORT"); p != "" {
+	switch p := os.Getenv("PORT"); {
+	case p != "":
 		addr = ":" + p
-	} else {
+	case tlsCertFile != "" || autocertHosts != nil:
+		addr = ":443" // default HTTPS port
+	default:
 		addr = ":8080" // default port
 	}
 
-	srv := &http.Server{
-		Addr:           addr,
-		Handler:        r,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   20 * time.Second,
-		IdleTimeout:    time.Minute,
-		MaxHeaderBytes: 1 << 20, // 1 MB
+	srv := newServer(addr, r)
+	// the slow routes time out by themselves, before the connection is closed
+	srv.srv.WriteTimeout = max(srv.srv.WriteTimeout, slowTimeout+5*time.Second)
+	switch {
+	case tlsCertFile != "":
+		srv.withCert(tlsCertFile, tlsKeyFile)
+	case autocertHosts != nil:
+		srv.withAutocert(autocertHosts, autocertCacheDir, autocertHTTPAddr)
+	}
+
+	app.srv = srv
+	if adminAddr != "" {
+		app.adminSrv = newServer(adminAddr, newRouter(app, adminRoutes))
+		app.adminSrv.srv.WriteTimeout = srv.srv.WriteTimeout
 	}
+	app.StartBackground(context.Background())
 
 	idleConnsClosed := make(chan struct{})
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 		s := <-quit
-		log.Printf("🚨 Shutdown signal \"%v\" received\n", s)
+		logger.Info("🚨 shutdown signal received", "signal", s.String())
 
-		log.Printf("🚦 Here we go for a graceful Shutdown...\n")
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(ctx); err != nil {
-			// Error from closing listeners, or context timeout:
-			log.Printf("⚠️ HTTP server Shutdown: %v", err)
+		logger.Info("🚦 here we go for a graceful shutdown")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		app.Shutdown(ctx)
+		cancel()
+		ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := stopTracing(ctx); err != nil {
+			logger.Warn("⚠️ cannot flush the traces", slog.Any("error", err))
 		}
-
-		log.Printf("⏳ Waiting the end of all go-routines...")
-		app.wg.Wait() // wait for all go-routines
-		log.Printf("👍 go-routines are over")
-		close(idleConnsClosed)
-	}()
-
-	go func() { // every 5 minutes, purge the rate limiters older than 10 minutes
-		for {
-			time.Sleep(5 * time.Minute)
-			app.rl.Cleanup(10 * time.Minute)
+		cancel()
+		if s, ok := app.reporter.(*reporting.Sentry); ok && !s.Flush(shutdownTimeout) {
+			logger.Warn("⚠️ cannot flush the error reports")
 		}
+		close(idleConnsClosed)
 	}()
 
-	log.Printf("✅ Listening and serving HTTP on %s\n", addr)
+	if app.adminSrv != nil {
+		go func() {
+			logger.Info("✅ listening and serving the admin routes", "scheme", app.adminSrv.scheme(), "addr", adminAddr)
+			if err := app.adminSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("👹 admin HTTP server ListenAndServe", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}()
+	}
+	logger.Info("✅ listening and serving", "scheme", srv.scheme(), "addr", addr)
 	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("👹 HTTP server ListenAndServe: %v", err)
+		logger.Error("👹 HTTP server ListenAndServe", slog.Any("error", err))
+		os.Exit(1)
 	}
 
 	<-idleConnsClosed
-	log.Printf("😴 Server stopped")
+	logger.Info("😴 server stopped")
 }
@@ -1,7 +1,33 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/cache"
+	"github.com/unleaktrade/waitlist/internal/crypto"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/limiter"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+	"github.com/unleaktrade/waitlist/internal/metrics"
 )
 
 func TestSetup(t *testing.T) {
@@ -11,8 +37,14 @@ func TestSetup(t *testing.T) {
 	t.Setenv("UNLEAKTRADE_API_SECURE_PATH1", p1)
 	t.Setenv("UNLEAKTRADE_API_SECURE_PATH2", p2)
 	t.Setenv("UNLEAKTRADE_WAITLIST_API_KEY", ak)
+	t.Setenv("UNLEAKTRADE_ENV", "")
+	defer gin.SetMode(gin.Mode())
 
 	setup()
+	if gin.Mode() != gin.ReleaseMode || exposeToken {
+		t.Errorf("gin must run in release mode without exposing the tokens by default, got %s", gin.Mode())
+		t.FailNow()
+	}
 	if tableName != tn {
 		t.Errorf("wrong table name, got %s, want %s", tableName, tn)
 		t.FailNow()
@@ -29,11 +61,149 @@ func TestSetup(t *testing.T) {
 		t.Errorf("wrong secure path #2, got %s, want %s", secpath2, p2)
 		t.FailNow()
 	}
-	if apiKey != ak {
-		t.Errorf("wrong api key, got %s, want %s", apiKey, ak)
+	if len(apiKeys) != 1 || len(apiKeys[ak].Scopes) != len(allScopes) {
+		t.Errorf("wrong api keys, got %v, want %s with all scopes", apiKeys, ak)
+		t.FailNow()
+	}
+	if audience != crypto.DefaultAudience {
+		t.Errorf("wrong audience, got %s, want %s", audience, crypto.DefaultAudience)
+		t.FailNow()
+	}
+
+	aud := "waitlist-prod"
+	t.Setenv("UNLEAKTRADE_JWT_AUDIENCE", aud)
+	setup()
+	if audience != aud {
+		t.Errorf("wrong audience, got %s, want %s", audience, aud)
+		t.FailNow()
+	}
+	for n, j := range jwts {
+		if j.Audience() != aud {
+			t.Errorf("wrong audience for %s, got %s, want %s", n, j.Audience(), aud)
+			t.FailNow()
+		}
+	}
+	audience = crypto.DefaultAudience
+
+	// replicas sharing the signing key, which activate the tokens of each other
+	pvk, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(pvk)
+	t.Setenv("UNLEAKTRADE_JWT_ES256_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})))
+	setup()
+	fp := jwts["ES256"].Fingerprint()
+	setup()
+	if jwts["ES256"].Fingerprint() != fp {
+		t.Errorf("the replicas sharing their key must have the same fingerprint, got %s and %s", fp, jwts["ES256"].Fingerprint())
+		t.FailNow()
+	}
+	t.Setenv("UNLEAKTRADE_JWT_ES256_KEY", "")
+	setup()
+	if jwts["ES256"].Fingerprint() == fp {
+		t.Errorf("a generated key must have another fingerprint, got %s", fp)
+		t.FailNow()
+	}
+
+	t.Setenv("UNLEAKTRADE_ENV", "dev")
+	setup()
+	if gin.Mode() != gin.DebugMode || exposeToken {
+		t.Errorf("gin must run in debug mode in dev, still without exposing the tokens, got %s", gin.Mode())
+		t.FailNow()
+	}
+	t.Setenv("UNLEAKTRADE_ENV", "")
+
+	g := "BDHCyVLMrJbPriFaopTzNFeHBqhtCQUUgnC3aBK5gNrq"
+	t.Setenv("UNLEAKTRADE_GENESIS_SPONSORS", g+", "+sponsor)
+	setup()
+	if len(genesisSponsors) != 2 || genesisSponsors[0] != g || genesisSponsors[1] != sponsor {
+		t.Errorf("wrong genesis sponsors, got %v", genesisSponsors)
+		t.FailNow()
+	}
+	t.Setenv("UNLEAKTRADE_GENESIS_SPONSORS", "")
+	setup()
+
+	arn := "arn:aws:kms:eu-west-3:111122223333:key/test"
+	t.Setenv("UNLEAKTRADE_ENCRYPTION_KEY", "") // optional with KMS
+	t.Setenv("UNLEAKTRADE_KMS_KEY_ARN", arn)
+	setup()
+	if kmsKeyARN != arn || ek != "" {
+		t.Errorf("wrong KMS key, got %q (encryption key %q), want %q", kmsKeyARN, ek, arn)
+		t.FailNow()
+	}
+	t.Setenv("UNLEAKTRADE_KMS_KEY_ARN", "")
+	t.Setenv("UNLEAKTRADE_ENCRYPTION_KEY", k)
+	setup()
+
+	// the settings disabled by 0
+	defer func(l int) { referralLimit = l }(referralLimit)
+	t.Setenv("UNLEAKTRADE_REFERRAL_LIMIT", "0")
+	t.Setenv("UNLEAKTRADE_WAITLIST_CAP", "0")
+	setup()
+	if referralLimit != 0 || waitlistCap != 0 {
+		t.Errorf("the referral limit and the cap must be disabled by 0, got %d and %d", referralLimit, waitlistCap)
+		t.FailNow()
+	}
+	defer func(s, b int) { enumSlowAfter, enumBlockAfter = s, b }(enumSlowAfter, enumBlockAfter)
+	t.Setenv("UNLEAKTRADE_ENUMERATION_SLOW_AFTER", "0")
+	t.Setenv("UNLEAKTRADE_ENUMERATION_BLOCK_AFTER", "0")
+	setup()
+	if enumSlowAfter != 0 || enumBlockAfter != 0 {
+		t.Errorf("the enumeration guard must be disabled by 0, got %d and %d", enumSlowAfter, enumBlockAfter)
+		t.FailNow()
+	}
+	defer func(f, s time.Duration) { fastTimeout, slowTimeout = f, s }(fastTimeout, slowTimeout)
+	t.Setenv("UNLEAKTRADE_FAST_TIMEOUT", "0")
+	t.Setenv("UNLEAKTRADE_SLOW_TIMEOUT", "0s")
+	setup()
+	if fastTimeout != 0 || slowTimeout != 0 {
+		t.Errorf("the request timeouts must be disabled by 0, got %v and %v", fastTimeout, slowTimeout)
+		t.FailNow()
+	}
+}
+
+func TestIntEnv(t *testing.T) {
+	t.Setenv("UNLEAKTRADE_REFERRAL_LIMIT", "0")
+	if i := nonNegativeIntEnv("UNLEAKTRADE_REFERRAL_LIMIT", 50); i != 0 {
+		t.Errorf("0 must be accepted, got %d", i)
 		t.FailNow()
 	}
+	for _, tc := range []struct {
+		name string
+		f    func(string, int) int
+		v    string
+	}{
+		{"zero", intEnv, "0"},
+		{"negative", nonNegativeIntEnv, "-1"},
+		{"not a number", nonNegativeIntEnv, "many"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("UNLEAKTRADE_REFERRAL_LIMIT", tc.v)
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q must fail the startup", tc.v)
+				}
+			}()
+			tc.f("UNLEAKTRADE_REFERRAL_LIMIT", 50)
+		})
+	}
+}
 
+func TestLocationEnv(t *testing.T) {
+	if l := locationEnv("UNLEAKTRADE_EXPORT_TZ", time.UTC); l != time.UTC {
+		t.Errorf("the default time zone must be UTC, got %v", l)
+		t.FailNow()
+	}
+	t.Setenv("UNLEAKTRADE_EXPORT_TZ", "Europe/Paris")
+	if l := locationEnv("UNLEAKTRADE_EXPORT_TZ", time.UTC); l.String() != "Europe/Paris" {
+		t.Errorf("incorrect time zone, got %v", l)
+		t.FailNow()
+	}
+	t.Setenv("UNLEAKTRADE_EXPORT_TZ", "Mars/Olympus_Mons")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("an invalid time zone must fail the startup")
+		}
+	}()
+	locationEnv("UNLEAKTRADE_EXPORT_TZ", time.UTC)
 }
 
 func TestNewApp(t *testing.T) {
@@ -43,6 +213,7 @@ func TestNewApp(t *testing.T) {
 	t.Setenv("UNLEAKTRADE_API_SECURE_PATH1", p1)
 	t.Setenv("UNLEAKTRADE_API_SECURE_PATH2", p2)
 	t.Setenv("UNLEAKTRADE_WAITLIST_API_KEY", ak)
+	t.Setenv("UNLEAKTRADE_DDB_CHECK", "false")
 	setup()
 	app := newApp()
 	if app == nil {
@@ -50,3 +221,287 @@ func TestNewApp(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestNewAppMemoryDB(t *testing.T) {
+	t.Setenv("UNLEAKTRADE_DB_DRIVER", "memory")
+	t.Setenv("UNLEAKTRADE_ENCRYPTION_KEY", "") // generated by the memory DB
+	t.Setenv("UNLEAKTRADE_API_SECURE_PATH1", "p4th1")
+	t.Setenv("UNLEAKTRADE_API_SECURE_PATH2", "p4th2")
+	t.Setenv("UNLEAKTRADE_WAITLIST_API_KEY", "test-api-key")
+	setup()
+	app := newApp()
+	u := data.NewUser("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "john.doe@mailservice.com", sponsor)
+	if err := app.db.Save(u); err != nil {
+		t.Errorf("cannot save in the memory DB: %v", err)
+		t.FailNow()
+	}
+	if got, _ := app.db.Get(u.Address); got == nil || got.Email != u.Email {
+		t.Errorf("the saved user must be found, got %v", got)
+		t.FailNow()
+	}
+}
+
+func TestNewAppSlidingWindow(t *testing.T) {
+	t.Setenv("UNLEAKTRADE_DB_DRIVER", "memory")
+	t.Setenv("UNLEAKTRADE_ENCRYPTION_KEY", "")
+	t.Setenv("UNLEAKTRADE_API_SECURE_PATH1", "p4th1")
+	t.Setenv("UNLEAKTRADE_API_SECURE_PATH2", "p4th2")
+	t.Setenv("UNLEAKTRADE_WAITLIST_API_KEY", "test-api-key")
+	t.Setenv("UNLEAKTRADE_RATE_LIMITER", "sliding_window")
+	t.Setenv("UNLEAKTRADE_RATE_LIMIT_PER_MINUTE", "2")
+	t.Cleanup(func() { rateLimiter = "token_bucket" })
+	setup()
+	app := newApp()
+	if _, ok := app.rl.(*limiter.SlidingWindow); !ok {
+		t.Errorf("incorrect limiter, got %T", app.rl)
+		t.FailNow()
+	}
+	for i, want := range []bool{true, true, false} {
+		if ok := app.rl.GetAccess("10.10.10.10").Allow(); ok != want {
+			t.Errorf("incorrect access %d, got %v, want %v", i, ok, want)
+			t.FailNow()
+		}
+	}
+}
+
+// changingDB lists the users set by the test, other methods are those of data.MockDB.
+type changingDB struct {
+	data.DB
+	mu    sync.Mutex
+	users []*data.User
+}
+
+func (db *changingDB) set(addresses ...string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.users = nil
+	for _, a := range addresses {
+		db.users = append(db.users, &data.User{Address: a, Timestamp: time.Now().UnixMilli()})
+	}
+}
+
+func (db *changingDB) List(options ...int) ([]*data.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.users, nil
+}
+
+func (db *changingDB) ListAddresses() (map[string]int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	m := map[string]int64{}
+	for _, u := range db.users {
+		m[u.Address] = u.Timestamp
+	}
+	return m, nil
+}
+
+func TestCacheRefresher(t *testing.T) {
+	db := &changingDB{DB: data.MockDB}
+	db.set("a", "b")
+	app := &App{db: db, logger: slog.Default()}
+	app.initCache()
+
+	db.set("b", "c") // activated on another replica
+	app.refreshCache()
+	if app.c.IsPresent("a") || !app.c.IsPresent("b") || !app.c.IsPresent("c") {
+		t.Errorf("cache must match the DB after a refresh")
+		t.FailNow()
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.runCacheRefresher(ctx, 5*time.Millisecond)
+	}()
+	db.set("c", "d")
+	for i := 0; i < 100 && !app.c.IsPresent("d"); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+	app.wg.Wait()
+	if !app.c.IsPresent("d") || app.c.IsPresent("b") {
+		t.Errorf("cache must converge to the DB content")
+		t.FailNow()
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	db := &changingDB{DB: data.MockDB}
+	db.set("a", "b")
+	app := &App{db: db, logger: slog.Default()}
+	app.initCache()
+	if err := app.snapshotCache(path); err != nil {
+		t.Errorf("cannot write snapshot: %v", err)
+		t.FailNow()
+	}
+
+	db.set("b", "c")
+	restored := &App{db: db, c: cache.New(), logger: slog.Default()}
+	if !restored.restoreCache(path, time.Hour) {
+		t.Errorf("a fresh snapshot must be restored")
+		t.FailNow()
+	}
+	if !restored.c.IsPresent("a") || restored.c.IsPresent("c") {
+		t.Errorf("restored cache must match the snapshot")
+		t.FailNow()
+	}
+	if restored.restoreCache(path, 0) {
+		t.Errorf("a snapshot older than the max age must be ignored")
+		t.FailNow()
+	}
+
+	if err := os.WriteFile(path, []byte("corrupted"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fallback := &App{db: db, logger: slog.Default()}
+	fallback.initCache() // no snapshot configured
+	if restored.restoreCache(path, time.Hour) {
+		t.Errorf("a corrupted snapshot must be ignored")
+		t.FailNow()
+	}
+	if !fallback.c.IsPresent("c") || fallback.c.IsPresent("a") {
+		t.Errorf("cache must be loaded from the DB without snapshot")
+		t.FailNow()
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var buf bytes.Buffer
+	app := &App{metrics: metrics.NewRegistry(), logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+	app.dispatcher = mailer.NewDispatcher(1, 10, &app.wg)
+	release := make(chan struct{})
+	defer close(release)
+	slow := func() error { <-release; return nil } // mailer never answering in time
+	app.sendEmail(context.Background(), mailer.TemplateActivation, slow)
+	app.sendEmail(context.Background(), mailer.TemplateConfirmation, slow)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(l.Addr().String(), http.NotFoundHandler())
+	go srv.Serve(l)
+
+	const timeout = 200 * time.Millisecond
+	app.srv = srv
+	ctx, stop := context.WithCancel(context.Background())
+	app.stop = stop
+	app.background(ctx, func(ctx context.Context) { <-ctx.Done() })
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	n := app.Shutdown(ctx)
+	if d := time.Since(start); d > timeout+300*time.Millisecond {
+		t.Errorf("shutdown must be bounded by its timeout, took %v", d)
+		t.FailNow()
+	}
+	if n != 2 {
+		t.Errorf("incorrect number of abandoned tasks, got %d, want 2", n)
+		t.FailNow()
+	}
+	var rec struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+		Count int    `json:"count"`
+		Tasks string `json:"tasks"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if json.Unmarshal([]byte(line), &rec) == nil && rec.Count > 0 {
+			break
+		}
+	}
+	if rec.Level != "WARN" || rec.Count != 2 || !strings.Contains(rec.Tasks, "activation email") {
+		t.Errorf("abandoned tasks must be logged, got %q", buf.String())
+		t.FailNow()
+	}
+}
+
+func TestDegradedStartup(t *testing.T) {
+	sponsor, a := solana.NewWallet().PublicKey().String(), solana.NewWallet().PublicKey().String()
+	newDB := func(failures int) data.DB {
+		db := data.NewMockDBContent([]string{sponsor, a})
+		for i := 1; i <= failures; i++ {
+			db.FailNth("ListAddresses", i, nil)
+		}
+		return db
+	}
+	ready := func(app *App) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ready", nil)
+		addAPIKey(req)
+		setupRouter(app).ServeHTTP(w, req)
+		var r struct{ Status, Cache string }
+		json.Unmarshal(w.Body.Bytes(), &r)
+		return r.Status + "/" + r.Cache
+	}
+
+	app := newTestApp(newDB(2))
+	app.cacheWarmup = time.Second
+	app.initCache()
+	if app.degraded.Load() || !app.c.IsPresent(a) || ready(app) != "ok/ok" {
+		t.Errorf("the cache must be loaded once the DB is back within the warm-up, got %s", ready(app))
+		t.FailNow()
+	}
+
+	app = newTestApp(newDB(3))
+	app.initCache() // no retry without warm-up
+	if !app.degraded.Load() || ready(app) != "degraded/degraded" {
+		t.Errorf("the server must come up degraded, got %s", ready(app))
+		t.FailNow()
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/check-wallet/"+a, nil)
+	addAPIKey(req)
+	setupRouter(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"position":0`) {
+		t.Errorf("check-wallet must fall through to the DB while degraded, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go app.runCacheRefresher(ctx, time.Millisecond)
+	for i := 0; i < 100 && app.degraded.Load(); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ready(app) != "ok/ok" || !app.c.IsPresent(sponsor) {
+		t.Errorf("the server must report ready once the cache is refreshed, got %s", ready(app))
+		t.FailNow()
+	}
+}
+
+func TestStartBackground(t *testing.T) {
+	db := &changingDB{DB: data.MockDB}
+	db.set("a")
+	app := newTestApp(db)
+	app.every = periods{time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond}
+	app.deleteRetention = time.Hour
+	app.digestInterval = time.Hour
+
+	app.StartBackground(context.Background())
+	db.set("a", "b")
+	for i := 0; i < 100 && !app.c.IsPresent("b"); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !app.c.IsPresent("b") {
+		t.Errorf("the cache must be refreshed in the background")
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if n := app.Shutdown(ctx); n != 0 || ctx.Err() != nil {
+		t.Errorf("the background tasks must stop on shutdown, got %d abandoned after %v", n, time.Since(start))
+		t.FailNow()
+	}
+	db.set("c")
+	time.Sleep(10 * time.Millisecond)
+	if app.c.IsPresent("c") {
+		t.Errorf("the cache must not be refreshed once stopped")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// maintenanceRetryAfter is the Retry-After of the requests refused during a maintenance.
+const maintenanceRetryAfter = 5 * time.Minute
+
+const defaultMaintenanceMessage = "service under maintenance, please retry later"
+
+// maintenanceKey is the context key of the requests refused by the maintenance, not reported as errors.
+const maintenanceKey = "maintenance"
+
+type maintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Message string `json:"message" binding:"max=200"`
+}
+
+// inMaintenance returns the maintenance in progress, false when serving.
+func (app *App) inMaintenance() (data.Maintenance, bool) {
+	m := app.maintenance.Load()
+	if m == nil || !m.Enabled {
+		return data.Maintenance{}, false
+	}
+	return *m, true
+}
+
+// setMaintenance turns the maintenance mode on or off, persisted first when it must survive the restarts.
+func (app *App) setMaintenance(c *gin.Context) {
+	var req maintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	m := data.Maintenance{Enabled: *req.Enabled, Since: time.Now().UnixMilli()}
+	if m.Enabled {
+		m.Message = req.Message
+	}
+	if app.persistMaintenance {
+		if err := app.dbOf(c.Request.Context()).SetMaintenance(m); err != nil {
+			app.failInternal(c, err)
+			return
+		}
+	}
+	app.maintenance.Store(&m)
+	app.logger.Info("🚧 maintenance mode changed", "enabled", m.Enabled, "message", m.Message, "by", requester(c))
+	c.JSON(http.StatusOK, m)
+}
+
+// requireService refuses the public requests with a 503 during a maintenance, the pages rendering its message.
+func (app *App) requireService(c *gin.Context) {
+	m, ok := app.inMaintenance()
+	if !ok {
+		c.Next()
+		return
+	}
+	msg := m.Message
+	if msg == "" {
+		msg = defaultMaintenanceMessage
+	}
+	c.Set(maintenanceKey, true)
+	c.Header("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+	if wantsHTML(c) {
+		app.render(c, http.StatusServiceUnavailable, page{Title: "Under maintenance", Message: msg})
+		return
+	}
+	app.fail(c, http.StatusServiceUnavailable, codeMaintenance, msg)
+}
+
+// loadMaintenance restores the maintenance mode persisted by a replica, kept as is when the DB cannot be read.
+func (app *App) loadMaintenance() {
+	if !app.persistMaintenance {
+		return
+	}
+	m, err := app.db.Maintenance()
+	if err != nil {
+		app.logger.Warn("⚠️ cannot load the maintenance mode", slog.Any("error", err))
+		return
+	}
+	if old := app.maintenance.Swap(&m); m.Enabled && (old == nil || !old.Enabled) {
+		app.logger.Info("🚧 in maintenance", "message", m.Message, "since", time.UnixMilli(m.Since).UTC())
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// serve sends the request to the router of app, with the API key.
+func serve(app *App, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	addAPIKey(req)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	setupRouter(app).ServeHTTP(w, req)
+	return w
+}
+
+func TestMaintenance(t *testing.T) {
+	app := newTestApp(data.NewMockDB())
+	wallet := "/check-wallet/" + solana.NewWallet().PublicKey().String()
+
+	w := serve(app, "POST", "/path1/path2/maintenance", `{"enabled":true,"message":"back at 14:00 UTC"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"enabled":true`) {
+		t.Errorf("the maintenance must be turned on, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	for _, path := range []string{"/status", "/challenge", wallet} {
+		w := serve(app, "GET", path, "")
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "300" || errorJSON(w) != `{"error":{"code":"maintenance","message":"back at 14:00 UTC"}}` {
+			t.Errorf("%s must be refused during the maintenance, got %d (Retry-After %q): %s", path, w.Code, w.Header().Get("Retry-After"), w.Body)
+			t.FailNow()
+		}
+	}
+	if w := serve(app, "GET", "/activate/token", "", "Accept", "text/html"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "back at 14:00 UTC") {
+		t.Errorf("the pages must show the maintenance message, got %d", w.Code)
+		t.FailNow()
+	}
+	for _, path := range []string{"/health", "/ready", "/path1/path2/cache"} {
+		if w := serve(app, "GET", path, ""); w.Code != http.StatusOK {
+			t.Errorf("%s must be served during the maintenance, got %d", path, w.Code)
+			t.FailNow()
+		}
+	}
+
+	if w := serve(app, "POST", "/path1/path2/maintenance", `{"message":"on"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("the mode must be given, got %d", w.Code)
+		t.FailNow()
+	}
+	if w := serve(app, "POST", "/path1/path2/maintenance", `{"enabled":false}`); w.Code != http.StatusOK {
+		t.Errorf("the maintenance must be turned off, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	for _, path := range []string{"/status", wallet} {
+		if w := serve(app, "GET", path, ""); w.Code == http.StatusServiceUnavailable {
+			t.Errorf("%s must be served after the maintenance, got %d", path, w.Code)
+			t.FailNow()
+		}
+	}
+}
+
+func TestMaintenancePersistence(t *testing.T) {
+	db := data.NewMockDB()
+	app := newTestApp(db)
+	app.persistMaintenance = true
+	if w := serve(app, "POST", "/path1/path2/maintenance", `{"enabled":true}`); w.Code != http.StatusOK {
+		t.Errorf("the maintenance must be turned on, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+
+	restarted := newTestApp(db)
+	restarted.loadMaintenance()
+	if _, ok := restarted.inMaintenance(); ok {
+		t.Errorf("the maintenance must not be restored unless persisted")
+		t.FailNow()
+	}
+	restarted.persistMaintenance = true
+	restarted.loadMaintenance()
+	if w := serve(restarted, "GET", "/status", ""); w.Code != http.StatusServiceUnavailable || errorJSON(w) != `{"error":{"code":"maintenance","message":"`+defaultMaintenanceMessage+`"}}` {
+		t.Errorf("a restarted replica must stay in maintenance, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+
+	db.FailOn("SetMaintenance", "")
+	if w := serve(restarted, "POST", "/path1/path2/maintenance", `{"enabled":false}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("the mode must not change unless persisted, got %d", w.Code)
+		t.FailNow()
+	}
+	if _, ok := restarted.inMaintenance(); !ok {
+		t.Errorf("the maintenance must go on when it cannot be turned off in DB")
+		t.FailNow()
+	}
+	if m, _ := data.NewMockDB().Maintenance(); m.Enabled {
+		t.Errorf("a new DB must not be in maintenance")
+		t.FailNow()
+	}
+}
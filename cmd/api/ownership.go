@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/cache"
+)
+
+// maxPendingNonces is the number of unexpired nonces kept per address, so requesting nonces for the
+// address of someone else does not invalidate the one being signed by its owner straight away.
+const maxPendingNonces = 5
+
+var (
+	errNoOwnershipNonce   = errors.New("ownership nonce missing or expired")
+	errOwnershipSignature = errors.New("invalid ownership signature")
+)
+
+// ownershipNonce is a message to sign with the key of a wallet, proving its ownership once before it expires.
+type ownershipNonce struct {
+	Message   string    `json:"message"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ownershipProofs keeps the nonces issued by address, in memory: the registration must reach the
+// replica that issued its nonce.
+type ownershipProofs struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending *cache.Cache[[]ownershipNonce]
+}
+
+func newOwnershipProofs(ttl time.Duration) *ownershipProofs {
+	return &ownershipProofs{ttl: ttl, now: time.Now, pending: cache.NewOf[[]ownershipNonce](cache.WithTTL(ttl))}
+}
+
+// live returns the unexpired nonces of address, the caller holding o.mu.
+func (o *ownershipProofs) live(address string) []ownershipNonce {
+	all, _ := o.pending.Get(address)
+	now := o.now()
+	nonces := make([]ownershipNonce, 0, len(all)+1)
+	for _, n := range all {
+		if now.Before(n.ExpiresAt) {
+			nonces = append(nonces, n)
+		}
+	}
+	return nonces
+}
+
+// issue returns a new nonce bound to address.
+func (o *ownershipProofs) issue(address string) ownershipNonce {
+	r := make([]byte, 16)
+	rand.Read(r)
+	exp := o.now().Add(o.ttl).Truncate(time.Second)
+	n := ownershipNonce{
+		Message:   fmt.Sprintf("unleak.trade waitlist\nWallet: %s\nNonce: %s\nExpires: %s", address, hex.EncodeToString(r), exp.UTC().Format(time.RFC3339)),
+		ExpiresAt: exp,
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	nonces := append(o.live(address), n)
+	if len(nonces) > maxPendingNonces {
+		nonces = nonces[len(nonces)-maxPendingNonces:]
+	}
+	o.pending.Add(address, nonces)
+	return n
+}
+
+// prove checks that signature, in base58, signs a pending nonce of address with its key, then burns the nonce.
+func (o *ownershipProofs) prove(address, signature string) error {
+	pk, err := solana.PublicKeyFromBase58(address)
+	if err != nil {
+		return errOwnershipSignature
+	}
+	sig, err := solana.SignatureFromBase58(signature)
+	if err != nil {
+		return errOwnershipSignature
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	nonces := o.live(address)
+	if len(nonces) == 0 {
+		return errNoOwnershipNonce
+	}
+	for i, n := range nonces {
+		if sig.Verify(pk, []byte(n.Message)) {
+			if nonces = append(nonces[:i], nonces[i+1:]...); len(nonces) == 0 {
+				o.pending.Remove(address)
+			} else {
+				o.pending.Add(address, nonces)
+			}
+			return nil
+		}
+	}
+	return errOwnershipSignature
+}
+
+// nonce issues the message to sign with the wallet's key before registering its address.
+func (app *App) nonce(c *gin.Context) {
+	if app.ownership == nil {
+		app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	var p struct {
+		Address string `uri:"address" json:"address" binding:"required,solana_addr"`
+	}
+	if err := c.ShouldBindUri(&p); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, app.ownership.issue(p.Address))
+}
+
+// owned returns whether r carries the signature of a nonce of its address, failing the request otherwise.
+func (app *App) owned(c *gin.Context, r *registerRequest) bool {
+	if app.ownership == nil {
+		return true
+	}
+	if r.Signature == "" {
+		app.fail(c, http.StatusBadRequest, codeOwnershipFailed, "signature required", fieldError{"signature", "required"})
+		return false
+	}
+	if err := app.ownership.prove(r.Address, r.Signature); err != nil {
+		app.fail(c, http.StatusBadRequest, codeOwnershipFailed, err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// page is the data of the page.html template.
+type page struct {
+	Title        string
+	Message      string
+	SupportEmail string
+}
+
+// reasonMessages explain the reasons of the failed activations to the users.
+var reasonMessages = map[string]string{
+	reasonInvalidToken:    "This activation link or code is invalid.",
+	reasonExpiredToken:    "This activation link has expired, please register again.",
+	reasonAlreadyUsed:     "This wallet address or email is already on the waitlist.",
+	reasonSponsorNotFound: "Your sponsor is not on the waitlist.",
+	reasonInvalidInvite:   "Your invite code is invalid, expired or already used.",
+	reasonReferralLimit:   "Your sponsor has no referral left.",
+	reasonWaitlistFull:    "The waitlist is full, thank you for your interest.",
+	reasonWaitlistClosed:  "The waitlist is closed, please come back at its next opening.",
+	reasonInternal:        "Something went wrong on our side, please try again later.",
+}
+
+// wantsHTML returns whether the client prefers HTML to JSON, JSON being the default.
+func wantsHTML(c *gin.Context) bool {
+	return c.NegotiateFormat(binding.MIMEJSON, binding.MIMEHTML) == binding.MIMEHTML
+}
+
+// render aborts c with the page p.
+func (app *App) render(c *gin.Context, status int, p page) {
+	p.SupportEmail = app.supportEmail
+	c.Header("Cache-Control", "no-store")
+	c.HTML(status, "page.html", p)
+	c.Abort()
+}
+
+// notFound responds to the unknown routes.
+func (app *App) notFound(c *gin.Context) {
+	if wantsHTML(c) {
+		app.render(c, http.StatusNotFound, page{Title: "Page not found", Message: "The page you are looking for does not exist."})
+		return
+	}
+	app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+}
+
+// activated responds to a successful activation of the activation page.
+func (app *App) activated(c *gin.Context, a activation) {
+	if !wantsHTML(c) {
+		c.JSON(a.status(), a)
+		return
+	}
+	app.render(c, http.StatusOK, page{
+		Title:   "You are on the waitlist",
+		Message: fmt.Sprintf("Wallet %s is activated, position %d in wave %d.", a.Address, a.Position, a.Wave),
+	})
+}
+
+// activationFailed responds to a failed activation of the activation page.
+func (app *App) activationFailed(c *gin.Context, f *activationFailure) {
+	if !wantsHTML(c) {
+		app.failActivation(c, f)
+		return
+	}
+	if f.err != nil {
+		app.logInternal(c, f.err)
+	}
+	app.render(c, f.status, page{Title: "Activation failed", Message: reasonMessages[f.reason]})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestNotFoundPage(t *testing.T) {
+	app := newTestApp(data.MockDB)
+	app.supportEmail = "support@unleak.trade"
+	r := setupRouter(app)
+	tt := []struct {
+		name   string
+		accept string
+		ctype  string
+		body   string
+	}{
+		{"browser", browserAccept, "text/html", "Page not found"},
+		{"JSON", "application/json", "application/json", `"code":"not_found"`},
+		{"JSON first", "application/json, text/html", "application/json", `"code":"not_found"`},
+		{"no accept", "", "application/json", `"code":"not_found"`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/n0where", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusNotFound {
+				t.Errorf("incorrect status, got %d, want %d", w.Code, http.StatusNotFound)
+				t.FailNow()
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.ctype) || !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("incorrect response, got %s %s, want %s with %s", ct, w.Body.String(), tc.ctype, tc.body)
+				t.FailNow()
+			}
+		})
+	}
+	t.Run("support email", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/n0where", nil)
+		req.Header.Set("Accept", browserAccept)
+		r.ServeHTTP(w, req)
+		if !strings.Contains(w.Body.String(), `href="mailto:support@unleak.trade"`) {
+			t.Errorf("the page must show the support email, got %s", w.Body.String())
+			t.FailNow()
+		}
+	})
+}
+
+func TestActivationResultPages(t *testing.T) {
+	app := newTestApp(data.NewMockDBContent([]string{sponsor}))
+	r := setupRouter(app)
+	address, other := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg"
+	tk, _ := app.jwt.Create(&data.User{Address: address, Email: "john.doe@mailservice.com", Sponsor: sponsor}, time.Now())
+	tk2, _ := app.jwt.Create(&data.User{Address: other, Email: "jane.doe@mailservice.com", Sponsor: sponsor}, time.Now()) // the first one is activated once
+	expired, _ := app.jwt.Create(&data.User{Address: address, Email: "john.doe@mailservice.com", Sponsor: sponsor}, time.Now().Add(-time.Hour))
+
+	tt := []struct {
+		name   string
+		token  string
+		accept string
+		status int
+		ctype  string
+		body   string
+	}{
+		{"success page", tk, browserAccept, http.StatusOK, "text/html", "Wallet " + address + " is activated"},
+		{"success JSON", tk2, "application/json", http.StatusCreated, "application/json", `"address":"` + other + `"`},
+		{"error page", expired, browserAccept, http.StatusGone, "text/html", "This activation link has expired"},
+		{"error JSON", expired, "application/json", http.StatusGone, "application/json", `"code":"activation_expired"`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/activate/"+tc.token, strings.NewReader(url.Values{"hash": {app.jwt.Hash(tc.token)}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Accept", tc.accept)
+			r.ServeHTTP(w, req)
+			if w.Code != tc.status {
+				t.Errorf("incorrect status, got %d, want %d", w.Code, tc.status)
+				t.FailNow()
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.ctype) || !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("incorrect response, got %s %s, want %s with %s", ct, w.Body.String(), tc.ctype, tc.body)
+				t.FailNow()
+			}
+		})
+	}
+}
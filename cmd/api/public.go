@@ -0,0 +1,65 @@
+package main
+
+import (
+	"cmp"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// PublicUser is a user as shown to the frontend and the partners: neither its email, encrypted once saved,
+// nor its UUID, the full record being listed with the PII or the client metadata only.
+type PublicUser struct {
+	Address      string `json:"address"`
+	Sponsor      string `json:"sponsor,omitempty"` // none for the genesis sponsors
+	RegisteredAt string `json:"registered_at"`     // RFC 3339, in UTC
+	Position     int    `json:"position"`          // by activation time, 0 when not cached yet
+}
+
+// newPublicUser returns the public user of address a, activated at ts in unix ms, at position p.
+func newPublicUser(a, sponsor string, ts int64, p int) PublicUser {
+	return PublicUser{a, sponsor, time.UnixMilli(ts).UTC().Format(time.RFC3339), p}
+}
+
+// positions returns the rank of every cached address by activation time, starting at 1, as position does.
+func (app *App) positions() map[string]int {
+	if app.degraded.Load() {
+		return map[string]int{}
+	}
+	type entry struct {
+		a  string
+		ts int64
+	}
+	var es []entry
+	app.c.Range(func(a string, ts int64) bool {
+		es = append(es, entry{a, ts})
+		return true
+	})
+	slices.SortFunc(es, func(x, y entry) int {
+		return cmp.Or(cmp.Compare(x.ts, y.ts), cmp.Compare(x.a, y.a))
+	})
+	p := make(map[string]int, len(es))
+	for i, e := range es {
+		p[e.a] = i + 1
+	}
+	return p
+}
+
+// publicUsers returns the public users of users, positioned by p.
+func publicUsers(users []*data.User, p map[string]int) []PublicUser {
+	l := make([]PublicUser, len(users))
+	for i, u := range users {
+		l[i] = newPublicUser(u.Address, u.Sponsor, u.Timestamp, p[u.Address])
+	}
+	return l
+}
+
+func writePublicListJSON(w io.Writer, users []PublicUser) error {
+	return writeJSON(w, gin.H{
+		"users": users,
+		"count": len(users),
+	})
+}
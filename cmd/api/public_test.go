@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestPublicList(t *testing.T) {
+	db := data.NewMockDBContent([]string{sponsor, solana.NewWallet().PublicKey().String(), solana.NewWallet().PublicKey().String()})
+	app := newTestApp(db)
+	users, _ := db.List()
+	for _, u := range users {
+		app.c.Add(u.Address, u.Timestamp)
+	}
+	r := setupRouter(app)
+	list := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/path1/path2/list"+query, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := list("")
+	var res struct {
+		Users []PublicUser
+		Count int
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || res.Count != len(users) || strings.Contains(w.Body.String(), `"uuid"`) {
+		t.Errorf("incorrect public list, got %d %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	positions := map[int]bool{}
+	for i, u := range res.Users {
+		p, _, _ := app.position(u.Address)
+		if ts, _ := app.c.Get(u.Address); u.Position != p || u.RegisteredAt != time.UnixMilli(ts).UTC().Format(time.RFC3339) {
+			t.Errorf("incorrect user %d, got %+v, want position %d", i, u, p)
+			t.FailNow()
+		}
+		positions[u.Position] = true
+	}
+	if len(positions) != len(users) || !positions[1] || !positions[len(users)] {
+		t.Errorf("every user must have its own position, got %+v", res.Users)
+		t.FailNow()
+	}
+
+	// the full records, for the admins
+	for _, q := range []string{"?include_pii=true", "?include_meta=true", "?mime=ndjson"} {
+		if w := list(q); !strings.Contains(w.Body.String(), `"uuid"`) {
+			t.Errorf("the list with %s must show the full records, got %s", q, w.Body)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPublicActivation(t *testing.T) {
+	app := newTestApp(data.NewMockDBContent([]string{sponsor}))
+	app.c.Add(sponsor, 1)
+	r := setupRouter(app)
+	address := solana.NewWallet().PublicKey().String()
+	w := activate(app, r, address)
+	var res map[string]any
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusCreated || len(res) != 5 || res["address"] != address || res["sponsor"] != sponsor || res["position"] != 2.0 || res["wave"] != 1.0 {
+		t.Errorf("the activation must show the public user, got %d %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if _, err := time.Parse(time.RFC3339, res["registered_at"].(string)); err != nil {
+		t.Errorf("the activation time must be in RFC 3339, got %v", res["registered_at"])
+		t.FailNow()
+	}
+	if u, _ := app.db.Get(address); u == nil || u.RegisteredAt == 0 || u.ActivatedAt < u.RegisteredAt || u.ActivatedAt != u.Timestamp {
+		t.Errorf("the user must be saved with its registration and activation times, got %+v", u)
+		t.FailNow()
+	}
+}
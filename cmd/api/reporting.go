@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/reporting"
+)
+
+// reportErrors reports the 5xx responses, with the last internal error of the request when logged by logInternal.
+// The requests refused by the maintenance mode are expected, not reported.
+func (app *App) reportErrors(c *gin.Context) {
+	c.Next()
+	if s := c.Writer.Status(); s >= 500 && !c.GetBool(maintenanceKey) {
+		err := fmt.Errorf("%d %s", s, http.StatusText(s))
+		if e := c.Errors.Last(); e != nil {
+			err = e.Err
+		}
+		app.report(c, err)
+	}
+}
+
+// recoverPanics logs the panics of the handlers with their stack, reported by reportErrors,
+// then fails with the internal error of the API unless the response is already written.
+// The middlewares and the handlers release their locks in defers, the panic leaves them consistent.
+func (app *App) recoverPanics(c *gin.Context) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		if v == http.ErrAbortHandler { // the client is gone, as net/http expects
+			panic(v)
+		}
+		err := fmt.Errorf("panic: %v", v)
+		_ = c.Error(err)
+		app.logger.Error("🔥 handler panicked", "method", c.Request.Method, "route", c.FullPath(), "request_id", c.GetString(requestIDHeader),
+			slog.Any("error", err), slog.String("stack", string(debug.Stack())))
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		app.fail(c, http.StatusInternalServerError, codeInternal, errInternal.Error())
+	}()
+	c.Next()
+}
+
+// report reports err, the internal error of the request c.
+func (app *App) report(c *gin.Context, err error) {
+	ctx := reporting.WithRequest(c.Request.Context(), c.Request, c.FullPath())
+	app.reporter.Report(ctx, err, map[string]string{
+		"method":     c.Request.Method,
+		"route":      c.FullPath(),
+		"status":     strconv.Itoa(c.Writer.Status()),
+		"request_id": c.GetString(requestIDHeader),
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/limiter"
+	"golang.org/x/time/rate"
+)
+
+// report is an error reported by a reporter, with its tags.
+type report struct {
+	err  error
+	tags map[string]string
+}
+
+// reports records the reported errors.
+type reports struct {
+	mu sync.Mutex
+	l  []report
+}
+
+func (r *reports) Report(_ context.Context, err error, tags map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.l = append(r.l, report{err, tags})
+}
+
+func TestReportErrors(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+	gin.SetMode(gin.DebugMode) // with /debug/panic
+	app := newTestApp(data.MockDB)
+	rs := &reports{}
+	app.reporter = rs
+	r := setupRouter(app)
+	boom := errors.New("boom")
+	r.GET("/boom", func(c *gin.Context) { app.failInternal(c, boom) })
+	r.GET("/unavailable", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+
+	tt := []struct {
+		path   string
+		status int
+		err    string
+	}{
+		{"/boom", http.StatusInternalServerError, "boom"},
+		{"/debug/panic", http.StatusInternalServerError, "panic: debug panic"},
+		{"/unavailable", http.StatusServiceUnavailable, "503 Service Unavailable"},
+		{"/status", http.StatusOK, ""},
+		{"/unknown", http.StatusNotFound, ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.path, func(t *testing.T) {
+			rs.l = nil
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tc.path, nil)
+			req.Header.Set(requestIDHeader, "req-1")
+			r.ServeHTTP(w, req)
+			if w.Code != tc.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.status, w.Body)
+				t.FailNow()
+			}
+			if tc.err == "" {
+				if len(rs.l) != 0 {
+					t.Errorf("only the 5xx responses must be reported, got %v", rs.l)
+					t.FailNow()
+				}
+				return
+			}
+			if len(rs.l) != 1 || rs.l[0].err.Error() != tc.err {
+				t.Errorf("the error must be reported once, got %v", rs.l)
+				t.FailNow()
+			}
+			if tags := rs.l[0].tags; tags["route"] != tc.path || tags["method"] != "GET" || tags["request_id"] != "req-1" || tags["status"] != strconv.Itoa(tc.status) {
+				t.Errorf("incorrect tags, got %v", tags)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+	gin.SetMode(gin.DebugMode) // with /debug/panic
+	var buf bytes.Buffer
+	app := newTestApp(data.MockDB)
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	app.rl = limiter.New(rate.Every(time.Minute), 2)
+	r := setupRouter(app)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/panic", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("a panic must fail with %d, got %d", http.StatusInternalServerError, w.Code)
+		t.FailNow()
+	}
+	var e errorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Error.Code != codeInternal || e.Error.Message != errInternal.Error() || e.RequestID != "req-1" {
+		t.Errorf("a panic must fail with the error envelope, got %s", w.Body)
+		t.FailNow()
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("a panic must fail in JSON, got %q", ct)
+		t.FailNow()
+	}
+	var logged bool
+	for _, rec := range records(t, &buf) {
+		if rec["msg"] == "🔥 handler panicked" {
+			logged = rec["request_id"] == "req-1" && rec["route"] == "/debug/panic" && strings.Contains(fmt.Sprint(rec["stack"]), "recoverPanics")
+		}
+	}
+	if !logged {
+		t.Errorf("the panic must be logged with its stack and request ID, got %s", buf.String())
+		t.FailNow()
+	}
+
+	// the limiter survived the panic, with the token of the panicking request consumed
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/status", nil)
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("request %d after the panic: got %d, want %d", i, w.Code, want)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// revisedDB bumps rev on every successful write of the users listed, so the list ETag changes with the edits
+// the cache does not reflect (email, anonymization, restoration), made by this replica.
+type revisedDB struct {
+	data.DB
+	rev *atomic.Uint64
+}
+
+// bump increments the revision when err is nil, and returns err.
+func (db revisedDB) bump(err error) error {
+	if err == nil {
+		db.rev.Add(1)
+	}
+	return err
+}
+
+func (db revisedDB) Save(u *data.User) error {
+	return db.bump(db.DB.Save(u))
+}
+
+func (db revisedDB) SaveBatch(users []*data.User) []error {
+	errs := db.DB.SaveBatch(users)
+	db.rev.Add(1) // some may be saved
+	return errs
+}
+
+func (db revisedDB) Delete(a string) error {
+	return db.bump(db.DB.Delete(a))
+}
+
+func (db revisedDB) Restore(a string) (*data.User, error) {
+	u, err := db.DB.Restore(a)
+	return u, db.bump(err)
+}
+
+func (db revisedDB) Anonymize(a string) (*data.User, error) {
+	u, err := db.DB.Anonymize(a)
+	return u, db.bump(err)
+}
+
+func (db revisedDB) UpdateEmail(a, e string) (*data.User, error) {
+	u, err := db.DB.UpdateEmail(a, e)
+	return u, db.bump(err)
+}
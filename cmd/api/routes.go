@@ -1,21 +1,37 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
 	"embed"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"github.com/unleaktrade/waitlist/internal/cache"
+	"github.com/unleaktrade/waitlist/internal/crypto"
 	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/events"
+	"github.com/unleaktrade/waitlist/internal/health"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+	"github.com/unleaktrade/waitlist/internal/tracing"
+	"github.com/unleaktrade/waitlist/internal/webhook"
 )
 
 //go:embed templates
@@ -24,16 +40,35 @@ var tfs embed.FS
 //go:embed swagger/swagger.json
 var swaggerFS embed.FS
 
+// routeSet selects the routes served by a listener.
+type routeSet int
+
+const (
+	publicRoutes routeSet = 1 << iota // registration, activation, check-wallet and health
+	adminRoutes                       // admin group, metrics and pprof, on a listener of its own
+	allRoutes    = publicRoutes | adminRoutes
+)
+
+// setupRouter returns the router of the single listener, serving all the routes but pprof.
 func setupRouter(app *App) *gin.Engine {
-	r := gin.Default()
-	r.Use(app.cors, app.limit)
+	return newRouter(app, allRoutes)
+}
+
+// newRouter returns the router of the routes, pprof being served by the admin listener only.
+func newRouter(app *App, routes routeSet) *gin.Engine {
+	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	r.Use(traceRequests()...)
+	r.Use(app.logRequests, app.reportErrors, app.recoverPanics, app.requestID, app.cors, app.limit)
+	r.NoRoute(app.notFound)
+	r.NoMethod(app.methodNotAllowed)
 	t := template.Must(template.ParseFS(tfs, "templates/*"))
 	r.SetHTMLTemplate(t)
 
 	r.GET("/openapi.json", func(c *gin.Context) {
 		b, err := swaggerFS.ReadFile("swagger/swagger.json")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "swagger spec not found"})
+			app.failInternal(c, err)
 			return
 		}
 		c.Data(http.StatusOK, "application/json; charset=utf-8", b)
@@ -45,147 +80,854 @@ func setupRouter(app *App) *gin.Engine {
 	r.GET("/", func(c *gin.Context) {
 		c.Redirect(http.StatusMovedPermanently, "/doc")
 	})
+	if gin.IsDebugging() {
+		// to check the recovery of the panics
+		r.GET("/debug/panic", func(c *gin.Context) {
+			panic("debug panic")
+		})
+	}
 
 	api := r.Group("/")
-	api.POST("/register", app.register)
-	api.POST("/activate/:token/:hash", app.activate)
+	if routes&publicRoutes != 0 {
+		public := api.Group("/", app.requireService)
+		public.GET("/status", app.status)
+		public.POST("/register", app.registerTimeout, app.requireOpen, limitBody(app.registerMaxBytes), app.optionalScope(scopeRegister), app.register)
+		public.GET("/challenge", app.challenge)
+		public.GET("/nonce/:address", app.nonce)
+		public.POST("/activate/:token/:hash", app.timeout(app.fastTimeout), app.requireOpen, app.activate)
+		public.GET("/activate/:token", app.requireOpenPage, app.activationPage)
+		public.POST("/activate/:token", app.requireOpenPage, app.activateForm)
+		public.GET("/unsubscribe/:token", app.unsubscribe)
+		public.GET("/download/:sig", app.timeout(app.slowTimeout), compress, app.downloadList) // the signature is the credential, for the browsers
+		public.POST("/unsubscribe/:token", app.unsubscribe)
+	}
 	protected := api.Group("/")
 	protected.Use(app.requireAPIKey)
-	protected.GET("/health", func(c *gin.Context) {
+	health := func(c *gin.Context) {
 		// Minimal, standard JSON health shape
 		c.JSON(http.StatusOK, gin.H{
 			"status": "ok",
 		})
-	})
-	protected.GET("/:path1/:path2/list", app.list)
-	protected.GET("/check-wallet/:address", app.checkWallet)
+	}
+	protected.GET("/health", health)
+	protected.HEAD("/health", health) // for the uptime monitors, the body being dropped
+	protected.GET("/ready", app.ready)
+	if routes&adminRoutes != 0 {
+		protected.GET("/metrics", app.metricsHandler)
+		admin := func(g *gin.RouterGroup) {
+			g.GET("/list", app.requireScope(scopeExport), app.timeout(app.slowTimeout), compress, app.list)
+			g.POST("/list/links", app.requireScope(scopeExport), app.listLink)
+			admin := app.requireScope(scopeAdmin)
+			g.GET("/emails", admin, app.emails)
+			g.GET("/cache", admin, app.cacheStats)
+			g.GET("/limits", admin, app.limits)
+			g.POST("/invites", admin, app.createInvite)
+			g.POST("/seed", admin, app.seed)
+			g.GET("/users/:address", admin, app.user)
+			g.GET("/users/:address/events", admin, app.events)
+			g.GET("/token/:token", admin, app.inspectToken)
+			g.PATCH("/users/:address", admin, app.updateEmail)
+			g.DELETE("/users/:address", admin, app.deleteUser)
+			g.POST("/users/:address/restore", admin, app.restoreUser)
+			g.GET("/tree/:address", admin, app.tree)
+			g.GET("/stats", admin, app.stats)
+			g.POST("/import", admin, app.importUsers)
+			g.POST("/digests", admin, app.digests)
+			g.POST("/maintenance", admin, app.setMaintenance)
+			export := app.requireScope(scopeExport)
+			g.POST("/exports", export, app.createExport)
+			g.GET("/exports/:id", export, app.export)
+			g.DELETE("/exports/:id", export, app.cancelExport)
+		}
+		admin(protected.Group("/admin", app.requireAdmin))
+		if app.secretPaths {
+			admin(protected.Group("/:path1/:path2", app.requireSecretPaths)) // deprecated
+		}
+	}
+	if routes == adminRoutes {
+		protected.Any("/debug/pprof/*profile", app.requireScope(scopeAdmin), profile)
+	}
+	if routes&publicRoutes != 0 {
+		protected.GET("/check-wallet/:address", app.requireService, app.requireScope(scopeCheck), app.guardEnumeration, app.timeout(app.fastTimeout), app.checkWallet)
+		protected.HEAD("/check-wallet/:address", app.requireService, app.requireScope(scopeCheck), app.guardEnumeration, app.timeout(app.fastTimeout), app.checkWallet)
+	}
 	return r
 }
 
+// profile serves the profiles of net/http/pprof, the index listing them.
+func profile(c *gin.Context) {
+	switch strings.TrimPrefix(c.Param("profile"), "/") {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
+
 var jwtregexp = regexp.MustCompile(`^[A-Za-z0-9-_]+\.[A-Za-z0-9-_]+\.[A-Za-z0-9-_]*$`)
 
 func generateSecuredLink(t string) string {
 	return fmt.Sprintf("https://unleak.trade/activate/%s", t)
 }
 
+func generateUnsubscribeLink(t string) string {
+	return fmt.Sprintf("https://unleak.trade/unsubscribe/%s", t)
+}
+
+func generateReferralLink(a string) string {
+	return fmt.Sprintf("https://unleak.trade/?sponsor=%s", a)
+}
+
 func (app *App) register(c *gin.Context) {
-	var u data.User
-	if err := c.ShouldBindJSON(&u); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req registerRequest
+	if err := decodeStrict(c, &req); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	if !app.resolved(c, &req.User) {
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	if app.trapped(c, &req) {
+		return
+	}
+	u := req.User
+	key := c.GetHeader(idempotencyHeader)
+	if len(key) > maxIdempotencyKey {
+		app.fail(c, http.StatusBadRequest, codeBadRequest, "Idempotency-Key too long")
+		return
+	}
+	digest := payloadDigest(&u)
+	if key != "" && app.idempotency != nil {
+		if r, ok := app.idempotency.Get(key); ok {
+			if r.digest != digest {
+				app.fail(c, http.StatusUnprocessableEntity, codeIdempotencyConflict, "Idempotency-Key already used with another payload")
+				return
+			}
+			app.logger.Info("🔁 registration replayed", "address", u.Address)
+			c.JSON(http.StatusAccepted, r.body)
+			return
+		}
+	}
+	if app.pending != nil {
+		if r, ok := app.pending.Get(u.Address); ok && r.digest == digest {
+			// the emailed link stays the one to activate
+			app.logger.Info("⏳ registration pending, activation email not sent again", "address", u.Address)
+			c.JSON(http.StatusOK, r.body)
+			return
+		}
+	}
+	if app.limitRegistration(c, &u) {
+		return
+	}
+	if app.full() {
+		// no activation email, its token could not be activated
+		app.fail(c, http.StatusGone, codeWaitlistFull, data.ErrWaitlistFull.Error())
+		return
+	}
+	if !app.solved(c) || !app.human(c, &req) || !app.owned(c, &req) {
+		return
+	}
+	if app.blocklist != nil && app.blocklist.IsDisposable(data.NormalizeEmail(u.Email)) {
+		app.fail(c, http.StatusBadRequest, codeValidation, data.ErrDisposableEmail.Error(), fieldError{"email", "disposable"})
+		return
+	}
+
+	if u.Lang == "" {
+		u.Lang = mailer.DefaultLang
+	}
+	suppressed, err := app.dbOf(c.Request.Context()).IsSuppressed(u.Email)
+	if err != nil {
+		app.failInternal(c, err)
 		return
 	}
 
-	token, err := app.jwt.Create(&u, time.Now())
+	now := time.Now()
+	token, err := app.jwt.Create(&u, now)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		app.failInternal(c, err)
 		return
 	}
 	hash := app.jwt.Hash(token)
-	app.wg.Add(1)
-	go func() {
-		defer app.wg.Done()
-		sl := generateSecuredLink(token)
-		app.mailer.SendActivationEmail(u.Email, sl, hash)
-	}()
+	if suppressed {
+		// same response as usual, not to disclose the suppression list
+		app.logger.Info("🔕 email suppressed, activation email not sent", "email", data.RedactEmail(u.Email))
+	} else {
+		ut, err := app.jwt.CreateWithPurpose(&u, crypto.PurposeUnsubscribe, now)
+		if err != nil {
+			app.failInternal(c, err)
+			return
+		}
+		sl, ul := generateSecuredLink(token), generateUnsubscribeLink(ut)
+		app.enqueueEmail(c.Request.Context(), data.NewOutboxEmail(u.Email, mailer.TemplateActivation, map[string]string{
+			"url":         sl,
+			"hash":        hash,
+			"unsubscribe": ul,
+			"lang":        u.Lang,
+		}), func() error {
+			return app.mailer.SendActivationEmail(u.Email, sl, hash, ul, u.Lang)
+		})
+	}
+
+	app.audit(c.Request.Context(), data.NewEvent(data.EventRegistered, u.Address, u.Email, referrer(&u)))
 
 	r := gin.H{
 		"hash": hash,
 	}
-	if gin.IsDebugging() {
+	if app.exposeToken {
 		r["token"] = token
 	}
+	if key != "" && app.idempotency != nil {
+		app.idempotency.Add(key, registration{digest, r})
+	}
+	if app.pending != nil {
+		app.pending.Add(u.Address, registration{digest, r})
+	}
 	c.JSON(http.StatusAccepted, r)
 }
 
+// limitBody fails the reads of request bodies beyond n bytes, no limit when 0.
+func limitBody(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if n > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, n)
+		}
+		c.Next()
+	}
+}
+
+// bindStrict decodes the JSON body into v, unknown fields being errors, then validates it.
+func bindStrict(c *gin.Context, v any) error {
+	if err := decodeStrict(c, v); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(v)
+}
+
+// decodeStrict decodes the JSON body into v, unknown fields being errors, without validating it.
+func decodeStrict(c *gin.Context, v any) error {
+	d := json.NewDecoder(c.Request.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); !errors.Is(err, io.EOF) { // the body is the JSON value only
+		if err == nil {
+			err = errors.New("unexpected data after the JSON body")
+		}
+		return err
+	}
+	return nil
+}
+
+// The Idempotency-Key header lets clients retry a registration without a new token nor email.
+const (
+	idempotencyHeader = "Idempotency-Key"
+	maxIdempotencyKey = 255
+)
+
+// registration is the response of register kept under its Idempotency-Key, with the digest of the payload.
+type registration struct {
+	digest string
+	body   gin.H
+}
+
+// payloadDigest identifies the registration payload u.
+func payloadDigest(u *data.User) string {
+	b, _ := json.Marshal(u)
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// referrer describes who refers u, for the audit trail.
+func referrer(u *data.User) string {
+	if u.InviteCode != "" {
+		return "invite " + u.InviteCode
+	}
+	if u.Sponsor == "" {
+		return "open wave"
+	}
+	return "sponsor " + u.Sponsor
+}
+
+// audit appends e to the audit trail, a failure never fails the request.
+// It is appended even once the request is cancelled, what it records being done.
+func (app *App) audit(ctx context.Context, e data.Event) {
+	if err := app.dbOf(context.WithoutCancel(ctx)).AppendEvent(e); err != nil {
+		app.logger.Warn("⚠️ cannot append the event", "type", e.Type, "address", e.Address, slog.Any("error", err))
+	}
+}
+
+// enqueueEmail persists the email in the outbox, falling back to a direct send if the outbox is unavailable.
+func (app *App) enqueueEmail(ctx context.Context, e *data.OutboxEmail, send func() error) {
+	if err := app.outbox.Enqueue(e.WithTrace(ctx)); err != nil {
+		app.logger.Warn("⚠️ cannot enqueue the email, sending it directly", "template", e.Template, slog.Any("error", err))
+		app.sendEmail(ctx, e.Template, send)
+	}
+}
+
+// scheduleWelcome enqueues the welcome email of the user of address a, due welcomeDelay after the activation.
+// Unlike the others, it is never sent directly when the outbox is unavailable.
+func (app *App) scheduleWelcome(ctx context.Context, a, e, l string) {
+	if app.welcomeDelay <= 0 {
+		return
+	}
+	m := data.NewOutboxEmail(e, mailer.TemplateWelcome, map[string]string{"referral": generateReferralLink(a), "lang": l})
+	if err := app.outbox.Enqueue(m.Schedule(a, time.Now().Add(app.welcomeDelay)).WithTrace(ctx)); err != nil {
+		app.logger.Warn("⚠️ cannot schedule the welcome email", "address", a, slog.Any("error", err))
+	}
+}
+
+// errEmailDropped fails the span of an email the mail dispatcher did not take.
+var errEmailDropped = errors.New("email dropped by the mail dispatcher")
+
+// sendEmail sends the email on the mail dispatcher, logging and counting delivery failures.
+// A send started is not interrupted at shutdown, a queued one is abandoned.
+func (app *App) sendEmail(ctx context.Context, kind string, send func() error) {
+	failed := app.metrics.Counter(fmt.Sprintf("waitlist_emails_failed_total{email=%q}", kind), "Emails not delivered by the mail provider")
+	span := app.traceSend(ctx, kind)
+	ok := app.dispatcher.Submit(kind+" email", func(context.Context) {
+		err := send()
+		tracing.End(span, err)
+		if err != nil {
+			app.logger.Error("🔥 email not delivered", "template", kind, slog.Any("error", err))
+			failed.Inc()
+		}
+	})
+	if !ok {
+		tracing.End(span, errEmailDropped)
+		failed.Inc()
+	}
+}
+
+// publish enqueues the event e about u in the outbox once per sink, published at least once to each one.
+func (app *App) publish(ctx context.Context, e string, u *data.User) {
+	ev := events.NewEvent(e, u, time.Now())
+	for name, s := range app.sinks {
+		p := ev.Payload()
+		p["sink"] = name
+		app.enqueueEmail(ctx, data.NewOutboxEmail("", mailer.TemplateEvent, p), func() error {
+			return s.Publish(context.Background(), ev)
+		})
+	}
+}
+
+// ready reports whether registrations are served end to end, 503 when the mailer fails so much the service is down.
+// The service is degraded, not down, while the cache is not loaded: registrations need no cache.
+func (app *App) ready(c *gin.Context) {
+	component, status := health.StatusOK, health.StatusOK
+	if app.mailerHealth != nil {
+		component, status = app.mailerHealth.Status()
+	}
+	cacheStatus := health.StatusOK
+	if app.degraded.Load() {
+		cacheStatus = health.StatusDegraded
+		if status == health.StatusOK {
+			status = health.StatusDegraded
+		}
+	}
+	code := http.StatusOK
+	if status == health.StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":            status,
+		"mailer":            component,
+		"cache":             cacheStatus,
+		"token_fingerprint": app.jwt.Fingerprint(), // differs between replicas not sharing their signing key
+	})
+}
+
+func (app *App) metricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	app.metrics.WriteTo(c.Writer)
+}
+
+// claimReferral takes one of the referrals left to sponsor s, data.ErrReferralLimit when at the cap.
+// The cached count only saves a DB round trip for sponsors already at the cap, the DB counter is authoritative.
+func (app *App) claimReferral(ctx context.Context, s string) error {
+	if app.referralLimit <= 0 {
+		return nil
+	}
+	n, ok := app.referrals.Get(s)
+	if !ok {
+		var err error
+		if n, err = app.dbOf(ctx).CountBySponsor(s); err != nil {
+			return err
+		}
+	}
+	if n >= app.referralLimit {
+		app.referrals.Add(s, n)
+		return data.ErrReferralLimit
+	}
+	if err := app.dbOf(ctx).ClaimReferral(s, n, app.referralLimit); err != nil {
+		if errors.Is(err, data.ErrReferralLimit) {
+			app.referrals.Add(s, app.referralLimit)
+		}
+		return err
+	}
+	app.referrals.Add(s, n+1)
+	return nil
+}
+
+// full reports whether the waitlist reached its cap, from the cached count of the activated users.
+func (app *App) full() bool {
+	return app.waitlistCap > 0 && app.c.Len() >= app.waitlistCap
+}
+
+// claimSeat takes one of the seats left in the waitlist, data.ErrWaitlistFull when at the cap.
+// As for the referrals, the DB counter is authoritative so concurrent activations, on any replica, cannot overshoot;
+// it is seeded with the cached count, the users imported or seeded later taking no seat,
+// counted in the DB while the cache is degraded.
+func (app *App) claimSeat(ctx context.Context) error {
+	if app.waitlistCap <= 0 {
+		return nil
+	}
+	if app.full() {
+		return data.ErrWaitlistFull
+	}
+	seed := app.c.Len()
+	if app.degraded.Load() {
+		m, err := app.dbOf(ctx).ListAddresses()
+		if err != nil {
+			return err
+		}
+		seed = len(m)
+	}
+	return app.dbOf(ctx).ClaimSeat(seed, app.waitlistCap)
+}
+
+// releaseSeat gives back the seat claimed by a failed registration, even once its request is cancelled.
+func (app *App) releaseSeat(ctx context.Context) {
+	if app.waitlistCap <= 0 {
+		return
+	}
+	if err := app.dbOf(context.WithoutCancel(ctx)).ReleaseSeat(); err != nil {
+		app.logger.Warn("⚠️ cannot release a seat of the waitlist", slog.Any("error", err))
+	}
+}
+
+// releaseReferral gives back the referral of s claimed by a failed registration, even once its request is cancelled.
+func (app *App) releaseReferral(ctx context.Context, s string) {
+	if app.referralLimit <= 0 {
+		return
+	}
+	app.referrals.Remove(s)
+	if err := app.dbOf(context.WithoutCancel(ctx)).ReleaseReferral(s); err != nil {
+		app.logger.Warn("⚠️ cannot release the referral", "sponsor", s, slog.Any("error", err))
+	}
+}
+
+// Max ages of the polled responses, validated by their ETag once stale.
+const (
+	checkWalletMaxAge = 5 * time.Second
+	listMaxAge        = 10 * time.Second
+)
+
 func (app *App) checkWallet(c *gin.Context) {
 	a := c.Param("address")
-	if !app.c.IsPresent(a) {
-		c.JSON(http.StatusNotFound, gin.H{"registered": false})
+	withSponsor := false
+	if v := c.Query("include"); v != "" {
+		for _, f := range strings.Split(v, ",") {
+			if f != "sponsor" {
+				app.fail(c, http.StatusBadRequest, codeValidation, "invalid include", fieldError{"include", "oneof=sponsor"})
+				return
+			}
+			withSponsor = true
+		}
+	}
+	var u *data.User
+	ts, ok := app.c.Get(a)
+	switch {
+	case ok && !withSponsor:
+	case !ok && app.c.IsMissing(a):
+		app.walletStatus(c, a, nil)
 		return
+	default:
+		// the cache may lag behind the DB (activation on another replica, expired entry), and lacks the sponsor
+		var err error
+		if u, err = app.dbOf(c.Request.Context()).Get(a); err != nil {
+			app.failInternal(c, err)
+			return
+		}
+		if u == nil && !ok {
+			app.c.AddMissing(a)
+			app.walletStatus(c, a, nil)
+			return
+		}
+		if u != nil && !ok {
+			ts = u.Timestamp
+			app.c.Add(a, ts)
+		}
+	}
+	p, _, _ := app.position(a)
+	var sponsor string
+	if withSponsor && u != nil {
+		sponsor = u.Sponsor
 	}
-	c.JSON(http.StatusOK, gin.H{"registered": true})
+	app.walletStatus(c, a, &walletResponse{true, newPublicUser(a, sponsor, ts, p)})
 }
 
-func (app *App) requireAPIKey(c *gin.Context) {
-	k := c.GetHeader("UNLK-API-KEY")
-	if k == "" || k != app.apiKey {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+// walletResponse is the response of check-wallet for a registered address, its sponsor with ?include=sponsor.
+type walletResponse struct {
+	Registered bool `json:"registered"`
+	PublicUser
+}
+
+// walletStatus responds to check-wallet with w, nil when a is not registered, 304 when the client has it already.
+func (app *App) walletStatus(c *gin.Context, a string, w *walletResponse) {
+	c.Set(walletFoundKey, w != nil)
+	if w == nil {
+		if !notModified(c, weakETag(a, "false"), checkWalletMaxAge) {
+			c.JSON(http.StatusNotFound, gin.H{"registered": false})
+		}
+		return
+	}
+	if notModified(c, weakETag(a, "true", w.RegisteredAt, strconv.Itoa(w.Position), w.Sponsor), checkWalletMaxAge) {
 		return
 	}
+	c.JSON(http.StatusOK, w)
+}
+
+// weakETag returns a weak ETag of the parts, which identify the content of a response.
+func weakETag(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return `W/"` + hex.EncodeToString(h[:8]) + `"`
+}
+
+// notModified sets the ETag and Cache-Control headers, then returns true with a 304 when If-None-Match matches etag.
+func notModified(c *gin.Context, etag string, maxAge time.Duration) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	for _, t := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") { // weak comparison
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// listETag identifies the list in format selected by q, by the number of users and the latest activation, as cached,
+// and the revision of the users, changed by their edits. It is meaningless while the cache is degraded.
+func (app *App) listETag(format string, q listQuery) string {
+	var n int
+	var latest int64
+	app.c.Range(func(_ string, ts int64) bool {
+		n++
+		latest = max(latest, ts)
+		return true
+	})
+	return weakETag(strconv.Itoa(n), strconv.FormatInt(latest, 10), strconv.FormatUint(app.revision.Load(), 10),
+		format, strconv.FormatBool(q.PII), strconv.FormatBool(q.Meta), q.Sponsor, fmt.Sprint(q.Options))
+}
+
+// position returns the rank of address a by activation time, starting at 1, and its wave.
+// None is known while the cache is degraded, missing the users activated before.
+func (app *App) position(a string) (position, wave int, ok bool) {
+	if app.degraded.Load() {
+		return 0, 0, false
+	}
+	position, ok = cache.Rank(app.c, a)
+	if !ok {
+		return 0, 0, false
+	}
+	wave = 1
+	if app.waveSize > 0 {
+		wave = (position-1)/app.waveSize + 1
+	}
+	return position, wave, true
+}
+
+// activation is the response of activate, the user activated and its place in the waitlist.
+type activation struct {
+	PublicUser
+	Wave     int  `json:"wave"`
+	replayed bool // already activated by the same token, answered with 200 instead of 201
+}
+
+// status returns the status of the response of a.
+func (a activation) status() int {
+	if a.replayed {
+		return http.StatusOK
+	}
+	return http.StatusCreated
+}
+
+// requireSecretPaths lets the admin routes through when path1 and path2 are the secret ones.
+func (app *App) requireSecretPaths(c *gin.Context) {
+	if c.Param("path1") != app.secpath1 || c.Param("path2") != app.secpath2 {
+		app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	c.Next()
+}
+
+// adminKey is the context key of the subject of the admin token.
+const adminKey = "admin"
+
+// requireAdmin lets the admin routes through with an admin token in the Authorization header.
+func (app *App) requireAdmin(c *gin.Context) {
+	t, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		app.fail(c, http.StatusUnauthorized, codeUnauthorized, "admin token required")
+		return
+	}
+	sub, err := app.jwt.ExtractAdmin(strings.TrimSpace(t))
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		msg := "invalid admin token"
+		if errors.Is(err, crypto.ErrExpiredToken) {
+			msg = "admin token expired"
+		}
+		app.fail(c, http.StatusUnauthorized, codeUnauthorized, msg)
+		return
+	}
+	app.logger.Info("🔑 admin request", "method", c.Request.Method, "route", c.FullPath(), "admin", sub)
+	c.Set(adminKey, sub)
 	c.Next()
 }
 
 func (app *App) activate(c *gin.Context) {
-	t := c.Param("token")
-	h := c.Param("hash")
-	if !jwtregexp.MatchString(t) || app.jwt.Hash(t) != h {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	a, f := app.activateToken(c.Request.Context(), c.Param("token"), c.Param("hash"), app.clientMeta(c))
+	if f != nil {
+		app.failActivation(c, f)
 		return
 	}
+	c.JSON(a.status(), a)
+}
 
-	u, err := app.jwt.Extract(t) // verify + extract
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+// Reasons of the failed activations, appended to the error URL of the activation pages.
+const (
+	reasonInvalidToken    = "invalid_token"
+	reasonExpiredToken    = "expired_token"
+	reasonAlreadyUsed     = "already_used"
+	reasonSponsorNotFound = "sponsor_not_found"
+	reasonInvalidInvite   = "invalid_invite"
+	reasonReferralLimit   = "referral_limit"
+	reasonWaitlistFull    = "waitlist_full"
+	reasonWaitlistClosed  = "waitlist_closed"
+	reasonInternal        = "internal_error"
+)
+
+// activationFailure is why a token cannot be activated, as an error response and as a reason.
+type activationFailure struct {
+	status  int
+	code    string
+	message string
+	fields  []fieldError
+	reason  string
+	err     error // internal error, not disclosed
+}
+
+var (
+	errUnauthorizedActivation = &activationFailure{status: http.StatusUnauthorized, code: codeUnauthorized, message: "Unauthorized", reason: reasonInvalidToken}
+	errFullActivation         = &activationFailure{status: http.StatusGone, code: codeWaitlistFull, message: data.ErrWaitlistFull.Error(), reason: reasonWaitlistFull}
+	// authentic but too old, unlike the forged and malformed tokens
+	errExpiredActivation = &activationFailure{status: http.StatusGone, code: codeActivationExpired, message: "activation link expired, register again to receive a new one", reason: reasonExpiredToken}
+)
+
+func internalActivation(err error) *activationFailure {
+	return &activationFailure{status: http.StatusInternalServerError, code: codeInternal, message: errInternal.Error(), reason: reasonInternal, err: err}
+}
+
+// failActivation fails c with the error response of f.
+func (app *App) failActivation(c *gin.Context, f *activationFailure) {
+	if f.err != nil {
+		app.failInternal(c, f.err)
 		return
 	}
+	app.fail(c, f.status, f.code, f.message, f.fields...)
+}
 
-	ra, err := app.db.IsPresent(u.Address)
+// checkActivationToken extracts the user of the activation token t.
+func (app *App) checkActivationToken(t string) (*data.User, *activationFailure) {
+	if !jwtregexp.MatchString(t) {
+		return nil, errUnauthorizedActivation
+	}
+	u, p, err := app.jwt.ExtractWithPurpose(t) // verify + extract
+	if errors.Is(err, crypto.ErrExpiredToken) {
+		return nil, errExpiredActivation
+	}
+	if err != nil || p != crypto.PurposeActivate {
+		return nil, errUnauthorizedActivation
+	}
+	return u, nil
+}
+
+// clientMeta returns the client of the activation c, its country located when a GeoIP database is set.
+func (app *App) clientMeta(c *gin.Context) *data.ClientMeta {
+	m := &data.ClientMeta{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if app.geo != nil {
+		m.Country = app.geo.Country(m.IP)
+	}
+	return m
+}
+
+// activateToken saves the user of the activation token t, h being its hash, activated by the client m.
+func (app *App) activateToken(ctx context.Context, t, h string, m *data.ClientMeta) (activation, *activationFailure) {
+	if app.jwt.Hash(t) != h {
+		return activation{}, errUnauthorizedActivation
+	}
+	u, f := app.checkActivationToken(t)
+	if f != nil {
+		return activation{}, f
+	}
+
+	ra, err := app.dbOf(ctx).IsPresent(u.Address)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return activation{}, internalActivation(err)
 	}
 	if ra {
-		err := fmt.Sprintf("user address %s already used", u.Address)
-		c.JSON(http.StatusConflict, gin.H{"error": err})
-		return
+		if a, ok, err := app.replayedActivation(ctx, u); err != nil {
+			return activation{}, internalActivation(err)
+		} else if ok {
+			return a, nil
+		}
+		app.audit(ctx, data.NewEvent(data.EventActivationConflict, u.Address, u.Email, "address already used"))
+		return activation{}, &activationFailure{status: http.StatusConflict, code: codeConflict, message: fmt.Sprintf("user address %s already used", u.Address), reason: reasonAlreadyUsed}
 	}
 
-	rs, err := app.db.IsPresent(u.Sponsor)
+	// registered in an open wave, without sponsor to check nor referral to count
+	sponsorless := u.InviteCode == "" && u.Sponsor == "" && data.IsOpenWave()
+	if u.InviteCode == "" && !sponsorless {
+		rs, err := app.dbOf(ctx).IsPresent(u.Sponsor)
+		if err != nil {
+			return activation{}, internalActivation(err)
+		}
+		if !rs && !app.genesis[u.Sponsor] {
+			return activation{}, &activationFailure{status: http.StatusBadRequest, code: codeValidation, message: fmt.Sprintf("sponsor address %s not found", u.Sponsor), fields: []fieldError{{"sponsor", "registered"}}, reason: reasonSponsorNotFound}
+		}
+	}
+	e, l := u.Email, u.Lang // user's email will be replaced by encryted value, so better do a copy
+	o, err := app.dbOf(ctx).FindByEmail(e)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return activation{}, internalActivation(err)
 	}
-	if !rs {
-		err := fmt.Sprintf("sponsor address %s not found", u.Sponsor)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
-		return
+	if o != nil {
+		app.audit(ctx, data.NewEvent(data.EventActivationConflict, u.Address, e, "email already used by "+o.Address))
+		return activation{}, &activationFailure{status: http.StatusConflict, code: codeConflict, message: "email already used", reason: reasonAlreadyUsed}
+	}
+	if err := app.claimSeat(ctx); err != nil {
+		if errors.Is(err, data.ErrWaitlistFull) {
+			return activation{}, errFullActivation
+		}
+		return activation{}, internalActivation(err)
 	}
-	e := u.Email         // user's email will be replaced by encryted value, so better do a copy
-	err = app.db.Save(u) //user data are replaced by saved one
+	saved := false
+	defer func() {
+		if !saved {
+			app.releaseSeat(ctx)
+		}
+	}()
+	if u.InviteCode != "" {
+		// the uses of an invite code bound its referrals, not the referral limit
+		i, err := app.dbOf(ctx).RedeemInvite(u.InviteCode, time.Now())
+		switch {
+		case errors.Is(err, data.ErrInviteNotFound):
+			return activation{}, &activationFailure{status: http.StatusBadRequest, code: codeValidation, message: err.Error(), fields: []fieldError{{"invite_code", "registered"}}, reason: reasonInvalidInvite}
+		case errors.Is(err, data.ErrInviteExpired), errors.Is(err, data.ErrInviteExhausted):
+			return activation{}, &activationFailure{status: http.StatusForbidden, code: codeForbidden, message: err.Error(), reason: reasonInvalidInvite}
+		case err != nil:
+			return activation{}, internalActivation(err)
+		}
+		u.Sponsor = i.Creator
+	} else if !sponsorless {
+		if err := app.claimReferral(ctx, u.Sponsor); err != nil {
+			if errors.Is(err, data.ErrReferralLimit) {
+				return activation{}, &activationFailure{status: http.StatusForbidden, code: codeForbidden, message: err.Error(), reason: reasonReferralLimit}
+			}
+			return activation{}, internalActivation(err)
+		}
+	}
+	invited, sponsor := u.InviteCode != "", u.Sponsor
+	u.Meta = m
+	err = app.dbOf(ctx).Save(u) //user data are replaced by saved one
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		if !invited && !sponsorless {
+			app.releaseReferral(ctx, sponsor)
+		}
+		return activation{}, internalActivation(err)
 	}
+	saved = true
+
+	app.audit(ctx, data.NewEvent(data.EventActivated, u.Address, e, referrer(u)))
 
 	// update cache
 	app.c.Add(u.Address, u.Timestamp)
+	if app.pending != nil {
+		app.pending.Remove(u.Address)
+	}
+	if app.webhooks != nil {
+		app.webhooks.Notify(webhook.Activated(u))
+	}
+	app.publish(ctx, events.UserActivated, u)
 
-	app.wg.Add(1)
-	go func() {
-		defer app.wg.Done()
-		app.mailer.SendConfirmationEmail(e)
-	}()
+	app.enqueueEmail(ctx, data.NewOutboxEmail(e, mailer.TemplateConfirmation, map[string]string{"lang": l}), func() error {
+		return app.mailer.SendConfirmationEmail(e, l)
+	})
+	app.scheduleWelcome(ctx, u.Address, e, l)
 
-	c.JSON(http.StatusCreated, u)
+	pos, wave, _ := app.position(u.Address)
+	return activation{newPublicUser(u.Address, u.Sponsor, u.Timestamp, pos), wave, false}, nil
+}
+
+// replayedActivation returns the activation of the user u of a token already activated, the form being submitted again,
+// false when the address was activated by another registration: with another email or sponsor.
+func (app *App) replayedActivation(ctx context.Context, u *data.User) (activation, bool, error) {
+	o, err := app.dbOf(ctx).Get(u.Address)
+	if err != nil || o == nil || o.Genesis {
+		return activation{}, false, err
+	}
+	same := u.InviteCode == o.InviteCode && (u.InviteCode != "" || u.Sponsor == o.Sponsor)
+	if !same || data.NormalizeEmail(o.Email) != data.NormalizeEmail(u.Email) {
+		return activation{}, false, nil
+	}
+	app.logger.Info("🔁 activation submitted again", "address", u.Address)
+	pos, wave, _ := app.position(o.Address)
+	return activation{newPublicUser(o.Address, o.Sponsor, o.Timestamp, pos), wave, true}, true, nil
 }
 
 func (app *App) limit(c *gin.Context) {
-	ip := c.ClientIP()
-	l := app.rl.GetAccess(ip)
+	l := app.rl.GetAccess(c.ClientIP())
 	if !l.Allow() {
-		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-			"error": "Too Many Requests",
-			"ip":    ip,
-		})
+		app.fail(c, http.StatusTooManyRequests, codeTooManyRequests, "Too Many Requests")
 		return
 	}
 	c.Next()
 }
 
+// limitRegistration fails the registration of u when its wallet or its email registered too often,
+// naming only the dimension tripped, the activity of the other being none of the client's business.
+func (app *App) limitRegistration(c *gin.Context, u *data.User) bool {
+	if !app.walletRL.GetAccess(u.Address).Allow() {
+		app.fail(c, http.StatusTooManyRequests, codeTooManyRequests, "too many registrations of this wallet, try again later", fieldError{"address", "rate_limit"})
+		return true
+	}
+	// in memory only, the hash keeps the emails out of it without a key
+	if !app.emailRL.GetAccess(data.EmailHash(u.Email, "")).Allow() {
+		app.fail(c, http.StatusTooManyRequests, codeTooManyRequests, "too many registrations of this email, try again later", fieldError{"email", "rate_limit"})
+		return true
+	}
+	return false
+}
+
 func (app *App) cors(c *gin.Context) {
 	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-	c.Writer.Header().Set("Access-Control-Allow-Headers", "origin, content-type, accept, authorization")
+	c.Writer.Header().Set("Access-Control-Allow-Headers", "origin, content-type, accept, authorization, "+powChallengeHeader+", "+powSolutionHeader+", "+idempotencyHeader)
 	c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 
 	if c.Request.Method == "OPTIONS" {
@@ -195,71 +937,432 @@ func (app *App) cors(c *gin.Context) {
 	c.Next()
 }
 
-func (app *App) list(c *gin.Context) {
-	p1, p2 := c.Param("path1"), c.Param("path2")
-	if p1 != app.secpath1 || p2 != app.secpath2 {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
-	}
+// listQuery is the selection of a list, from the query parameters of list and signed in its download links.
+type listQuery struct {
+	Options []int  `json:"options,omitempty"` // offset then max
+	PII     bool   `json:"pii,omitempty"`
+	Meta    bool   `json:"meta,omitempty"`
+	Sponsor string `json:"sponsor,omitempty"` // users sponsored by, all when empty
+}
 
-	options := []int{}
-	offset := c.Query("offset")
-	if offset != "" {
-		v, err := strconv.Atoi(offset)
+// listQuery returns the list selected by the query parameters of c, failing the request when invalid
+// or not allowed by the scopes of its key.
+func (app *App) listQuery(c *gin.Context) (listQuery, bool) {
+	var q listQuery
+	for _, p := range []string{"offset", "max"} {
+		v := c.Query(p)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
 		if err != nil {
-			c.AbortWithStatus(http.StatusBadRequest)
-			return
+			app.fail(c, http.StatusBadRequest, codeValidation, "invalid "+p, fieldError{p, "numeric"})
+			return q, false
+		}
+		if n < 0 {
+			app.fail(c, http.StatusBadRequest, codeValidation, "invalid "+p+", must not be negative", fieldError{p, "min=0"})
+			return q, false
+		}
+		if p == "max" && len(q.Options) == 0 {
+			q.Options = append(q.Options, 0) // from the first user
 		}
-		options = append(options, v)
+		q.Options = append(q.Options, n)
 	}
-	if max := c.Query("max"); max != "" {
-		v, err := strconv.Atoi(max)
-		if err != nil || offset == "" { // offset & max required
-			c.AbortWithStatus(http.StatusBadRequest)
-			return
+	for _, b := range []struct {
+		p string
+		v *bool
+	}{{"include_pii", &q.PII}, {"include_meta", &q.Meta}} {
+		v := c.Query(b.p)
+		if v == "" {
+			continue
+		}
+		var err error
+		if *b.v, err = strconv.ParseBool(v); err != nil {
+			app.fail(c, http.StatusBadRequest, codeValidation, "invalid "+b.p, fieldError{b.p, "boolean"})
+			return q, false
 		}
-		options = append(options, v)
 	}
+	if q.Sponsor = c.Query("sponsor"); q.Sponsor != "" && data.ValidateSolanaAddress(q.Sponsor) != nil {
+		app.fail(c, http.StatusBadRequest, codeValidation, "invalid sponsor", fieldError{"sponsor", "solana_addr"})
+		return q, false
+	}
+	if (q.PII || q.Meta) && !app.scoped(c, c.GetStringSlice(scopesKey), scopePII) {
+		return q, false
+	}
+	return q, true
+}
+
+func (app *App) list(c *gin.Context) {
+	q, ok := app.listQuery(c)
+	if !ok {
+		return
+	}
+	c.Writer.Header().Add("Vary", "Accept")
+	f, ok := negotiateList(c.Query("mime"), c.GetHeader("Accept"))
+	if !ok {
+		app.fail(c, http.StatusNotAcceptable, codeNotAcceptable, "supported formats: json, csv, ndjson")
+		return
+	}
+	if !app.degraded.Load() && notModified(c, app.listETag(f.name, q), listMaxAge) {
+		return
+	}
+	app.writeList(c, q, f, requester(c))
+}
 
-	users, err := app.db.List(options...)
+// writeList responds with the users selected by q in format f, the export of their emails audited as made by by.
+func (app *App) writeList(c *gin.Context, q listQuery, f listFormat, by string) {
+	db := app.dbOf(c.Request.Context())
+	var users []*data.User
+	var err error
+	if q.Sponsor == "" {
+		users, err = db.List(q.Options...)
+	} else if users, err = db.ListBySponsor(q.Sponsor); err == nil {
+		users, err = data.Page(users, q.Options...)
+	}
+	if err == nil {
+		err = c.Request.Context().Err() // not streamed once timed out
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		app.failInternal(c, err)
 		return
 	}
+	if q.PII {
+		users = withoutAnonymized(users)
+		app.audit(c.Request.Context(), data.NewEvent(data.EventPIIExported, data.ListAddress, "", fmt.Sprintf("%d emails in %s by %s", len(users), f.name, by)))
+		app.logger.Info("🔓 emails exported", "count", len(users), "format", f.name, "by", by)
+	} else {
+		for _, u := range users {
+			u.Email = data.RedactEmail(u.Email)
+		}
+	}
 
 	sort.Slice(users, func(i, j int) bool {
 		return users[i].Timestamp > users[j].Timestamp
 	})
 
-	mime := c.DefaultQuery("mime", "json")
-	switch mime {
-	case "csv":
-		b := new(bytes.Buffer)
-		w := csv.NewWriter(b)
-		err := w.Write([]string{"address", "email", "uuid", "timestamp", "sponsor"})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// streamed, rows being compressed as they are written when gzip is negotiated
+	if f.attachment {
+		c.Header("Content-Description", "File Transfer")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=users_list_%s.%s", time.Now().Format("20060102-150405"), f.name))
+	}
+	c.Header("Content-Type", f.mediaType)
+	c.Status(http.StatusOK)
+	if f.writePublic != nil && !q.PII && !q.Meta {
+		err = f.writePublic(c.Writer, publicUsers(users, app.positions()))
+	} else {
+		err = f.write(c.Writer, users, app.exportTZ, q.Meta)
+	}
+	if err != nil {
+		app.logger.Warn("⚠️ list interrupted", "format", f.name, slog.Any("error", err))
+	}
+}
+
+// emails returns the last emails rendered by the log mailer.
+func (app *App) emails(c *gin.Context) {
+	if app.recorder == nil {
+		app.fail(c, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+
+	n := 10
+	if v := c.Query("n"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 {
+			app.fail(c, http.StatusBadRequest, codeValidation, "invalid n", fieldError{"n", "min=1"})
 			return
 		}
-		for _, u := range users {
-			l, _ := time.LoadLocation("Europe/Paris")
-			err := w.Write([]string{u.Address, u.Email, u.UUID, time.UnixMilli(u.Timestamp).In(l).String(), u.Sponsor})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
+		n = i
+	}
+	emails := app.recorder.Recent(n)
+	c.JSON(http.StatusOK, gin.H{
+		"emails": emails,
+		"count":  len(emails),
+	})
+}
+
+// seed inserts a genesis user, a sponsor without email that shows up in check-wallet and the counts.
+func (app *App) seed(c *gin.Context) {
+	var req struct {
+		Address string `json:"address" binding:"required,solana_addr"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	ok, err := app.dbOf(c.Request.Context()).IsPresent(req.Address)
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	if ok {
+		app.fail(c, http.StatusConflict, codeConflict, fmt.Sprintf("user address %s already used", req.Address))
+		return
+	}
+	u := data.NewGenesisUser(req.Address)
+	if err := app.dbOf(c.Request.Context()).Save(u); err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	app.c.Add(u.Address, u.Timestamp)
+	app.audit(c.Request.Context(), data.NewEvent(data.EventSeeded, u.Address, "", ""))
+	app.logger.Info("🌱 genesis sponsor seeded", "address", u.Address)
+	c.JSON(http.StatusCreated, u)
+}
+
+type inviteRequest struct {
+	Creator   string    `json:"creator" binding:"required,solana_addr"`
+	MaxUses   int       `json:"max_uses" binding:"required,min=1"`
+	ExpiresAt time.Time `json:"expires_at"` // never expires when omitted
+}
+
+// createInvite mints an invite code, creator sponsoring the users registered with it.
+func (app *App) createInvite(c *gin.Context) {
+	var req inviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(time.Now()) {
+		app.fail(c, http.StatusBadRequest, codeValidation, "expires_at must be in the future", fieldError{"expires_at", "future"})
+		return
+	}
+	i := data.NewInvite(req.Creator, req.MaxUses, req.ExpiresAt)
+	if err := app.dbOf(c.Request.Context()).CreateInvite(i); err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	app.audit(c.Request.Context(), data.NewEvent(data.EventInviteCreated, i.Creator, "", fmt.Sprintf("invite %s, %d uses", i.Code, i.MaxUses)))
+	app.logger.Info("🎟️ invite code created", "code", i.Code, "creator", i.Creator, "uses", i.MaxUses)
+	c.JSON(http.StatusCreated, i)
+}
+
+// cacheStats shows whether the check-wallet cache is effective.
+func (app *App) cacheStats(c *gin.Context) {
+	s := app.c.Stats()
+	c.JSON(http.StatusOK, gin.H{
+		"size":      s.Size,
+		"hits":      s.Hits,
+		"misses":    s.Misses,
+		"hit_ratio": s.HitRatio(),
+		"filled":    s.Filled,
+	})
+}
+
+// inspectToken shows support what a token contained and whether it is valid, even expired.
+// The activation and unsubscribe links go on extracting their tokens strictly.
+func (app *App) inspectToken(c *gin.Context) {
+	t := c.Param("token")
+	if !jwtregexp.MatchString(t) {
+		c.JSON(http.StatusBadRequest, gin.H{"validity": crypto.BadSignature})
+		return
+	}
+	u, v := crypto.Inspect(app.jwt, t)
+	app.logger.Info("🔍 token inspected", "admin", c.GetString(adminKey), "validity", v)
+	r := gin.H{"validity": v}
+	if u != nil {
+		r["user"] = u
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// unsubscribe puts the email of the token on the suppression list, no activation email will be sent to it anymore.
+func (app *App) unsubscribe(c *gin.Context) {
+	t := c.Param("token")
+	if !jwtregexp.MatchString(t) {
+		app.fail(c, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+		return
+	}
+	u, p, err := app.jwt.ExtractWithPurpose(t)
+	if err != nil || p != crypto.PurposeUnsubscribe {
+		app.fail(c, http.StatusUnauthorized, codeUnauthorized, "Unauthorized")
+		return
+	}
+	if err := app.dbOf(c.Request.Context()).Suppress(u.Email); err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	app.audit(c.Request.Context(), data.NewEvent(data.EventUnsubscribed, u.Address, u.Email, ""))
+	c.JSON(http.StatusOK, gin.H{"unsubscribed": true})
+}
+
+// events returns the audit trail of an address, most recent first.
+func (app *App) events(c *gin.Context) {
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 {
+			app.fail(c, http.StatusBadRequest, codeValidation, "invalid limit", fieldError{"limit", "min=1"})
+			return
 		}
-		w.Flush()
-		c.Header("Content-Description", "File Transfer")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=users_list_%s.csv", time.Now().Format("20060102-150405")))
-		c.Data(http.StatusOK, "text/csv", b.Bytes())
-		// c.Writer.Write(b.Bytes())
+		limit = i
+	}
+	l, err := app.dbOf(c.Request.Context()).ListEvents(c.Param("address"), limit)
+	if err != nil {
+		app.failInternal(c, err)
 		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"events": l,
+		"count":  len(l),
+	})
+}
+
+type importRow struct {
+	Address string `json:"address"`
+	Email   string `json:"email"`
+	Sponsor string `json:"sponsor"`
+}
+
+type importResult struct {
+	Row     int    `json:"row"` // index of the record in the payload, header excluded
+	Address string `json:"address"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// readImport decodes the records of a JSON array, a CSV body or a CSV file uploaded as "file".
+// CSV records are address,email,sponsor with an optional header.
+func readImport(c *gin.Context) ([]importRow, error) {
+	var r io.Reader
+	switch c.ContentType() {
+	case "multipart/form-data":
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	case "text/csv":
+		r = c.Request.Body
 	default:
-		c.JSON(http.StatusOK, gin.H{
-			"users": users,
-			"count": len(users),
-		})
+		var rows []importRow
+		err := json.NewDecoder(c.Request.Body).Decode(&rows)
+		return rows, err
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 3
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && strings.EqualFold(records[0][0], "address") {
+		records = records[1:]
+	}
+	rows := make([]importRow, len(records))
+	for i, rec := range records {
+		rows[i] = importRow{rec[0], rec[1], rec[2]}
+	}
+	return rows, nil
+}
+
+// importUsers writes the users of a partner directly, already activated, without any email.
+// Each row is validated like a registration; invalid rows are reported and the valid ones saved.
+func (app *App) importUsers(c *gin.Context) {
+	rows, err := readImport(c)
+	if err != nil {
+		app.fail(c, http.StatusBadRequest, codeBadRequest, "malformed records")
+		return
+	}
+	if len(rows) == 0 {
+		app.fail(c, http.StatusBadRequest, codeBadRequest, "no record to import")
 		return
 	}
+	if app.importMaxRows > 0 && len(rows) > app.importMaxRows {
+		app.fail(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("%d records, at most %d can be imported at once", len(rows), app.importMaxRows))
+		return
+	}
+
+	results := make([]importResult, len(rows))
+	var users []*data.User
+	var indexes []int // row of each user
+	addresses, emails := map[string]bool{}, map[string]bool{}
+	for i, row := range rows {
+		results[i] = importResult{Row: i, Address: row.Address}
+		u := data.NewUser(row.Address, row.Email, row.Sponsor)
+		u.Lang = mailer.DefaultLang
+		if err := app.checkImport(c.Request.Context(), u, addresses, emails); err != nil {
+			results[i].Error = describe(err)
+			continue
+		}
+		addresses[u.Address], emails[data.NormalizeEmail(u.Email)] = true, true
+		users = append(users, u)
+		indexes = append(indexes, i)
+	}
+
+	imported := 0
+	if len(users) > 0 {
+		for j, err := range app.dbOf(c.Request.Context()).SaveBatch(users) {
+			i, u := indexes[j], users[j]
+			if errors.Is(err, data.ErrUnprocessed) {
+				results[i].Error = err.Error() // throttled, worth a retry
+				continue
+			}
+			if err != nil {
+				results[i].Error = app.internal(err).Error()
+				continue
+			}
+			results[i].OK = true
+			imported++
+			app.c.Add(u.Address, u.Timestamp)
+			app.audit(c.Request.Context(), data.NewEvent(data.EventImported, u.Address, rows[i].Email, referrer(u)))
+		}
+	}
+	app.logger.Info("📥 users imported", "imported", imported, "rows", len(rows))
+	c.JSON(http.StatusOK, gin.H{
+		"imported": imported,
+		"failed":   len(rows) - imported,
+		"results":  results,
+	})
+}
+
+// checkImport returns why u cannot be imported, given the addresses and normalized emails of the previous valid rows.
+func (app *App) checkImport(ctx context.Context, u *data.User, addresses, emails map[string]bool) error {
+	if err := binding.Validator.ValidateStruct(u); err != nil {
+		return err
+	}
+	if addresses[u.Address] {
+		return fmt.Errorf("user address %s duplicated", u.Address)
+	}
+	if emails[data.NormalizeEmail(u.Email)] {
+		return errors.New("email duplicated")
+	}
+	ok, err := app.isRegistered(ctx, u.Address)
+	if err != nil {
+		return app.internal(err)
+	}
+	if ok {
+		return fmt.Errorf("user address %s already used", u.Address)
+	}
+	// the users imported in an open wave may have no sponsor
+	if sponsorless := u.Sponsor == "" && data.IsOpenWave(); !sponsorless && !addresses[u.Sponsor] && !app.genesis[u.Sponsor] {
+		ok, err := app.isRegistered(ctx, u.Sponsor)
+		if err != nil {
+			return app.internal(err)
+		}
+		if !ok {
+			return fmt.Errorf("sponsor address %s not found", u.Sponsor)
+		}
+	}
+	o, err := app.dbOf(ctx).FindByEmail(u.Email)
+	if err != nil {
+		return app.internal(err)
+	}
+	if o != nil {
+		return errors.New("email already used")
+	}
+	return nil
+}
+
+// isRegistered looks a up in the cache, then in the DB.
+func (app *App) isRegistered(ctx context.Context, a string) (bool, error) {
+	if app.c.IsPresent(a) {
+		return true, nil
+	}
+	return app.dbOf(ctx).IsPresent(a)
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/crypto"
+)
+
+// window is a period the waitlist is open in, from Start included to End excluded.
+type window struct {
+	Start, End time.Time
+}
+
+// parseWindows parses the windows of v, start/end RFC 3339 pairs separated by commas.
+func parseWindows(v string) ([]window, error) {
+	var l []window
+	for _, p := range strings.Split(v, ",") {
+		s, e, ok := strings.Cut(strings.TrimSpace(p), "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q, not start/end", p)
+		}
+		start, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of window %q: %w", p, err)
+		}
+		end, err := time.Parse(time.RFC3339, e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of window %q: %w", p, err)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("invalid window %q, ending before its start", p)
+		}
+		l = append(l, window{start, end})
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Start.Before(l[j].Start) })
+	for i := 1; i < len(l); i++ {
+		if l[i].Start.Before(l[i-1].End) {
+			return nil, errors.New("overlapping windows")
+		}
+	}
+	return l, nil
+}
+
+// schedule opens the registrations and activations during its windows only.
+type schedule struct {
+	windows []window
+	grace   time.Duration // after the end of a window, during which the tokens issued in it can still be activated
+	now     func() time.Time
+}
+
+func newSchedule(windows []window, grace time.Duration) *schedule {
+	return &schedule{windows, grace, time.Now}
+}
+
+// current returns the window of t.
+func (s *schedule) current(t time.Time) (window, bool) {
+	for _, w := range s.windows {
+		if !t.Before(w.Start) && t.Before(w.End) {
+			return w, true
+		}
+	}
+	return window{}, false
+}
+
+// next returns the first window starting after t, none once the last one started.
+func (s *schedule) next(t time.Time) (window, bool) {
+	for _, w := range s.windows {
+		if w.Start.After(t) {
+			return w, true
+		}
+	}
+	return window{}, false
+}
+
+// activatable reports whether a token issued at iat can be activated at t, in its window or its grace period.
+func (s *schedule) activatable(iat, t time.Time) bool {
+	w, ok := s.current(iat)
+	return ok && t.Before(w.End.Add(s.grace))
+}
+
+// closedResponse is the error envelope of the closed waitlist, with its next opening when one is scheduled.
+type closedResponse struct {
+	errorResponse
+	NextOpen *time.Time `json:"next_open,omitempty"`
+}
+
+// closedMessage tells when the waitlist opens again after t.
+func (s *schedule) closedMessage(t time.Time) (string, *time.Time) {
+	w, ok := s.next(t)
+	if !ok {
+		return "waitlist closed", nil
+	}
+	return "waitlist closed until " + w.Start.Format(time.RFC3339), &w.Start
+}
+
+// closed reports whether the request c is out of the windows, the activations being checked against
+// the issue time of their token: an invalid token is let through to fail as usual.
+func (app *App) closed(c *gin.Context) bool {
+	if app.schedule == nil {
+		return false
+	}
+	now := app.schedule.now()
+	if _, ok := app.schedule.current(now); ok {
+		return false
+	}
+	if t := c.Param("token"); t != "" {
+		iat, err := crypto.IssuedAt(t)
+		return err == nil && !app.schedule.activatable(iat, now)
+	}
+	return true
+}
+
+// requireOpen fails the registrations and activations while the waitlist is closed.
+func (app *App) requireOpen(c *gin.Context) {
+	if !app.closed(c) {
+		c.Next()
+		return
+	}
+	m, next := app.schedule.closedMessage(app.schedule.now())
+	if app.legacyErrors {
+		app.fail(c, http.StatusForbidden, codeWaitlistClosed, m)
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, closedResponse{
+		errorResponse{Error: apiError{Code: codeWaitlistClosed, Message: m}, RequestID: c.GetString(requestIDHeader)},
+		next,
+	})
+}
+
+// requireOpenPage fails the activations of the activation pages while the waitlist is closed.
+func (app *App) requireOpenPage(c *gin.Context) {
+	if !app.closed(c) {
+		c.Next()
+		return
+	}
+	m, _ := app.schedule.closedMessage(app.schedule.now())
+	app.activationResult(c, nil, &activationFailure{status: http.StatusForbidden, code: codeWaitlistClosed, message: m, reason: reasonWaitlistClosed})
+	c.Abort()
+}
+
+// status tells the frontend whether the waitlist is open, and until when.
+func (app *App) status(c *gin.Context) {
+	full := app.full()
+	r := gin.H{"open": !full, "full": full}
+	if app.schedule != nil {
+		now := app.schedule.now()
+		w, ok := app.schedule.current(now)
+		r["open"] = ok && !full
+		if ok {
+			r["closes_at"] = w.End
+		}
+		if n, ok := app.schedule.next(now); ok {
+			r["next_open"] = n.Start
+		}
+	}
+	c.JSON(http.StatusOK, r)
+}
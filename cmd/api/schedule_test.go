@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestParseWindows(t *testing.T) {
+	l, err := parseWindows("2026-03-09T00:00:00Z/2026-03-10T00:00:00Z, 2026-03-02T09:00:00+01:00/2026-03-02T18:00:00+01:00")
+	if err != nil || len(l) != 2 || !l[0].Start.Equal(time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("incorrect windows, got %v %v", l, err)
+		t.FailNow()
+	}
+	for _, v := range []string{
+		"2026-03-02T00:00:00Z",
+		"2026-03-02/2026-03-03",
+		"2026-03-03T00:00:00Z/2026-03-02T00:00:00Z",
+		"2026-03-02T00:00:00Z/2026-03-04T00:00:00Z,2026-03-03T00:00:00Z/2026-03-05T00:00:00Z",
+	} {
+		if _, err := parseWindows(v); err == nil {
+			t.Errorf("%q must be invalid", v)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	now := time.Now()
+	opening := now.Add(time.Hour).UTC().Truncate(time.Second)
+	app := newTestApp(data.NewMockDBContent([]string{sponsor}))
+	app.schedule = newSchedule([]window{{now.Add(-time.Hour), now.Add(-2 * time.Minute)}, {opening, opening.Add(time.Hour)}}, 5*time.Minute)
+	app.schedule.now = func() time.Time { return now }
+	r := setupRouter(app)
+
+	activate := func(issued time.Time) *httptest.ResponseRecorder {
+		a := solana.NewWallet().PublicKey().String()
+		tk, _ := app.jwt.Create(&data.User{Address: a, Email: "john.doe+" + a + "@mailservice.com", Sponsor: sponsor}, issued)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/activate/%s/%s", tk, app.jwt.Hash(tk)), nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	closed := fmt.Sprintf(`{"error":{"code":"waitlist_closed","message":"waitlist closed until %s"},"next_open":%q}`, opening.Format(time.RFC3339), opening.Format(time.RFC3339))
+	failed := func(w *httptest.ResponseRecorder) bool {
+		var res closedResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		res.RequestID = ""
+		b, _ := json.Marshal(res)
+		return w.Code == http.StatusForbidden && string(b) == closed
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/register", strings.NewReader(fmt.Sprintf(`{"address":"5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF","email":"john.doe@mailservice.com","sponsor":%q}`, sponsor)))
+	r.ServeHTTP(w, req)
+	if !failed(w) {
+		t.Errorf("the registrations must fail outside the windows, got %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+	if w := activate(now.Add(-2 * time.Hour)); !failed(w) {
+		t.Errorf("the tokens issued outside the windows must fail, got %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+	if w := activate(now.Add(-5 * time.Minute)); w.Code != http.StatusCreated {
+		t.Errorf("the tokens issued in a window must be activated in its grace period, got %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+	app.schedule.now = func() time.Time { return now.Add(10 * time.Minute) }
+	if w := activate(now.Add(-5 * time.Minute)); !failed(w) {
+		t.Errorf("the tokens issued in a window must fail after its grace period, got %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	tk, _ := app.jwt.Create(&data.User{Address: solana.NewWallet().PublicKey().String(), Email: "john.doe@mailservice.com", Sponsor: sponsor}, now.Add(-2*time.Hour))
+	req, _ = http.NewRequest("GET", "/activate/"+tk, nil)
+	req.Header.Set("Accept", "text/html")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), reasonMessages[reasonWaitlistClosed]) {
+		t.Errorf("the activation page must fail outside the windows, got %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+
+	app.schedule.now = func() time.Time { return opening }
+	if w := activate(time.Now()); w.Code != http.StatusCreated {
+		t.Errorf("the activations must succeed in a window, got %d %s", w.Code, w.Body.String())
+		t.FailNow()
+	}
+}
+
+func TestStatus(t *testing.T) {
+	opening := time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)
+	closing := opening.Add(8 * time.Hour)
+	tt := []struct {
+		name string
+		now  time.Time
+		cap  int
+		want string
+	}{
+		{"always open", time.Time{}, 0, `{"full":false,"open":true}`},
+		{"before", opening.Add(-time.Minute), 0, `{"full":false,"next_open":"2026-03-09T09:00:00Z","open":false}`},
+		{"open", opening, 0, `{"closes_at":"2026-03-09T17:00:00Z","full":false,"open":true}`},
+		{"full", opening, 1, `{"closes_at":"2026-03-09T17:00:00Z","full":true,"open":false}`},
+		{"after", closing, 0, `{"full":false,"open":false}`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newTestApp(data.MockDB)
+			app.waitlistCap = tc.cap
+			app.c.Add(sponsor, 1)
+			if !tc.now.IsZero() {
+				app.schedule = newSchedule([]window{{opening, closing}}, time.Minute)
+				app.schedule.now = func() time.Time { return tc.now }
+			}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/status", nil)
+			setupRouter(app).ServeHTTP(w, req)
+			if w.Code != http.StatusOK || w.Body.String() != tc.want {
+				t.Errorf("incorrect status, got %d %s, want %s", w.Code, w.Body.String(), tc.want)
+				t.FailNow()
+			}
+		})
+	}
+}
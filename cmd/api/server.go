@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// server serves the router over HTTP, over HTTPS with a certificate from files,
+// or over HTTPS with certificates obtained from Let's Encrypt.
+type server struct {
+	srv               *http.Server
+	certFile, keyFile string       // TLS from files
+	challenge         *http.Server // HTTP-01 challenges and redirection to HTTPS, autocert only
+}
+
+func newServer(addr string, h http.Handler) *server {
+	return &server{srv: &http.Server{
+		Addr:           addr,
+		Handler:        h,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   20 * time.Second,
+		IdleTimeout:    time.Minute,
+		MaxHeaderBytes: 1 << 20, // 1 MB
+	}}
+}
+
+// withCert serves HTTPS with the PEM certificate and key of the files.
+func (s *server) withCert(certFile, keyFile string) *server {
+	s.certFile, s.keyFile = certFile, keyFile
+	return s
+}
+
+// withAutocert serves HTTPS for hosts with certificates of Let's Encrypt, kept in the dir cache.
+// The HTTP-01 challenges are answered on httpAddr, where other requests are redirected to HTTPS.
+func (s *server) withAutocert(hosts []string, dir, httpAddr string) *server {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(dir),
+	}
+	s.srv.TLSConfig = m.TLSConfig()
+	s.challenge = &http.Server{
+		Addr:              httpAddr,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+	return s
+}
+
+func (s *server) scheme() string {
+	if s.certFile != "" || s.challenge != nil {
+		return "HTTPS"
+	}
+	return "HTTP"
+}
+
+// ListenAndServe listens on the address of the server then serves, see Serve.
+func (s *server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves on l until Shutdown, returning http.ErrServerClosed then.
+// In autocert mode, the challenge listener must be bound for the server to start.
+func (s *server) Serve(l net.Listener) error {
+	switch {
+	case s.challenge != nil:
+		cl, err := net.Listen("tcp", s.challenge.Addr)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		go func() {
+			if err := s.challenge.Serve(cl); !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("👹 HTTP-01 challenge server", slog.Any("error", err))
+			}
+		}()
+		logger.Info("🔏 HTTP-01 challenges served", "addr", cl.Addr().String())
+		return s.srv.ServeTLS(l, "", "")
+	case s.certFile != "":
+		return s.srv.ServeTLS(l, s.certFile, s.keyFile)
+	}
+	return s.srv.Serve(l)
+}
+
+// Shutdown gracefully stops both listeners, see http.Server.Shutdown.
+func (s *server) Shutdown(ctx context.Context) error {
+	var err error
+	if s.challenge != nil {
+		err = s.challenge.Shutdown(ctx)
+	}
+	return errors.Join(err, s.srv.Shutdown(ctx))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// selfSigned writes a certificate for 127.0.0.1 and its key in dir, returning their paths and the certificate.
+func selfSigned(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "waitlist test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	kd, err := x509.MarshalECPrivateKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kd}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+// start serves s on a random local port, returning its address and the result of Serve.
+func start(t *testing.T, s *server) (string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	return l.Addr().String(), served
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, cert := selfSigned(t, t.TempDir())
+	s := newServer("", setupRouter(newTestApp(data.MockDB))).withCert(certFile, keyFile)
+	if s.scheme() != "HTTPS" {
+		t.Errorf("incorrect scheme, got %s, want HTTPS", s.scheme())
+		t.FailNow()
+	}
+	addr, served := start(t, s)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	req, _ := http.NewRequest(http.MethodGet, "https://"+addr+"/health", nil)
+	addAPIKey(req)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Errorf("cannot GET /health over TLS: %v", err)
+		t.FailNow()
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.TLS == nil {
+		t.Errorf("incorrect response, got %d (TLS %v), want 200 over TLS", res.StatusCode, res.TLS != nil)
+		t.FailNow()
+	}
+
+	if res, err := http.Get("http://" + addr + "/health"); err == nil {
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("plain HTTP must not be served, got %d", res.StatusCode)
+			t.FailNow()
+		}
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("incorrect shutdown error, got %v, want nil", err)
+		t.FailNow()
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("incorrect Serve error, got %v, want %v", err, http.ErrServerClosed)
+		t.FailNow()
+	}
+}
+
+func TestServeAutocert(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0") // a free port for the challenges, :80 needing privileges
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := l.Addr().String()
+	l.Close()
+	s := newServer("", http.NotFoundHandler()).withAutocert([]string{"waitlist.example.com"}, t.TempDir(), challenge)
+	addr, served := start(t, s)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	var res *http.Response
+	for i := 0; i < 100; i++ { // until the challenge listener is bound
+		if res, err = client.Get("http://" + challenge + "/health"); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("cannot reach the challenge listener: %v", err)
+		t.FailNow()
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound || res.Header.Get("Location") == "" {
+		t.Errorf("plain HTTP must be redirected to HTTPS, got %d", res.StatusCode)
+		t.FailNow()
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("incorrect shutdown error, got %v, want nil", err)
+		t.FailNow()
+	}
+	<-served
+	for _, a := range []string{addr, challenge} {
+		if c, err := net.Dial("tcp", a); err == nil {
+			c.Close()
+			t.Errorf("listener %s must be closed by Shutdown", a)
+			t.FailNow()
+		}
+	}
+}
+
+func TestAdminListener(t *testing.T) {
+	app := newTestApp(data.MockDB)
+	app.srv = newServer("", newRouter(app, publicRoutes))
+	app.adminSrv = newServer("", newRouter(app, adminRoutes))
+	public, publicServed := start(t, app.srv)
+	admin, adminServed := start(t, app.adminSrv)
+
+	// served reports whether the listener at addr has a route for path, the missing ones being not found
+	served := func(addr, path string) bool {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+		addAPIKey(req)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode != http.StatusNotFound || !strings.Contains(string(b), `"code":"not_found"`)
+	}
+	address := solana.NewWallet().PublicKey().String()
+	tt := []struct {
+		path          string
+		public, admin bool
+	}{
+		{"/health", true, true},
+		{"/ready", true, true},
+		{"/status", true, false},
+		{"/check-wallet/" + address, true, false},
+		{"/metrics", false, true},
+		{"/path1/path2/stats", false, true},
+		{"/debug/pprof/", false, true},
+		{"/debug/pprof/cmdline", false, true},
+	}
+	for _, tc := range tt {
+		if got := served(public, tc.path); got != tc.public {
+			t.Errorf("incorrect route %s on the public listener, got %v, want %v", tc.path, got, tc.public)
+			t.FailNow()
+		}
+		if got := served(admin, tc.path); got != tc.admin {
+			t.Errorf("incorrect route %s on the admin listener, got %v, want %v", tc.path, got, tc.admin)
+			t.FailNow()
+		}
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil)
+	addAPIKey(req)
+	setupRouter(app).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("the single listener must not serve pprof, got %d", w.Code)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	app.Shutdown(ctx)
+	for name, served := range map[string]chan error{"public": publicServed, "admin": adminServed} {
+		if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("the %s listener must be shut down with the app, got %v", name, err)
+			t.FailNow()
+		}
+	}
+}
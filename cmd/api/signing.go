@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/cache"
+	"github.com/unleaktrade/waitlist/pkg/client"
+)
+
+// maxSkew is the largest difference between the timestamp of a signed request and the server's clock.
+const maxSkew = 5 * time.Minute
+
+var (
+	errUnsigned         = errors.New("request signature required")
+	errSkewed           = fmt.Errorf("request timestamp not within %v", maxSkew)
+	errRequestSignature = errors.New("invalid request signature")
+	errReplayedRequest  = errors.New("request signature already used")
+)
+
+// requestSignatures verifies the signatures of the requests of the signed keys, each one being accepted once:
+// the same request sent twice within a second must wait for the next one.
+// The signatures seen are kept in memory: a replay reaching another replica is accepted within the skew.
+type requestSignatures struct {
+	now func() time.Time
+
+	mu   sync.Mutex
+	seen *cache.Cache[bool] // signatures accepted, until their timestamp is out of the skew
+}
+
+func newRequestSignatures() *requestSignatures {
+	return &requestSignatures{now: time.Now, seen: cache.NewOf[bool](cache.WithTTL(2 * maxSkew))}
+}
+
+// verify checks the timestamp and signature of r with secret, then burns the signature.
+// The body of r is read, then replaced by a copy.
+func (s *requestSignatures) verify(r *http.Request, secret string) error {
+	ts, sig := r.Header.Get(client.TimestampHeader), r.Header.Get(client.SignatureHeader)
+	if ts == "" || sig == "" {
+		return errUnsigned
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errRequestSignature
+	}
+	if d := s.now().Sub(time.Unix(sec, 0)); d > maxSkew || d < -maxSkew {
+		return errSkewed
+	}
+	var body []byte
+	if r.Body != nil {
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if !hmac.Equal([]byte(sig), []byte(client.Signature(secret, r.Method, r.URL.RequestURI(), ts, body))) {
+		return errRequestSignature
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen.IsPresent(sig) {
+		return errReplayedRequest
+	}
+	s.seen.Add(sig, true)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/pkg/client"
+)
+
+func TestSignedKeys(t *testing.T) {
+	app := newTestApp(data.MockDB)
+	app.apiKeys["partner"] = apiKey{Scopes: []string{scopeRegister, scopeCheck}, Signed: true, Secret: "s3cr3t"}
+	now := time.Now()
+	app.signatures.now = func() time.Time { return now }
+	r := setupRouter(app)
+	check := "/check-wallet/5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	body := `{"address":"5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF","email":"john.doe@mailservice.com","sponsor":"` + sponsor + `"}`
+
+	// signed returns a request signed at t, its body replaced by sent when not empty
+	signed := func(method, path, body, sent string, t time.Time) *http.Request {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("UNLK-API-KEY", "partner")
+		client.Sign(req, "s3cr3t", t)
+		if sent != "" {
+			req.Body = io.NopCloser(strings.NewReader(sent))
+		}
+		return req
+	}
+	replayed := signed("GET", check, "", "", now.Add(-time.Second))
+	r.ServeHTTP(httptest.NewRecorder(), signed("GET", check, "", "", now.Add(-time.Second)))
+	unsigned, _ := http.NewRequest("GET", check, nil)
+	unsigned.Header.Set("UNLK-API-KEY", "partner")
+	other := signed("GET", check, "", "", now.Add(-2*time.Second))
+	other.URL.Path = "/check-wallet/Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg"
+	wrongSecret, _ := http.NewRequest("GET", check, nil)
+	wrongSecret.Header.Set("UNLK-API-KEY", "partner")
+	client.Sign(wrongSecret, "0th3r", now.Add(-3*time.Second))
+
+	tt := []struct {
+		name   string
+		req    *http.Request
+		status int
+		want   string
+	}{
+		{"signed", signed("GET", check, "", "", now), http.StatusOK, ""},
+		{"signed body", signed("POST", "/register", body, "", now), http.StatusAccepted, ""},
+		{"signed within skew", signed("GET", check, "", "", now.Add(-4*time.Minute)), http.StatusOK, ""},
+		{"unsigned", unsigned, http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"request signature required"}}`},
+		{"past skew", signed("GET", check, "", "", now.Add(-6*time.Minute)), http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"request timestamp not within 5m0s"}}`},
+		{"future skew", signed("GET", check, "", "", now.Add(6*time.Minute)), http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"request timestamp not within 5m0s"}}`},
+		{"replayed", replayed, http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"request signature already used"}}`},
+		{"tampered body", signed("POST", "/register", body, strings.Replace(body, "john.doe", "jane.doe", 1), now), http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"invalid request signature"}}`},
+		{"tampered path", other, http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"invalid request signature"}}`},
+		{"wrong secret", wrongSecret, http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"invalid request signature"}}`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tc.req)
+			if w.Code != tc.status {
+				t.Errorf("incorrect status, got %d, want %d: %s", w.Code, tc.status, w.Body.String())
+				t.FailNow()
+			}
+			if tc.want != "" && errorJSON(w) != tc.want {
+				t.Errorf("incorrect body, got %s, want %s", errorJSON(w), tc.want)
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("unsigned key", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", check, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("the keys not signed must not need a signature, got %d", w.Code)
+			t.FailNow()
+		}
+	})
+}
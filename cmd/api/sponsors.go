@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// resolved replaces the .sol sponsor of u by the address it resolves to, before u is validated.
+// It returns false when the sponsor cannot be resolved, the request being answered.
+func (app *App) resolved(c *gin.Context, u *data.User) bool {
+	if app.resolver == nil || !strings.HasSuffix(strings.ToLower(u.Sponsor), ".sol") {
+		return true
+	}
+	a, err := app.resolver.Resolve(u.Sponsor)
+	if err != nil {
+		if errors.Is(err, data.ErrResolverUnavailable) {
+			app.logger.Warn("⚠️ cannot resolve the sponsor", "sponsor", u.Sponsor, slog.Any("error", err))
+		}
+		app.fail(c, http.StatusBadRequest, codeSponsorUnresolvable, "sponsor "+u.Sponsor+" cannot be resolved", fieldError{"sponsor", "resolvable"})
+		return false
+	}
+	app.logger.Info("🏷️ sponsor resolved", "name", u.Sponsor, "sponsor", a)
+	u.Sponsor = a
+	return true
+}
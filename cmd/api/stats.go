@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	statsDate       = "2006-01-02"
+	maxStatsBuckets = 1000
+)
+
+// statsBucket counts the activations, or the registrations, of the day or week starting at Start.
+type statsBucket struct {
+	Start string `json:"start"` // date in the time zone of the stats
+	Count int    `json:"count"`
+}
+
+type statsResponse struct {
+	Granularity string        `json:"granularity"`
+	By          string        `json:"by"` // time bucketed, of the activations or of the registrations
+	From        string        `json:"from"`
+	To          string        `json:"to"`
+	TimeZone    string        `json:"time_zone"`
+	Buckets     []statsBucket `json:"buckets"`
+	Total       int           `json:"total"` // activations within the buckets
+	AllTime     int           `json:"all_time"`
+	// GrowthRate is the size of the waitlist over the last bucket, relative to its size before, none when it was empty.
+	GrowthRate *float64 `json:"growth_rate,omitempty"`
+	Undated    int      `json:"undated,omitempty"` // users saved before their registration time was, by registration
+}
+
+// bucketStart returns the start of the day or the week, from Monday, of t.
+func bucketStart(t time.Time, week bool) time.Time {
+	d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if week {
+		d = d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	}
+	return d
+}
+
+// activationTimes returns the activation timestamps, from the cache once loaded from the DB,
+// else from the DB as a restored snapshot may miss the latest activations.
+func (app *App) activationTimes() ([]int64, error) {
+	var l []int64
+	if app.c.Stats().Fills == 0 {
+		users, err := app.db.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			l = append(l, u.Timestamp)
+		}
+		return l, nil
+	}
+	app.c.Range(func(_ string, ts int64) bool {
+		l = append(l, ts)
+		return true
+	})
+	return l, nil
+}
+
+// registrationTimes returns the registration timestamps from the DB, the cache lacking them,
+// and the number of users saved without one.
+func (app *App) registrationTimes(ctx context.Context) (l []int64, undated int, err error) {
+	users, err := app.dbOf(ctx).List()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, u := range users {
+		if u.RegisteredAt == 0 {
+			undated++
+			continue
+		}
+		l = append(l, u.RegisteredAt)
+	}
+	return l, undated, nil
+}
+
+func (app *App) stats(c *gin.Context) {
+	var q struct {
+		Granularity string `form:"granularity" json:"granularity" binding:"omitempty,oneof=day week"`
+		From        string `form:"from" json:"from" binding:"omitempty,datetime=2006-01-02"`
+		To          string `form:"to" json:"to" binding:"omitempty,datetime=2006-01-02"`
+		TimeZone    string `form:"tz" json:"tz" binding:"omitempty,timezone"`
+		By          string `form:"by" json:"by" binding:"omitempty,oneof=activation registration"`
+	}
+	if err := c.ShouldBindQuery(&q); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	if q.Granularity == "" {
+		q.Granularity = "day"
+	}
+	if q.By == "" {
+		q.By = "activation"
+	}
+	week := q.Granularity == "week"
+	l := app.exportTZ
+	if q.TimeZone != "" {
+		l, _ = time.LoadLocation(q.TimeZone) // validated
+	}
+	to := bucketStart(time.Now().In(l), week)
+	if q.To != "" {
+		to, _ = time.ParseInLocation(statsDate, q.To, l)
+		to = bucketStart(to, week)
+	}
+	from := to.AddDate(0, 0, -29)
+	if week {
+		from = to.AddDate(0, 0, -7*11)
+	}
+	if q.From != "" {
+		from, _ = time.ParseInLocation(statsDate, q.From, l)
+		from = bucketStart(from, week)
+	}
+	if from.After(to) {
+		app.fail(c, http.StatusBadRequest, codeValidation, "invalid from, after to", fieldError{"from", "ltefield=to"})
+		return
+	}
+
+	var starts []time.Time
+	for d := from; !d.After(to); {
+		if len(starts) == maxStatsBuckets {
+			app.fail(c, http.StatusBadRequest, codeValidation, fmt.Sprintf("invalid from, more than %d buckets until to", maxStatsBuckets), fieldError{"from", "buckets"})
+			return
+		}
+		starts = append(starts, d)
+		if week {
+			d = d.AddDate(0, 0, 7)
+		} else {
+			d = d.AddDate(0, 0, 1)
+		}
+	}
+	end := starts[len(starts)-1].AddDate(0, 0, 1)
+	if week {
+		end = starts[len(starts)-1].AddDate(0, 0, 7)
+	}
+
+	var times []int64
+	var undated int
+	var err error
+	if q.By == "registration" {
+		times, undated, err = app.registrationTimes(c.Request.Context())
+	} else {
+		times, err = app.activationTimes()
+	}
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	r := statsResponse{
+		Granularity: q.Granularity,
+		By:          q.By,
+		From:        from.Format(statsDate),
+		To:          to.Format(statsDate),
+		TimeZone:    l.String(),
+		Buckets:     make([]statsBucket, len(starts)),
+		AllTime:     len(times),
+		Undated:     undated,
+	}
+	for i, s := range starts {
+		r.Buckets[i].Start = s.Format(statsDate)
+	}
+	last, before := starts[len(starts)-1], 0
+	for _, ts := range times {
+		t := time.UnixMilli(ts).In(l)
+		if t.Before(last) {
+			before++
+		}
+		if t.Before(from) || !t.Before(end) {
+			continue
+		}
+		i := sort.Search(len(starts), func(i int) bool { return starts[i].After(t) }) - 1
+		r.Buckets[i].Count++
+		r.Total++
+	}
+	if before > 0 {
+		g := float64(r.Buckets[len(starts)-1].Count) / float64(before)
+		r.GrowthRate = &g
+	}
+	c.JSON(http.StatusOK, r)
+}
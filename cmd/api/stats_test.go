@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// activationsDB lists users activated at the times of a list, other methods are those of the wrapped DB.
+type activationsDB struct {
+	data.DB
+	times []time.Time
+}
+
+func (db activationsDB) List(...int) ([]*data.User, error) {
+	users := []*data.User{}
+	for _, t := range db.times {
+		users = append(users, &data.User{Address: t.String(), Timestamp: t.UnixMilli()})
+	}
+	return users, nil
+}
+
+// registrationsDB lists users registered a day before their activation at the times of a list, the first one
+// saved before the registration times were.
+type registrationsDB struct {
+	activationsDB
+}
+
+func (db registrationsDB) List(...int) ([]*data.User, error) {
+	users, _ := db.activationsDB.List()
+	for _, u := range users[1:] {
+		u.RegisteredAt, u.ActivatedAt = u.Timestamp-24*3600000, u.Timestamp
+	}
+	return users, nil
+}
+
+func getStats(t *testing.T, app *App, query string) (*httptest.ResponseRecorder, statsResponse) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/path1/path2/stats"+query, nil)
+	addAPIKey(req)
+	setupRouter(app).ServeHTTP(w, req)
+	var res statsResponse
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, res
+}
+
+func counts(res statsResponse) map[string]int {
+	m := map[string]int{}
+	for _, b := range res.Buckets {
+		m[b.Start] = b.Count
+	}
+	return m
+}
+
+func TestStats(t *testing.T) {
+	times := []time.Time{
+		time.Date(2026, 2, 20, 12, 0, 0, 0, time.UTC), // before the ranges
+		time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC),  // a Monday
+		time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC), // March 3 in Tokyo
+		time.Date(2026, 3, 4, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC),
+	}
+	app := newTestApp(activationsDB{data.MockDB, times})
+
+	tt := []struct {
+		name   string
+		query  string
+		want   map[string]int
+		total  int
+		growth float64
+	}{
+		{"days", "?from=2026-03-01&to=2026-03-04", map[string]int{"2026-03-01": 0, "2026-03-02": 2, "2026-03-03": 0, "2026-03-04": 1}, 3, 1.0 / 3},
+		{"time zone", "?from=2026-03-02&to=2026-03-03&tz=Asia/Tokyo", map[string]int{"2026-03-02": 1, "2026-03-03": 1}, 2, 1.0 / 2},
+		{"weeks", "?granularity=week&from=2026-02-18&to=2026-03-11", map[string]int{"2026-02-16": 1, "2026-02-23": 0, "2026-03-02": 3, "2026-03-09": 1}, 5, 1.0 / 4},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w, res := getStats(t, app, tc.query)
+			if w.Code != http.StatusOK {
+				t.Errorf("incorrect status, got %d: %s", w.Code, w.Body.String())
+				t.FailNow()
+			}
+			got := counts(res)
+			if len(got) != len(tc.want) || res.Total != tc.total || res.AllTime != len(times) {
+				t.Errorf("incorrect stats, got %v with %d of %d, want %v with %d", got, res.Total, res.AllTime, tc.want, tc.total)
+				t.FailNow()
+			}
+			for d, n := range tc.want {
+				if got[d] != n {
+					t.Errorf("incorrect count of %s, got %d, want %d", d, got[d], n)
+					t.FailNow()
+				}
+			}
+			if res.GrowthRate == nil || *res.GrowthRate != tc.growth {
+				t.Errorf("incorrect growth rate, got %v, want %v", res.GrowthRate, tc.growth)
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("empty range", func(t *testing.T) {
+		w, res := getStats(t, newTestApp(activationsDB{data.MockDB, nil}), "?from=2026-03-01&to=2026-03-07")
+		if w.Code != http.StatusOK || len(res.Buckets) != 7 || res.Total != 0 || res.GrowthRate != nil {
+			t.Errorf("an empty range must have zero buckets, got %d: %+v", w.Code, res)
+			t.FailNow()
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		app := newTestApp(data.NewMockDB().FailOn("List", ""))
+		m := map[string]int64{}
+		for _, ts := range times {
+			m[ts.String()] = ts.UnixMilli()
+		}
+		app.c.Fill(m)
+		w, res := getStats(t, app, "?from=2026-03-09&to=2026-03-09")
+		if w.Code != http.StatusOK || res.Total != 1 || res.AllTime != len(times) {
+			t.Errorf("the stats must be read from the filled cache, got %d: %+v", w.Code, res)
+			t.FailNow()
+		}
+	})
+
+	t.Run("registrations", func(t *testing.T) {
+		app := newTestApp(registrationsDB{activationsDB{data.MockDB, times}})
+		app.c.Fill(map[string]int64{"a": 1}) // not read
+		w, res := getStats(t, app, "?by=registration&from=2026-03-01&to=2026-03-08")
+		got := counts(res)
+		if w.Code != http.StatusOK || res.By != "registration" || res.Total != 4 || res.AllTime != len(times)-1 || res.Undated != 1 || got["2026-03-01"] != 2 || got["2026-03-03"] != 1 || got["2026-03-08"] != 1 {
+			t.Errorf("the registrations must be bucketed by their time, got %d: %+v", w.Code, res)
+			t.FailNow()
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		w, res := getStats(t, app, "")
+		if w.Code != http.StatusOK || res.By != "activation" || res.Granularity != "day" || len(res.Buckets) != 30 || res.TimeZone != "UTC" {
+			t.Errorf("incorrect default stats, got %d: %s %d buckets in %s", w.Code, res.Granularity, len(res.Buckets), res.TimeZone)
+			t.FailNow()
+		}
+		if res.To != time.Now().UTC().Format(statsDate) {
+			t.Errorf("the stats must end today, got %s", res.To)
+			t.FailNow()
+		}
+	})
+
+	for query, want := range map[string]string{
+		"?granularity=month":             `{"error":{"code":"validation_failed","message":"invalid granularity","fields":[{"field":"granularity","rule":"oneof"}]}}`,
+		"?from=03/01/2026":               `{"error":{"code":"validation_failed","message":"invalid from","fields":[{"field":"from","rule":"datetime"}]}}`,
+		"?by=invitation":                 `{"error":{"code":"validation_failed","message":"invalid by","fields":[{"field":"by","rule":"oneof"}]}}`,
+		"?tz=Mars/Olympus":               `{"error":{"code":"validation_failed","message":"invalid tz","fields":[{"field":"tz","rule":"timezone"}]}}`,
+		"?from=2026-03-05&to=2026-03-04": `{"error":{"code":"validation_failed","message":"invalid from, after to","fields":[{"field":"from","rule":"ltefield=to"}]}}`,
+		"?from=2000-01-01&to=2026-03-04": `{"error":{"code":"validation_failed","message":"invalid from, more than 1000 buckets until to","fields":[{"field":"from","rule":"buckets"}]}}`,
+	} {
+		w, _ := getStats(t, app, query)
+		if w.Code != http.StatusBadRequest || errorJSON(w) != want {
+			t.Errorf("incorrect error of %s, got %d %s, want %s", query, w.Code, errorJSON(w), want)
+			t.FailNow()
+		}
+	}
+
+	w, _ := getStats(t, newTestApp(data.NewMockDB().FailOn("List", "")), "")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("a DB error must fail the stats, got %d", w.Code)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+type specResponse struct {
+	Content map[string]struct {
+		Schema struct {
+			Ref string `json:"$ref"`
+		} `json:"schema"`
+	} `json:"content"`
+}
+
+type specOperation struct {
+	Security  []map[string][]string   `json:"security"`
+	Responses map[string]specResponse `json:"responses"`
+}
+
+type spec struct {
+	Paths      map[string]map[string]specOperation `json:"paths"`
+	Components struct {
+		SecuritySchemes map[string]struct {
+			Type, In, Name, Scheme string
+		} `json:"securitySchemes"`
+	} `json:"components"`
+}
+
+// ginParam matches the parameters of the gin paths, {name} in the spec.
+var ginParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// TestSpec fails when the served spec is missing a route of the router, or misdocuments its security and errors.
+func TestSpec(t *testing.T) {
+	b, err := swaggerFS.ReadFile("swagger/swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s spec
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	if k := s.Components.SecuritySchemes["ApiKeyAuth"]; k.Type != "apiKey" || k.In != "header" || k.Name != "UNLK-API-KEY" {
+		t.Fatalf("the API key security scheme must be the UNLK-API-KEY header, got %+v", k)
+	}
+	if a := s.Components.SecuritySchemes["AdminAuth"]; a.Type != "http" || a.Scheme != "bearer" {
+		t.Fatalf("the admin security scheme must be a bearer token, got %+v", a)
+	}
+
+	// the documentation itself, the debug routes, and the routes callable without API key
+	undocumented := map[string]bool{"GET /": true, "GET /doc": true, "GET /openapi.json": true, "GET /swagger/*any": true, "GET /debug/panic": true}
+	public := map[string]bool{
+		"POST /register":                true,
+		"GET /status":                   true,
+		"GET /challenge":                true,
+		"GET /nonce/{address}":          true,
+		"POST /activate/{token}/{hash}": true,
+		"GET /activate/{token}":         true,
+		"POST /activate/{token}":        true,
+		"GET /unsubscribe/{token}":      true,
+		"POST /unsubscribe/{token}":     true,
+		"GET /download/{sig}":           true,
+	}
+	// error responses with another body than the envelope, the HEAD ones having none
+	bare := map[string]bool{"GET /check-wallet/{address} 404": true, "GET /ready 503": true}
+
+	app := newTestApp(data.MockDB)
+	for _, rt := range setupRouter(app).Routes() {
+		route := rt.Method + " " + ginParam.ReplaceAllString(rt.Path, "{$1}")
+		if undocumented[route] {
+			continue
+		}
+		t.Run(route, func(t *testing.T) {
+			path := strings.TrimPrefix(route, rt.Method+" ")
+			op, ok := s.Paths[path][strings.ToLower(rt.Method)]
+			if !ok {
+				t.Errorf("%s missing from the spec", route)
+				t.FailNow()
+			}
+			schemes := map[string]bool{}
+			for _, r := range op.Security {
+				for k := range r {
+					schemes[k] = true
+				}
+			}
+			if !public[route] && !schemes["ApiKeyAuth"] {
+				t.Errorf("%s must require the API key", route)
+				t.FailNow()
+			}
+			if strings.HasPrefix(path, "/admin/") && !schemes["AdminAuth"] {
+				t.Errorf("%s must require an admin token", route)
+				t.FailNow()
+			}
+			for status, res := range op.Responses {
+				if status[0] != '4' && status[0] != '5' || bare[route+" "+status] || rt.Method == "HEAD" {
+					continue
+				}
+				if res.Content["application/json"].Schema.Ref != "#/components/schemas/ErrorResponse" {
+					t.Errorf("the %s response of %s must be the error envelope", status, route)
+					t.FailNow()
+				}
+			}
+		})
+	}
+
+	for _, path := range []string{"/admin/list", "/{path1}/{path2}/list"} {
+		content := s.Paths[path]["get"].Responses["200"].Content
+		for _, f := range listFormats {
+			mt, _, _ := mime.ParseMediaType(f.mediaType)
+			if _, ok := content[mt]; !ok {
+				t.Errorf("the %s list of %s missing from the spec", f.name, path)
+				t.FailNow()
+			}
+		}
+	}
+}
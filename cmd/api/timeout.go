@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errTimeout is all the clients know of a request exceeding its deadline.
+var errTimeout = errors.New("request timed out")
+
+// timeout bounds the requests of a route by d, no bound when 0: their context is cancelled at the deadline,
+// cancelling their DB calls, and they fail with 504 unless the handler already responded.
+// The handler is not preempted, it returns once its calls in progress observe the cancellation.
+func (app *App) timeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		if timedOut(c) && !c.Writer.Written() {
+			app.fail(c, http.StatusGatewayTimeout, codeTimeout, errTimeout.Error())
+		}
+	}
+}
+
+// timedOut reports whether the request c exceeded its deadline.
+func timedOut(c *gin.Context) bool {
+	return errors.Is(c.Request.Context().Err(), context.DeadlineExceeded)
+}
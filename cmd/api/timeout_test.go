@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+const timeoutJSON = `{"error":{"code":"timeout","message":"request timed out"}}`
+
+func TestTimeout(t *testing.T) {
+	db := data.NewMockDB().Delay("IsPresent", 50*time.Millisecond).Delay("List", 50*time.Millisecond)
+	app := newTestApp(db)
+	app.fastTimeout = 20 * time.Millisecond
+	app.slowTimeout = 20 * time.Millisecond
+	r := setupRouter(app)
+
+	w := activate(app, r, solana.NewWallet().PublicKey().String())
+	if w.Code != http.StatusGatewayTimeout || errorJSON(w) != timeoutJSON {
+		t.Errorf("an activation slower than its timeout must time out, got %d: %s", w.Code, errorJSON(w))
+		t.FailNow()
+	}
+	// the lookup of the sponsor, after the one of the address, fails with the cancelled context
+	if db.Calls("IsPresent") != 1 || db.Calls("FindByEmail") != 0 || db.Calls("Save") != 0 {
+		t.Errorf("the activation must stop at the timeout, got %d lookups and %d saves", db.Calls("IsPresent"), db.Calls("Save"))
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/path1/path2/list", nil)
+	addAPIKey(req)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusGatewayTimeout || errorJSON(w) != timeoutJSON {
+		t.Errorf("a list slower than its timeout must time out, got %d: %s", w.Code, errorJSON(w))
+		t.FailNow()
+	}
+
+	app.slowTimeout = time.Second
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/path1/path2/list", nil)
+	addAPIKey(req)
+	setupRouter(app).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("a list within its timeout must be answered, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	app := newTestApp(data.NewMockDB())
+	r := gin.New()
+	cancelled := make(chan bool, 1)
+	r.GET("/wait", app.timeout(10*time.Millisecond), func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			cancelled <- true
+		case <-time.After(time.Second):
+			cancelled <- false
+		}
+	})
+	r.GET("/written", app.timeout(10*time.Millisecond), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+		<-c.Request.Context().Done()
+	})
+	r.GET("/unbounded", app.timeout(0), func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/wait", nil)
+	r.ServeHTTP(w, req)
+	if !<-cancelled {
+		t.Errorf("the handler must observe the cancellation of its context")
+		t.FailNow()
+	}
+	if w.Code != http.StatusGatewayTimeout || errorJSON(w) != timeoutJSON {
+		t.Errorf("a handler not responding before the timeout must fail with 504, got %d: %s", w.Code, errorJSON(w))
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/written", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("a response written before the timeout must be kept, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/unbounded", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("no deadline must be set for a zero timeout, got %d", w.Code)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingService names the waitlist in the traces, unless OTEL_SERVICE_NAME is set.
+const tracingService = "waitlist"
+
+// traceRequests returns the middlewares tracing the requests, a no-op until tracing.Setup is called.
+// The url.path of a span is its route, not to export the tokens of the activation and unsubscribe links.
+func traceRequests() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		otelgin.Middleware(tracingService),
+		func(c *gin.Context) {
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("url.path", c.FullPath()))
+			c.Next()
+		},
+	}
+}
+
+// dbOf returns the DB of the calls made for ctx, traced as children of its span, its writes revising the users.
+func (app *App) dbOf(ctx context.Context) data.DB {
+	return revisedDB{data.Traced(ctx, app.db), &app.revision}
+}
+
+// traceSend starts the span of a direct send of template t, a child of the span of ctx
+// but outliving it as the send is queued on the mail dispatcher.
+func (app *App) traceSend(ctx context.Context, t string) trace.Span {
+	_, span := tracing.Tracer("mailer").Start(trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx)), "mailer.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("email.template", t), attribute.String("mail.provider", app.mailProvider)),
+	)
+	return span
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans records the spans of the test in memory, until it ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return sr
+}
+
+// attr returns the value of the attribute k of s, empty when absent.
+func attr(s sdktrace.ReadOnlySpan, k string) string {
+	for _, a := range s.Attributes() {
+		if string(a.Key) == k {
+			return a.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTraceRegister(t *testing.T) {
+	sr := recordSpans(t)
+	db := data.NewMemoryDB()
+	app := newTestApp(db)
+	app.outbox = mailer.NewOutboxWorker(db, mailer.NewMockSmtpMailer(0), app.metrics, time.Hour, time.Minute).WithProvider("smtp")
+	r := setupRouter(app)
+
+	email := "john.doe@mailservice.com"
+	w := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"address":%q,"email":%q,"sponsor":%q}`, solana.NewWallet().PublicKey().String(), email, sponsor)
+	req, _ := http.NewRequest("POST", "/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("cannot register, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	app.outbox.Tick() // sent after the request
+
+	var server, send sdktrace.ReadOnlySpan
+	var queries []sdktrace.ReadOnlySpan
+	for _, s := range sr.Ended() {
+		switch {
+		case s.SpanKind() == trace.SpanKindServer:
+			server = s
+		case s.Name() == "mailer.send":
+			send = s
+		case strings.HasPrefix(s.Name(), "db."):
+			queries = append(queries, s)
+		}
+		for _, a := range s.Attributes() {
+			if strings.Contains(a.Value.Emit(), email) {
+				t.Errorf("the emails must not be traced, got %s=%s in %s", a.Key, a.Value.Emit(), s.Name())
+				t.FailNow()
+			}
+		}
+	}
+	if server == nil || attr(server, "http.route") != "/register" || attr(server, "url.path") != "/register" {
+		t.Errorf("the request must be traced, got %v", sr.Ended())
+		t.FailNow()
+	}
+	if len(queries) == 0 {
+		t.Error("the DB calls must be traced")
+		t.FailNow()
+	}
+	for _, s := range queries {
+		if s.Parent().SpanID() != server.SpanContext().SpanID() || attr(s, "db.system.name") != "memory" || attr(s, "db.operation.name") != strings.TrimPrefix(s.Name(), "db.") {
+			t.Errorf("incorrect DB span %s, parent %v, attributes %v", s.Name(), s.Parent().SpanID(), s.Attributes())
+			t.FailNow()
+		}
+	}
+	if send == nil || send.Parent().SpanID() != server.SpanContext().SpanID() || send.SpanContext().TraceID() != server.SpanContext().TraceID() {
+		t.Errorf("the email must be sent in the trace of the request, got %v", send)
+		t.FailNow()
+	}
+	if attr(send, "email.template") != mailer.TemplateActivation || attr(send, "mail.provider") != "smtp" {
+		t.Errorf("incorrect send attributes, got %v", send.Attributes())
+		t.FailNow()
+	}
+}
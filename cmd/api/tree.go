@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTreeDepth = 3
+	maxTreeDepth     = 5
+	// maxTreeNodes bounds the DB queries of a tree, the referral limit letting each level grow 50 times.
+	maxTreeNodes = 1000
+)
+
+// referralNode is an address with its referrals, without emails.
+type referralNode struct {
+	Address      string          `json:"address"`
+	RegisteredAt string          `json:"registered_at,omitempty"`
+	Referrals    []*referralNode `json:"referrals"`
+	Truncated    bool            `json:"truncated,omitempty"` // referrals not listed, beyond the nodes of a tree
+}
+
+// referralTree builds the tree of the referrals of an address, each address being listed once
+// so a cycle in bad data does not loop.
+type referralTree struct {
+	app   *App
+	seen  map[string]bool
+	nodes int
+}
+
+// grow lists the referrals of n, down depth levels.
+func (t *referralTree) grow(n *referralNode, depth int) error {
+	if depth == 0 {
+		return nil
+	}
+	users, err := t.app.db.ListBySponsor(n.Address)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if t.seen[u.Address] {
+			continue
+		}
+		if t.nodes >= maxTreeNodes {
+			n.Truncated = true
+			return nil
+		}
+		t.seen[u.Address] = true
+		t.nodes++
+		r := &referralNode{Address: u.Address, RegisteredAt: time.UnixMilli(u.Timestamp).UTC().Format(time.RFC3339), Referrals: []*referralNode{}}
+		n.Referrals = append(n.Referrals, r)
+	}
+	for _, r := range n.Referrals {
+		if err := t.grow(r, depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *App) tree(c *gin.Context) {
+	var p struct {
+		Address string `uri:"address" json:"address" binding:"required,solana_addr"`
+	}
+	if err := c.ShouldBindUri(&p); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	var q struct {
+		Depth int `form:"depth" json:"depth" binding:"omitempty,min=1"`
+	}
+	if err := c.ShouldBindQuery(&q); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	depth := min(q.Depth, maxTreeDepth)
+	if depth == 0 {
+		depth = defaultTreeDepth
+	}
+	root := &referralNode{Address: p.Address, Referrals: []*referralNode{}}
+	t := &referralTree{app: app, seen: map[string]bool{p.Address: true}}
+	if err := t.grow(root, depth); err != nil {
+		app.failInternal(c, fmt.Errorf("referral tree of %s: %w", p.Address, err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tree":  root,
+		"depth": depth,
+		"count": t.nodes,
+	})
+}
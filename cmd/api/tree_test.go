@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// referralsDB lists the referrals of a map, other methods are those of the wrapped DB.
+type referralsDB struct {
+	data.DB
+	referrals map[string][]string
+}
+
+func (db referralsDB) ListBySponsor(s string) ([]*data.User, error) {
+	users := []*data.User{}
+	for _, a := range db.referrals[s] {
+		users = append(users, &data.User{Address: a, Email: a + "@mailservice.com", Sponsor: s, Timestamp: 1})
+	}
+	return users, nil
+}
+
+// flatten returns the addresses of the tree n, as "address(referrals...)".
+func flatten(n *referralNode) string {
+	l := make([]string, len(n.Referrals))
+	for i, r := range n.Referrals {
+		l[i] = flatten(r)
+	}
+	if len(l) == 0 {
+		return n.Address
+	}
+	return n.Address + "(" + strings.Join(l, " ") + ")"
+}
+
+func TestTree(t *testing.T) {
+	root := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	db := referralsDB{data.MockDB, map[string][]string{
+		root: {"a", "b"},
+		"a":  {"c"},
+		"c":  {"d"},
+		"d":  {"e"},
+		"e":  {root, "f"}, // bad data, cycling back to the root
+		"f":  {"g"},
+	}}
+	app := newTestApp(db)
+	r := setupRouter(app)
+
+	tt := []struct {
+		name  string
+		query string
+		depth int
+		want  string
+	}{
+		{"default depth", "", 3, root + "(a(c(d)) b)"},
+		{"depth", "?depth=1", 1, root + "(a b)"},
+		{"cycle", "?depth=5", 5, root + "(a(c(d(e(f)))) b)"},
+		{"depth cap", "?depth=50", 5, root + "(a(c(d(e(f)))) b)"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", fmt.Sprintf("/%s/%s/tree/%s%s", app.secpath1, app.secpath2, root, tc.query), nil)
+			addAPIKey(req)
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("incorrect status, got %d: %s", w.Code, w.Body.String())
+				t.FailNow()
+			}
+			if strings.Contains(w.Body.String(), "@") {
+				t.Errorf("the tree must not disclose emails, got %s", w.Body.String())
+				t.FailNow()
+			}
+			var res struct {
+				Tree  *referralNode `json:"tree"`
+				Depth int           `json:"depth"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			if got := flatten(res.Tree); got != tc.want || res.Depth != tc.depth {
+				t.Errorf("incorrect tree, got %s at depth %d, want %s at depth %d", got, res.Depth, tc.want, tc.depth)
+				t.FailNow()
+			}
+		})
+	}
+
+	for path, status := range map[string]int{
+		"/tree/n0t-an-address":        http.StatusBadRequest,
+		"/tree/" + root + "?depth=x":  http.StatusBadRequest,
+		"/tree/" + root + "?depth=-1": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/path1/path2"+path, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("incorrect status of %s, got %d, want %d", path, w.Code, status)
+			t.FailNow()
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/path1/path2/tree/"+root, nil)
+	addAPIKey(req)
+	setupRouter(newTestApp(data.NewMockDB().FailOn("ListBySponsor", ""))).ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("a DB error must fail the tree, got %d", w.Code)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/events"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+)
+
+// user returns an activated user, its email redacted, with the last attempts to send it an email, for the support
+// to see whether the provider accepted them.
+func (app *App) user(c *gin.Context) {
+	var p struct {
+		Address string `uri:"address" json:"address" binding:"required,solana_addr"`
+	}
+	if err := c.ShouldBindUri(&p); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	db := app.dbOf(c.Request.Context())
+	u, err := db.Get(p.Address)
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	if u == nil {
+		app.fail(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("user %s not found", p.Address))
+		return
+	}
+	deliveries := []data.Delivery{}
+	if !u.Genesis && !u.Anonymized() { // never sent anything
+		l, err := db.Deliveries(u.Email)
+		if err != nil {
+			app.failInternal(c, err)
+			return
+		}
+		deliveries = append(deliveries, l...)
+	}
+	u.Email = data.RedactEmail(u.Email)
+	c.JSON(http.StatusOK, gin.H{
+		"user":       u,
+		"deliveries": deliveries,
+	})
+}
+
+type updateEmailRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Resend bool   `json:"resend_confirmation"` // confirmation email sent to the new address
+}
+
+// updateEmail replaces the email of an activated user, to fix a typo reported to the support.
+func (app *App) updateEmail(c *gin.Context) {
+	var p struct {
+		Address string `uri:"address" json:"address" binding:"required,solana_addr"`
+	}
+	if err := c.ShouldBindUri(&p); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	var req updateEmailRequest
+	if err := bindStrict(c, &req); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	if app.blocklist != nil && app.blocklist.IsDisposable(data.NormalizeEmail(req.Email)) {
+		app.fail(c, http.StatusBadRequest, codeValidation, data.ErrDisposableEmail.Error(), fieldError{"email", "disposable"})
+		return
+	}
+	o, err := app.dbOf(c.Request.Context()).FindByEmail(req.Email)
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	if o != nil && o.Address != p.Address {
+		app.fail(c, http.StatusConflict, codeConflict, "email already used")
+		return
+	}
+	u, err := app.dbOf(c.Request.Context()).UpdateEmail(p.Address, req.Email)
+	if errors.Is(err, data.ErrUserNotFound) {
+		app.fail(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("user %s not found", p.Address))
+		return
+	}
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	by := "secret paths"
+	if sub := c.GetString(adminKey); sub != "" {
+		by = "admin " + sub
+	}
+	app.audit(c.Request.Context(), data.NewEvent(data.EventEmailUpdated, u.Address, req.Email, "by "+by))
+	app.logger.Info("✏️ email updated", "address", u.Address, "by", by)
+
+	sent := false
+	if req.Resend {
+		suppressed, err := app.dbOf(c.Request.Context()).IsSuppressed(req.Email)
+		if err != nil {
+			app.failInternal(c, err)
+			return
+		}
+		if !suppressed {
+			e, l := req.Email, u.Lang
+			if l == "" {
+				l = mailer.DefaultLang
+			}
+			app.enqueueEmail(c.Request.Context(), data.NewOutboxEmail(e, mailer.TemplateConfirmation, map[string]string{"lang": l}), func() error {
+				return app.mailer.SendConfirmationEmail(e, l)
+			})
+			sent = true
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"address":           u.Address,
+		"email":             u.Email,
+		"confirmation_sent": sent,
+	})
+}
+
+// deleteUser soft-deletes a user, restorable until purged, or with mode=anonymize erases its email and client metadata
+// for good, the user keeping its seat, referral and position.
+func (app *App) deleteUser(c *gin.Context) {
+	var p struct {
+		Address string `uri:"address" json:"address" binding:"required,solana_addr"`
+	}
+	if err := c.ShouldBindUri(&p); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	mode := c.DefaultQuery("mode", "delete")
+	if mode != "delete" && mode != "anonymize" {
+		app.fail(c, http.StatusBadRequest, codeValidation, "invalid mode, supported modes: delete, anonymize", fieldError{"mode", "oneof=delete anonymize"})
+		return
+	}
+	db := app.dbOf(c.Request.Context())
+	u, err := db.Get(p.Address) // for the hash of the email in the audit event
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	if u != nil {
+		if mode == "delete" {
+			err = db.Delete(p.Address)
+		} else {
+			u, err = db.Anonymize(p.Address)
+		}
+	}
+	if err != nil && !errors.Is(err, data.ErrUserNotFound) {
+		app.failInternal(c, err)
+		return
+	}
+	if u == nil || err != nil {
+		app.fail(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("user %s not found", p.Address))
+		return
+	}
+	by := requester(c)
+	if mode == "delete" {
+		app.c.Remove(u.Address)
+		app.audit(c.Request.Context(), data.NewEvent(data.EventDeleted, u.Address, u.Email, "by "+by))
+		app.publish(c.Request.Context(), events.UserDeleted, u)
+		app.logger.Info("🗑️ user deleted", "address", u.Address, "by", by)
+	} else {
+		app.audit(c.Request.Context(), data.NewEvent(data.EventAnonymized, u.Address, "", "by "+by)) // not even the hash of the email
+		app.logger.Info("🕶️ user anonymized", "address", u.Address, "by", by)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"address": u.Address,
+		"mode":    mode,
+	})
+}
+
+// withoutAnonymized returns the users whose email was not erased, the only ones in the exports of the emails.
+func withoutAnonymized(users []*data.User) []*data.User {
+	l := make([]*data.User, 0, len(users))
+	for _, u := range users {
+		if !u.Anonymized() {
+			l = append(l, u)
+		}
+	}
+	return l
+}
+
+// purgeLock is the lock held by the replica purging the deleted users.
+const purgeLock = "purge"
+
+// restoreUser undoes the deletion of a user not purged yet, back in the cache.
+// The user kept its seat and its referral while deleted.
+func (app *App) restoreUser(c *gin.Context) {
+	var p struct {
+		Address string `uri:"address" json:"address" binding:"required,solana_addr"`
+	}
+	if err := c.ShouldBindUri(&p); err != nil {
+		app.failBinding(c, err)
+		return
+	}
+	u, err := app.dbOf(c.Request.Context()).Restore(p.Address)
+	if errors.Is(err, data.ErrUserNotFound) {
+		app.fail(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("deleted user %s not found", p.Address))
+		return
+	}
+	if err != nil {
+		app.failInternal(c, err)
+		return
+	}
+	app.c.Add(u.Address, u.Timestamp)
+	by := requester(c)
+	app.audit(c.Request.Context(), data.NewEvent(data.EventRestored, u.Address, u.Email, "by "+by))
+	app.publish(c.Request.Context(), events.UserRestored, u)
+	app.logger.Info("♻️ user restored", "address", u.Address, "by", by)
+	c.JSON(http.StatusOK, gin.H{
+		"address":       u.Address,
+		"registered_at": time.UnixMilli(u.Timestamp).UTC().Format(time.RFC3339),
+	})
+}
+
+// runPurge hard-deletes the users deleted app.deleteRetention before now, giving back their seats and referrals,
+// when this replica holds the purge lock, for twice the check period d.
+func (app *App) runPurge(now time.Time, d time.Duration) {
+	ok, err := app.db.AcquireLock(purgeLock, app.replica, 2*d)
+	if err != nil {
+		app.logger.Warn("⚠️ cannot acquire the purge lock", slog.Any("error", err))
+		return
+	}
+	if !ok {
+		return // purged by another replica
+	}
+	ctx := context.Background()
+	users, err := app.db.Purge(now.Add(-app.deleteRetention))
+	for _, u := range users {
+		app.c.Remove(u.Address)
+		app.releaseSeat(ctx)
+		if u.Sponsor != "" && u.InviteCode == "" {
+			app.releaseReferral(ctx, u.Sponsor)
+		}
+		app.audit(ctx, data.NewEvent(data.EventPurged, u.Address, u.Email, fmt.Sprintf("deleted more than %s ago", app.deleteRetention)))
+	}
+	if len(users) > 0 {
+		app.logger.Info("🗑️ deleted users purged", "count", len(users))
+	}
+	if err != nil {
+		app.logger.Warn("⚠️ cannot purge the deleted users", slog.Any("error", err))
+	}
+}
+
+// runPurges purges the deleted users every d until ctx is done.
+func (app *App) runPurges(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			app.runPurge(now, d)
+		}
+	}
+}
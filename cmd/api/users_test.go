@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+)
+
+func TestUser(t *testing.T) {
+	db := data.NewMockDBContent([]string{sponsor})
+	app := newTestApp(db)
+	m := mailer.NewRetrying(mailer.NewTracked(mailer.NewMockSmtpMailer(1), db), 2, 0) // the first attempt failing
+	app.mailer = m
+	app.outbox = mailer.NewOutboxWorker(data.NewMockOutbox(), m, app.metrics, time.Second, time.Minute)
+	r := setupRouter(app)
+	get := func(r http.Handler, a string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/path1/path2/users/"+a, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	address := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	if w := activate(app, r, address); w.Code != http.StatusCreated {
+		t.Errorf("incorrect activation, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	app.outbox.Tick()
+	w := get(r, address)
+	var res struct {
+		User       data.User
+		Deliveries []data.Delivery
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); w.Code != http.StatusOK || err != nil {
+		t.Errorf("incorrect user, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if res.User.Address != address || res.User.Sponsor != sponsor || strings.Contains(w.Body.String(), "john.doe") {
+		t.Errorf("the user must be returned, its email redacted, got %s", w.Body)
+		t.FailNow()
+	}
+	d := res.Deliveries
+	if len(d) != 2 || d[0].Template != mailer.TemplateConfirmation || d[0].Status != data.DeliveryFailed || d[0].Error == "" || d[1].Status != data.DeliverySent || d[1].MessageID == "" {
+		t.Errorf("the attempts to send the confirmation must be returned, got %+v", d)
+		t.FailNow()
+	}
+
+	if w := get(r, sponsor); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deliveries":[]`) {
+		t.Errorf("a user never sent anything must have no attempt, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if w := get(r, "Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg"); w.Code != http.StatusNotFound {
+		t.Errorf("an unknown user must not be found, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if w := get(r, "n0t-an-address"); w.Code != http.StatusBadRequest {
+		t.Errorf("an invalid address must be rejected, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	db.FailOn("Deliveries", "")
+	if w := get(r, address); w.Code != http.StatusInternalServerError {
+		t.Errorf("a DB error must fail the view, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+}
+
+func TestUpdateEmail(t *testing.T) {
+	address, taken := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "jane.doe@mailservice.com"
+	db := data.NewMockDBContent([]string{sponsor, address}).WithEmails(taken)
+	app := newTestApp(db)
+	m := mailer.NewMockSmtpMailer(0)
+	app.mailer = m
+	app.outbox = mailer.NewOutboxWorker(data.NewMockOutbox(), m, app.metrics, time.Second, time.Minute)
+	r := setupRouter(app)
+
+	patch := func(a, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", fmt.Sprintf("/%s/%s/users/%s", app.secpath1, app.secpath2, a), strings.NewReader(body))
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tt := []struct {
+		name    string
+		address string
+		body    string
+		status  int
+		err     string
+	}{
+		{"invalid email", address, `{"email":"john.doe@gamil"}`, http.StatusBadRequest, `{"error":{"code":"validation_failed","message":"invalid email","fields":[{"field":"email","rule":"email"}]}}`},
+		{"no email", address, `{}`, http.StatusBadRequest, `{"error":{"code":"validation_failed","message":"invalid email","fields":[{"field":"email","rule":"required"}]}}`},
+		{"unknown field", address, `{"email":"john.doe@gmail.com","sponsor":"x"}`, http.StatusBadRequest, ""},
+		{"invalid address", "n0t-an-address", `{"email":"john.doe@gmail.com"}`, http.StatusBadRequest, ""},
+		{"unknown address", "Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg", `{"email":"john.doe@gmail.com"}`, http.StatusNotFound, `{"error":{"code":"not_found","message":"user Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg not found"}}`},
+		{"taken email", address, fmt.Sprintf(`{"email":%q}`, taken), http.StatusConflict, `{"error":{"code":"conflict","message":"email already used"}}`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := patch(tc.address, tc.body)
+			if w.Code != tc.status {
+				t.Errorf("Status code is incorrect, got %d, want %d: %s", w.Code, tc.status, w.Body.String())
+				t.FailNow()
+			}
+			if tc.err != "" && errorJSON(w) != tc.err {
+				t.Errorf("Error is incorrect, got %s, want %s", errorJSON(w), tc.err)
+				t.FailNow()
+			}
+		})
+	}
+
+	for _, resend := range []bool{false, true} {
+		w := patch(address, fmt.Sprintf(`{"email":"john.doe@gmail.com","resend_confirmation":%v}`, resend))
+		var res struct {
+			Address, Email string
+			Sent           bool `json:"confirmation_sent"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		if w.Code != http.StatusOK || res.Address != address || res.Email != "john.doe@gmail.com" || res.Sent != resend {
+			t.Errorf("incorrect update, got %d %s", w.Code, w.Body.String())
+			t.FailNow()
+		}
+	}
+	app.outbox.Tick()
+	app.dispatcher.Shutdown(context.Background())
+	if m.Calls() != 1 {
+		t.Errorf("the confirmation email must be sent once, on demand, got %d calls", m.Calls())
+		t.FailNow()
+	}
+	l, _ := db.ListEvents(address, 0)
+	if len(l) != 2 || l[0].Type != data.EventEmailUpdated || l[0].EmailHash == "" || l[0].Detail != "by secret paths" {
+		t.Errorf("each update must be audited, got %+v", l)
+		t.FailNow()
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/path1/path2/users/"+address, strings.NewReader(`{"email":"john.doe@gmail.com"}`))
+	addAPIKey(req)
+	setupRouter(newTestApp(data.NewMockDBContent([]string{address}).FailOn("UpdateEmail", ""))).ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("a DB error must fail the update, got %d", w.Code)
+		t.FailNow()
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	address := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	db := data.NewMockDBContent([]string{sponsor, address})
+	app := newTestApp(db)
+	app.refreshCache()
+	r := setupRouter(app)
+	check := func() int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/check-wallet/"+address, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	restore := func(a string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/%s/%s/users/%s/restore", app.secpath1, app.secpath2, a), nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if got := check(); got != http.StatusOK {
+		t.Errorf("the user must be registered, got %d", got)
+		t.FailNow()
+	}
+	db.Delete(address) // by waitlistctl
+	app.refreshCache()
+	if got := check(); got != http.StatusNotFound {
+		t.Errorf("a deleted user must not be registered, got %d", got)
+		t.FailNow()
+	}
+	if w := restore(address); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"address":"`+address+`"`) {
+		t.Errorf("cannot restore the user, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if got := check(); got != http.StatusOK {
+		t.Errorf("a restored user must be registered, got %d", got)
+		t.FailNow()
+	}
+	if l, _ := db.ListEvents(address, 0); len(l) != 1 || l[0].Type != data.EventRestored || l[0].Detail != "by secret paths" {
+		t.Errorf("the restoration must be audited, got %v", l)
+		t.FailNow()
+	}
+	if w := restore(address); w.Code != http.StatusNotFound || errorJSON(w) != `{"error":{"code":"not_found","message":"deleted user `+address+` not found"}}` {
+		t.Errorf("a user not deleted must not be restored, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if w := restore("n0t-an-address"); w.Code != http.StatusBadRequest {
+		t.Errorf("an invalid address must be rejected, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	address, deleted := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg"
+	db := data.NewMockDBContent([]string{sponsor, address, deleted})
+	app := newTestApp(db)
+	app.refreshCache()
+	r := setupRouter(app)
+	del := func(a, mode string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/%s/%s/users/%s%s", app.secpath1, app.secpath2, a, mode), nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	check := func(a string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/check-wallet/"+a, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if w := del(deleted, ""); w.Code != http.StatusOK || w.Body.String() != `{"address":"`+deleted+`","mode":"delete"}` {
+		t.Errorf("cannot delete the user, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if got := check(deleted); got != http.StatusNotFound {
+		t.Errorf("a deleted user must not be registered, got %d", got)
+		t.FailNow()
+	}
+	if l, _ := db.ListEvents(deleted, 0); len(l) != 1 || l[0].Type != data.EventDeleted || l[0].EmailHash == "" {
+		t.Errorf("the deletion must be audited, got %v", l)
+		t.FailNow()
+	}
+	if w := del(deleted, ""); w.Code != http.StatusNotFound {
+		t.Errorf("a deleted user must not be deleted again, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+
+	if w := del(address, "?mode=anonymize"); w.Code != http.StatusOK || w.Body.String() != `{"address":"`+address+`","mode":"anonymize"}` {
+		t.Errorf("cannot anonymize the user, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if got := check(address); got != http.StatusOK {
+		t.Errorf("an anonymized user must still be registered, got %d", got)
+		t.FailNow()
+	}
+	if u, _ := db.Get(address); u == nil || !u.Anonymized() {
+		t.Errorf("the email must be erased, got %v", u)
+		t.FailNow()
+	}
+	if l, _ := db.ListEvents(address, 0); len(l) != 1 || l[0].Type != data.EventAnonymized || l[0].EmailHash != "" {
+		t.Errorf("the anonymization must be audited without the email, got %v", l)
+		t.FailNow()
+	}
+	if w := del(address, "?mode=anonymize"); w.Code != http.StatusNotFound {
+		t.Errorf("a user must be anonymized once, got %d: %s", w.Code, w.Body)
+		t.FailNow()
+	}
+	if w := del(address, "?mode=erase"); w.Code != http.StatusBadRequest || errorJSON(w) != `{"error":{"code":"validation_failed","message":"invalid mode, supported modes: delete, anonymize","fields":[{"field":"mode","rule":"oneof=delete anonymize"}]}}` {
+		t.Errorf("an unknown mode must be rejected, got %d: %s", w.Code, errorJSON(w))
+		t.FailNow()
+	}
+
+	// out of the exports of the emails, still in the redacted ones
+	db.WithEmails("john.doe@mailservice.com")
+	list := func(query string) []string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/path1/path2/list?mime=json"+query, nil)
+		addAPIKey(req)
+		r.ServeHTTP(w, req)
+		var res struct {
+			Users []data.User `json:"users"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		var l []string
+		for _, u := range res.Users {
+			l = append(l, u.Email)
+		}
+		return l
+	}
+	if l := list("&include_pii=true"); len(l) != 2 || strings.Contains(strings.Join(l, ","), data.AnonymizedEmail) {
+		t.Errorf("the anonymized users must not be exported with the emails, got %v", l)
+		t.FailNow()
+	}
+	if l := list(""); len(l) != 3 {
+		t.Errorf("the anonymized users must be in the list, got %v", l)
+		t.FailNow()
+	}
+}
+
+func TestPurge(t *testing.T) {
+	address := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	db := data.NewMockDBContent([]string{sponsor, address})
+	db.ClaimReferral(sponsor, 0, 1)
+	app := newTestApp(db)
+	app.referralLimit, app.deleteRetention, app.replica = 1, 30*24*time.Hour, "test"
+	db.Delete(address)
+
+	now := time.Now()
+	app.runPurge(now.Add(29*24*time.Hour), time.Minute)
+	if err := db.ClaimReferral(sponsor, 0, 1); !errors.Is(err, data.ErrReferralLimit) {
+		t.Errorf("the user deleted within the retention must keep its referral, got %v", err)
+		t.FailNow()
+	}
+	if u, err := db.Restore(address); err != nil || u.Address != address {
+		t.Errorf("the user deleted within the retention must be restorable, got %v", err)
+		t.FailNow()
+	}
+
+	db.Delete(address)
+	app.runPurge(now.Add(31*24*time.Hour), time.Minute)
+	if _, err := db.Restore(address); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("the user deleted before the retention must be purged, got %v", err)
+		t.FailNow()
+	}
+	if err := db.ClaimReferral(sponsor, 0, 1); err != nil {
+		t.Errorf("the referral of the purged user must be released, got %v", err)
+		t.FailNow()
+	}
+	if l, _ := db.ListEvents(address, 0); len(l) != 1 || l[0].Type != data.EventPurged {
+		t.Errorf("the purge must be audited, got %v", l)
+		t.FailNow()
+	}
+	if ok, _ := db.IsPresent(sponsor); !ok {
+		t.Error("the users not deleted must be kept")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,392 @@
+// Command waitlistctl runs the operational tasks of the waitlist directly against its DB,
+// configured by the same env variables as the API.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/unleaktrade/waitlist/internal/crypto"
+	"github.com/unleaktrade/waitlist/internal/crypto/envelope"
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/mailer"
+)
+
+const usage = `usage: waitlistctl [--json] <command> [arguments]
+
+commands:
+  list [--csv]              list the activated users
+  count                     count the activated users
+  delete <address>          delete a user, restorable until purged by the API
+  resend <address> <email>  send the activation email of a registration again
+  verify-token <jwt>        verify a token and show its user, even when expired
+  admin-token <subject>     mint a token of the admin routes for the operator subject
+`
+
+var (
+	ErrUsage    = errors.New("invalid arguments")
+	ErrNoJWTKey = errors.New("UNLEAKTRADE_JWT_ES256_KEY must be set to sign or verify tokens")
+)
+
+// commands are the number of arguments of each command.
+var commands = map[string]int{
+	"list":         0,
+	"count":        0,
+	"delete":       1,
+	"resend":       2,
+	"verify-token": 1,
+	"admin-token":  1,
+}
+
+type command struct {
+	name string
+	args []string
+	json bool
+	csv  bool
+}
+
+// parse returns the command of the arguments, flags being accepted before and after the command name.
+func parse(args []string) (*command, error) {
+	cmd := &command{}
+	fs := flag.NewFlagSet("waitlistctl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&cmd.json, "json", false, "machine-readable output")
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if fs.NArg() == 0 {
+		return nil, fmt.Errorf("%w: no command", ErrUsage)
+	}
+	cmd.name = fs.Arg(0)
+	n, ok := commands[cmd.name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown command %q", ErrUsage, cmd.name)
+	}
+
+	cfs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	cfs.SetOutput(io.Discard)
+	cfs.BoolVar(&cmd.json, "json", cmd.json, "machine-readable output")
+	if cmd.name == "list" {
+		cfs.BoolVar(&cmd.csv, "csv", false, "CSV output")
+	}
+	if err := cfs.Parse(fs.Args()[1:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUsage, err)
+	}
+	if cfs.NArg() != n {
+		return nil, fmt.Errorf("%w: %s expects %d argument(s), got %d", ErrUsage, cmd.name, n, cfs.NArg())
+	}
+	if cmd.json && cmd.csv {
+		return nil, fmt.Errorf("%w: --json and --csv are exclusive", ErrUsage)
+	}
+	cmd.args = cfs.Args()
+	return cmd, nil
+}
+
+type ctl struct {
+	db     data.DB
+	jwt    crypto.Token  // nil when no signing key is shared with the API
+	mailer mailer.Mailer // nil until resend needs it
+	config mailer.Config
+	hash   func(e string) string // email hash of the DB
+	out    io.Writer
+}
+
+// newCtl reads the env variables of the API.
+func newCtl(out io.Writer) (*ctl, error) {
+	tn := os.Getenv("UNLEAKTRADE_WAITLIST_TABLE_NAME")
+	if tn == "" {
+		tn = "Waitlist"
+	}
+	ek := os.Getenv("UNLEAKTRADE_ENCRYPTION_KEY")
+	retry := data.WithRetry(data.DefaultRetryPolicy, nil)
+	db, err := data.NewDynamoDB(tn, ek, retry)
+	if arn := os.Getenv("UNLEAKTRADE_KMS_KEY_ARN"); arn != "" {
+		env := envelope.New(kms.New(session.Must(session.NewSession())), arn, envelope.DefaultRotation)
+		db, err = data.NewDynamoDBWithEnvelope(tn, ek, env, retry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	db.WithEventsTable(os.Getenv("UNLEAKTRADE_EVENTS_TABLE_NAME"))
+	c := &ctl{
+		db:   db,
+		hash: db.HashEmail,
+		out:  out,
+		config: mailer.Config{
+			Provider:    os.Getenv("UNLEAKTRADE_MAIL_PROVIDER"),
+			User:        os.Getenv("UNLEAKTRADE_MAIL_USER"),
+			Password:    os.Getenv("UNLEAKTRADE_MAIL_PASSWORD"),
+			Host:        "live.smtp.mailtrap.io",
+			Port:        587,
+			SendGridKey: os.Getenv("UNLEAKTRADE_SENDGRID_API_KEY"),
+			LogDir:      os.Getenv("UNLEAKTRADE_MAIL_LOG_DIR"),
+			Options: mailer.Options{
+				FromName:            os.Getenv("UNLEAKTRADE_MAIL_FROM_NAME"),
+				FromAddress:         os.Getenv("UNLEAKTRADE_MAIL_FROM"),
+				ReplyTo:             os.Getenv("UNLEAKTRADE_MAIL_REPLY_TO"),
+				Product:             os.Getenv("UNLEAKTRADE_PRODUCT_NAME"),
+				ActivationSubject:   os.Getenv("UNLEAKTRADE_MAIL_ACTIVATION_SUBJECT"),
+				ConfirmationSubject: os.Getenv("UNLEAKTRADE_MAIL_CONFIRMATION_SUBJECT"),
+				WelcomeSubject:      os.Getenv("UNLEAKTRADE_MAIL_WELCOME_SUBJECT"),
+				DigestSubject:       os.Getenv("UNLEAKTRADE_MAIL_DIGEST_SUBJECT"),
+			},
+		},
+	}
+	if pem := os.Getenv("UNLEAKTRADE_JWT_ES256_KEY"); pem != "" {
+		j, err := crypto.NewJWTECDSA(pem, jwt.SigningMethodES256)
+		if err != nil {
+			return nil, fmt.Errorf("UNLEAKTRADE_JWT_ES256_KEY: %w", err)
+		}
+		aud := crypto.DefaultAudience
+		if a := os.Getenv("UNLEAKTRADE_JWT_AUDIENCE"); a != "" {
+			aud = a
+		}
+		c.jwt = j.WithAudience(aud)
+	}
+	return c, nil
+}
+
+func (c *ctl) run(cmd *command) error {
+	switch cmd.name {
+	case "list":
+		return c.list(cmd)
+	case "count":
+		return c.count(cmd)
+	case "delete":
+		return c.delete(cmd, cmd.args[0])
+	case "resend":
+		return c.resend(cmd, cmd.args[0], cmd.args[1])
+	case "verify-token":
+		return c.verifyToken(cmd, cmd.args[0])
+	case "admin-token":
+		return c.adminToken(cmd, cmd.args[0])
+	}
+	return fmt.Errorf("%w: unknown command %q", ErrUsage, cmd.name)
+}
+
+func (c *ctl) printJSON(v any) error {
+	e := json.NewEncoder(c.out)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+func (c *ctl) list(cmd *command) error {
+	users, err := c.db.List()
+	if err != nil {
+		return err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Timestamp > users[j].Timestamp
+	})
+	switch {
+	case cmd.json:
+		return c.printJSON(map[string]any{"users": users, "count": len(users)})
+	case cmd.csv:
+		w := csv.NewWriter(c.out)
+		w.Write([]string{"address", "email", "uuid", "timestamp", "sponsor", "registered_at", "activated_at"})
+		for _, u := range users {
+			registered := ""
+			if u.RegisteredAt != 0 {
+				registered = time.UnixMilli(u.RegisteredAt).UTC().Format(time.RFC3339)
+			}
+			w.Write([]string{u.Address, u.Email, u.UUID, time.UnixMilli(u.Timestamp).UTC().Format(time.RFC3339), u.Sponsor, registered, time.UnixMilli(u.Activated()).UTC().Format(time.RFC3339)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tEMAIL\tSPONSOR\tACTIVATED")
+	for _, u := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", u.Address, u.Email, u.Sponsor, time.UnixMilli(u.Timestamp).UTC().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func (c *ctl) count(cmd *command) error {
+	users, err := c.db.List()
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		return c.printJSON(map[string]int{"count": len(users)})
+	}
+	_, err = fmt.Fprintln(c.out, len(users))
+	return err
+}
+
+// delete soft-deletes the user of address a, restorable by the API until it purges the user.
+// The referral it took to its sponsor and its seat in the waitlist are given back on the purge.
+func (c *ctl) delete(cmd *command, a string) error {
+	u, err := c.db.Get(a)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("%w: %s", data.ErrUserNotFound, a)
+	}
+	if err := c.db.Delete(a); err != nil {
+		return err
+	}
+	if err := c.db.AppendEvent(data.NewEvent(data.EventDeleted, a, u.Email, "waitlistctl")); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️ cannot append %s event of %s: %v\n", data.EventDeleted, a, err)
+	}
+	if cmd.json {
+		return c.printJSON(map[string]string{"deleted": a})
+	}
+	_, err = fmt.Fprintf(c.out, "🗑️ %s deleted\n", a)
+	return err
+}
+
+// registration returns the user registered with address a and email e, from the audit trail.
+func (c *ctl) registration(a, e string) (*data.User, error) {
+	l, err := c.db.ListEvents(a, 0)
+	if err != nil {
+		return nil, err
+	}
+	h := c.hash(e)
+	for _, ev := range l { // most recent first
+		if ev.Type != data.EventRegistered || ev.EmailHash != h {
+			continue
+		}
+		u := &data.User{Address: a, Email: e, Lang: mailer.DefaultLang}
+		kind, v, _ := strings.Cut(ev.Detail, " ")
+		switch kind {
+		case "sponsor":
+			u.Sponsor = v
+		case "invite":
+			u.InviteCode = v
+		default:
+			return nil, fmt.Errorf("unexpected registration detail %q", ev.Detail)
+		}
+		return u, nil
+	}
+	return nil, fmt.Errorf("no registration of %s with this email", a)
+}
+
+// resend sends a new activation email for a registration not activated yet.
+func (c *ctl) resend(cmd *command, a, e string) error {
+	if c.jwt == nil {
+		return ErrNoJWTKey
+	}
+	ok, err := c.db.IsPresent(a)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fmt.Errorf("%s is already activated", a)
+	}
+	if s, err := c.db.IsSuppressed(e); err != nil || s {
+		if err == nil {
+			err = fmt.Errorf("%s is suppressed", e)
+		}
+		return err
+	}
+	u, err := c.registration(a, e)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	token, err := c.jwt.Create(u, now)
+	if err != nil {
+		return err
+	}
+	ut, err := c.jwt.CreateWithPurpose(u, crypto.PurposeUnsubscribe, now)
+	if err != nil {
+		return err
+	}
+	if c.mailer == nil {
+		if c.mailer, err = mailer.NewProvider(c.config); err != nil {
+			return err
+		}
+	}
+	hash := c.jwt.Hash(token)
+	if err := c.mailer.SendActivationEmail(e, generateSecuredLink(token), hash, generateUnsubscribeLink(ut), u.Lang); err != nil {
+		return err
+	}
+	if cmd.json {
+		return c.printJSON(map[string]string{"address": a, "hash": hash})
+	}
+	_, err = fmt.Fprintf(c.out, "📧 activation email of %s sent again, hash %s\n", a, hash)
+	return err
+}
+
+// verifyToken shows the user of a token with its validity, the claims of an authentic token being shown even when expired.
+func (c *ctl) verifyToken(cmd *command, t string) error {
+	if c.jwt == nil {
+		return ErrNoJWTKey
+	}
+	u, p, err := c.jwt.ExtractWithPurpose(t)
+	if err == nil {
+		if cmd.json {
+			return c.printJSON(map[string]any{"valid": true, "validity": crypto.Valid, "purpose": p, "hash": c.jwt.Hash(t), "user": u})
+		}
+		_, err = fmt.Fprintf(c.out, "✅ valid %s token of %s (email %s, sponsor %s)\n", p, u.Address, u.Email, u.Sponsor)
+		return err
+	}
+	u, v := crypto.Inspect(c.jwt, t)
+	if u == nil {
+		return err
+	}
+	if cmd.json {
+		return c.printJSON(map[string]any{"valid": false, "validity": v, "hash": c.jwt.Hash(t), "user": u})
+	}
+	_, err = fmt.Fprintf(c.out, "⌛ %s token of %s (email %s, sponsor %s)\n", v, u.Address, u.Email, u.Sponsor)
+	return err
+}
+
+func generateSecuredLink(t string) string {
+	return fmt.Sprintf("https://unleak.trade/activate/%s", t)
+}
+
+func generateUnsubscribeLink(t string) string {
+	return fmt.Sprintf("https://unleak.trade/unsubscribe/%s", t)
+}
+
+func main() {
+	cmd, err := parse(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n%s", err, usage)
+		os.Exit(2)
+	}
+	c, err := newCtl(os.Stdout)
+	if err == nil {
+		err = c.run(cmd)
+	}
+	if err != nil {
+		if cmd.json {
+			json.NewEncoder(os.Stderr).Encode(map[string]string{"error": err.Error()})
+		} else {
+			fmt.Fprintf(os.Stderr, "🔥 %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// adminToken mints a short-lived token of the admin routes, sub naming the operator in the logs.
+func (c *ctl) adminToken(cmd *command, sub string) error {
+	if c.jwt == nil {
+		return ErrNoJWTKey
+	}
+	t, err := c.jwt.CreateAdmin(sub, time.Now())
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		return c.printJSON(map[string]string{"subject": sub, "token": t})
+	}
+	_, err = fmt.Fprintln(c.out, t)
+	return err
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/crypto"
+	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+const (
+	address = "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	sponsor = "9mf2bkJf5TebjCYQYq3WcK61ruHTs3bpeQwW2s6WWj3A"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name string
+		args []string
+		want *command
+	}{
+		{"list", []string{"list"}, &command{name: "list", args: []string{}}},
+		{"list csv", []string{"list", "--csv"}, &command{name: "list", args: []string{}, csv: true}},
+		{"json before", []string{"--json", "count"}, &command{name: "count", args: []string{}, json: true}},
+		{"json after", []string{"delete", "--json", address}, &command{name: "delete", args: []string{address}, json: true}},
+		{"resend", []string{"resend", address, "john.doe@mailservice.com"}, &command{name: "resend", args: []string{address, "john.doe@mailservice.com"}}},
+		{"verify-token", []string{"verify-token", "a.b.c"}, &command{name: "verify-token", args: []string{"a.b.c"}}},
+		{"admin-token", []string{"admin-token", "alice"}, &command{name: "admin-token", args: []string{"alice"}}},
+		{"no command", []string{}, nil},
+		{"unknown command", []string{"drop"}, nil},
+		{"missing argument", []string{"delete"}, nil},
+		{"extra argument", []string{"count", "now"}, nil},
+		{"csv not supported", []string{"count", "--csv"}, nil},
+		{"csv and json", []string{"--json", "list", "--csv"}, nil},
+		{"unknown flag", []string{"--yaml", "list"}, nil},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd, err := parse(tc.args)
+			if tc.want == nil {
+				if !errors.Is(err, ErrUsage) {
+					t.Errorf("parsing must fail with ErrUsage, got %v", err)
+					t.FailNow()
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("cannot parse %v: %v", tc.args, err)
+				t.FailNow()
+			}
+			if cmd.name != tc.want.name || cmd.json != tc.want.json || cmd.csv != tc.want.csv || strings.Join(cmd.args, " ") != strings.Join(tc.want.args, " ") {
+				t.Errorf("incorrect command, got %+v, want %+v", cmd, tc.want)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func newTestCtl(db data.DB) (*ctl, *bytes.Buffer) {
+	b := new(bytes.Buffer)
+	return &ctl{db: db, out: b}, b
+}
+
+func run(t *testing.T, c *ctl, args ...string) {
+	cmd, err := parse(args)
+	if err != nil {
+		t.Errorf("cannot parse %v: %v", args, err)
+		t.FailNow()
+	}
+	if err := c.run(cmd); err != nil {
+		t.Errorf("%v failed: %v", args, err)
+		t.FailNow()
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		c, b := newTestCtl(data.MockDB)
+		run(t, c, "list")
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		if len(lines) != data.UsersCountMock+1 || !strings.HasPrefix(lines[0], "ADDRESS") {
+			t.Errorf("incorrect output, got %d lines, want a header and %d users", len(lines), data.UsersCountMock)
+			t.FailNow()
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		c, b := newTestCtl(data.MockDB)
+		run(t, c, "list", "--csv")
+		records, err := csv.NewReader(b).ReadAll()
+		if err != nil {
+			t.Errorf("invalid CSV: %v", err)
+			t.FailNow()
+		}
+		if len(records) != data.UsersCountMock+1 || strings.Join(records[0], ",") != "address,email,uuid,timestamp,sponsor,registered_at,activated_at" {
+			t.Errorf("incorrect CSV, got %d records, header %v", len(records), records[0])
+			t.FailNow()
+		}
+		if _, err := time.Parse(time.RFC3339, records[1][3]); err != nil {
+			t.Errorf("timestamp must be RFC 3339, got %q", records[1][3])
+			t.FailNow()
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		c, b := newTestCtl(data.MockDB)
+		run(t, c, "--json", "list")
+		var res struct {
+			Users []data.User
+			Count int
+		}
+		if err := json.NewDecoder(b).Decode(&res); err != nil {
+			t.Errorf("invalid JSON: %v", err)
+			t.FailNow()
+		}
+		if res.Count != data.UsersCountMock || len(res.Users) != data.UsersCountMock {
+			t.Errorf("incorrect count, got %d (%d users), want %d", res.Count, len(res.Users), data.UsersCountMock)
+			t.FailNow()
+		}
+		for i := 1; i < len(res.Users); i++ {
+			if res.Users[i-1].Timestamp < res.Users[i].Timestamp {
+				t.Errorf("users must be sorted most recent first")
+				t.FailNow()
+			}
+		}
+	})
+
+	t.Run("count", func(t *testing.T) {
+		c, b := newTestCtl(data.MockDB)
+		run(t, c, "count")
+		if strings.TrimSpace(b.String()) != strconv.Itoa(data.UsersCountMock) {
+			t.Errorf("incorrect count, got %q, want %d", b.String(), data.UsersCountMock)
+			t.FailNow()
+		}
+	})
+
+	t.Run("DB error", func(t *testing.T) {
+		c, _ := newTestCtl(data.NewMockDBContent([]string{sponsor}).FailOn("List", ""))
+		cmd, _ := parse([]string{"list"})
+		if err := c.run(cmd); err == nil {
+			t.Errorf("list must fail when the DB fails")
+			t.FailNow()
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	db := data.NewMockDBContent([]string{sponsor, address})
+	db.ClaimReferral(sponsor, 0, 1)
+	c, b := newTestCtl(db)
+	run(t, c, "--json", "delete", address)
+	if !strings.Contains(b.String(), `"deleted": "`+address+`"`) {
+		t.Errorf("incorrect output, got %s", b.String())
+		t.FailNow()
+	}
+	if ok, _ := db.IsPresent(address); ok {
+		t.Errorf("%s must be deleted", address)
+		t.FailNow()
+	}
+	if err := db.ClaimReferral(sponsor, 0, 1); !errors.Is(err, data.ErrReferralLimit) {
+		t.Errorf("the referral of the deleted user must be kept until purged, got %v", err)
+		t.FailNow()
+	}
+	if l, _ := db.ListEvents(address, 0); len(l) != 1 || l[0].Type != data.EventDeleted {
+		t.Errorf("the deletion must be audited, got %v", l)
+		t.FailNow()
+	}
+
+	cmd, _ := parse([]string{"delete", address})
+	if err := c.run(cmd); !errors.Is(err, data.ErrUserNotFound) {
+		t.Errorf("deleting a missing user must fail with ErrUserNotFound, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	k, _ := cipher.GenerateKey(32)
+	c, b := newTestCtl(data.MockDB)
+	cmd, _ := parse([]string{"verify-token", "a.b.c"})
+	if err := c.run(cmd); !errors.Is(err, ErrNoJWTKey) {
+		t.Errorf("verify-token must fail without key, got %v", err)
+		t.FailNow()
+	}
+
+	c.jwt = crypto.NewJWTHS256(k)
+	tk, _ := c.jwt.Create(data.NewUser(address, "john.doe@mailservice.com", sponsor), time.Now())
+	run(t, c, "--json", "verify-token", tk)
+	var res struct {
+		Valid   bool
+		Purpose string
+		User    data.User
+	}
+	if err := json.NewDecoder(b).Decode(&res); err != nil {
+		t.Errorf("invalid JSON: %v", err)
+		t.FailNow()
+	}
+	if !res.Valid || res.Purpose != crypto.PurposeActivate || res.User.Address != address {
+		t.Errorf("incorrect verification, got %+v", res)
+		t.FailNow()
+	}
+
+	cmd, _ = parse([]string{"verify-token", tk + "x"})
+	if err := c.run(cmd); !errors.Is(err, crypto.ErrInvalidToken) {
+		t.Errorf("verify-token must reject an invalid signature, got %v", err)
+		t.FailNow()
+	}
+
+	cmd, _ = parse([]string{"verify-token", "garbage"})
+	if err := c.run(cmd); !errors.Is(err, crypto.ErrInvalidToken) {
+		t.Errorf("verify-token must reject a malformed token, got %v", err)
+		t.FailNow()
+	}
+
+	expired, _ := c.jwt.Create(data.NewUser(address, "john.doe@mailservice.com", sponsor), time.Now().Add(-time.Hour))
+	run(t, c, "--json", "verify-token", expired)
+	var exp struct {
+		Valid    bool
+		Validity string
+		User     data.User
+	}
+	if err := json.NewDecoder(b).Decode(&exp); err != nil {
+		t.Errorf("invalid JSON: %v", err)
+		t.FailNow()
+	}
+	if exp.Valid || exp.Validity != crypto.Expired || exp.User.Email != "john.doe@mailservice.com" {
+		t.Errorf("the claims of an expired token must be shown, got %+v", exp)
+		t.FailNow()
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	k, _ := cipher.GenerateKey(32)
+	c, b := newTestCtl(data.MockDB)
+	cmd, _ := parse([]string{"admin-token", "alice"})
+	if err := c.run(cmd); !errors.Is(err, ErrNoJWTKey) {
+		t.Errorf("admin-token must fail without key, got %v", err)
+		t.FailNow()
+	}
+
+	c.jwt = crypto.NewJWTHS256(k)
+	run(t, c, "admin-token", "alice")
+	sub, err := c.jwt.ExtractAdmin(strings.TrimSpace(b.String()))
+	if err != nil || sub != "alice" {
+		t.Errorf("incorrect admin token, got %q, %v", sub, err)
+		t.FailNow()
+	}
+	if _, _, err := c.jwt.ExtractWithPurpose(strings.TrimSpace(b.String())); err == nil {
+		t.Errorf("admin token must not be accepted as a user token")
+		t.FailNow()
+	}
+}
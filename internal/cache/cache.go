@@ -1,38 +1,326 @@
 package cache
 
-import "sync"
+import (
+	"cmp"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-type Cache struct {
+// Cache maps keys to values of type V, Timestamps being the registration timestamps by address.
+type Cache[V any] struct {
 	mu sync.RWMutex
-	m  map[string]int64
+	m  map[string]V
+
+	config
+	added  map[string]time.Time // entries added after the last Fill
+	filled time.Time            // insertion time of the entries of the last Fill
+	stop   chan struct{}
+	once   sync.Once
+
+	missing map[string]time.Time // keys known to be absent, by insertion time
+
+	hits, misses, adds, fills atomic.Int64
+}
+
+// Timestamps is the cache of the App.
+type Timestamps = Cache[int64]
+
+type config struct {
+	ttl    time.Duration // no expiry when 0
+	negTTL time.Duration // no negative caching when 0
+	now    func() time.Time
+}
+
+// Stats is a snapshot of the cache usage.
+type Stats struct {
+	Size   int       `json:"size"`
+	Hits   int64     `json:"hits"`
+	Misses int64     `json:"misses"`
+	Adds   int64     `json:"adds"`
+	Fills  int64     `json:"fills"`
+	Filled time.Time `json:"filled"` // last Fill or Refresh
+}
+
+// HitRatio is the share of lookups that found the key, 0 before the first call.
+func (s Stats) HitRatio() float64 {
+	if n := s.Hits + s.Misses; n > 0 {
+		return float64(s.Hits) / float64(n)
+	}
+	return 0
+}
+
+type Option func(*config)
+
+// WithTTL expires the entries d after their insertion, a janitor evicting them periodically.
+func WithTTL(d time.Duration) Option {
+	return func(c *config) {
+		c.ttl = d
+	}
+}
+
+// WithNegativeTTL remembers for d the keys reported absent with AddMissing.
+func WithNegativeTTL(d time.Duration) Option {
+	return func(c *config) {
+		c.negTTL = d
+	}
+}
+
+// WithClock replaces time.Now, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+func New(opts ...Option) *Timestamps {
+	return NewOf[int64](opts...)
 }
 
-func New() *Cache {
-	return &Cache{m: make(map[string]int64)}
+func NewOf[V any](opts ...Option) *Cache[V] {
+	c := &Cache[V]{
+		m:       make(map[string]V),
+		config:  config{now: time.Now},
+		added:   make(map[string]time.Time),
+		stop:    make(chan struct{}),
+		missing: make(map[string]time.Time),
+	}
+	for _, o := range opts {
+		o(&c.config)
+	}
+	c.filled = c.now()
+	if d := c.period(); d > 0 {
+		go c.janitor(d)
+	}
+	return c
+}
+
+// period is the eviction period of the janitor, the shortest TTL set.
+func (c *Cache[V]) period() time.Duration {
+	if c.negTTL > 0 && (c.ttl <= 0 || c.negTTL < c.ttl) {
+		return c.negTTL
+	}
+	return c.ttl
+}
+
+func (c *Cache[V]) janitor(d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-t.C:
+			c.evict()
+		}
+	}
+}
+
+// Close stops the janitor.
+func (c *Cache[V]) Close() {
+	c.once.Do(func() { close(c.stop) })
+}
+
+// expired must be called with the lock held.
+func (c *Cache[V]) expired(key string, now time.Time) bool {
+	if c.ttl <= 0 {
+		return false
+	}
+	at, ok := c.added[key]
+	if !ok {
+		at = c.filled
+	}
+	return now.Sub(at) >= c.ttl
+}
+
+func (c *Cache[V]) evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k := range c.m {
+		if c.expired(k, now) {
+			delete(c.m, k)
+			delete(c.added, k)
+		}
+	}
+	for k, at := range c.missing {
+		if now.Sub(at) >= c.negTTL {
+			delete(c.missing, k)
+		}
+	}
+}
+
+func (c *Cache[V]) IsPresent(key string) bool {
+	_, ok := c.Get(key)
+	return ok
 }
 
-func (c *Cache) IsPresent(key string) bool {
+// Get returns the value of key, the zero value and false when absent or expired.
+func (c *Cache[V]) Get(key string) (V, bool) {
 	c.mu.RLock()
-	_, ok := c.m[key]
+	v, ok := c.m[key]
+	ok = ok && !c.expired(key, c.now())
+	c.mu.RUnlock()
+	if !ok {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.hits.Add(1)
+	return v, true
+}
+
+// Keys returns a copy of the keys, in no particular order.
+func (c *Cache[V]) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	keys := make([]string, 0, len(c.m))
+	for k := range c.m {
+		if !c.expired(k, now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Range calls f for each entry until f returns false, in no particular order.
+// The read lock is held meanwhile: f must not call the other methods of the cache.
+func (c *Cache[V]) Range(f func(k string, v V) bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	for k, v := range c.m {
+		if c.expired(k, now) {
+			continue
+		}
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+// Rank returns the 1-based rank of key, the entries being ordered by value then key, false when absent.
+func Rank[V cmp.Ordered](c *Cache[V], key string) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	v, ok := c.m[key]
+	if !ok || c.expired(key, now) {
+		return 0, false
+	}
+	r := 1
+	for k, o := range c.m {
+		if (o < v || o == v && k < key) && !c.expired(k, now) {
+			r++
+		}
+	}
+	return r, true
+}
+
+// Len returns the number of entries, expired ones not evicted yet included.
+func (c *Cache[V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.m)
+}
+
+func (c *Cache[V]) Stats() Stats {
+	c.mu.RLock()
+	size, filled := len(c.m), c.filled
+	c.mu.RUnlock()
+	return Stats{
+		Size:   size,
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Adds:   c.adds.Load(),
+		Fills:  c.fills.Load(),
+		Filled: filled,
+	}
+}
+
+func (c *Cache[V]) Add(key string, v V) {
+	c.mu.Lock()
+	c.m[key] = v
+	c.added[key] = c.now()
+	delete(c.missing, key)
+	c.mu.Unlock()
+	c.adds.Add(1)
+}
+
+// AddMissing records that key is absent, until the negative TTL expires or key is added.
+func (c *Cache[V]) AddMissing(key string) {
+	if c.negTTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.missing[key] = c.now()
+	c.mu.Unlock()
+}
+
+func (c *Cache[V]) IsMissing(key string) bool {
+	c.mu.RLock()
+	at, ok := c.missing[key]
+	ok = ok && c.now().Sub(at) < c.negTTL
 	c.mu.RUnlock()
 	return ok
 }
 
-func (c *Cache) Add(key string, ts int64) {
+func (c *Cache[V]) Remove(key string) {
 	c.mu.Lock()
-	c.m[key] = ts
+	delete(c.m, key)
+	delete(c.added, key)
 	c.mu.Unlock()
 }
 
 // Fill swaps the backing map in O(1).
 // The caller must treat entries as owned by the cache after this call:
 // do not write to it from other goroutines (or at all) without going through Cache.
-func (c *Cache) Fill(entries map[string]int64) {
+func (c *Cache[V]) Fill(entries map[string]V) {
 	if entries == nil {
-		entries = make(map[string]int64)
+		entries = make(map[string]V)
 	}
 
 	c.mu.Lock()
 	c.m = entries
+	c.added = make(map[string]time.Time)
+	c.filled = c.now()
+	c.missing = make(map[string]time.Time)
 	c.mu.Unlock()
+	c.fills.Add(1)
+}
+
+// Refresh replaces the entries like Fill and returns the number of keys added and removed.
+// Keys added since the last Fill are kept, entries may be a snapshot older than them.
+func (c *Cache[V]) Refresh(entries map[string]V) (added, removed int) {
+	if entries == nil {
+		entries = make(map[string]V)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for k := range entries {
+		if _, ok := c.m[k]; !ok {
+			added++
+		}
+	}
+	for k, v := range c.m {
+		if _, ok := entries[k]; ok {
+			continue
+		}
+		if _, ok := c.added[k]; ok && !c.expired(k, now) {
+			entries[k] = v // kept until the next refresh
+			continue
+		}
+		removed++
+	}
+	for k := range entries {
+		delete(c.missing, k)
+	}
+	c.m = entries
+	c.added = make(map[string]time.Time)
+	c.filled = now
+	c.fills.Add(1)
+	return
 }
@@ -2,7 +2,10 @@ package cache
 
 import (
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCacheAddAndIsPresent(t *testing.T) {
@@ -22,7 +25,7 @@ func TestCacheAddAndIsPresent(t *testing.T) {
 	if !c.IsPresent(key) {
 		t.Fatalf("IsPresent(%q) = false, want true", key)
 	}
-	if got := c.m[key]; got != ts {
+	if got, _ := c.Get(key); got != ts {
 		t.Fatalf("timestamp mismatch, got %d, want %d", got, ts)
 	}
 }
@@ -42,11 +45,12 @@ func TestCacheFillSwapsMap(t *testing.T) {
 	if !c.IsPresent("new") {
 		t.Fatalf("new entry should be present after Fill")
 	}
-	if got := c.m["new"]; got != 42 {
+	if got, _ := c.Get("new"); got != 42 {
 		t.Fatalf("timestamp mismatch, got %d, want %d", got, 42)
 	}
 
-	if reflect.ValueOf(c.m).Pointer() != reflect.ValueOf(entries).Pointer() {
+	c.Add("later", 43)
+	if _, ok := entries["later"]; !ok {
 		t.Fatalf("Fill did not swap the backing map")
 	}
 }
@@ -60,7 +64,274 @@ func TestCacheFillNil(t *testing.T) {
 	if c.IsPresent("old") {
 		t.Fatalf("entry should not be present after Fill(nil)")
 	}
-	if c.m == nil || len(c.m) != 0 {
+	if c.Len() != 0 {
 		t.Fatalf("expected empty map after Fill(nil)")
 	}
+	c.Add("new", 2) // backing map is usable
+	if !c.IsPresent("new") {
+		t.Fatalf("entry should be present after Add")
+	}
+}
+
+// clock is a fake clock moved forward by the tests.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func TestCacheTTL(t *testing.T) {
+	clk := &clock{t: time.Unix(1700000000, 0)}
+	c := New(WithTTL(time.Minute), WithClock(clk.now))
+	defer c.Close()
+
+	c.Fill(map[string]int64{"filled": 1})
+	clk.advance(30 * time.Second)
+	c.Add("added", 2)
+	if !c.IsPresent("filled") || !c.IsPresent("added") {
+		t.Fatalf("entries should be present before their ttl")
+	}
+
+	clk.advance(30 * time.Second)
+	if c.IsPresent("filled") {
+		t.Fatalf("filled entry should be expired, even before the janitor runs")
+	}
+	if !c.IsPresent("added") {
+		t.Fatalf("added entry should still be present")
+	}
+
+	if c.Len() != 2 {
+		t.Fatalf("expired entry should be kept until evicted, got %d entries", c.Len())
+	}
+	if keys := c.Keys(); !reflect.DeepEqual(keys, []string{"added"}) {
+		t.Fatalf("Keys should skip expired entries, got %v", keys)
+	}
+	c.evict()
+	if c.Len() != 1 {
+		t.Fatalf("expired entry should be evicted")
+	}
+	if !reflect.DeepEqual(c.Keys(), []string{"added"}) {
+		t.Fatalf("valid entry should not be evicted")
+	}
+
+	clk.advance(30 * time.Second)
+	if c.IsPresent("added") {
+		t.Fatalf("added entry should be expired")
+	}
+}
+
+func TestCacheNoTTL(t *testing.T) {
+	clk := &clock{t: time.Unix(1700000000, 0)}
+	c := New(WithClock(clk.now))
+	c.Add("key", 1)
+	clk.advance(24 * 365 * time.Hour)
+	c.evict()
+	if !c.IsPresent("key") {
+		t.Fatalf("entries should never expire without ttl")
+	}
+}
+
+func TestCacheRemove(t *testing.T) {
+	c := New()
+	c.Fill(map[string]int64{"a": 1, "b": 2})
+	c.Remove("a")
+	c.Remove("unknown")
+	if c.IsPresent("a") || !c.IsPresent("b") {
+		t.Fatalf("only removed entry should be absent")
+	}
+}
+
+func TestCacheClose(t *testing.T) {
+	c := New(WithTTL(time.Millisecond))
+	c.Add("key", 1)
+	time.Sleep(20 * time.Millisecond)
+	if n := c.Len(); n != 0 {
+		t.Fatalf("janitor should evict expired entries, got %d left", n)
+	}
+	c.Close()
+	c.Close() // idempotent
+}
+
+func TestCacheRefresh(t *testing.T) {
+	c := New()
+	c.Fill(map[string]int64{"a": 1, "b": 2})
+	c.Add("new", 3) // activated after the DB snapshot
+
+	added, removed := c.Refresh(map[string]int64{"b": 2, "c": 4})
+	if added != 1 || removed != 1 {
+		t.Fatalf("incorrect delta, got +%d/-%d, want +1/-1", added, removed)
+	}
+	if c.IsPresent("a") || !c.IsPresent("b") || !c.IsPresent("c") {
+		t.Fatalf("cache should match the refreshed entries")
+	}
+	if !c.IsPresent("new") {
+		t.Fatalf("entry added since the last fill should be kept")
+	}
+
+	added, removed = c.Refresh(map[string]int64{"b": 2, "c": 4})
+	if added != 0 || removed != 1 || c.IsPresent("new") {
+		t.Fatalf("entry missing from two snapshots should be removed, got +%d/-%d", added, removed)
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	now := time.Now()
+	c := New(WithNegativeTTL(time.Minute), WithClock(func() time.Time { return now }))
+	defer c.Close()
+
+	c.AddMissing("a")
+	if !c.IsMissing("a") || c.IsMissing("b") {
+		t.Fatalf("only a should be known as missing")
+	}
+	now = now.Add(time.Minute)
+	if c.IsMissing("a") {
+		t.Fatalf("missing entries should expire after the negative ttl")
+	}
+
+	c.AddMissing("a")
+	c.Add("a", 1)
+	if c.IsMissing("a") || !c.IsPresent("a") {
+		t.Fatalf("adding a key should clear its negative entry")
+	}
+
+	c.AddMissing("b")
+	c.Refresh(map[string]int64{"b": 2})
+	if c.IsMissing("b") {
+		t.Fatalf("refreshing a key should clear its negative entry")
+	}
+
+	d := New()
+	d.AddMissing("a")
+	if d.IsMissing("a") {
+		t.Fatalf("negative caching should be disabled without negative ttl")
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	now := time.Now()
+	c := New(WithClock(func() time.Time { return now }))
+	if s := c.Stats(); s.HitRatio() != 0 || s.Size != 0 {
+		t.Fatalf("empty cache stats incorrect, got %+v", s)
+	}
+
+	c.Fill(map[string]int64{"a": 1, "b": 2})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			c.IsPresent("a")
+		}()
+		go func() {
+			defer wg.Done()
+			c.IsPresent("z")
+		}()
+		go func() {
+			defer wg.Done()
+			c.Add("c", 3)
+		}()
+	}
+	wg.Wait()
+
+	want := Stats{Size: 3, Hits: 50, Misses: 50, Adds: 50, Fills: 1, Filled: now}
+	if got := c.Stats(); got != want {
+		t.Fatalf("stats incorrect, got %+v, want %+v", got, want)
+	}
+	if r := c.Stats().HitRatio(); r != 0.5 {
+		t.Fatalf("hit ratio incorrect, got %v, want 0.5", r)
+	}
+}
+
+func TestCacheGeneric(t *testing.T) {
+	type user struct {
+		Email string
+		Ts    int64
+	}
+	c := NewOf[user]()
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("Get(%q) should miss on an empty cache", "a")
+	}
+
+	entries := map[string]user{"a": {"a@domain.com", 1}}
+	c.Fill(entries)
+	c.Add("b", user{"b@domain.com", 2})
+	if c.Len() != 2 {
+		t.Fatalf("incorrect length, got %d, want 2", c.Len())
+	}
+	// the filled map is owned by the cache, entries added later go to it
+	if _, ok := entries["b"]; !ok {
+		t.Fatalf("Fill must not copy the entries")
+	}
+	if u, ok := c.Get("a"); !ok || u.Email != "a@domain.com" || u.Ts != 1 {
+		t.Fatalf("Get(%q) incorrect, got %+v, %v", "a", u, ok)
+	}
+
+	c.Remove("a")
+	if u, ok := c.Get("a"); ok || u != (user{}) {
+		t.Fatalf("Get(%q) after Remove should return the zero value, got %+v, %v", "a", u, ok)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("incorrect length, got %d, want 1", c.Len())
+	}
+}
+
+func TestCacheKeysAndRange(t *testing.T) {
+	c := New()
+	entries := map[string]int64{"a": 1, "b": 2, "c": 3}
+	c.Fill(map[string]int64{"a": 1, "b": 2, "c": 3})
+
+	keys := c.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Fatalf("incorrect keys, got %v", keys)
+	}
+	keys[0] = "z" // a copy
+	if c.IsPresent("z") {
+		t.Fatalf("Keys must return a copy")
+	}
+
+	seen := make(map[string]int64)
+	c.Range(func(k string, v int64) bool {
+		seen[k] = v
+		return true
+	})
+	if !reflect.DeepEqual(seen, entries) {
+		t.Fatalf("Range incorrect, got %v, want %v", seen, entries)
+	}
+
+	n := 0
+	c.Range(func(k string, v int64) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatalf("Range must stop when f returns false, got %d calls", n)
+	}
+}
+
+func TestRank(t *testing.T) {
+	c := New()
+	c.Fill(map[string]int64{"a": 10, "b": 20, "c": 20, "d": 5})
+	for k, want := range map[string]int{"d": 1, "a": 2, "b": 3, "c": 4} {
+		if r, ok := Rank(c, k); !ok || r != want {
+			t.Fatalf("incorrect rank of %s, got %d, %v, want %d", k, r, ok, want)
+		}
+	}
+	if _, ok := Rank(c, "z"); ok {
+		t.Fatalf("missing key cannot be ranked")
+	}
+	if s := c.Stats(); s.Hits != 0 || s.Misses != 0 {
+		t.Fatalf("Rank must not count as lookups, got %+v", s)
+	}
 }
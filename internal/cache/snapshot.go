@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// snapshotVersion is bumped when the encoding of the snapshots changes.
+const snapshotVersion = 1
+
+var ErrInvalidSnapshot = errors.New("invalid cache snapshot")
+
+type snapshot[V any] struct {
+	Version int
+	Entries map[string]V
+}
+
+// Snapshot writes the entries of the cache to w, expired ones not evicted yet included.
+func (c *Cache[V]) Snapshot(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(snapshot[V]{snapshotVersion, c.m})
+}
+
+// Restore fills the cache with the entries of a snapshot written by Snapshot.
+// The cache is left untouched when the snapshot cannot be decoded.
+func (c *Cache[V]) Restore(r io.Reader) error {
+	var s snapshot[V]
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if s.Version != snapshotVersion {
+		return ErrInvalidSnapshot
+	}
+	c.Fill(s.Entries)
+	return nil
+}
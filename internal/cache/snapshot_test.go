@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	const n = 100000
+	entries := make(map[string]int64, n)
+	for i := 0; i < n; i++ {
+		entries[fmt.Sprintf("wallet-%06d", i)] = int64(1700000000000 + i)
+	}
+	c := New()
+	c.Fill(entries)
+
+	var b bytes.Buffer
+	if err := c.Snapshot(&b); err != nil {
+		t.Fatalf("cannot snapshot: %v", err)
+	}
+	r := New()
+	if err := r.Restore(&b); err != nil {
+		t.Fatalf("cannot restore: %v", err)
+	}
+	if r.Len() != n {
+		t.Fatalf("incorrect length, got %d, want %d", r.Len(), n)
+	}
+	for k, want := range entries {
+		if got, ok := r.Get(k); !ok || got != want {
+			t.Fatalf("Get(%q) incorrect, got %d, %v, want %d", k, got, ok, want)
+		}
+	}
+}
+
+func TestSnapshotCorrupted(t *testing.T) {
+	c := New()
+	c.Fill(map[string]int64{"a": 1, "b": 2})
+	var b bytes.Buffer
+	if err := c.Snapshot(&b); err != nil {
+		t.Fatalf("cannot snapshot: %v", err)
+	}
+	raw := b.Bytes()
+
+	tt := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", raw[:len(raw)/2]},
+		{"garbage", []byte("not a snapshot at all")},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := New()
+			r.Fill(map[string]int64{"kept": 3})
+			if err := r.Restore(bytes.NewReader(tc.data)); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Fatalf("Restore must fail with %v, got %v", ErrInvalidSnapshot, err)
+			}
+			if !r.IsPresent("kept") || r.Len() != 1 {
+				t.Fatalf("a failed restore must leave the cache untouched")
+			}
+		})
+	}
+}
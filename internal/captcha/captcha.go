@@ -0,0 +1,90 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TurnstileURL is the siteverify endpoint of Cloudflare Turnstile.
+const TurnstileURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+
+var (
+	ErrMissingToken = errors.New("captcha token missing")
+	ErrRejected     = errors.New("captcha rejected")
+	// ErrUnavailable is wrapped by the errors of a verification that could not complete, the token being neither accepted nor rejected.
+	ErrUnavailable = errors.New("captcha verification unavailable")
+)
+
+// Verifier verifies the CAPTCHA token solved by a client.
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// Noop is a Verifier returning Err for every token, accepting them all when nil.
+type Noop struct {
+	Err error
+}
+
+func (n Noop) Verify(context.Context, string, string) error {
+	return n.Err
+}
+
+// Turnstile verifies the tokens with the siteverify endpoint of Cloudflare Turnstile.
+type Turnstile struct {
+	secret   string
+	endpoint string
+	client   *http.Client
+}
+
+func NewTurnstile(secret string) *Turnstile {
+	return &Turnstile{secret: secret, endpoint: TurnstileURL, client: &http.Client{}}
+}
+
+// WithEndpoint returns t verifying the tokens with the siteverify endpoint u.
+func (t *Turnstile) WithEndpoint(u string) *Turnstile {
+	t.endpoint = u
+	return t
+}
+
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify returns nil when the token is valid, ErrRejected when it is not. The call is bounded by ctx.
+func (t *Turnstile) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrMissingToken
+	}
+	form := url.Values{"secret": {t.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: status %d", ErrUnavailable, res.StatusCode)
+	}
+	var r siteverifyResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&r); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if !r.Success {
+		return fmt.Errorf("%w: %s", ErrRejected, strings.Join(r.ErrorCodes, ", "))
+	}
+	return nil
+}
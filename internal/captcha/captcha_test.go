@@ -0,0 +1,59 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// siteverify stubs the Turnstile endpoint, accepting the token "valid" sent with the secret "s3cr3t".
+func siteverify(t *testing.T) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("response") {
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.FormValue("secret") == "s3cr3t" && r.FormValue("response") == "valid" && r.FormValue("remoteip") == "203.0.113.7" {
+			w.Write([]byte(`{"success":true}`))
+			return
+		}
+		w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestTurnstile(t *testing.T) {
+	s := siteverify(t)
+	v := NewTurnstile("s3cr3t").WithEndpoint(s.URL)
+	tt := []struct {
+		name  string
+		v     *Turnstile
+		token string
+		err   error
+	}{
+		{"valid", v, "valid", nil},
+		{"invalid", v, "forged", ErrRejected},
+		{"missing", v, "", ErrMissingToken},
+		{"wrong secret", NewTurnstile("other").WithEndpoint(s.URL), "valid", ErrRejected},
+		{"server error", v, "broken", ErrUnavailable},
+		{"timeout", v, "slow", ErrUnavailable},
+		{"unreachable", NewTurnstile("s3cr3t").WithEndpoint("http://127.0.0.1:1"), "valid", ErrUnavailable},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if err := tc.v.Verify(ctx, tc.token, "203.0.113.7"); !errors.Is(err, tc.err) {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+		})
+	}
+}
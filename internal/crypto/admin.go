@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// AdminClaims are the claims of the admin tokens, the subject naming the operator.
+type AdminClaims struct {
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+func createAdmin(subject string, t time.Time, m jwt.SigningMethod, k interface{}, aud string) (string, error) {
+	claims := AdminClaims{
+		PurposeAdmin,
+		jwt.RegisteredClaims{
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(t.Add(lifetime(PurposeAdmin))),
+			IssuedAt:  jwt.NewNumericDate(t),
+			NotBefore: jwt.NewNumericDate(t),
+			Issuer:    Issuer,
+			Audience:  jwt.ClaimStrings{aud},
+		},
+	}
+	ss, err := jwt.NewWithClaims(m, claims).SignedString(k)
+	if err != nil {
+		slog.Error("🔥 cannot create the admin token", "subject", subject, slog.Any("error", err))
+		err = ErrSigningToken
+	}
+	return ss, err
+}
+
+// CreateAdmin mints an admin token for the operator subject.
+func (j JWTBase[K]) CreateAdmin(subject string, t time.Time) (string, error) {
+	return createAdmin(subject, t, j.method, j.k, j.aud)
+}
+
+// extractAdmin returns the subject of the admin token, verifying its signature, expiry, issuer, audience and purpose.
+func extractAdmin[SM *jwt.SigningMethodHMAC | *jwt.SigningMethodECDSA](token string, k interface{}, aud string) (string, error) {
+	claims := &AdminClaims{}
+	tk, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(SM); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return k, nil
+	})
+	valid := claims.Purpose == PurposeAdmin && claims.Subject != "" && claims.VerifyIssuer(Issuer, true) && claims.VerifyAudience(aud, true)
+	if tk != nil && tk.Valid && valid {
+		return claims.Subject, nil
+	}
+	var ve *jwt.ValidationError
+	if errors.As(err, &ve) && ve.Errors == jwt.ValidationErrorExpired && valid {
+		return "", ErrExpiredToken
+	}
+	return "", ErrInvalidToken
+}
+
+func (j JWTHMAC) ExtractAdmin(token string) (string, error) {
+	return extractAdmin[*jwt.SigningMethodHMAC](token, j.k, j.aud)
+}
+
+func (j JWTECDSA) ExtractAdmin(token string) (string, error) {
+	return extractAdmin[*jwt.SigningMethodECDSA](token, j.k.Public(), j.aud)
+}
@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestAdminToken(t *testing.T) {
+	es, err := NewJWTES256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, j := range map[string]Token{"HS256": NewJWTHS256("s3cr3t"), "ES256": es} {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			valid, _ := j.CreateAdmin("ops", now)
+			expired, _ := j.CreateAdmin("ops", now.Add(-time.Hour))
+			activation, _ := j.Create(data.NewUser("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "john.doe@mailservice.com", "9mf2bkJf5TebjCYQYq3WcK61ruHTs3bpeQwW2s6WWj3A"), now)
+			other := jwt.NewWithClaims(jwt.SigningMethodHS256, AdminClaims{PurposeAdmin, jwt.RegisteredClaims{
+				Subject:   "ops",
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+				Issuer:    "someone.else",
+				Audience:  jwt.ClaimStrings{DefaultAudience},
+			}})
+			forged, _ := other.SignedString([]byte("s3cr3t"))
+
+			tt := []struct {
+				name    string
+				token   string
+				subject string
+				err     error
+			}{
+				{"valid", valid, "ops", nil},
+				{"expired", expired, "", ErrExpiredToken},
+				{"activation token", activation, "", ErrInvalidToken},
+				{"other issuer", forged, "", ErrInvalidToken},
+				{"tampered", valid + "x", "", ErrInvalidToken},
+			}
+			for _, tc := range tt {
+				t.Run(tc.name, func(t *testing.T) {
+					s, err := j.ExtractAdmin(tc.token)
+					if s != tc.subject || !errors.Is(err, tc.err) {
+						t.Errorf("incorrect extraction, got %q %v, want %q %v", s, err, tc.subject, tc.err)
+						t.FailNow()
+					}
+				})
+			}
+			if _, err := j.Extract(valid); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("an admin token must not be a user token, got %v", err)
+				t.FailNow()
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
 var ErrTooShortCipherText = errors.New("ciphertext too short")
@@ -21,29 +22,35 @@ func GenerateKey(size int) (s string, err error) {
 	return
 }
 
-func Encrypt(text, ks string) (string, error) {
+// boundPrefix marks the ciphertexts bound to associated data, it cannot start a legacy hex ciphertext.
+const boundPrefix = "v2:"
+
+func newGCM(ks string) (cipher.AEAD, error) {
 	k, err := hex.DecodeString(ks)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	c, err := aes.NewCipher(k)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	gcm, err := cipher.NewGCM(c)
+	return cipher.NewGCM(c)
+}
+
+func seal(text, ks string, ad []byte) (string, error) {
+	gcm, err := newGCM(ks)
 	if err != nil {
 		return "", err
 	}
-
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%x", gcm.Seal(nonce, nonce, []byte(text), nil)), nil
+	return fmt.Sprintf("%x", gcm.Seal(nonce, nonce, []byte(text), ad)), nil
 }
 
-func Decrypt(ctext, ks string) (string, error) {
-	k, err := hex.DecodeString(ks)
+func open(ctext, ks string, ad []byte) (string, error) {
+	gcm, err := newGCM(ks)
 	if err != nil {
 		return "", err
 	}
@@ -51,24 +58,49 @@ func Decrypt(ctext, ks string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	c, err := aes.NewCipher(k)
-	if err != nil {
-		return "", err
+	nonceSize := gcm.NonceSize()
+	if len(enc) < nonceSize {
+		return "", ErrTooShortCipherText
 	}
-	gcm, err := cipher.NewGCM(c)
+
+	nonce, ciphertext := enc[:nonceSize], enc[nonceSize:]
+	b, err := gcm.Open(nil, nonce, ciphertext, ad)
 	if err != nil {
 		return "", err
 	}
+	return string(b), nil
+}
 
-	nonceSize := gcm.NonceSize()
-	if len(ctext) < nonceSize {
-		return "nil", ErrTooShortCipherText
-	}
+// Encrypt returns the hex AES-GCM ciphertext of text, prefixed by its random nonce.
+// Prefer EncryptBound, whose ciphertexts cannot be moved to another record.
+func Encrypt(text, ks string) (string, error) {
+	return seal(text, ks, nil)
+}
 
-	nonce, ciphertext := enc[:nonceSize], enc[nonceSize:]
-	b, err := gcm.Open(nil, nonce, ciphertext, nil)
+func Decrypt(ctext, ks string) (string, error) {
+	return open(ctext, ks, nil)
+}
+
+// EncryptBound encrypts text like Encrypt, authenticating ad (the key of the record) along,
+// so the ciphertext only decrypts with the same ad.
+func EncryptBound(text, ks, ad string) (string, error) {
+	c, err := seal(text, ks, []byte(ad))
 	if err != nil {
 		return "", err
 	}
-	return string(b), nil
+	return boundPrefix + c, nil
+}
+
+// DecryptBound decrypts a ciphertext of EncryptBound with the same ad,
+// or a legacy one of Encrypt, which is not bound to any record.
+func DecryptBound(ctext, ks, ad string) (string, error) {
+	if c, ok := strings.CutPrefix(ctext, boundPrefix); ok {
+		return open(c, ks, []byte(ad))
+	}
+	return open(ctext, ks, nil)
+}
+
+// IsLegacy returns whether ctext was not encrypted by EncryptBound, so should be encrypted again.
+func IsLegacy(ctext string) bool {
+	return !strings.HasPrefix(ctext, boundPrefix)
 }
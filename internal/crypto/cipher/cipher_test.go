@@ -120,3 +120,65 @@ func TestEncryptDecryptRotation(t *testing.T) {
 		})
 	}
 }
+
+func TestEncryptDecryptBound(t *testing.T) {
+	ks := keys[32]
+	a, b := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "9mf2bkJf5TebjCYQYq3WcK61ruHTs3bpeQwW2s6WWj3A"
+	ctext, err := EncryptBound(plaintext, ks, a)
+	if err != nil {
+		t.Errorf("incorrect error, got %v, want nil", err)
+		t.FailNow()
+	}
+	if IsLegacy(ctext) {
+		t.Errorf("%q must not be legacy", ctext)
+		t.FailNow()
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		txt, err := DecryptBound(ctext, ks, a)
+		if err != nil || txt != plaintext {
+			t.Errorf("incorrect decryption, got %q, %v, want %q", txt, err, plaintext)
+			t.FailNow()
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		for _, i := range []int{len(boundPrefix), len(ctext) / 2, len(ctext) - 1} { // nonce, ciphertext, tag
+			c := []byte(ctext)
+			if c[i] == '0' {
+				c[i] = '1'
+			} else {
+				c[i] = '0'
+			}
+			if txt, err := DecryptBound(string(c), ks, a); err == nil {
+				t.Errorf("flipping char %d must fail, got %q", i, txt)
+				t.FailNow()
+			}
+		}
+		if _, err := DecryptBound(boundPrefix+"00", ks, a); !errors.Is(err, ErrTooShortCipherText) {
+			t.Errorf("incorrect error, got %v, want %v", err, ErrTooShortCipherText)
+			t.FailNow()
+		}
+	})
+
+	t.Run("swapped between rows", func(t *testing.T) {
+		if txt, err := DecryptBound(ctext, ks, b); err == nil {
+			t.Errorf("a ciphertext bound to %s must not decrypt for %s, got %q", a, b, txt)
+			t.FailNow()
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		for _, n := range []int{16, 24, 32} {
+			if !IsLegacy(ctexts[n]) {
+				t.Errorf("%q must be legacy", ctexts[n])
+				t.FailNow()
+			}
+			txt, err := DecryptBound(ctexts[n], keys[n], a)
+			if err != nil || txt != plaintext {
+				t.Errorf("incorrect legacy decryption, got %q, %v, want %q", txt, err, plaintext)
+				t.FailNow()
+			}
+		}
+	})
+}
@@ -18,7 +18,7 @@ func NewJWTES256() (*JWTECDSA, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &JWTECDSA{JWTBase[*ecdsa.PrivateKey]{jwt.SigningMethodES256, pvk}}, nil
+	return &JWTECDSA{JWTBase[*ecdsa.PrivateKey]{jwt.SigningMethodES256, pvk, DefaultAudience}}, nil
 }
 
 func NewJWTES512() (*JWTECDSA, error) {
@@ -26,7 +26,7 @@ func NewJWTES512() (*JWTECDSA, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &JWTECDSA{JWTBase[*ecdsa.PrivateKey]{jwt.SigningMethodES512, pvk}}, nil
+	return &JWTECDSA{JWTBase[*ecdsa.PrivateKey]{jwt.SigningMethodES512, pvk, DefaultAudience}}, nil
 }
 
 func NewJWTECDSA(k string, m *jwt.SigningMethodECDSA) (*JWTECDSA, error) {
@@ -34,9 +34,26 @@ func NewJWTECDSA(k string, m *jwt.SigningMethodECDSA) (*JWTECDSA, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &JWTECDSA{JWTBase[*ecdsa.PrivateKey]{m, pvk}}, nil
+	return &JWTECDSA{JWTBase[*ecdsa.PrivateKey]{m, pvk, DefaultAudience}}, nil
 }
 
 func (j JWTECDSA) Extract(token string) (u *data.User, err error) {
-	return extract[*jwt.SigningMethodECDSA](token, j.k.Public())
+	u, _, err = j.ExtractWithPurpose(token)
+	return
+}
+
+func (j JWTECDSA) ExtractWithPurpose(token string) (u *data.User, purpose string, err error) {
+	return extract[*jwt.SigningMethodECDSA](token, j.k.Public(), j.aud)
+}
+
+// ExtractUnsafe extracts the user of token, verifying its signature and audience but not its expiry.
+// It tells support what a token contained, never use it for authorization decisions.
+func (j JWTECDSA) ExtractUnsafe(token string) (*data.User, error) {
+	return extractUnsafe[*jwt.SigningMethodECDSA](token, j.k.Public(), j.aud)
+}
+
+// WithAudience binds the tokens to the given deployment audience.
+func (j *JWTECDSA) WithAudience(aud string) *JWTECDSA {
+	j.aud = aud
+	return j
 }
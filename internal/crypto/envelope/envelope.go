@@ -0,0 +1,170 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
+)
+
+// prefix marks the enveloped ciphertexts: prefix, base64 wrapped data key, ':' and the ciphertext of cipher.EncryptBound.
+const prefix = "kms:"
+
+// DefaultRotation is how long a data key encrypts new records before a new one is generated.
+const DefaultRotation = 24 * time.Hour
+
+var ErrNotEnveloped = errors.New("ciphertext not enveloped")
+
+// KMS is the subset of the AWS KMS client used, *kms.KMS implementing it.
+type KMS interface {
+	GenerateDataKey(*kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error)
+	Encrypt(*kms.EncryptInput) (*kms.EncryptOutput, error)
+	Decrypt(*kms.DecryptInput) (*kms.DecryptOutput, error)
+}
+
+type dataKey struct {
+	ks      string // hex plaintext key
+	wrapped string // base64 key encrypted by KMS
+	created time.Time
+}
+
+// Envelope encrypts with data keys generated by KMS, each ciphertext carrying its wrapped data key,
+// so no key but the KMS one is needed to decrypt.
+type Envelope struct {
+	kms      KMS
+	keyID    string
+	rotation time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	current *dataKey
+	keys    map[string]string // unwrapped keys by wrapped one
+}
+
+func New(k KMS, keyID string, rotation time.Duration) *Envelope {
+	return &Envelope{
+		kms:      k,
+		keyID:    keyID,
+		rotation: rotation,
+		now:      time.Now,
+		keys:     map[string]string{},
+	}
+}
+
+// NewKey returns a new AES-256 key, hex encoded, and its wrapped form.
+func (e *Envelope) NewKey() (string, []byte, error) {
+	r, err := e.kms.GenerateDataKey(&kms.GenerateDataKeyInput{
+		KeyId:   aws.String(e.keyID),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	ks := hex.EncodeToString(r.Plaintext)
+	e.mu.Lock()
+	e.keys[string(r.CiphertextBlob)] = ks
+	e.mu.Unlock()
+	return ks, r.CiphertextBlob, nil
+}
+
+// Wrap encrypts the hex key ks with the KMS key.
+func (e *Envelope) Wrap(ks string) ([]byte, error) {
+	k, err := hex.DecodeString(ks)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.kms.Encrypt(&kms.EncryptInput{
+		KeyId:     aws.String(e.keyID),
+		Plaintext: k,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.CiphertextBlob, nil
+}
+
+// Unwrap returns the hex key of a wrapped one, KMS being called once per key.
+func (e *Envelope) Unwrap(wrapped []byte) (string, error) {
+	e.mu.Lock()
+	ks, ok := e.keys[string(wrapped)]
+	e.mu.Unlock()
+	if ok {
+		return ks, nil
+	}
+	r, err := e.kms.Decrypt(&kms.DecryptInput{
+		KeyId:          aws.String(e.keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return "", err
+	}
+	ks = hex.EncodeToString(r.Plaintext)
+	e.mu.Lock()
+	e.keys[string(wrapped)] = ks
+	e.mu.Unlock()
+	return ks, nil
+}
+
+// dataKey returns the key encrypting new records, generating one when the current key is too old.
+func (e *Envelope) dataKey() (*dataKey, error) {
+	e.mu.Lock()
+	k := e.current
+	e.mu.Unlock()
+	if k != nil && e.now().Sub(k.created) < e.rotation {
+		return k, nil
+	}
+	ks, wrapped, err := e.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	k = &dataKey{ks, base64.StdEncoding.EncodeToString(wrapped), e.now()}
+	e.mu.Lock()
+	e.current = k
+	e.mu.Unlock()
+	return k, nil
+}
+
+// Encrypt encrypts text bound to ad with the current data key.
+func (e *Envelope) Encrypt(text, ad string) (string, error) {
+	k, err := e.dataKey()
+	if err != nil {
+		return "", err
+	}
+	c, err := cipher.EncryptBound(text, k.ks, ad)
+	if err != nil {
+		return "", err
+	}
+	return prefix + k.wrapped + ":" + c, nil
+}
+
+// Decrypt decrypts a ciphertext of Encrypt with the same ad, ErrNotEnveloped for other ciphertexts.
+func (e *Envelope) Decrypt(ctext, ad string) (string, error) {
+	s, ok := strings.CutPrefix(ctext, prefix)
+	if !ok {
+		return "", ErrNotEnveloped
+	}
+	w, c, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", ErrNotEnveloped
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(w)
+	if err != nil {
+		return "", err
+	}
+	ks, err := e.Unwrap(wrapped)
+	if err != nil {
+		return "", err
+	}
+	return cipher.DecryptBound(c, ks, ad)
+}
+
+// IsEnveloped returns whether ctext was encrypted by an Envelope.
+func IsEnveloped(ctext string) bool {
+	return strings.HasPrefix(ctext, prefix)
+}
@@ -0,0 +1,170 @@
+package envelope
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
+)
+
+const (
+	keyID   = "arn:aws:kms:eu-west-3:111122223333:key/test"
+	address = "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	email   = "john.doe@mailservice.com"
+)
+
+// fakeKMS wraps the keys with its own cipher key, counting the calls.
+type fakeKMS struct {
+	ks                   string
+	generated, decrypted int
+}
+
+func newFakeKMS() *fakeKMS {
+	ks, _ := cipher.GenerateKey(32)
+	return &fakeKMS{ks: ks}
+}
+
+func (f *fakeKMS) GenerateDataKey(in *kms.GenerateDataKeyInput) (*kms.GenerateDataKeyOutput, error) {
+	f.generated++
+	k := make([]byte, 32)
+	rand.Read(k)
+	r, err := f.Encrypt(&kms.EncryptInput{KeyId: in.KeyId, Plaintext: k})
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyOutput{KeyId: in.KeyId, Plaintext: k, CiphertextBlob: r.CiphertextBlob}, nil
+}
+
+func (f *fakeKMS) Encrypt(in *kms.EncryptInput) (*kms.EncryptOutput, error) {
+	c, err := cipher.EncryptBound(string(in.Plaintext), f.ks, *in.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.EncryptOutput{KeyId: in.KeyId, CiphertextBlob: []byte(c)}, nil
+}
+
+func (f *fakeKMS) Decrypt(in *kms.DecryptInput) (*kms.DecryptOutput, error) {
+	f.decrypted++
+	p, err := cipher.DecryptBound(string(in.CiphertextBlob), f.ks, *in.KeyId)
+	if err != nil {
+		return nil, fmt.Errorf("InvalidCiphertextException: %v", err)
+	}
+	return &kms.DecryptOutput{KeyId: in.KeyId, Plaintext: []byte(p)}, nil
+}
+
+func TestEnvelope(t *testing.T) {
+	f := newFakeKMS()
+	e := New(f, keyID, time.Hour)
+	ctext, err := e.Encrypt(email, address)
+	if err != nil {
+		t.Errorf("incorrect error, got %v, want nil", err)
+		t.FailNow()
+	}
+	if !IsEnveloped(ctext) {
+		t.Errorf("%q must be enveloped", ctext)
+		t.FailNow()
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		txt, err := e.Decrypt(ctext, address)
+		if err != nil || txt != email {
+			t.Errorf("incorrect decryption, got %q, %v, want %q", txt, err, email)
+			t.FailNow()
+		}
+		if f.decrypted != 0 {
+			t.Errorf("the current data key must not be unwrapped, got %d KMS calls", f.decrypted)
+			t.FailNow()
+		}
+	})
+
+	t.Run("after restart", func(t *testing.T) {
+		e2 := New(f, keyID, time.Hour) // no key in memory
+		for i := 0; i < 3; i++ {
+			txt, err := e2.Decrypt(ctext, address)
+			if err != nil || txt != email {
+				t.Errorf("incorrect decryption, got %q, %v, want %q", txt, err, email)
+				t.FailNow()
+			}
+		}
+		if f.decrypted != 1 {
+			t.Errorf("unwrapped keys must be cached, got %d KMS calls, want 1", f.decrypted)
+			t.FailNow()
+		}
+	})
+
+	t.Run("swapped between rows", func(t *testing.T) {
+		if txt, err := e.Decrypt(ctext, "9mf2bkJf5TebjCYQYq3WcK61ruHTs3bpeQwW2s6WWj3A"); err == nil {
+			t.Errorf("a ciphertext bound to another address must not decrypt, got %q", txt)
+			t.FailNow()
+		}
+	})
+
+	t.Run("another KMS key", func(t *testing.T) {
+		e2 := New(newFakeKMS(), keyID, time.Hour)
+		if txt, err := e2.Decrypt(ctext, address); err == nil {
+			t.Errorf("decryption must fail without the KMS key, got %q", txt)
+			t.FailNow()
+		}
+	})
+
+	t.Run("not enveloped", func(t *testing.T) {
+		legacy, _ := cipher.EncryptBound(email, f.ks, address)
+		for _, c := range []string{legacy, prefix + "nocolon"} {
+			if _, err := e.Decrypt(c, address); !errors.Is(err, ErrNotEnveloped) {
+				t.Errorf("incorrect error for %q, got %v, want %v", c, err, ErrNotEnveloped)
+				t.FailNow()
+			}
+		}
+	})
+}
+
+func TestRotation(t *testing.T) {
+	f := newFakeKMS()
+	now := time.Now()
+	e := New(f, keyID, time.Hour)
+	e.now = func() time.Time { return now }
+
+	c1, _ := e.Encrypt(email, address)
+	c2, _ := e.Encrypt(email, address)
+	now = now.Add(time.Hour)
+	c3, _ := e.Encrypt(email, address)
+	if f.generated != 2 {
+		t.Errorf("incorrect number of data keys, got %d, want 2", f.generated)
+		t.FailNow()
+	}
+	wrapped := func(c string) string { return strings.Split(c, ":")[1] }
+	if wrapped(c1) != wrapped(c2) || wrapped(c1) == wrapped(c3) {
+		t.Errorf("a data key must encrypt until rotated")
+		t.FailNow()
+	}
+	for _, c := range []string{c1, c3} {
+		if txt, err := e.Decrypt(c, address); err != nil || txt != email {
+			t.Errorf("incorrect decryption, got %q, %v, want %q", txt, err, email)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	f := newFakeKMS()
+	e := New(f, keyID, time.Hour)
+	ks, _ := cipher.GenerateKey(32)
+	w, err := e.Wrap(ks)
+	if err != nil {
+		t.Errorf("incorrect error, got %v, want nil", err)
+		t.FailNow()
+	}
+	if k, err := New(f, keyID, time.Hour).Unwrap(w); err != nil || k != ks {
+		t.Errorf("incorrect unwrapped key, got %q, %v, want %q", k, err, ks)
+		t.FailNow()
+	}
+	if _, err := e.Wrap("not hex"); err == nil {
+		t.Errorf("wrapping an invalid key must fail")
+		t.FailNow()
+	}
+}
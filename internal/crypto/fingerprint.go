@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// ErrSelfCheck is returned by SelfCheck when the tokens created are not extracted as they were.
+var ErrSelfCheck = errors.New("token self-check failed")
+
+// Fingerprint identifies the verifying key and the audience of the tokens, the same for the replicas sharing them:
+// the SHA-256 of the public key, or of the secret, with the audience. Neither key can be recovered from it.
+func (j JWTBase[K]) Fingerprint() string {
+	var b []byte
+	switch k := any(j.k).(type) {
+	case *ecdsa.PrivateKey:
+		b, _ = x509.MarshalPKIXPublicKey(&k.PublicKey) // P-256 and P-521 keys always marshal
+	case []byte:
+		b = k
+	}
+	h := sha256.New()
+	h.Write([]byte(j.method.Alg() + "\x00" + j.aud + "\x00"))
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// selfCheckUser is the user of the tokens created by SelfCheck, never sent.
+var selfCheckUser = data.User{
+	Address: "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF",
+	Email:   "self-check@waitlist.invalid",
+	Sponsor: "9mf2bkJf5TebjCYQYq3WcK61ruHTs3bpeQwW2s6WWj3A",
+}
+
+// SelfCheck creates an activation and an admin token with t, then extracts them, failing with ErrSelfCheck
+// unless they are extracted as they were created: a replica failing it would reject its own tokens.
+func SelfCheck(t Token) error {
+	now := time.Now()
+	u := selfCheckUser
+	ss, err := t.Create(&u, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfCheck, err)
+	}
+	got, err := t.Extract(ss)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfCheck, err)
+	}
+	if got.Address != u.Address || got.Email != u.Email || got.Sponsor != u.Sponsor {
+		return fmt.Errorf("%w: extracted %s", ErrSelfCheck, got.Address)
+	}
+	if ss, err = t.CreateAdmin("self-check", now); err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfCheck, err)
+	}
+	if sub, err := t.ExtractAdmin(ss); err != nil || sub != "self-check" {
+		return fmt.Errorf("%w: admin token extracted as %q: %v", ErrSelfCheck, sub, err)
+	}
+	return nil
+}
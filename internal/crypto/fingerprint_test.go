@@ -0,0 +1,61 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestFingerprint(t *testing.T) {
+	j1, _ := NewJWTECDSA(privateKey, jwt.SigningMethodES256)
+	j2, _ := NewJWTECDSA(privateKeyPKCS_8, jwt.SigningMethodES256) // the same key, encoded otherwise
+	if j1.Fingerprint() != j2.Fingerprint() || len(j1.Fingerprint()) != 16 {
+		t.Errorf("the tokens of the same key must have the same fingerprint, got %s and %s", j1.Fingerprint(), j2.Fingerprint())
+		t.FailNow()
+	}
+	generated, _ := NewJWTES256()
+	for name, other := range map[string]Token{
+		"another key":      generated,
+		"another audience": j2.WithAudience("waitlist-staging"),
+		"HMAC":             NewJWTHS256(secret),
+	} {
+		if other.Fingerprint() == j1.Fingerprint() {
+			t.Errorf("the tokens of %s must have another fingerprint", name)
+			t.FailNow()
+		}
+	}
+	if NewJWTHS256(secret).Fingerprint() != NewJWTHS256(secret).Fingerprint() {
+		t.Errorf("the tokens of the same secret must have the same fingerprint")
+		t.FailNow()
+	}
+}
+
+// forgetful extracts the tokens of another user than the one they were created for.
+type forgetful struct {
+	*JWTHMAC
+}
+
+func (f forgetful) Extract(token string) (*data.User, error) {
+	u, err := f.JWTHMAC.Extract(token)
+	if u != nil {
+		u.Email = email
+	}
+	return u, err
+}
+
+func TestSelfCheck(t *testing.T) {
+	es256, _ := NewJWTES256()
+	es512, _ := NewJWTES512()
+	for _, j := range []Token{NewJWTHS256(secret), NewJWTHS512(secret), es256, es512.WithAudience("waitlist-staging")} {
+		if err := SelfCheck(j); err != nil {
+			t.Errorf("the self-check must pass, got %v", err)
+			t.FailNow()
+		}
+	}
+	if err := SelfCheck(forgetful{NewJWTHS256(secret)}); !errors.Is(err, ErrSelfCheck) {
+		t.Errorf("a token extracted otherwise than created must fail the self-check, got %v", err)
+		t.FailNow()
+	}
+}
@@ -10,13 +10,30 @@ type JWTHMAC struct {
 }
 
 func NewJWTHS256(s string) *JWTHMAC {
-	return &JWTHMAC{JWTBase[[]byte]{jwt.SigningMethodHS256, []byte(s)}}
+	return &JWTHMAC{JWTBase[[]byte]{jwt.SigningMethodHS256, []byte(s), DefaultAudience}}
 }
 
 func NewJWTHS512(s string) *JWTHMAC {
-	return &JWTHMAC{JWTBase[[]byte]{jwt.SigningMethodHS512, []byte(s)}}
+	return &JWTHMAC{JWTBase[[]byte]{jwt.SigningMethodHS512, []byte(s), DefaultAudience}}
 }
 
 func (j JWTHMAC) Extract(token string) (u *data.User, err error) {
-	return extract[*jwt.SigningMethodHMAC](token, j.k)
+	u, _, err = j.ExtractWithPurpose(token)
+	return
+}
+
+func (j JWTHMAC) ExtractWithPurpose(token string) (u *data.User, purpose string, err error) {
+	return extract[*jwt.SigningMethodHMAC](token, j.k, j.aud)
+}
+
+// ExtractUnsafe extracts the user of token, verifying its signature and audience but not its expiry.
+// It tells support what a token contained, never use it for authorization decisions.
+func (j JWTHMAC) ExtractUnsafe(token string) (*data.User, error) {
+	return extractUnsafe[*jwt.SigningMethodHMAC](token, j.k, j.aud)
+}
+
+// WithAudience binds the tokens to the given deployment audience.
+func (j *JWTHMAC) WithAudience(aud string) *JWTHMAC {
+	j.aud = aud
+	return j
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -13,8 +14,15 @@ import (
 
 type Token interface {
 	Create(user *data.User, t time.Time) (string, error)
+	CreateWithPurpose(user *data.User, purpose string, t time.Time) (string, error)
 	Extract(token string) (*data.User, error)
+	ExtractWithPurpose(token string) (*data.User, string, error)
+	ExtractUnsafe(token string) (*data.User, error)
 	Hash(token string) string
+	Audience() string
+	CreateAdmin(subject string, t time.Time) (string, error)
+	ExtractAdmin(token string) (string, error)
+	Fingerprint() string
 }
 
 type KeyConstraint interface {
@@ -24,16 +32,50 @@ type KeyConstraint interface {
 type JWTBase[K KeyConstraint] struct {
 	method jwt.SigningMethod
 	k      K
+	aud    string
 }
 
 type UserClaims struct {
 	data.User
+	Purpose string `json:"purpose"`
 	jwt.RegisteredClaims
 }
 
+// registeredAt returns the unix ms of the registration of the user of c, when its token was issued.
+func (c *UserClaims) registeredAt() int64 {
+	if c.IssuedAt == nil {
+		return 0
+	}
+	return c.IssuedAt.UnixMilli()
+}
+
+const (
+	// DefaultAudience is the aud claim used when no deployment audience is configured.
+	DefaultAudience = "waitlist"
+	// PurposeActivate is the purpose of the tokens sent in activation emails, the only ones /activate accepts.
+	PurposeActivate = "activate"
+	// PurposeUnsubscribe is the purpose of the opt-out tokens sent along the activation ones.
+	PurposeUnsubscribe = "unsubscribe"
+	// PurposeAdmin is the purpose of the tokens of the operators, accepted by the admin routes only.
+	PurposeAdmin = "admin"
+	// Issuer is the iss claim of the tokens.
+	Issuer = "unleak.trade"
+)
+
+// ttl is the lifetime of the tokens by purpose, defaultTTL for the others.
+var (
+	defaultTTL = 10 * time.Minute
+	ttl        = map[string]time.Duration{
+		PurposeUnsubscribe: 30 * 24 * time.Hour,
+		PurposeAdmin:       15 * time.Minute,
+	}
+)
+
 var (
 	ErrSigningToken = errors.New("cannot sign token")
 	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is an ErrInvalidToken whose only fault is its expiry.
+	ErrExpiredToken = fmt.Errorf("%w: expired", ErrInvalidToken)
 )
 
 func hash(token string) string {
@@ -44,43 +86,124 @@ func (JWTBase[K]) Hash(token string) string {
 	return hash(token)
 }
 
-func create(user *data.User, t time.Time, m jwt.SigningMethod, k interface{}) (string, error) {
+func lifetime(purpose string) time.Duration {
+	if d, ok := ttl[purpose]; ok {
+		return d
+	}
+	return defaultTTL
+}
+
+func create(user *data.User, purpose string, t time.Time, m jwt.SigningMethod, k interface{}, aud string) (string, error) {
 	claims := UserClaims{
 		*user,
+		purpose,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(t.Add(10 * time.Minute)), // seconds
-			IssuedAt:  jwt.NewNumericDate(t),                       // seconds
-			NotBefore: jwt.NewNumericDate(t),                       // seconds
-			Issuer:    "unleak.trade",
+			ExpiresAt: jwt.NewNumericDate(t.Add(lifetime(purpose))), // seconds
+			IssuedAt:  jwt.NewNumericDate(t),                        // seconds
+			NotBefore: jwt.NewNumericDate(t),                        // seconds
+			Issuer:    Issuer,
+			Audience:  jwt.ClaimStrings{aud},
 		},
 	}
 	token := jwt.NewWithClaims(m, claims)
 	ss, err := token.SignedString(k)
 	if err != nil {
-		fmt.Printf("error creating token for user %v : %v", *user, err)
+		slog.Error("🔥 cannot create the token", "address", user.Address, slog.Any("error", err))
 		err = ErrSigningToken
 	}
 	return ss, err
 }
 
+// IssuedAt returns the time token was minted at, without verifying it: the token must still be extracted to be trusted.
+func IssuedAt(token string) (time.Time, error) {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil || claims.IssuedAt == nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	return claims.IssuedAt.Time, nil
+}
+
+// Create mints an activation token.
 func (j JWTBase[K]) Create(user *data.User, t time.Time) (string, error) {
-	return create(user, t, j.method, j.k)
+	return j.CreateWithPurpose(user, PurposeActivate, t)
+}
+
+func (j JWTBase[K]) CreateWithPurpose(user *data.User, purpose string, t time.Time) (string, error) {
+	return create(user, purpose, t, j.method, j.k, j.aud)
 }
 
-func extract[SM *jwt.SigningMethodHMAC | *jwt.SigningMethodECDSA](token string, k interface{}) (u *data.User, err error) {
+// Audience returns the aud claim set in created tokens and required in extracted ones.
+func (j JWTBase[K]) Audience() string {
+	return j.aud
+}
+
+func extract[SM *jwt.SigningMethodHMAC | *jwt.SigningMethodECDSA](token string, k interface{}, aud string) (u *data.User, purpose string, err error) {
 	uclaims := &UserClaims{}
-	tk, _ := jwt.ParseWithClaims(token, uclaims, func(token *jwt.Token) (interface{}, error) {
+	tk, perr := jwt.ParseWithClaims(token, uclaims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(SM); !ok {
-			fmt.Printf("Unexpected signing method: %v\n", token.Header["alg"])
+			slog.Warn("⚠️ unexpected signing method", "alg", token.Header["alg"])
 			return nil, jwt.ErrSignatureInvalid
 		}
 		return k, nil
 	})
 
-	if tk.Valid && uclaims.IsSet() {
-		return data.NewUser(uclaims.Address, uclaims.Email, uclaims.Sponsor), nil
+	// tokens minted for another deployment (or without audience) are rejected, tk being nil when malformed
+	if tk != nil && tk.Valid && uclaims.VerifyAudience(aud, true) && uclaims.IsSet() {
+		u = data.NewUser(uclaims.Address, uclaims.Email, uclaims.Sponsor)
+		u.Lang = uclaims.Lang
+		u.InviteCode = uclaims.InviteCode
+		u.RegisteredAt = uclaims.registeredAt()
+		return u, uclaims.Purpose, nil
 	}
 	//fmt.Printf("Error extracting JWT: %v\n", err)
+	var ve *jwt.ValidationError
+	if errors.As(perr, &ve) && ve.Errors == jwt.ValidationErrorExpired && uclaims.VerifyAudience(aud, true) && uclaims.IsSet() {
+		return nil, "", ErrExpiredToken
+	}
 	err = ErrInvalidToken
 	return
 }
+
+// extractUnsafe is extract ignoring the exp, nbf and iat claims: the signature and the audience are still verified.
+func extractUnsafe[SM *jwt.SigningMethodHMAC | *jwt.SigningMethodECDSA](token string, k interface{}, aud string) (*data.User, error) {
+	uclaims := &UserClaims{}
+	tk, err := jwt.NewParser(jwt.WithoutClaimsValidation()).ParseWithClaims(token, uclaims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(SM); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return k, nil
+	})
+	if err != nil || !tk.Valid || !uclaims.VerifyAudience(aud, true) || !uclaims.IsSet() {
+		return nil, ErrInvalidToken
+	}
+	u := data.NewUser(uclaims.Address, uclaims.Email, uclaims.Sponsor)
+	u.Lang = uclaims.Lang
+	u.InviteCode = uclaims.InviteCode
+	u.RegisteredAt = uclaims.registeredAt()
+	return u, nil
+}
+
+// Validities of the tokens, as inspected by Inspect.
+const (
+	Valid        = "valid"
+	Expired      = "expired"
+	BadSignature = "bad_signature" // or malformed, or of another audience
+	NotYetValid  = "not_yet_valid"
+)
+
+// Inspect returns the user of token and its validity, the user being nil when the signature is bad.
+// Like ExtractUnsafe, it is for support tooling: only Extract must decide what a token authorizes.
+func Inspect(j Token, token string) (*data.User, string) {
+	u, err := j.Extract(token)
+	switch {
+	case err == nil:
+		return u, Valid
+	case errors.Is(err, ErrExpiredToken):
+		u, _ = j.ExtractUnsafe(token)
+		return u, Expired
+	}
+	if u, err = j.ExtractUnsafe(token); err != nil {
+		return nil, BadSignature
+	}
+	return u, NotYetValid
+}
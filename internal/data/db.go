@@ -3,16 +3,76 @@ package data
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
 )
 
 type DB interface {
 	Save(u *User) error
+	SaveBatch(users []*User) []error // the error of each user, nil when saved
 	List(options ...int) ([]*User, error)
+	ListAddresses() (map[string]int64, error) // the timestamps of the users by address, their emails not decrypted
 	IsPresent(a string) (bool, error)
+	Get(a string) (*User, error) // nil when absent
+	Delete(a string) error       // soft-deletes the user, ErrUserNotFound when absent or already deleted
+	// Restore undoes the deletion of the user of address a, ErrUserNotFound when absent or not deleted.
+	Restore(a string) (*User, error)
+	Purge(before time.Time) ([]*User, error) // hard-deletes the users deleted before, returned
+	// Anonymize erases the email and client metadata of the user of address a, keeping its uuid, timestamp and sponsor,
+	// ErrUserNotFound when absent, deleted, genesis or already anonymized.
+	Anonymize(a string) (*User, error)
+	FindByEmail(e string) (*User, error) // nil when no user has the same normalized email
+	Suppress(e string) error             // opts email e out, by its hash
+	IsSuppressed(e string) (bool, error)
+	// UpdateEmail replaces the email of the user of address a, ErrUserNotFound when absent, genesis or anonymized.
+	UpdateEmail(a, e string) (*User, error)
+	CountBySponsor(s string) (int, error)    // activated users sponsored by s
+	ListBySponsor(s string) ([]*User, error) // activated users sponsored by s, from the sponsor index
+	// ClaimReferral atomically takes one of the max referrals of sponsor s, ErrReferralLimit when none is left.
+	// seed is the number of referrals already claimed when the counter does not exist yet.
+	ClaimReferral(s string, seed, max int) error
+	ReleaseReferral(s string) error // gives back a referral claimed for an activation that failed
+	// ClaimSeat atomically takes one of the max seats of the waitlist, ErrWaitlistFull when none is left.
+	// seed is the number of activated users when the counter does not exist yet.
+	ClaimSeat(seed, max int) error
+	ReleaseSeat() error // gives back a seat claimed for an activation that failed, or of a deleted user
+	CreateInvite(i *Invite) error
+	// RedeemInvite atomically takes one use of the invite code at t,
+	// ErrInviteNotFound, ErrInviteExpired or ErrInviteExhausted when it cannot be used.
+	RedeemInvite(code string, t time.Time) (*Invite, error)
+	AppendEvent(e Event) error
+	ListEvents(a string, limit int) ([]Event, error) // most recent first, all when limit is 0
+	// AcquireLock takes the lock name for owner during ttl, false when another owner holds it.
+	// The owner holding it extends it.
+	AcquireLock(name, owner string, ttl time.Duration) (bool, error)
+	LastDigests() (map[string]int64, error) // the time of the last digest of each sponsor, unix ms
+	SetLastDigest(s string, t int64) error
+	Maintenance() (Maintenance, error) // disabled when never set
+	SetMaintenance(m Maintenance) error
+	RecordDelivery(e string, d Delivery) error // appends the attempt d to send an email to e, by its hash
+	Deliveries(e string) ([]Delivery, error)   // the last attempts to send an email to e, oldest first
 }
 
+// logger is the logger of the data layer, replaced by SetLogger.
+var logger = slog.Default()
+
+// decryptor decrypts the emails and metadata stored, replaced by a counting stub in the benchmarks.
+var decryptor = cipher.DecryptBound
+
+// SetLogger replaces the logger of the data layer by l.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+var (
+	ErrReferralLimit = errors.New("sponsor referral limit reached")
+	ErrWaitlistFull  = errors.New("waitlist full")
+	ErrUserNotFound  = errors.New("user not found")
+)
+
 // MOCK
 var (
 	usersMapMock = map[string]int{
@@ -34,10 +94,19 @@ type mockDB struct {
 }
 
 func (db mockDB) Save(u *User) (err error) {
-	fmt.Printf("💾 User [ %v ] saved in DB\n", *u)
+	logger.Debug("💾 user saved in mock DB", "address", u.Address)
 	return
 }
 
+func (db mockDB) SaveBatch(users []*User) []error {
+	errs := make([]error, len(users))
+	for i, u := range users {
+		errs[i] = checkUser(u)
+	}
+	logger.Debug("💾 users saved in mock DB", "count", len(users))
+	return errs
+}
+
 func (db mockDB) List(options ...int) ([]*User, error) {
 	m := usersMapMock
 	users := []*User{}
@@ -49,90 +118,191 @@ func (db mockDB) List(options ...int) ([]*User, error) {
 			users = append(users, u)
 		}
 	}
+	return Page(users, options...)
+}
+
+func (db mockDB) ListAddresses() (map[string]int64, error) {
+	users, _ := db.List()
+	return addresses(users), nil
+}
+
+// addresses returns the timestamps of users by address.
+func addresses(users []*User) map[string]int64 {
+	m := make(map[string]int64, len(users))
+	for _, u := range users {
+		m[u.Address] = u.Timestamp
+	}
+	return m
+}
 
+// Page returns the users from the offset options[0] up to the max options[1], both optional.
+// An offset beyond the users gives none, a max beyond them the users left.
+func Page(users []*User, options ...int) ([]*User, error) {
 	offset, max := 0, len(users)
 	if len(options) >= 1 {
 		offset = options[0]
-		max = len(users) - offset
 	}
 	if len(options) == 2 {
 		max = options[1]
 	}
-	if offset < 0 || offset > len(users) {
-		return nil, fmt.Errorf("incorrect offset")
+	if offset < 0 {
+		return nil, ErrBadOffset
 	}
 	if max < 0 {
-		return nil, fmt.Errorf("incorrect max")
-	}
-	if max > len(users) {
-		max = len(users) - offset
-	}
-
-	if offset+max > len(users) {
-		return nil, fmt.Errorf("ouf of bounds [%d:%d]", offset, offset+max)
+		return nil, ErrBadMax
 	}
-
-	return users[offset : offset+max], nil
+	offset = min(offset, len(users))
+	max = min(max, len(users)-offset)
+	return append([]*User{}, users[offset:offset+max]...), nil
 }
 
 func (db mockDB) IsPresent(a string) (bool, error) {
 	return true, nil
 }
 
-var MockDB = mockDB{}
+func (db mockDB) Get(a string) (*User, error) {
+	return NewUser(a, "john.doe@domain.com", solana.NewWallet().PublicKey().String()), nil
+}
 
-type mockDBContent struct {
-	mockDB
-	l []string
+func (db mockDB) Delete(a string) error {
+	logger.Debug("🗑️ user deleted from mock DB", "address", a)
+	return nil
 }
 
-func (db mockDBContent) IsPresent(a string) (bool, error) {
-	for _, v := range db.l {
-		if v == a {
-			return true, nil
-		}
-	}
+func (db mockDB) Restore(a string) (*User, error) {
+	logger.Debug("♻️ user restored in mock DB", "address", a)
+	return NewUser(a, "john.doe@domain.com", solana.NewWallet().PublicKey().String()), nil
+}
+
+func (db mockDB) Purge(before time.Time) ([]*User, error) {
+	return []*User{}, nil
+}
+
+func (db mockDB) Anonymize(a string) (*User, error) {
+	logger.Debug("🕶️ user anonymized in mock DB", "address", a)
+	return &User{Address: a, Email: AnonymizedEmail, Sponsor: solana.NewWallet().PublicKey().String()}, nil
+}
+
+func (db mockDB) UpdateEmail(a, e string) (*User, error) {
+	logger.Debug("✏️ email updated in mock DB", "address", a)
+	return NewUser(a, e, solana.NewWallet().PublicKey().String()), nil
+}
+
+func (db mockDB) FindByEmail(e string) (*User, error) {
+	return nil, nil
+}
+
+func (db mockDB) Suppress(e string) error {
+	logger.Debug("🔕 email suppressed in mock DB", "email", RedactEmail(e))
+	return nil
+}
+
+func (db mockDB) IsSuppressed(e string) (bool, error) {
 	return false, nil
 }
 
-func NewMockDBContent(l []string) *mockDBContent {
-	return &mockDBContent{MockDB, l}
+func (db mockDB) CountBySponsor(s string) (int, error) {
+	return 0, nil
+}
+
+func (db mockDB) ListBySponsor(s string) ([]*User, error) {
+	return []*User{}, nil
+}
+
+func (db mockDB) ClaimReferral(s string, seed, max int) error {
+	return nil
+}
+
+func (db mockDB) ReleaseReferral(s string) error {
+	return nil
+}
+
+func (db mockDB) ClaimSeat(seed, max int) error {
+	return nil
 }
 
-type mockErrDB struct {
-	mockDBContent
+func (db mockDB) ReleaseSeat() error {
+	return nil
 }
 
-func NewMockErrDB(l []string) *mockErrDB {
-	return &mockErrDB{*NewMockDBContent(l)}
+func (db mockDB) CreateInvite(i *Invite) error {
+	logger.Debug("🎟️ invite saved in mock DB", "code", i.Code)
+	return nil
 }
 
-func (db mockErrDB) Save(u *User) (err error) {
-	m := fmt.Sprintf("🔥 Error saving User [ %v ] in DB\n", *u)
-	fmt.Print(m)
-	return errors.New(m)
+func (db mockDB) RedeemInvite(code string, t time.Time) (*Invite, error) {
+	return &Invite{Code: code, Creator: solana.NewWallet().PublicKey().String(), MaxUses: 1, Uses: 1}, nil
 }
 
-func (db mockErrDB) List(options ...int) ([]*User, error) {
-	m := "🔥 Error listing Users in DB"
-	fmt.Println(m)
-	return nil, errors.New(m)
+var MockDB = mockDB{}
+
+// mockDBContent is a memory store seeded with users, l[0] being the genesis sponsor of the others.
+type mockDBContent struct {
+	*store
 }
 
-type mockErrFindingAddress struct {
-	mockDBContent
-	a string
+func NewMockDBContent(l []string) *mockDBContent {
+	db := &mockDBContent{NewMemoryDB()}
+	for i, a := range l {
+		if i == 0 {
+			db.add(NewGenesisUser(a))
+			continue
+		}
+		db.add(NewUser(a, fmt.Sprintf("user%d@domain.com", i), l[0]))
+	}
+	return db
 }
 
-func (db mockErrFindingAddress) IsPresent(a string) (bool, error) {
-	if a == db.a {
-		m := fmt.Sprintf("🔥 Error finding address %s in DB", a)
-		fmt.Println(m)
-		return false, errors.New(m)
+// add stores u without validating it, the mocks being seeded with any address.
+func (db *mockDBContent) add(u *User) {
+	stored := &storedUser{User: *u}
+	if !u.Genesis {
+		stored.Email, _ = cipher.EncryptBound(u.Email, db.ek, u.Address)
+		stored.EmailHash = EmailHash(u.Email, db.ek)
 	}
-	return db.mockDBContent.IsPresent(a)
+	db.update(func(s *state) error {
+		s.Users[u.Address] = stored
+		return nil
+	})
 }
 
-func NewMockErrFindingAddress(l []string, a string) *mockErrFindingAddress {
-	return &mockErrFindingAddress{*NewMockDBContent(l), a}
+// Seats returns the seats claimed in the mock, -1 before the first claim.
+func (db *mockDBContent) Seats() int {
+	n := -1
+	db.read(func(s *state) error {
+		if s.Seats != nil {
+			n = *s.Seats
+		}
+		return nil
+	})
+	return n
+}
+
+// WithReferrals adds n users sponsored by s, their referrals claimed.
+func (db *mockDBContent) WithReferrals(s string, n int) *mockDBContent {
+	for i := 0; i < n; i++ {
+		db.add(NewUser(solana.NewWallet().PublicKey().String(), fmt.Sprintf("referral%d@domain.com", i), s))
+	}
+	db.update(func(st *state) error {
+		st.Referrals[s] = n
+		return nil
+	})
+	return db
+}
+
+// WithEmails adds users of emails e, sponsored by the genesis user.
+func (db *mockDBContent) WithEmails(e ...string) *mockDBContent {
+	var g string
+	db.read(func(s *state) error {
+		for a, u := range s.Users {
+			if u.Genesis {
+				g = a
+			}
+		}
+		return nil
+	})
+	for _, v := range e {
+		db.add(NewUser(solana.NewWallet().PublicKey().String(), v, g))
+	}
+	return db
 }
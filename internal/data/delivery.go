@@ -0,0 +1,36 @@
+package data
+
+// Statuses of the delivery attempts.
+const (
+	DeliverySent   = "sent"   // accepted by the mail server or provider, not necessarily delivered to the inbox
+	DeliveryFailed = "failed" // refused, or the server unreachable
+)
+
+// maxDeliveries bounds the delivery attempts kept by email, the oldest being dropped.
+const maxDeliveries = 50
+
+// Delivery is an attempt to send an email, kept by hash of its normalized recipient for the support.
+type Delivery struct {
+	Template  string `json:"template"`
+	Status    string `json:"status"`
+	MessageID string `json:"message_id,omitempty"` // given by the provider, when accepted
+	Timestamp int64  `json:"timestamp"`            // of the attempt, unix ms
+	Error     string `json:"error,omitempty"`      // of the provider, when failed
+}
+
+// latest returns the last maxDeliveries attempts of l.
+func latest(l []Delivery) []Delivery {
+	if len(l) > maxDeliveries {
+		return l[len(l)-maxDeliveries:]
+	}
+	return l
+}
+
+// MOCK
+func (db mockDB) RecordDelivery(e string, d Delivery) error {
+	return nil
+}
+
+func (db mockDB) Deliveries(e string) ([]Delivery, error) {
+	return nil, nil
+}
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"time"
+)
+
+// lock is the holder of a lock until it expires.
+type lock struct {
+	Owner   string `json:"owner"`
+	Expires int64  `json:"expires"` // unix ms
+}
+
+// held reports whether l is held by another owner than o at t.
+func (l lock) held(o string, t time.Time) bool {
+	return l.Owner != o && l.Expires > t.UnixMilli()
+}
+
+// MOCK
+func (db mockDB) AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (db mockDB) LastDigests() (map[string]int64, error) {
+	return map[string]int64{}, nil
+}
+
+func (db mockDB) SetLastDigest(s string, t int64) error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+func TestAcquireLock(t *testing.T) {
+	db := NewMemoryDB()
+	if ok, err := db.AcquireLock("digest", "replica-1", time.Hour); !ok || err != nil {
+		t.Errorf("the free lock must be acquired, got %v %v", ok, err)
+		t.FailNow()
+	}
+	if ok, _ := db.AcquireLock("digest", "replica-2", time.Hour); ok {
+		t.Error("the lock held by another replica must not be acquired")
+		t.FailNow()
+	}
+	if ok, _ := db.AcquireLock("digest", "replica-1", time.Hour); !ok {
+		t.Error("the holder must extend its lock")
+		t.FailNow()
+	}
+	if ok, _ := db.AcquireLock("other", "replica-2", time.Hour); !ok {
+		t.Error("the locks must be independent")
+		t.FailNow()
+	}
+
+	db.s.Locks["digest"] = lock{"replica-1", time.Now().Add(-time.Second).UnixMilli()} // replica-1 died
+	if ok, _ := db.AcquireLock("digest", "replica-2", time.Hour); !ok {
+		t.Error("the expired lock must be acquired")
+		t.FailNow()
+	}
+	if ok, _ := db.AcquireLock("digest", "replica-1", time.Hour); ok {
+		t.Error("the lock taken over must not be acquired by its previous holder")
+		t.FailNow()
+	}
+}
+
+func TestLastDigests(t *testing.T) {
+	db := NewMemoryDB()
+	if m, err := db.LastDigests(); len(m) != 0 || err != nil {
+		t.Errorf("no digest must be sent yet, got %v %v", m, err)
+		t.FailNow()
+	}
+	db.SetLastDigest("sponsor-1", 10)
+	db.SetLastDigest("sponsor-2", 20)
+	db.SetLastDigest("sponsor-1", 30)
+	if m, _ := db.LastDigests(); len(m) != 2 || m["sponsor-1"] != 30 || m["sponsor-2"] != 20 {
+		t.Errorf("incorrect last digests, got %v", m)
+		t.FailNow()
+	}
+}
+
+// lockStub fails the conditional writes, like a lock held by another replica.
+type lockStub struct {
+	dynamodbiface.DynamoDBAPI
+	put *dynamodb.PutItemInput
+}
+
+func (s *lockStub) PutItem(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	s.put = in
+	return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+}
+
+func TestDynamoDBAcquireLock(t *testing.T) {
+	s := &lockStub{}
+	db := &dynamoDB{tn: tableName, ek: ek, svc: s}
+	ok, err := db.AcquireLock("digest", "replica-2", time.Hour)
+	if ok || err != nil {
+		t.Errorf("the lock held by another replica must not be acquired, got %v %v", ok, err)
+		t.FailNow()
+	}
+	if s.put.ConditionExpression == nil || *s.put.Item["address"].S != lockPrefix+"digest" || *s.put.Item["owner"].S != "replica-2" {
+		t.Errorf("incorrect conditional write %v", s.put)
+		t.FailNow()
+	}
+}
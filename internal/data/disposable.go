@@ -0,0 +1,101 @@
+package data
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrDisposableEmail = errors.New("disposable email addresses are not allowed")
+
+//go:embed disposable_domains.txt
+var disposableDomains string
+
+// Blocklist holds the disposable email domains.
+type Blocklist struct {
+	mu sync.RWMutex
+	d  map[string]struct{}
+}
+
+// NewBlocklist returns the embedded blocklist extended with the extra domains.
+func NewBlocklist(extra ...string) *Blocklist {
+	b := &Blocklist{d: map[string]struct{}{}}
+	b.load(strings.NewReader(disposableDomains))
+	b.Add(extra...)
+	return b
+}
+
+// load reads one domain per line, ignoring blank lines and # comments.
+func (b *Blocklist) load(r io.Reader) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		l := strings.ToLower(strings.TrimSpace(s.Text()))
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		b.d[l] = struct{}{}
+		n++
+	}
+	return n, s.Err()
+}
+
+func (b *Blocklist) Add(domains ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			b.d[d] = struct{}{}
+		}
+	}
+}
+
+// Refresh adds the domains listed at url to the blocklist.
+func (b *Blocklist) Refresh(url string) (int, error) {
+	c := &http.Client{Timeout: 10 * time.Second}
+	res, err := c.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("cannot refresh blocklist: status %d", res.StatusCode)
+	}
+	return b.load(io.LimitReader(res.Body, 10<<20))
+}
+
+// Len returns the number of blocked domains.
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.d)
+}
+
+// IsDisposable tests if the domain of email e, or one of its parent domains, is blocked.
+func (b *Blocklist) IsDisposable(e string) bool {
+	i := strings.LastIndexByte(e, '@')
+	if i < 0 {
+		return false
+	}
+	d := strings.ToLower(strings.TrimSpace(e[i+1:]))
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for {
+		if _, ok := b.d[d]; ok {
+			return true
+		}
+		j := strings.IndexByte(d, '.')
+		if j < 0 {
+			return false
+		}
+		d = d[j+1:]
+	}
+}
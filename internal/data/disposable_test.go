@@ -0,0 +1,59 @@
+package data
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsDisposable(t *testing.T) {
+	b := NewBlocklist("spam.example", " Junk.Example ")
+	tt := []struct {
+		email      string
+		disposable bool
+	}{
+		{"john.doe@mailservice.com", false},
+		{"john.doe@gmail.com", false},
+		{"john.doe@mailinator.com", true},
+		{"john.doe@MAILINATOR.com", true},
+		{"john.doe@foo.mailinator.com", true},
+		{"john.doe@a.b.yopmail.fr", true},
+		{"john.doe@notmailinator.com", false},
+		{"john.doe@mailinator.com.evil.org", false},
+		{"john.doe@spam.example", true},
+		{"john.doe@junk.example", true},
+		{"john.doe", false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.email, func(t *testing.T) {
+			if got := b.IsDisposable(tc.email); got != tc.disposable {
+				t.Errorf("incorrect result for %s, got %t, want %t", tc.email, got, tc.disposable)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestRefreshBlocklist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# remote list\nfreshtrash.io\n\nnewtempmail.com\n"))
+	}))
+	defer srv.Close()
+
+	b := NewBlocklist()
+	l := b.Len()
+	n, err := b.Refresh(srv.URL)
+	if err != nil || n != 2 {
+		t.Errorf("cannot refresh blocklist, got %d domains (%v), want 2", n, err)
+		t.FailNow()
+	}
+	if b.Len() != l+2 || !b.IsDisposable("x@sub.freshtrash.io") {
+		t.Errorf("refreshed domains must be added to the embedded ones")
+		t.FailNow()
+	}
+
+	if _, err := b.Refresh(srv.URL + "/missing\x7f"); err == nil {
+		t.Errorf("invalid url must fail")
+		t.FailNow()
+	}
+}
@@ -1,29 +1,148 @@
 package data
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
+	"github.com/unleaktrade/waitlist/internal/crypto/envelope"
 )
 
 type dynamoDB struct {
-	tn string
-	ek string
+	tn  string
+	ek  string             // hashes the emails, and decrypts the ones not enveloped
+	etn string             // events table, keyed by (address, timestamp)
+	env *envelope.Envelope // nil when the emails are encrypted by ek
+
+	svc     dynamodbiface.DynamoDBAPI // nil for a client of the AWS session
+	retrier *retrier                  // nil for the retries of the SDK
+	ensure  bool                      // table checked at creation
+	create  bool                      // table created at creation when missing
+	ctx     context.Context           // of the calls, the background one when nil
 }
 
 var (
 	ErrDynamoDBNoEncryptionKey = errors.New("cannot create DynamoDB: UnleakTrade's encryption key is missing")
 	ErrDynamoDBNoTableName     = errors.New("cannot create DynamoDB: no table name")
+	ErrBadOffset               = errors.New("incorrect offset")
 	ErrBadMax                  = errors.New("incorrect max")
 	ErrInvalidUser             = errors.New("nil user or missing required field")
+	ErrUnprocessed             = errors.New("not processed by DynamoDB, retry later")
+	ErrBaseKeyMismatch         = errors.New("encryption key differs from the one wrapped in DB")
 )
 
-func NewDynamoDB(tn, ek string) (db *dynamoDB, err error) {
+// Non-user items (outbox...) share the table, identified by a type attribute
+// and a prefixed partition key that cannot collide with a Solana address.
+const (
+	typeAttribute = "type"
+	outboxType    = "outbox"
+	outboxPrefix  = "outbox#"
+
+	suppressionType   = "suppression"
+	suppressionPrefix = "suppressed#"
+
+	referralsType   = "referrals"
+	referralsPrefix = "referrals#"
+
+	inviteType   = "invite"
+	invitePrefix = "invite#"
+
+	keyType    = "key"
+	baseKeyKey = "key#base"
+
+	seatsType = "seats"
+	seatsKey  = "seats#waitlist"
+
+	lockType   = "lock"
+	lockPrefix = "lock#"
+
+	digestType   = "digest"
+	digestPrefix = "digest#"
+
+	maintenanceType = "maintenance"
+	maintenanceKey  = "maintenance#api"
+
+	exportType   = "export"
+	exportPrefix = "export#"
+
+	deliveryType   = "delivery"
+	deliveryPrefix = "delivery#"
+)
+
+// deletedAttribute is the time of the soft deletion of a user, unix ms, absent unless deleted.
+const deletedAttribute = "deleted_at"
+
+// anonymizedAttribute is the time of the anonymization of a user, unix ms, absent unless anonymized.
+const anonymizedAttribute = "anonymized_at"
+
+// sponsorIndex is the global secondary index of the users by sponsor, projecting all their attributes.
+const sponsorIndex = "sponsor-index"
+
+type suppressionItem struct {
+	Address   string `json:"address"` // prefixed email hash
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type inviteItem struct {
+	Address string `json:"address"` // prefixed code
+	Type    string `json:"type"`
+	Invite
+}
+
+type lockItem struct {
+	Address string `json:"address"` // prefixed lock name
+	Type    string `json:"type"`
+	lock
+}
+
+type digestItem struct {
+	Address   string `json:"address"` // prefixed sponsor
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type maintenanceItem struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Maintenance
+}
+
+type deliveryItem struct {
+	Address    string     `json:"address"` // prefixed email hash
+	Type       string     `json:"type"`
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+type keyItem struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Wrapped []byte `json:"wrapped"` // by KMS
+}
+
+type exportItem struct {
+	Address string `json:"address"` // prefixed ID
+	Type    string `json:"type"`
+	ExportJob
+}
+
+type outboxItem struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	OutboxEmail
+}
+
+func NewDynamoDB(tn, ek string, opts ...Option) (db *dynamoDB, err error) {
 	if tn == "" {
 		return nil, ErrDynamoDBNoTableName
 	}
@@ -31,15 +150,268 @@ func NewDynamoDB(tn, ek string) (db *dynamoDB, err error) {
 		return nil, ErrDynamoDBNoEncryptionKey
 	}
 	db = &dynamoDB{
-		tn: tn,
-		ek: ek,
+		tn:  tn,
+		ek:  ek,
+		etn: tn + "_Events",
+	}
+	for _, o := range opts {
+		o(db)
+	}
+	if err := db.ensureTable(); err != nil {
+		return nil, err
 	}
 	return
 }
 
+// NewDynamoDBWithEnvelope returns a DB encrypting the emails with the KMS data keys of e.
+// Its base key, hashing the emails, is stored wrapped by KMS in the table:
+// the first time, ek is wrapped when set, so existing hashes and emails stay readable, or a new key is generated.
+// Once stored, ek is not needed anymore.
+func NewDynamoDBWithEnvelope(tn, ek string, e *envelope.Envelope, opts ...Option) (*dynamoDB, error) {
+	if tn == "" {
+		return nil, ErrDynamoDBNoTableName
+	}
+	db := &dynamoDB{
+		tn:  tn,
+		etn: tn + "_Events",
+		env: e,
+	}
+	for _, o := range opts {
+		o(db)
+	}
+	if err := db.ensureTable(); err != nil {
+		return nil, err
+	}
+	k, err := db.baseKey(ek)
+	if err != nil {
+		return nil, err
+	}
+	db.ek = k
+	return db, nil
+}
+
+// Option configures the DynamoDB at its creation.
+type Option func(*dynamoDB)
+
+// withClient replaces the DynamoDB client of the AWS session, by a stub in the tests.
+func withClient(svc dynamodbiface.DynamoDBAPI) Option {
+	return func(db *dynamoDB) {
+		db.svc = svc
+	}
+}
+
+// client returns the DynamoDB client of the options, a new one of the AWS session otherwise, retrying with the retrier when set.
+func (db *dynamoDB) client() dynamodbiface.DynamoDBAPI {
+	svc := db.svc
+	if svc == nil {
+		cfg := aws.NewConfig()
+		if db.retrier != nil {
+			cfg.WithMaxRetries(0)
+		}
+		svc = dynamodb.New(session.Must(session.NewSession()), cfg)
+	}
+	if db.retrier != nil {
+		svc = &retryingClient{svc, db.retrier}
+	}
+	if db.ctx != nil {
+		return &contextClient{svc, db.ctx}
+	}
+	return svc
+}
+
+// WithContext returns a copy of db making its calls in ctx, cancelled with it.
+func (db *dynamoDB) WithContext(ctx context.Context) DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+// contextClient decorates a DynamoDB client, making the calls of the data layer in its context.
+type contextClient struct {
+	dynamodbiface.DynamoDBAPI
+	ctx aws.Context
+}
+
+func (c *contextClient) GetItem(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return c.DynamoDBAPI.GetItemWithContext(c.ctx, in)
+}
+
+func (c *contextClient) PutItem(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	return c.DynamoDBAPI.PutItemWithContext(c.ctx, in)
+}
+
+func (c *contextClient) UpdateItem(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	return c.DynamoDBAPI.UpdateItemWithContext(c.ctx, in)
+}
+
+func (c *contextClient) DeleteItem(in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return c.DynamoDBAPI.DeleteItemWithContext(c.ctx, in)
+}
+
+func (c *contextClient) BatchWriteItem(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	return c.DynamoDBAPI.BatchWriteItemWithContext(c.ctx, in)
+}
+
+func (c *contextClient) Scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	return c.DynamoDBAPI.ScanWithContext(c.ctx, in)
+}
+
+func (c *contextClient) ScanPages(in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	return c.DynamoDBAPI.ScanPagesWithContext(c.ctx, in, fn)
+}
+
+func (c *contextClient) QueryPages(in *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+	return c.DynamoDBAPI.QueryPagesWithContext(c.ctx, in, fn)
+}
+
+// baseKey returns the base key unwrapped from the table, storing it first when missing.
+func (db *dynamoDB) baseKey(ek string) (string, error) {
+	svc := db.client()
+	for {
+		r, err := svc.GetItem(&dynamodb.GetItemInput{
+			TableName: aws.String(db.tn),
+			Key:       map[string]*dynamodb.AttributeValue{"address": {S: aws.String(baseKeyKey)}},
+		})
+		if err != nil {
+			return "", err
+		}
+		if r.Item != nil {
+			item := keyItem{}
+			if err := dynamodbattribute.UnmarshalMap(r.Item, &item); err != nil {
+				return "", err
+			}
+			k, err := db.env.Unwrap(item.Wrapped)
+			if err != nil {
+				return "", err
+			}
+			if ek != "" && ek != k {
+				return "", ErrBaseKeyMismatch
+			}
+			return k, nil
+		}
+
+		var wrapped []byte
+		if ek != "" {
+			wrapped, err = db.env.Wrap(ek)
+		} else {
+			_, wrapped, err = db.env.NewKey()
+		}
+		if err != nil {
+			return "", err
+		}
+		av, err := dynamodbattribute.MarshalMap(keyItem{baseKeyKey, keyType, wrapped})
+		if err != nil {
+			return "", err
+		}
+		_, err = svc.PutItem(&dynamodb.PutItemInput{
+			Item:                av,
+			TableName:           aws.String(db.tn),
+			ConditionExpression: aws.String("attribute_not_exists(address)"),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			continue // stored concurrently by another replica, read it
+		}
+		if err != nil {
+			return "", err
+		}
+		logger.Info("🔑 base key wrapped by KMS stored in DB")
+	}
+}
+
+// HashEmail returns the hash of email e, as stored in DB.
+func (db *dynamoDB) HashEmail(e string) string {
+	return EmailHash(e, db.ek)
+}
+
+// encrypt encrypts text bound to ad, the key of its record.
+func (db *dynamoDB) encrypt(text, ad string) (string, error) {
+	if db.env != nil {
+		return db.env.Encrypt(text, ad)
+	}
+	return cipher.EncryptBound(text, db.ek, ad)
+}
+
+// decryptText decrypts a ciphertext of encrypt, enveloped or not.
+func (db *dynamoDB) decryptText(ctext, ad string) (string, error) {
+	if envelope.IsEnveloped(ctext) {
+		if db.env == nil {
+			return "", envelope.ErrNotEnveloped
+		}
+		return db.env.Decrypt(ctext, ad)
+	}
+	return decryptor(ctext, db.ek, ad)
+}
+
+// WithEventsTable replaces the default events table, the users table name suffixed with _Events.
+func (db *dynamoDB) WithEventsTable(n string) *dynamoDB {
+	if n != "" {
+		db.etn = n
+	}
+	return db
+}
+
+// EventsTable is WithEventsTable at creation.
+func EventsTable(n string) Option {
+	return func(db *dynamoDB) {
+		db.WithEventsTable(n)
+	}
+}
+
+// eventCollisions is the number of following milliseconds tried when an event already has the same key.
+const eventCollisions = 3
+
+func (db *dynamoDB) AppendEvent(e Event) error {
+	svc := db.client()
+	e.hash(db.ek)
+	for i := 0; ; i++ {
+		av, err := dynamodbattribute.MarshalMap(e)
+		if err != nil {
+			return err
+		}
+		_, err = svc.PutItem(&dynamodb.PutItemInput{
+			Item:                av,
+			TableName:           aws.String(db.etn),
+			ConditionExpression: aws.String("attribute_not_exists(address)"), // append-only
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException && i < eventCollisions {
+			e.Timestamp++
+			continue
+		}
+		return err
+	}
+}
+
+func (db *dynamoDB) ListEvents(a string, limit int) ([]Event, error) {
+	svc := db.client()
+
+	l := []Event{}
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(db.etn),
+		KeyConditionExpression:    aws.String("address = :a"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":a": {S: aws.String(a)}},
+		ScanIndexForward:          aws.Bool(false), // most recent first
+	}
+	if limit > 0 {
+		input.Limit = aws.Int64(int64(limit))
+	}
+	err := svc.QueryPages(input, func(page *dynamodb.QueryOutput, last bool) bool {
+		for _, i := range page.Items {
+			e := Event{}
+			if err := dynamodbattribute.UnmarshalMap(i, &e); err != nil {
+				continue
+			}
+			l = append(l, e)
+		}
+		return limit <= 0 || len(l) < limit
+	})
+	if limit > 0 && len(l) > limit {
+		l = l[:limit]
+	}
+	return l, err
+}
+
 func (db *dynamoDB) IsPresent(a string) (bool, error) {
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	svc := db.client()
 	r, err := svc.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String(db.tn),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -51,28 +423,458 @@ func (db *dynamoDB) IsPresent(a string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return r.Item != nil, nil
+	return r.Item != nil && r.Item[deletedAttribute] == nil, nil
 }
 
-func (db *dynamoDB) Save(u *User) error {
-	if u == nil || !u.IsSet() {
-		return ErrInvalidUser
+func (db *dynamoDB) Get(a string) (*User, error) {
+	svc := db.client()
+	r, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(db.tn),
+		Key: map[string]*dynamodb.AttributeValue{
+			"address": {
+				S: aws.String(a),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-	if svc == nil {
-		return errors.New("cannot create dynamodb client")
+	_, typed := r.Item[typeAttribute]
+	if _, deleted := r.Item[deletedAttribute]; r.Item == nil || typed || deleted { // not a user, or deleted
+		return nil, nil
+	}
+	return db.user(r.Item)
+}
+
+func (db *dynamoDB) Delete(a string) error {
+	svc := db.client()
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String(db.tn),
+		Key:                       map[string]*dynamodb.AttributeValue{"address": {S: aws.String(a)}},
+		UpdateExpression:          aws.String("SET #d = :now"),
+		ConditionExpression:       aws.String("attribute_exists(address) AND attribute_not_exists(#t) AND attribute_not_exists(#d)"), // users not deleted yet
+		ExpressionAttributeNames:  map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":now": {N: aws.String(fmt.Sprint(time.Now().UnixMilli()))}},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+func (db *dynamoDB) Restore(a string) (*User, error) {
+	svc := db.client()
+	r, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String(db.tn),
+		Key:                      map[string]*dynamodb.AttributeValue{"address": {S: aws.String(a)}},
+		UpdateExpression:         aws.String("REMOVE #d"),
+		ConditionExpression:      aws.String("attribute_not_exists(#t) AND attribute_exists(#d)"), // deleted users only
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute)},
+		ReturnValues:             aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.user(r.Attributes)
+}
+
+// Purge scans the users deleted before, then deletes each one unless restored meanwhile.
+func (db *dynamoDB) Purge(before time.Time) ([]*User, error) {
+	svc := db.client()
+	names := map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute)}
+	values := map[string]*dynamodb.AttributeValue{":b": {N: aws.String(fmt.Sprint(before.UnixMilli()))}}
+
+	var due []*User
+	var uerr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String(db.tn),
+		FilterExpression:          aws.String("attribute_not_exists(#t) AND #d < :b"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, last bool) bool {
+		for _, i := range page.Items {
+			u, err := db.user(i)
+			if uerr = err; uerr != nil {
+				return false
+			}
+			due = append(due, u)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if uerr != nil {
+		return nil, uerr
+	}
+	purged := []*User{}
+	for _, u := range due {
+		_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName:                 aws.String(db.tn),
+			Key:                       map[string]*dynamodb.AttributeValue{"address": {S: aws.String(u.Address)}},
+			ConditionExpression:       aws.String("attribute_not_exists(#t) AND #d < :b"),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			continue // restored
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged = append(purged, u)
+	}
+	return purged, nil
+}
+
+func (db *dynamoDB) Anonymize(a string) (*User, error) {
+	encEmail, err := db.encrypt(AnonymizedEmail, a)
+	if err != nil {
+		return nil, err
+	}
+	svc := db.client()
+	r, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String(db.tn),
+		Key:                      map[string]*dynamodb.AttributeValue{"address": {S: aws.String(a)}},
+		UpdateExpression:         aws.String("SET email = :e, #a = :now REMOVE email_hash, meta, lang"), // out of the email index
+		ConditionExpression:      aws.String("attribute_exists(address) AND attribute_not_exists(#t) AND attribute_not_exists(genesis) AND attribute_not_exists(#d) AND attribute_not_exists(#a)"),
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute), "#a": aws.String(anonymizedAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":e":   {S: aws.String(encEmail)},
+			":now": {N: aws.String(fmt.Sprint(time.Now().UnixMilli()))},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.user(r.Attributes)
+}
+
+func (db *dynamoDB) UpdateEmail(a, e string) (*User, error) {
+	encEmail, err := db.encrypt(e, a)
+	if err != nil {
+		return nil, err
+	}
+	svc := db.client()
+	r, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String(db.tn),
+		Key:                      map[string]*dynamodb.AttributeValue{"address": {S: aws.String(a)}},
+		UpdateExpression:         aws.String("SET email = :e, email_hash = :h"),
+		ConditionExpression:      aws.String("attribute_exists(address) AND attribute_not_exists(#t) AND attribute_not_exists(genesis) AND attribute_not_exists(#d) AND attribute_not_exists(#a)"), // users with an email only
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute), "#a": aws.String(anonymizedAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":e": {S: aws.String(encEmail)},
+			":h": {S: aws.String(EmailHash(e, db.ek))},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
+	return db.user(r.Attributes)
+}
 
-	encEmail, err := cipher.Encrypt(u.Email, db.ek)
+func (db *dynamoDB) Suppress(e string) error {
+	svc := db.client()
+	av, err := dynamodbattribute.MarshalMap(suppressionItem{
+		suppressionPrefix + EmailHash(e, db.ek),
+		suppressionType,
+		time.Now().UnixMilli(),
+	})
 	if err != nil {
 		return err
 	}
-	u2 := NewUser(u.Address, encEmail, u.Sponsor)
-	av, err := dynamodbattribute.MarshalMap(*u2)
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(db.tn),
+	})
+	return err
+}
+
+func (db *dynamoDB) IsSuppressed(e string) (bool, error) {
+	return db.IsPresent(suppressionPrefix + EmailHash(e, db.ek))
+}
+
+func (db *dynamoDB) CountBySponsor(s string) (int, error) {
+	svc := db.client()
+
+	n := 0
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String(db.tn),
+		Select:                    aws.String(dynamodb.SelectCount),
+		FilterExpression:          aws.String("sponsor = :s AND attribute_not_exists(#t) AND attribute_not_exists(#d)"), // users only
+		ExpressionAttributeNames:  map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":s": {S: aws.String(s)}},
+	}, func(page *dynamodb.ScanOutput, last bool) bool {
+		n += int(aws.Int64Value(page.Count))
+		return true
+	})
+	return n, err
+}
+
+func (db *dynamoDB) ListBySponsor(s string) ([]*User, error) {
+	svc := db.client()
+
+	users := []*User{}
+	var uerr error
+	err := svc.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String(db.tn),
+		IndexName:                 aws.String(sponsorIndex),
+		KeyConditionExpression:    aws.String("sponsor = :s"),
+		FilterExpression:          aws.String("attribute_not_exists(#d)"),
+		ExpressionAttributeNames:  map[string]*string{"#d": aws.String(deletedAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":s": {S: aws.String(s)}},
+	}, func(page *dynamodb.QueryOutput, last bool) bool {
+		for _, i := range page.Items {
+			u, err := db.user(i)
+			if uerr = err; uerr != nil {
+				return false
+			}
+			users = append(users, u)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, uerr
+}
+
+// ClaimReferral increments the counter item of the sponsor, the condition keeping it under max.
+func (db *dynamoDB) ClaimReferral(s string, seed, max int) error {
+	if seed >= max {
+		return ErrReferralLimit
+	}
+	svc := db.client()
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(db.tn),
+		Key:                 map[string]*dynamodb.AttributeValue{"address": {S: aws.String(referralsPrefix + s)}},
+		UpdateExpression:    aws.String("SET #t = :t, #n = if_not_exists(#n, :seed) + :one"),
+		ConditionExpression: aws.String("attribute_not_exists(#n) OR #n < :max"),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String(typeAttribute),
+			"#n": aws.String("count"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t":    {S: aws.String(referralsType)},
+			":seed": {N: aws.String(fmt.Sprint(seed))},
+			":one":  {N: aws.String("1")},
+			":max":  {N: aws.String(fmt.Sprint(max))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrReferralLimit
+	}
+	return err
+}
+
+func (db *dynamoDB) ReleaseReferral(s string) error {
+	svc := db.client()
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String(db.tn),
+		Key:                      map[string]*dynamodb.AttributeValue{"address": {S: aws.String(referralsPrefix + s)}},
+		UpdateExpression:         aws.String("SET #n = #n - :one"),
+		ConditionExpression:      aws.String("#n > :zero"),
+		ExpressionAttributeNames: map[string]*string{"#n": aws.String("count")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one":  {N: aws.String("1")},
+			":zero": {N: aws.String("0")},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil // nothing to give back
+	}
+	return err
+}
+
+func (db *dynamoDB) ClaimSeat(seed, max int) error {
+	if seed >= max {
+		return ErrWaitlistFull
+	}
+	svc := db.client()
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(db.tn),
+		Key:                 map[string]*dynamodb.AttributeValue{"address": {S: aws.String(seatsKey)}},
+		UpdateExpression:    aws.String("SET #t = :t, #n = if_not_exists(#n, :seed) + :one"),
+		ConditionExpression: aws.String("attribute_not_exists(#n) OR #n < :max"),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String(typeAttribute),
+			"#n": aws.String("count"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t":    {S: aws.String(seatsType)},
+			":seed": {N: aws.String(fmt.Sprint(seed))},
+			":one":  {N: aws.String("1")},
+			":max":  {N: aws.String(fmt.Sprint(max))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrWaitlistFull
+	}
+	return err
+}
+
+func (db *dynamoDB) ReleaseSeat() error {
+	svc := db.client()
+	_, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String(db.tn),
+		Key:                      map[string]*dynamodb.AttributeValue{"address": {S: aws.String(seatsKey)}},
+		UpdateExpression:         aws.String("SET #n = #n - :one"),
+		ConditionExpression:      aws.String("#n > :zero"),
+		ExpressionAttributeNames: map[string]*string{"#n": aws.String("count")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one":  {N: aws.String("1")},
+			":zero": {N: aws.String("0")},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil // nothing to give back
+	}
+	return err
+}
+
+func (db *dynamoDB) CreateInvite(i *Invite) error {
+	svc := db.client()
+	av, err := dynamodbattribute.MarshalMap(inviteItem{invitePrefix + i.Code, inviteType, *i})
 	if err != nil {
 		return err
 	}
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:                av,
+		TableName:           aws.String(db.tn),
+		ConditionExpression: aws.String("attribute_not_exists(address)"), // never reset the uses of a code
+	})
+	return err
+}
+
+// RedeemInvite increments the uses of the code, the condition rejecting expired and exhausted codes.
+func (db *dynamoDB) RedeemInvite(code string, t time.Time) (*Invite, error) {
+	svc := db.client()
+	key := map[string]*dynamodb.AttributeValue{"address": {S: aws.String(invitePrefix + code)}}
+	r, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(db.tn),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET uses = uses + :one"),
+		ConditionExpression: aws.String("attribute_exists(address) AND uses < max_uses AND (expiry = :zero OR attribute_not_exists(expiry) OR expiry > :now)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one":  {N: aws.String("1")},
+			":zero": {N: aws.String("0")},
+			":now":  {N: aws.String(fmt.Sprint(t.UnixMilli()))},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// tell why the code cannot be used
+		g, err := svc.GetItem(&dynamodb.GetItemInput{TableName: aws.String(db.tn), Key: key})
+		if err != nil {
+			return nil, err
+		}
+		if g.Item == nil {
+			return nil, ErrInviteNotFound
+		}
+		i := Invite{}
+		if err := dynamodbattribute.UnmarshalMap(g.Item, &i); err != nil {
+			return nil, err
+		}
+		if err := i.check(t); err != nil {
+			return nil, err
+		}
+		return nil, ErrInviteExhausted // used up meanwhile
+	}
+	if err != nil {
+		return nil, err
+	}
+	i := Invite{}
+	if err := dynamodbattribute.UnmarshalMap(r.Attributes, &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// dynamoUser is a user as stored, with its client metadata encrypted.
+type dynamoUser struct {
+	User
+	Meta string `dynamodbav:"meta,omitempty"`
+}
+
+// user returns the decrypted user of the item i.
+func (db *dynamoDB) user(i map[string]*dynamodb.AttributeValue) (*User, error) {
+	var du dynamoUser
+	if err := dynamodbattribute.UnmarshalMap(i, &du); err != nil {
+		return nil, err
+	}
+	u := du.User
+	if err := db.decrypt(&u); err != nil {
+		return nil, err
+	}
+	var err error
+	if u.Meta, err = openMeta(du.Meta, u.Address, db.decryptText); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// decrypt replaces the encrypted email of u, genesis users having none.
+// Emails are bound to the address, legacy unbound ones being encrypted again by the next Save.
+func (db *dynamoDB) decrypt(u *User) (err error) {
+	if u.Genesis {
+		return nil
+	}
+	u.Email, err = db.decryptText(u.Email, u.Address)
+	return
+}
+
+// prepare returns the user to store for u, with a new UUID and timestamp and the email encrypted.
+func (db *dynamoDB) prepare(u *User) (*User, map[string]*dynamodb.AttributeValue, error) {
+	if err := checkUser(u); err != nil {
+		return nil, nil, err
+	}
+	var u2 *User
+	if u.Genesis {
+		u2 = u.saved(NewGenesisUser(u.Address)) // no email to protect
+	} else {
+		h := EmailHash(u.Email, db.ek) // before encryption
+		encEmail, err := db.encrypt(u.Email, u.Address)
+		if err != nil {
+			return nil, nil, err
+		}
+		u2 = u.saved(NewUser(u.Address, encEmail, u.Sponsor))
+		u2.Lang = u.Lang
+		u2.EmailHash = h
+		u2.InviteCode = u.InviteCode
+		u2.Meta = u.Meta.saved(db.ek)
+	}
+	meta, err := sealMeta(u2.Meta, u2.Address, db.encrypt)
+	if err != nil {
+		return nil, nil, err
+	}
+	av, err := dynamodbattribute.MarshalMap(dynamoUser{*u2, meta})
+	if err != nil {
+		return nil, nil, err
+	}
+	return u2, av, nil
+}
+
+func (db *dynamoDB) Save(u *User) error {
+	u2, av, err := db.prepare(u)
+	if err != nil {
+		return err
+	}
+	svc := db.client()
+	if svc == nil {
+		return errors.New("cannot create dynamodb client")
+	}
+
 	input := &dynamodb.PutItemInput{
 		Item:      av,
 		TableName: aws.String(db.tn),
@@ -82,16 +884,100 @@ func (db *dynamoDB) Save(u *User) error {
 	if err != nil {
 		return err
 	}
-	fmt.Printf("💾 User saved in DB: [%v]\n", *u2)
+	logger.Debug("💾 user saved in DB", "address", u2.Address)
 	*u = *u2 // copy saved user
 	return nil
 }
 
+// batchSize is the maximum number of items of a BatchWriteItem request.
+const batchSize = 25
+
+// batchAttempts is the number of BatchWriteItem calls made for a chunk until all its items are processed.
+const batchAttempts = 5
+
+func (db *dynamoDB) SaveBatch(users []*User) []error {
+	errs := make([]error, len(users))
+	svc := db.client()
+
+	for start := 0; start < len(users); start += batchSize {
+		end := min(start+batchSize, len(users))
+		pending := map[string]int{} // index of the users by address
+		saved := map[int]*User{}
+		var requests []*dynamodb.WriteRequest
+		for i := start; i < end; i++ {
+			u2, av, err := db.prepare(users[i])
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			pending[u2.Address], saved[i] = i, u2
+			requests = append(requests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: av}})
+		}
+
+		for n := 0; len(requests) > 0 && n < batchAttempts; n++ {
+			if n > 0 {
+				time.Sleep(50 * time.Millisecond << n) // unprocessed items are throttled ones
+			}
+			r, err := svc.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]*dynamodb.WriteRequest{db.tn: requests},
+			})
+			if err != nil {
+				for _, i := range pending {
+					errs[i] = err
+				}
+				pending = nil
+				break
+			}
+			requests = r.UnprocessedItems[db.tn]
+			left := map[string]int{}
+			for _, w := range requests {
+				a := aws.StringValue(w.PutRequest.Item["address"].S)
+				left[a] = pending[a]
+			}
+			pending = left
+		}
+		for _, i := range pending {
+			errs[i] = ErrUnprocessed
+		}
+		for i, u2 := range saved {
+			if errs[i] == nil {
+				*users[i] = *u2 // copy saved user
+			}
+		}
+	}
+	return errs
+}
+
+// FindByEmail queries the users by email hash, from the email hash index.
+func (db *dynamoDB) FindByEmail(e string) (*User, error) {
+	svc := db.client()
+
+	var found *User
+	var uerr error
+	err := svc.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String(db.tn),
+		IndexName:                 aws.String(emailHashIndex),
+		KeyConditionExpression:    aws.String("email_hash = :h"),
+		FilterExpression:          aws.String("attribute_not_exists(#d)"),
+		ExpressionAttributeNames:  map[string]*string{"#d": aws.String(deletedAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":h": {S: aws.String(EmailHash(e, db.ek))}},
+	}, func(page *dynamodb.QueryOutput, last bool) bool {
+		if len(page.Items) == 0 {
+			return true
+		}
+		found, uerr = db.user(page.Items[0])
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, uerr
+}
+
 func (db *dynamoDB) List(options ...int) ([]*User, error) {
 	users := []*User{}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	svc := db.client()
 	if svc == nil {
 		return nil, errors.New("cannot create dynamodb client")
 	}
@@ -107,8 +993,10 @@ func (db *dynamoDB) List(options ...int) ([]*User, error) {
 	}
 
 	input := &dynamodb.ScanInput{
-		TableName: aws.String(db.tn),
-		Limit:     max,
+		TableName:                aws.String(db.tn),
+		Limit:                    max,
+		FilterExpression:         aws.String("attribute_not_exists(#t) AND attribute_not_exists(#d)"), // users not deleted only
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute)},
 	}
 	for {
 		if input.Limit != nil && *input.Limit == 0 {
@@ -119,23 +1007,18 @@ func (db *dynamoDB) List(options ...int) ([]*User, error) {
 			return nil, err
 		}
 
-		for _, u := range result.Items {
-			user := User{}
-			err = dynamodbattribute.UnmarshalMap(u, &user)
-			if err != nil {
-				return nil, err
-			}
-			e, err := cipher.Decrypt(user.Email, db.ek)
+		for _, i := range result.Items {
+			u, err := db.user(i)
 			if err != nil {
 				return nil, err
 			}
-			user.Email = e
-			users = append(users, &user)
+			users = append(users, u)
 		}
-		// pagination
+		// pagination: Limit bounds the items evaluated before the filter, the typed and deleted items
+		// not counting, so the scan goes on until max users are found or the table is exhausted
 		input.ExclusiveStartKey = result.LastEvaluatedKey
 		if input.Limit != nil {
-			*input.Limit = *input.Limit - *result.ScannedCount
+			*input.Limit -= aws.Int64Value(result.Count)
 		}
 		if result.LastEvaluatedKey == nil {
 			break
@@ -144,3 +1027,391 @@ func (db *dynamoDB) List(options ...int) ([]*User, error) {
 
 	return users, nil
 }
+
+// addressItem is the projection of a user item on its address and timestamp.
+type addressItem struct {
+	Address   string `dynamodbav:"address"`
+	Timestamp int64  `dynamodbav:"timestamp"`
+}
+
+// ListAddresses scans the address and timestamp of the users only, neither reading nor decrypting their emails.
+func (db *dynamoDB) ListAddresses() (map[string]int64, error) {
+	svc := db.client()
+	if svc == nil {
+		return nil, errors.New("cannot create dynamodb client")
+	}
+
+	m := map[string]int64{}
+	var uerr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:            aws.String(db.tn),
+		ProjectionExpression: aws.String("#a, #ts"),
+		FilterExpression:     aws.String("attribute_not_exists(#t) AND attribute_not_exists(#d)"), // users not deleted only
+		ExpressionAttributeNames: map[string]*string{
+			"#a":  aws.String("address"),
+			"#ts": aws.String("timestamp"), // reserved word
+			"#t":  aws.String(typeAttribute),
+			"#d":  aws.String(deletedAttribute),
+		},
+	}, func(page *dynamodb.ScanOutput, last bool) bool {
+		for _, i := range page.Items {
+			var ai addressItem
+			if uerr = dynamodbattribute.UnmarshalMap(i, &ai); uerr != nil {
+				return false
+			}
+			m[ai.Address] = ai.Timestamp
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if uerr != nil {
+		return nil, uerr
+	}
+	return m, nil
+}
+
+func (db *dynamoDB) AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	svc := db.client()
+
+	now := time.Now()
+	av, err := dynamodbattribute.MarshalMap(lockItem{lockPrefix + name, lockType, lock{owner, now.Add(ttl).UnixMilli()}})
+	if err != nil {
+		return false, err
+	}
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:                     av,
+		TableName:                aws.String(db.tn),
+		ConditionExpression:      aws.String("attribute_not_exists(address) OR #o = :o OR #e <= :now"),
+		ExpressionAttributeNames: map[string]*string{"#o": aws.String("owner"), "#e": aws.String("expires")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":o":   {S: aws.String(owner)},
+			":now": {N: aws.String(fmt.Sprint(now.UnixMilli()))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil // held by another owner
+	}
+	return err == nil, err
+}
+
+func (db *dynamoDB) LastDigests() (map[string]int64, error) {
+	svc := db.client()
+
+	m := map[string]int64{}
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String(db.tn),
+		FilterExpression:          aws.String("#t = :t"),
+		ExpressionAttributeNames:  map[string]*string{"#t": aws.String(typeAttribute)},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":t": {S: aws.String(digestType)}},
+	}, func(page *dynamodb.ScanOutput, last bool) bool {
+		for _, i := range page.Items {
+			item := digestItem{}
+			if err := dynamodbattribute.UnmarshalMap(i, &item); err != nil {
+				continue
+			}
+			m[strings.TrimPrefix(item.Address, digestPrefix)] = item.Timestamp
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (db *dynamoDB) SetLastDigest(s string, t int64) error {
+	svc := db.client()
+
+	av, err := dynamodbattribute.MarshalMap(digestItem{digestPrefix + s, digestType, t})
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(db.tn),
+	})
+	return err
+}
+
+func (db *dynamoDB) Maintenance() (Maintenance, error) {
+	svc := db.client()
+
+	r, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(db.tn),
+		Key:       map[string]*dynamodb.AttributeValue{"address": {S: aws.String(maintenanceKey)}},
+	})
+	if err != nil || r.Item == nil {
+		return Maintenance{}, err
+	}
+	item := maintenanceItem{}
+	if err := dynamodbattribute.UnmarshalMap(r.Item, &item); err != nil {
+		return Maintenance{}, err
+	}
+	return item.Maintenance, nil
+}
+
+func (db *dynamoDB) SetMaintenance(m Maintenance) error {
+	svc := db.client()
+
+	av, err := dynamodbattribute.MarshalMap(maintenanceItem{maintenanceKey, maintenanceType, m})
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(db.tn),
+	})
+	return err
+}
+
+func (db *dynamoDB) RecordDelivery(e string, d Delivery) error {
+	svc := db.client()
+
+	av, err := dynamodbattribute.Marshal([]Delivery{d})
+	if err != nil {
+		return err
+	}
+	key := map[string]*dynamodb.AttributeValue{"address": {S: aws.String(deliveryPrefix + EmailHash(e, db.ek))}}
+	r, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:        aws.String(db.tn),
+		Key:              key,
+		UpdateExpression: aws.String("SET #t = :t, #d = list_append(if_not_exists(#d, :empty), :d)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#t": aws.String(typeAttribute),
+			"#d": aws.String("deliveries"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t":     {S: aws.String(deliveryType)},
+			":d":     av,
+			":empty": {L: []*dynamodb.AttributeValue{}},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+	if err != nil {
+		return err
+	}
+	// the oldest attempts beyond maxDeliveries are dropped
+	n := len(r.Attributes["deliveries"].L) - maxDeliveries
+	if n <= 0 {
+		return nil
+	}
+	drop := make([]string, n)
+	for i := range drop {
+		drop[i] = fmt.Sprintf("#d[%d]", i)
+	}
+	_, err = svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String(db.tn),
+		Key:                      key,
+		UpdateExpression:         aws.String("REMOVE " + strings.Join(drop, ", ")),
+		ExpressionAttributeNames: map[string]*string{"#d": aws.String("deliveries")},
+	})
+	return err
+}
+
+func (db *dynamoDB) Deliveries(e string) ([]Delivery, error) {
+	svc := db.client()
+
+	r, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(db.tn),
+		Key:       map[string]*dynamodb.AttributeValue{"address": {S: aws.String(deliveryPrefix + EmailHash(e, db.ek))}},
+	})
+	if err != nil || r.Item == nil {
+		return nil, err
+	}
+	item := deliveryItem{}
+	if err := dynamodbattribute.UnmarshalMap(r.Item, &item); err != nil {
+		return nil, err
+	}
+	return latest(item.Deliveries), nil
+}
+
+func (db *dynamoDB) putOutbox(e *OutboxEmail, cond *string) error {
+	svc := db.client()
+
+	item := outboxItem{outboxPrefix + e.ID, outboxType, *e}
+	r, err := db.encrypt(e.Recipient, item.Address)
+	if err != nil {
+		return err
+	}
+	item.Recipient = r
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		Item:                av,
+		TableName:           aws.String(db.tn),
+		ConditionExpression: cond,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrOutboxNotFound
+	}
+	return err
+}
+
+func (db *dynamoDB) Enqueue(e *OutboxEmail) error {
+	return db.putOutbox(e, nil)
+}
+
+func (db *dynamoDB) Update(e *OutboxEmail) error {
+	return db.putOutbox(e, aws.String("attribute_exists(address)"))
+}
+
+func (db *dynamoDB) Pending() ([]*OutboxEmail, error) {
+	svc := db.client()
+
+	l := []*OutboxEmail{}
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(db.tn),
+		FilterExpression:         aws.String("#t = :t AND #s = :s"),
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String(typeAttribute), "#s": aws.String("status")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": {S: aws.String(outboxType)},
+			":s": {S: aws.String(OutboxPending)},
+		},
+	}
+	err := svc.ScanPages(input, func(page *dynamodb.ScanOutput, last bool) bool {
+		for _, i := range page.Items {
+			item := outboxItem{}
+			if err := dynamodbattribute.UnmarshalMap(i, &item); err != nil {
+				continue
+			}
+			r, err := db.decryptText(item.Recipient, item.Address)
+			if err != nil {
+				continue
+			}
+			e := item.OutboxEmail
+			e.Recipient = r
+			l = append(l, &e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].CreatedAt < l[j].CreatedAt })
+	return l, nil
+}
+
+// putExport stores j, unconditionally for a new one, else only while it is not finished.
+func (db *dynamoDB) putExport(j *ExportJob, exists bool) error {
+	svc := db.client()
+
+	av, err := dynamodbattribute.MarshalMap(exportItem{exportPrefix + j.ID, exportType, *j})
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(db.tn),
+	}
+	if exists {
+		input.ConditionExpression = aws.String("attribute_exists(address) AND #s IN (:q, :r)")
+		input.ExpressionAttributeNames = map[string]*string{"#s": aws.String("status")}
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":q": {S: aws.String(ExportQueued)},
+			":r": {S: aws.String(ExportRunning)},
+		}
+	}
+	_, err = svc.PutItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		if _, err := db.GetExport(j.ID); err != nil {
+			return err // ErrExportNotFound rather than finished
+		}
+		return ErrExportFinished
+	}
+	return err
+}
+
+func (db *dynamoDB) CreateExport(j *ExportJob) error {
+	return db.putExport(j, false)
+}
+
+func (db *dynamoDB) UpdateExport(j *ExportJob) error {
+	return db.putExport(j, true)
+}
+
+func (db *dynamoDB) GetExport(id string) (*ExportJob, error) {
+	svc := db.client()
+
+	r, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(db.tn),
+		Key:            map[string]*dynamodb.AttributeValue{"address": {S: aws.String(exportPrefix + id)}},
+		ConsistentRead: aws.Bool(true), // the cancellations seen by the worker
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Item == nil {
+		return nil, ErrExportNotFound
+	}
+	item := exportItem{}
+	if err := dynamodbattribute.UnmarshalMap(r.Item, &item); err != nil {
+		return nil, err
+	}
+	return &item.ExportJob, nil
+}
+
+func (db *dynamoDB) PendingExports() ([]*ExportJob, error) {
+	svc := db.client()
+
+	l := []*ExportJob{}
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(db.tn),
+		FilterExpression:         aws.String("#t = :t AND #s IN (:q, :r)"),
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String(typeAttribute), "#s": aws.String("status")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": {S: aws.String(exportType)},
+			":q": {S: aws.String(ExportQueued)},
+			":r": {S: aws.String(ExportRunning)},
+		},
+	}
+	err := svc.ScanPages(input, func(page *dynamodb.ScanOutput, last bool) bool {
+		for _, i := range page.Items {
+			item := exportItem{}
+			if err := dynamodbattribute.UnmarshalMap(i, &item); err != nil {
+				continue
+			}
+			j := item.ExportJob
+			l = append(l, &j)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].CreatedAt < l[j].CreatedAt })
+	return l, nil
+}
+
+// ScanUsers calls f with the users of each page of a scan of the table, never holding the whole table in memory.
+func (db *dynamoDB) ScanUsers(f func(users []*User) error) error {
+	svc := db.client()
+
+	var ferr error
+	err := svc.ScanPages(&dynamodb.ScanInput{
+		TableName:                aws.String(db.tn),
+		Limit:                    aws.Int64(exportPage),
+		FilterExpression:         aws.String("attribute_not_exists(#t) AND attribute_not_exists(#d)"), // users not deleted only
+		ExpressionAttributeNames: map[string]*string{"#t": aws.String(typeAttribute), "#d": aws.String(deletedAttribute)},
+	}, func(page *dynamodb.ScanOutput, last bool) bool {
+		users := make([]*User, 0, len(page.Items))
+		for _, i := range page.Items {
+			u, err := db.user(i)
+			if ferr = err; ferr != nil {
+				return false
+			}
+			users = append(users, u)
+		}
+		if len(users) > 0 {
+			ferr = f(users)
+		}
+		return ferr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return ferr
+}
@@ -4,12 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/gagliardetto/solana-go"
 )
 
 const (
@@ -214,3 +218,216 @@ func TestIsPresent(t *testing.T) {
 		})
 	}
 }
+
+func TestOutbox(t *testing.T) {
+	db, _ := NewDynamoDB(tableName, ek)
+	e := NewOutboxEmail("john.doe@mailservice.com", "confirmation", nil)
+	if err := db.Enqueue(e); err != nil {
+		t.Errorf("cannot enqueue email: %v", err)
+		t.FailNow()
+	}
+	l, err := db.Pending()
+	if err != nil {
+		t.Errorf("cannot list pending emails: %v", err)
+		t.FailNow()
+	}
+	var found *OutboxEmail
+	for _, p := range l {
+		if p.ID == e.ID {
+			found = p
+		}
+	}
+	if found == nil || found.Recipient != e.Recipient {
+		t.Errorf("enqueued email must be pending with decrypted recipient, got %v", found)
+		t.FailNow()
+	}
+
+	e.Status = OutboxSent
+	if err := db.Update(e); err != nil {
+		t.Errorf("cannot update email: %v", err)
+		t.FailNow()
+	}
+	users, _ := db.List()
+	for _, u := range users {
+		if strings.HasPrefix(u.Address, outboxPrefix) {
+			t.Errorf("outbox items cannot be listed as users")
+			t.FailNow()
+		}
+	}
+}
+
+// scanStub answers the scans with its items, recording the last input.
+type scanStub struct {
+	dynamodbiface.DynamoDBAPI
+	items []map[string]*dynamodb.AttributeValue
+	in    *dynamodb.ScanInput
+}
+
+func (s *scanStub) Scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	s.in = in
+	return &dynamodb.ScanOutput{Items: s.items, ScannedCount: aws.Int64(int64(len(s.items)))}, nil
+}
+
+func (s *scanStub) ScanPages(in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	out, _ := s.Scan(in)
+	fn(out, true)
+	return nil
+}
+
+func TestDynamoDBListAddresses(t *testing.T) {
+	s := &scanStub{}
+	db := &dynamoDB{tn: tableName, ek: ek, svc: s}
+	sponsor := solana.NewWallet().PublicKey().String()
+	m := map[string]int64{}
+	for i := range 3 {
+		u2, av, err := db.prepare(NewUser(solana.NewWallet().PublicKey().String(), fmt.Sprintf("user%d@domain.com", i), sponsor))
+		if err != nil {
+			t.Errorf("cannot prepare the user: %v", err)
+			t.FailNow()
+		}
+		s.items = append(s.items, av)
+		m[u2.Address] = u2.Timestamp
+	}
+
+	n := countDecryptions(t)
+	got, err := db.ListAddresses()
+	if err != nil || fmt.Sprint(got) != fmt.Sprint(m) {
+		t.Errorf("incorrect addresses, got %v %v, want %v", got, err, m)
+		t.FailNow()
+	}
+	if *n != 0 || s.in.ProjectionExpression == nil {
+		t.Errorf("only the addresses and timestamps must be read, got %d decryptions of %v", *n, s.in)
+		t.FailNow()
+	}
+	if l, _ := db.List(); len(l) != 3 || *n != 3 {
+		t.Errorf("the list must decrypt every email, got %d decryptions", *n)
+		t.FailNow()
+	}
+}
+
+// pagedStub scans its items as DynamoDB does: Limit bounds the items evaluated, at most page of them by call,
+// before the filter on the type and deletion attributes.
+type pagedStub struct {
+	dynamodbiface.DynamoDBAPI
+	items []map[string]*dynamodb.AttributeValue
+	page  int
+}
+
+func (s *pagedStub) Scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	start := 0
+	if in.ExclusiveStartKey != nil {
+		start, _ = strconv.Atoi(*in.ExclusiveStartKey["address"].N)
+	}
+	end := min(start+s.page, len(s.items))
+	if in.Limit != nil {
+		end = min(end, start+int(*in.Limit))
+	}
+	out := &dynamodb.ScanOutput{ScannedCount: aws.Int64(int64(end - start))}
+	for _, i := range s.items[start:end] {
+		if i[typeAttribute] == nil && i[deletedAttribute] == nil {
+			out.Items = append(out.Items, i)
+		}
+	}
+	out.Count = aws.Int64(int64(len(out.Items)))
+	if end < len(s.items) {
+		out.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"address": {N: aws.String(strconv.Itoa(end))}}
+	}
+	return out, nil
+}
+
+func TestDynamoDBListMax(t *testing.T) {
+	s := &pagedStub{page: 3}
+	db := &dynamoDB{tn: tableName, ek: ek, svc: s}
+	sponsor := solana.NewWallet().PublicKey().String()
+	for i := range 5 {
+		_, av, err := db.prepare(NewUser(solana.NewWallet().PublicKey().String(), fmt.Sprintf("user%d@domain.com", i), sponsor))
+		if err != nil {
+			t.Errorf("cannot prepare the user: %v", err)
+			t.FailNow()
+		}
+		// the users are interleaved with typed and deleted items
+		s.items = append(s.items,
+			map[string]*dynamodb.AttributeValue{"address": {S: aws.String(fmt.Sprintf("%s%d", outboxPrefix, i))}, typeAttribute: {S: aws.String(outboxType)}},
+			map[string]*dynamodb.AttributeValue{"address": {S: aws.String(fmt.Sprintf("%s%d", deliveryPrefix, i))}, typeAttribute: {S: aws.String(deliveryType)}},
+			map[string]*dynamodb.AttributeValue{"address": {S: aws.String(solana.NewWallet().PublicKey().String())}, deletedAttribute: {N: aws.String("1")}},
+			av,
+		)
+	}
+
+	tt := []struct {
+		name     string
+		max, len int
+	}{
+		{"fewer than the users", 2, 2},
+		{"all the users", 5, 5},
+		{"more than the users", 10, 5},
+		{"none", 0, 0},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := db.List(0, tc.max)
+			if err != nil || len(l) != tc.len {
+				t.Errorf("incorrect list, got %d users (%v), want %d", len(l), err, tc.len)
+				t.FailNow()
+			}
+			for _, u := range l {
+				if !strings.HasPrefix(u.Email, "user") {
+					t.Errorf("only the users must be listed, got %+v", u)
+					t.FailNow()
+				}
+			}
+		})
+	}
+}
+
+// deliveryStub keeps the deliveries of a single item, appended and removed as the update expressions say.
+type deliveryStub struct {
+	dynamodbiface.DynamoDBAPI
+	deliveries []*dynamodb.AttributeValue
+	updates    []string
+}
+
+func (s *deliveryStub) UpdateItem(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	s.updates = append(s.updates, *in.UpdateExpression)
+	if r, ok := strings.CutPrefix(*in.UpdateExpression, "REMOVE "); ok {
+		s.deliveries = s.deliveries[len(strings.Split(r, ", ")):]
+	} else {
+		s.deliveries = append(s.deliveries, in.ExpressionAttributeValues[":d"].L...)
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: map[string]*dynamodb.AttributeValue{"deliveries": {L: s.deliveries}}}, nil
+}
+
+func (s *deliveryStub) GetItem(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	if s.deliveries == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		"address":    in.Key["address"],
+		"type":       {S: aws.String(deliveryType)},
+		"deliveries": {L: s.deliveries},
+	}}, nil
+}
+
+func TestDynamoDBDeliveries(t *testing.T) {
+	s := &deliveryStub{}
+	db := &dynamoDB{tn: tableName, ek: ek, svc: s}
+	if l, err := db.Deliveries("john.doe@mailservice.com"); err != nil || len(l) != 0 {
+		t.Errorf("no delivery must be found before the first send, got %v: %v", l, err)
+		t.FailNow()
+	}
+	for i := range maxDeliveries + 2 {
+		if err := db.RecordDelivery("john.doe@mailservice.com", Delivery{Template: "activation", Status: DeliverySent, Timestamp: int64(i + 1)}); err != nil {
+			t.Errorf("cannot record the delivery: %v", err)
+			t.FailNow()
+		}
+	}
+	if len(s.updates) != maxDeliveries+4 || s.updates[len(s.updates)-1] != "REMOVE #d[0]" {
+		t.Errorf("the oldest deliveries must be removed beyond the limit, got %v", s.updates[maxDeliveries-1:])
+		t.FailNow()
+	}
+	l, err := db.Deliveries("John.Doe@mailservice.com")
+	if err != nil || len(l) != maxDeliveries || l[0].Timestamp != 3 || l[maxDeliveries-1].Timestamp != maxDeliveries+2 {
+		t.Errorf("the last deliveries must be kept by normalized email, oldest first, got %d: %v", len(l), err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// providers whose addresses ignore plus-tags, and dots for gmail
+var (
+	plusTagDomains = map[string]bool{
+		"gmail.com":      true,
+		"googlemail.com": true,
+		"outlook.com":    true,
+		"hotmail.com":    true,
+		"live.com":       true,
+		"icloud.com":     true,
+		"me.com":         true,
+		"fastmail.com":   true,
+		"protonmail.com": true,
+		"proton.me":      true,
+	}
+	gmailDomains = map[string]bool{
+		"gmail.com":      true,
+		"googlemail.com": true,
+	}
+)
+
+// NormalizeEmail returns the canonical form of email e: trimmed, lowercased and,
+// for known providers, without plus-tag (and without dots for gmail).
+func NormalizeEmail(e string) string {
+	e = strings.ToLower(strings.TrimSpace(e))
+	i := strings.LastIndexByte(e, '@')
+	if i < 0 {
+		return e
+	}
+	local, domain := e[:i], e[i+1:]
+	if plusTagDomains[domain] {
+		if j := strings.IndexByte(local, '+'); j >= 0 {
+			local = local[:j]
+		}
+	}
+	if gmailDomains[domain] {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// EmailHash returns the keyed hash of the normalized email e, used to find users by email
+// without storing it in clear.
+func EmailHash(e, k string) string {
+	m := hmac.New(sha256.New, []byte(k))
+	m.Write([]byte(NormalizeEmail(e)))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// RedactEmail masks e but the first letter of its local part and domain, and its top-level domain,
+// like j***@g***.com. An empty email stays empty.
+func RedactEmail(e string) string {
+	if e == "" {
+		return ""
+	}
+	i := strings.LastIndexByte(e, '@')
+	if i < 0 {
+		return "***"
+	}
+	r := mask(e[:i]) + "@"
+	domain := e[i+1:]
+	if j := strings.LastIndexByte(domain, '.'); j >= 0 {
+		return r + mask(domain[:j]) + domain[j:]
+	}
+	return r + mask(domain)
+}
+
+// mask keeps the first letter of s, any other being replaced by a fixed number of stars not to disclose the length.
+func mask(s string) string {
+	if s == "" {
+		return "***"
+	}
+	_, n := utf8.DecodeRuneInString(s)
+	return s[:n] + "***"
+}
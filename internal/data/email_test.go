@@ -0,0 +1,67 @@
+package data
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tt := []struct {
+		email, want string
+	}{
+		{"john.doe@mailservice.com", "john.doe@mailservice.com"},
+		{"  John.Doe@MailService.COM ", "john.doe@mailservice.com"},
+		{"John.Doe+waitlist@gmail.com", "johndoe@gmail.com"},
+		{"johndoe@GMAIL.com", "johndoe@gmail.com"},
+		{"j.o.h.n.doe@googlemail.com", "johndoe@gmail.com"},
+		{"john.doe+news+more@outlook.com", "john.doe@outlook.com"},
+		{"john.doe+waitlist@mailservice.com", "john.doe+waitlist@mailservice.com"}, // unknown provider
+		{"john.doe", "john.doe"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.email, func(t *testing.T) {
+			if got := NormalizeEmail(tc.email); got != tc.want {
+				t.Errorf("incorrect normalized email, got %q, want %q", got, tc.want)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestEmailHash(t *testing.T) {
+	k := "s3cr3t"
+	h := EmailHash("John.Doe+waitlist@gmail.com", k)
+	if h != EmailHash("johndoe@gmail.com", k) {
+		t.Errorf("equivalent emails must have the same hash")
+		t.FailNow()
+	}
+	if h == EmailHash("johndoe@gmail.com", "0th3r") {
+		t.Errorf("hash must depend on the key")
+		t.FailNow()
+	}
+	if h == EmailHash("janedoe@gmail.com", k) {
+		t.Errorf("distinct emails must have distinct hashes")
+		t.FailNow()
+	}
+}
+
+func TestRedactEmail(t *testing.T) {
+	tt := []struct {
+		email, want string
+	}{
+		{"john.doe@gmail.com", "j***@g***.com"},
+		{"j@gmail.com", "j***@g***.com"},
+		{"jo@x.io", "j***@x***.io"},
+		{"john@mail.example.co.uk", "j***@m***.uk"},
+		{"john@localhost", "j***@l***"},
+		{"élodie@exemple.fr", "é***@e***.fr"},
+		{"@gmail.com", "***@g***.com"},
+		{"john.doe", "***"},
+		{"", ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.email, func(t *testing.T) {
+			if got := RedactEmail(tc.email); got != tc.want {
+				t.Errorf("incorrect redacted email, got %q, want %q", got, tc.want)
+				t.FailNow()
+			}
+		})
+	}
+}
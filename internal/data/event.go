@@ -0,0 +1,64 @@
+package data
+
+import (
+	"time"
+)
+
+// Types of the audit events.
+const (
+	EventRegistered         = "registered"
+	EventActivated          = "activated"
+	EventActivationConflict = "activation_conflict"
+	EventUnsubscribed       = "unsubscribed"
+	EventInviteCreated      = "invite_created"
+	EventSeeded             = "seeded"
+	EventImported           = "imported"
+	EventDeleted            = "deleted"
+	EventRestored           = "restored"
+	EventPurged             = "purged"
+	EventAnonymized         = "anonymized"
+	EventEmailUpdated       = "email_updated"
+	EventPIIExported        = "pii_exported"
+)
+
+// ListAddress is the address of the events about the whole list rather than a user.
+const ListAddress = "list"
+
+// Event is an append-only audit record about an address, keyed by (address, timestamp).
+// Only the keyed hash of the normalized email is stored, never the email.
+type Event struct {
+	Address   string `json:"address"`
+	Timestamp int64  `json:"timestamp"` // unix milliseconds
+	Type      string `json:"type"`
+	EmailHash string `json:"email_hash,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+
+	email string // hashed by the DB, which holds the key
+}
+
+func NewEvent(typ, address, email, detail string) Event {
+	return Event{
+		Address:   address,
+		Timestamp: time.Now().UnixMilli(),
+		Type:      typ,
+		Detail:    detail,
+		email:     email,
+	}
+}
+
+// hash sets EmailHash from the email of the event with key k.
+func (e *Event) hash(k string) {
+	if e.email != "" {
+		e.EmailHash = EmailHash(e.email, k)
+		e.email = ""
+	}
+}
+
+// MOCK
+func (db mockDB) AppendEvent(e Event) error {
+	return nil
+}
+
+func (db mockDB) ListEvents(a string, limit int) ([]Event, error) {
+	return []Event{}, nil
+}
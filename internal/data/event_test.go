@@ -0,0 +1,54 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEventHash(t *testing.T) {
+	email := "John.Doe+waitlist@gmail.com"
+	e := NewEvent(EventRegistered, sponsor, email, "")
+	e.hash("k3y")
+	if e.EmailHash != EmailHash(email, "k3y") {
+		t.Errorf("incorrect email hash, got %q, want %q", e.EmailHash, EmailHash(email, "k3y"))
+		t.FailNow()
+	}
+	b, _ := json.Marshal(e)
+	if strings.Contains(strings.ToLower(string(b)), "john") {
+		t.Errorf("events must never include the email, got %s", b)
+		t.FailNow()
+	}
+}
+
+func TestMockEvents(t *testing.T) {
+	db := NewMockDBContent(nil)
+	for _, typ := range []string{EventRegistered, EventActivationConflict, EventActivated} {
+		db.AppendEvent(NewEvent(typ, sponsor, "john.doe@mailservice.com", ""))
+	}
+	db.AppendEvent(NewEvent(EventRegistered, "8mxgS3kGYjmCwyktyBqcAxxYy4G32vUKuCNEUdpAySPk", "", ""))
+
+	tt := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{"all", 0, []string{EventActivated, EventActivationConflict, EventRegistered}},
+		{"limited", 2, []string{EventActivated, EventActivationConflict}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l, _ := db.ListEvents(sponsor, tc.limit)
+			if len(l) != len(tc.want) {
+				t.Errorf("incorrect number of events, got %d, want %d", len(l), len(tc.want))
+				t.FailNow()
+			}
+			for i, e := range l {
+				if e.Type != tc.want[i] || e.EmailHash == "" {
+					t.Errorf("incorrect event #%d, got %+v, want type %q", i, e, tc.want[i])
+					t.FailNow()
+				}
+			}
+		})
+	}
+}
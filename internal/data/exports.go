@@ -0,0 +1,71 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportDone      = "done"
+	ExportFailed    = "failed"
+	ExportCancelled = "cancelled"
+)
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportFinished is the error of the updates of an export done, failed or cancelled, which cannot change anymore.
+	ErrExportFinished = errors.New("export finished")
+)
+
+// exportPage is the number of users of the pages of ScanUsers in the stores.
+const exportPage = 500
+
+// ExportJob is a full export of the users, written to the object storage by the export worker.
+type ExportJob struct {
+	ID          string `json:"id"`
+	Format      string `json:"format"` // csv or jsonl
+	PII         bool   `json:"include_pii"`
+	Status      string `json:"status"`
+	Key         string `json:"key"` // of the object written
+	Rows        int    `json:"rows"`
+	Error       string `json:"error,omitempty"`
+	By          string `json:"by,omitempty"` // requester, as in the audit events
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+	CompletedAt int64  `json:"completed_at,omitempty"`
+}
+
+func NewExportJob(format string, pii bool, by string) *ExportJob {
+	id := uuid.New().String()
+	now := time.Now().UnixMilli()
+	return &ExportJob{
+		ID:        id,
+		Format:    format,
+		PII:       pii,
+		Status:    ExportQueued,
+		Key:       id + "." + format,
+		By:        by,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Finished reports whether j is done, failed or cancelled.
+func (j *ExportJob) Finished() bool {
+	return j.Status == ExportDone || j.Status == ExportFailed || j.Status == ExportCancelled
+}
+
+// Exports persists the export jobs, so they survive restarts, and pages the users they export.
+type Exports interface {
+	CreateExport(j *ExportJob) error
+	GetExport(id string) (*ExportJob, error) // ErrExportNotFound when absent
+	// UpdateExport replaces the export j, ErrExportFinished when the stored one is finished.
+	UpdateExport(j *ExportJob) error
+	PendingExports() ([]*ExportJob, error) // queued or running, oldest first
+	// ScanUsers calls f with the users by page, in no particular order, until f fails.
+	ScanUsers(f func(users []*User) error) error
+}
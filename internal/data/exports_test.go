@@ -0,0 +1,91 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestExports(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := NewFileStore(dir, ek)
+	if err != nil {
+		t.Errorf("cannot create file store: %v", err)
+		t.FailNow()
+	}
+	j1 := NewExportJob("csv", false, "admin alice")
+	j1.CreatedAt = time.Now().Add(-time.Minute).UnixMilli()
+	j2 := NewExportJob("jsonl", true, "admin bob")
+	if j1.ID == j2.ID || j1.Key != j1.ID+".csv" {
+		t.Errorf("incorrect export jobs, got %+v and %+v", j1, j2)
+		t.FailNow()
+	}
+	fs.CreateExport(j2)
+	fs.CreateExport(j1)
+	j1.Status = ExportRunning
+	if err := fs.UpdateExport(j1); err != nil {
+		t.Errorf("cannot update export: %v", err)
+		t.FailNow()
+	}
+
+	fs, _ = NewFileStore(dir, ek) // restart
+	l, _ := fs.PendingExports()
+	if len(l) != 2 || l[0].ID != j1.ID || l[0].Status != ExportRunning {
+		t.Errorf("the pending exports must survive a restart, oldest first, got %v", l)
+		t.FailNow()
+	}
+
+	j2.Status = ExportCancelled
+	fs.UpdateExport(j2)
+	j2.Status = ExportDone
+	if err := fs.UpdateExport(j2); !errors.Is(err, ErrExportFinished) {
+		t.Errorf("a cancelled export must not be updated, got %v", err)
+		t.FailNow()
+	}
+	if j, _ := fs.GetExport(j2.ID); j.Status != ExportCancelled {
+		t.Errorf("the export must stay cancelled, got %+v", j)
+		t.FailNow()
+	}
+	if l, _ := fs.PendingExports(); len(l) != 1 {
+		t.Errorf("the cancelled exports must not be pending, got %v", l)
+		t.FailNow()
+	}
+	if _, err := fs.GetExport("unknown"); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("an unknown export must not be found, got %v", err)
+		t.FailNow()
+	}
+	if err := fs.UpdateExport(NewExportJob("csv", false, "")); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("an unknown export must not be updated, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestScanUsers(t *testing.T) {
+	db := NewMemoryDB()
+	for i := 0; i < exportPage+1; i++ {
+		db.Save(NewUser(solana.NewWallet().PublicKey().String(), "john.doe@mailservice.com", solana.NewWallet().PublicKey().String()))
+	}
+	pages, n := 0, 0
+	err := db.ScanUsers(func(users []*User) error {
+		pages++
+		n += len(users)
+		return nil
+	})
+	if err != nil || pages != 2 || n != exportPage+1 {
+		t.Errorf("incorrect scan, got %d users in %d pages: %v", n, pages, err)
+		t.FailNow()
+	}
+
+	stop := errors.New("stop")
+	pages = 0
+	err = db.ScanUsers(func(users []*User) error {
+		pages++
+		return stop
+	})
+	if !errors.Is(err, stop) || pages != 1 {
+		t.Errorf("the scan must stop at the first failure, got %d pages: %v", pages, err)
+		t.FailNow()
+	}
+}
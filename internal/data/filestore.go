@@ -0,0 +1,71 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var ErrFileStoreNoEncryptionKey = errors.New("cannot create file store: UnleakTrade's encryption key is missing")
+
+// fileStoreName is the file of the store in its directory, replaced as a whole by each write.
+const fileStoreName = "waitlist.json"
+
+// NewFileStore returns the store of a local JSON file in dir, for the demos and the CI,
+// dir being created when missing and its file loaded when it exists.
+// The state is written through on every change, to a temporary file renamed over the previous one:
+// a write interrupted midway leaves the previous file complete.
+func NewFileStore(dir, ek string) (*store, error) {
+	if ek == "" {
+		return nil, ErrFileStoreNoEncryptionKey
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	db := &store{path: filepath.Join(dir, fileStoreName), ek: ek, s: newState()}
+	db.write = db.writeFile
+	b, err := os.ReadFile(db.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := db.restore(b); err != nil {
+		return nil, fmt.Errorf("cannot load file store %s: %w", db.path, err)
+	}
+	return db, nil
+}
+
+// restore replaces the state by the content b of the file.
+func (db *store) restore(b []byte) error {
+	s := newState()
+	if err := json.Unmarshal(b, s); err != nil {
+		return err
+	}
+	db.s, db.saved = s, b
+	return nil
+}
+
+// writeFile writes b to a temporary file of the directory, synced then renamed over the file.
+func (db *store) writeFile(b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(db.path), "."+fileStoreName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // once renamed, nothing to remove
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), db.path)
+}
@@ -0,0 +1,260 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewFileStore(dir, ""); !errors.Is(err, ErrFileStoreNoEncryptionKey) {
+		t.Errorf("the encryption key must be required, got %v", err)
+		t.FailNow()
+	}
+	fs, err := NewFileStore(dir, ek)
+	if err != nil {
+		t.Errorf("cannot create the file store: %v", err)
+		t.FailNow()
+	}
+	var db DB = fs
+
+	sponsor := solana.NewWallet().PublicKey().String()
+	g := NewGenesisUser(sponsor)
+	if err := db.Save(g); err != nil {
+		t.Errorf("cannot save the genesis user: %v", err)
+		t.FailNow()
+	}
+	users := make([]*User, 20)
+	for i := range users {
+		users[i] = &User{Address: solana.NewWallet().PublicKey().String(), Email: fmt.Sprintf("john.doe+%d@mailservice.com", i), Sponsor: sponsor}
+	}
+	for i, err := range db.SaveBatch(users) {
+		if err != nil || users[i].UUID == "" || users[i].Timestamp == 0 || users[i].Email != fmt.Sprintf("john.doe+%d@mailservice.com", i) {
+			t.Errorf("incorrect saved user %v %v", users[i], err)
+			t.FailNow()
+		}
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, fileStoreName))
+	if strings.Contains(string(b), "mailservice.com") {
+		t.Error("the emails must be encrypted in the file")
+		t.FailNow()
+	}
+
+	if ok, err := db.IsPresent(users[0].Address); !ok || err != nil {
+		t.Errorf("the saved user must be present, got %v %v", ok, err)
+		t.FailNow()
+	}
+	if u, err := db.Get(users[0].Address); err != nil || u.Email != users[0].Email || u.UUID != users[0].UUID {
+		t.Errorf("incorrect user, got %v %v", u, err)
+		t.FailNow()
+	}
+	if u, err := db.FindByEmail("John.Doe+3@MailService.com"); err != nil || u == nil || u.Address != users[3].Address {
+		t.Errorf("the users must be found by normalized email, got %v %v", u, err)
+		t.FailNow()
+	}
+	if n, err := db.CountBySponsor(sponsor); n != len(users) || err != nil {
+		t.Errorf("incorrect count by sponsor, got %d %v", n, err)
+		t.FailNow()
+	}
+	if _, err := db.UpdateEmail(sponsor, "jane.doe@mailservice.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("the genesis users have no email to update, got %v", err)
+		t.FailNow()
+	}
+	if u, err := db.UpdateEmail(users[1].Address, "jane.doe@mailservice.com"); err != nil || u.Email != "jane.doe@mailservice.com" {
+		t.Errorf("incorrect updated email, got %v %v", u, err)
+		t.FailNow()
+	}
+	if err := db.Delete(users[2].Address); err != nil {
+		t.Errorf("cannot delete the user: %v", err)
+		t.FailNow()
+	}
+	if err := db.Delete(users[2].Address); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("deleting an absent user must fail, got %v", err)
+		t.FailNow()
+	}
+
+	count := len(users) // one deleted, with the genesis user
+	tt := []struct {
+		name    string
+		options []int
+		ln      int
+		err     bool
+	}{
+		{"no option", nil, count, false},
+		{"offset=0", []int{0}, count, false},
+		{"offset=5", []int{5}, count - 5, false},
+		{"offset=5 max=3", []int{5, 3}, 3, false},
+		{"offset=5 max=0", []int{5, 0}, 0, false},
+		{"offset=-2 max=5", []int{-2, 5}, 0, true},
+		{"offset too large", []int{count + 1, 5}, 0, false},
+		{"offset=5 max=-2", []int{5, -2}, 0, true},
+		{"max too large", []int{5, count + 1}, count - 5, false},
+		{"offset=count max=5", []int{count, 5}, 0, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := db.List(tc.options...)
+			if (err != nil) != tc.err || len(l) != tc.ln {
+				t.Errorf("incorrect list, got %d users %v, want %d", len(l), err, tc.ln)
+				t.FailNow()
+			}
+		})
+	}
+
+	e := "john.doe+9@mailservice.com"
+	i := NewInvite(sponsor, 2, time.Time{})
+	o := NewOutboxEmail(e, "confirmation", nil)
+	for _, err := range []error{
+		db.Suppress(e),
+		db.ClaimReferral(sponsor, 3, 5),
+		db.ClaimSeat(count, 100),
+		db.CreateInvite(i),
+		db.AppendEvent(NewEvent(EventActivated, users[0].Address, e, "")),
+		fs.Enqueue(o),
+	} {
+		if err != nil {
+			t.Errorf("cannot change the store: %v", err)
+			t.FailNow()
+		}
+	}
+	if _, err := db.RedeemInvite(i.Code, time.Now()); err != nil {
+		t.Errorf("cannot redeem the invite: %v", err)
+		t.FailNow()
+	}
+	if err := fs.Update(&OutboxEmail{ID: "unknown"}); !errors.Is(err, ErrOutboxNotFound) {
+		t.Errorf("updating an absent outbox email must fail, got %v", err)
+		t.FailNow()
+	}
+
+	fs, err = NewFileStore(dir, ek) // restart
+	if err != nil {
+		t.Errorf("cannot load the file store: %v", err)
+		t.FailNow()
+	}
+	if l, err := fs.List(); len(l) != count || err != nil {
+		t.Errorf("the users must be recovered, got %d %v", len(l), err)
+		t.FailNow()
+	}
+	if u, _ := fs.Get(users[1].Address); u == nil || u.Email != "jane.doe@mailservice.com" || u.EmailHash != EmailHash(u.Email, ek) {
+		t.Errorf("the updated email must be recovered, got %v", u)
+		t.FailNow()
+	}
+	if ok, _ := fs.IsSuppressed(e); !ok {
+		t.Error("the suppressed emails must be recovered")
+		t.FailNow()
+	}
+	if err := fs.ClaimReferral(sponsor, 0, 5); err != nil {
+		t.Errorf("the referrals must be recovered, got %v", err)
+		t.FailNow()
+	}
+	if err := fs.ClaimReferral(sponsor, 0, 5); !errors.Is(err, ErrReferralLimit) {
+		t.Errorf("the referrals must be limited, got %v", err)
+		t.FailNow()
+	}
+	if err := fs.ClaimSeat(0, count+1); !errors.Is(err, ErrWaitlistFull) {
+		t.Errorf("the seats must be recovered, got %v", err)
+		t.FailNow()
+	}
+	if r, err := fs.RedeemInvite(i.Code, time.Now()); err != nil || r.Uses != 2 {
+		t.Errorf("the invite uses must be recovered, got %v %v", r, err)
+		t.FailNow()
+	}
+	if l, _ := fs.ListEvents(users[0].Address, 0); len(l) != 1 || l[0].EmailHash != EmailHash(e, ek) {
+		t.Errorf("the events must be recovered, got %v", l)
+		t.FailNow()
+	}
+	if l, _ := fs.Pending(); len(l) != 1 || l[0].Recipient != e {
+		t.Errorf("the outbox must be recovered, got %v", l)
+		t.FailNow()
+	}
+}
+
+func TestFileStoreConcurrentSave(t *testing.T) {
+	dir := t.TempDir()
+	fs, _ := NewFileStore(dir, ek)
+	sponsor := solana.NewWallet().PublicKey().String()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fs.Save(&User{Address: solana.NewWallet().PublicKey().String(), Email: fmt.Sprintf("john.doe+%d@mailservice.com", i), Sponsor: sponsor}); err != nil {
+				t.Errorf("cannot save the user: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	fs, err := NewFileStore(dir, ek)
+	if err != nil {
+		t.Errorf("the file must not be corrupted, got %v", err)
+		t.FailNow()
+	}
+	if l, _ := fs.List(); len(l) != 50 {
+		t.Errorf("every save must be written, got %d users", len(l))
+		t.FailNow()
+	}
+}
+
+func TestFileStoreCrash(t *testing.T) {
+	dir := t.TempDir()
+	fs, _ := NewFileStore(dir, ek)
+	sponsor := solana.NewWallet().PublicKey().String()
+	u := &User{Address: solana.NewWallet().PublicKey().String(), Email: "john.doe@mailservice.com", Sponsor: sponsor}
+	if err := fs.Save(u); err != nil {
+		t.Errorf("cannot save the user: %v", err)
+		t.FailNow()
+	}
+
+	// killed midway, the temporary file is half written and never renamed
+	fs.write = func(b []byte) error {
+		f, err := os.CreateTemp(dir, "."+fileStoreName+".*.tmp")
+		if err != nil {
+			return err
+		}
+		f.Write(b[:len(b)/2])
+		f.Close()
+		return errors.New("killed")
+	}
+	a := solana.NewWallet().PublicKey().String()
+	if err := fs.Save(&User{Address: a, Email: "jane.doe@mailservice.com", Sponsor: sponsor}); err == nil {
+		t.Error("the interrupted write must fail the save")
+		t.FailNow()
+	}
+	if ok, _ := fs.IsPresent(a); ok {
+		t.Error("the state must be restored when the write fails")
+		t.FailNow()
+	}
+	if err := fs.Delete(u.Address); err == nil {
+		t.Error("the interrupted write must fail the delete")
+		t.FailNow()
+	}
+	if ok, _ := fs.IsPresent(u.Address); !ok {
+		t.Error("the state must be restored when the write fails")
+		t.FailNow()
+	}
+
+	fs, err := NewFileStore(dir, ek) // restart
+	if err != nil {
+		t.Errorf("the file must be the last complete one, got %v", err)
+		t.FailNow()
+	}
+	if l, _ := fs.List(); len(l) != 1 || l[0].Address != u.Address || l[0].Email != u.Email {
+		t.Errorf("the state of the last complete write must be recovered, got %v", l)
+		t.FailNow()
+	}
+
+	os.WriteFile(filepath.Join(dir, fileStoreName), []byte(`{"users":{`), 0o600)
+	if _, err := NewFileStore(dir, ek); err == nil {
+		t.Error("a corrupted file must fail the loading")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInviteNotFound  = errors.New("invite code not found")
+	ErrInviteExhausted = errors.New("invite code exhausted")
+	ErrInviteExpired   = errors.New("invite code expired")
+)
+
+// inviteCodeSize is the number of random bytes of a code, 8 base32 characters.
+const inviteCodeSize = 5
+
+// Invite lets up to MaxUses users register without knowing a sponsor, Creator sponsoring them.
+type Invite struct {
+	Code      string `json:"code"`
+	Creator   string `json:"creator"`
+	MaxUses   int    `json:"max_uses"`
+	Uses      int    `json:"uses"`
+	Expiry    int64  `json:"expiry,omitempty"` // unix milliseconds, never expires when 0
+	Timestamp int64  `json:"timestamp"`
+}
+
+func NewInvite(creator string, maxUses int, expiry time.Time) *Invite {
+	b := make([]byte, inviteCodeSize)
+	rand.Read(b)
+	i := &Invite{
+		Code:      base32.StdEncoding.EncodeToString(b),
+		Creator:   creator,
+		MaxUses:   maxUses,
+		Timestamp: time.Now().UnixMilli(),
+	}
+	if !expiry.IsZero() {
+		i.Expiry = expiry.UnixMilli()
+	}
+	return i
+}
+
+// check returns why the invite cannot be redeemed at t, nil when it can.
+func (i *Invite) check(t time.Time) error {
+	if i.Expiry > 0 && t.UnixMilli() >= i.Expiry {
+		return ErrInviteExpired
+	}
+	if i.Uses >= i.MaxUses {
+		return ErrInviteExhausted
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewInvite(t *testing.T) {
+	i := NewInvite(sponsor, 3, time.Time{})
+	if len(i.Code) != 8 || i.Creator != sponsor || i.MaxUses != 3 || i.Uses != 0 || i.Expiry != 0 {
+		t.Errorf("incorrect invite %+v", *i)
+		t.FailNow()
+	}
+	if NewInvite(sponsor, 3, time.Time{}).Code == i.Code {
+		t.Errorf("codes must be random")
+		t.FailNow()
+	}
+	u := &User{Address: "8mxgS3kGYjmCwyktyBqcAxxYy4G32vUKuCNEUdpAySPk", Email: "john.doe@mailservice.com", InviteCode: i.Code}
+	if !u.IsSet() {
+		t.Errorf("a user with an invite code instead of a sponsor must be set")
+		t.FailNow()
+	}
+}
+
+func TestRedeemInvite(t *testing.T) {
+	now := time.Now()
+	db := NewMockDBContent(nil)
+	valid := NewInvite(sponsor, 2, now.Add(time.Hour))
+	expired := NewInvite(sponsor, 2, now.Add(-time.Hour))
+	db.CreateInvite(valid)
+	db.CreateInvite(expired)
+
+	tt := []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"first use", valid.Code, nil},
+		{"last use", valid.Code, nil},
+		{"exhausted", valid.Code, ErrInviteExhausted},
+		{"expired", expired.Code, ErrInviteExpired},
+		{"unknown", "UNKNOWN1", ErrInviteNotFound},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			i, err := db.RedeemInvite(tc.code, now)
+			if err != tc.err {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+			if err == nil && i.Creator != sponsor {
+				t.Errorf("incorrect creator, got %q, want %q", i.Creator, sponsor)
+				t.FailNow()
+			}
+		})
+	}
+}
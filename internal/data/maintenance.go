@@ -0,0 +1,17 @@
+package data
+
+// Maintenance is the maintenance mode of the API, kept in DB so the replicas restarted meanwhile stay in maintenance.
+type Maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"` // shown to the clients, when the service is back for instance
+	Since   int64  `json:"since,omitempty"`   // of the last change, unix ms
+}
+
+// MOCK
+func (db mockDB) Maintenance() (Maintenance, error) {
+	return Maintenance{}, nil
+}
+
+func (db mockDB) SetMaintenance(m Maintenance) error {
+	return nil
+}
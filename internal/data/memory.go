@@ -0,0 +1,880 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/crypto/cipher"
+	"github.com/unleaktrade/waitlist/internal/faults"
+)
+
+// ErrInjected is the failure of the operations set by FailOn, and by FailNth without an error.
+var ErrInjected = errors.New("injected failure")
+
+// storedUser is a stored user, whose email hash and client metadata are not serialized with the user.
+type storedUser struct {
+	User
+	EmailHash    string `json:"email_hash,omitempty"`
+	Meta         string `json:"meta,omitempty"`          // encrypted
+	DeletedAt    int64  `json:"deleted_at,omitempty"`    // unix ms, 0 unless soft-deleted
+	AnonymizedAt int64  `json:"anonymized_at,omitempty"` // unix ms, 0 unless anonymized
+}
+
+// live reports whether f is stored and not soft-deleted.
+func (f *storedUser) live() bool {
+	return f != nil && f.DeletedAt == 0
+}
+
+// state is the content of a store, emails and recipients encrypted as in DynamoDB.
+type state struct {
+	Users       map[string]*storedUser  `json:"users"`      // by address
+	Suppressed  map[string]int64        `json:"suppressed"` // suppression time by email hash
+	Referrals   map[string]int          `json:"referrals"`  // claimed referrals by sponsor
+	Seats       *int                    `json:"seats,omitempty"`
+	Invites     map[string]*Invite      `json:"invites"`
+	Events      map[string][]Event      `json:"events"` // by address, in append order
+	Outbox      map[string]*OutboxEmail `json:"outbox"`
+	Locks       map[string]lock         `json:"locks"`
+	Digests     map[string]int64        `json:"digests"` // time of the last digest by sponsor
+	Exports     map[string]*ExportJob   `json:"exports"`
+	Maintenance Maintenance             `json:"maintenance"`
+	Deliveries  map[string][]Delivery   `json:"deliveries"` // by email hash, oldest first
+}
+
+func newState() *state {
+	return &state{
+		Users:      map[string]*storedUser{},
+		Suppressed: map[string]int64{},
+		Referrals:  map[string]int{},
+		Invites:    map[string]*Invite{},
+		Events:     map[string][]Event{},
+		Outbox:     map[string]*OutboxEmail{},
+		Locks:      map[string]lock{},
+		Digests:    map[string]int64{},
+		Exports:    map[string]*ExportJob{},
+		Deliveries: map[string][]Delivery{},
+	}
+}
+
+// store is a DB, an Outbox and Exports held in memory, for the ephemeral deployments, the load tests and the mocks.
+// The file store writes its state through on every change.
+type store struct {
+	mu    sync.Mutex
+	path  string // file of the file store, empty in memory
+	ek    string
+	s     *state
+	saved []byte               // content of the file, restored when a write fails
+	write func(b []byte) error // replaces the file by b, nil in memory
+	plan  faults.Plan          // failures and delays of the operations, by their method names
+}
+
+// NewMemoryDB returns an empty store lost on exit, its emails encrypted with a key of its own.
+func NewMemoryDB() *store {
+	ek, err := cipher.GenerateKey(32)
+	if err != nil {
+		panic(err)
+	}
+	return &store{ek: ek, s: newState()}
+}
+
+// NewMockDB returns an empty store lost on exit, scripted by FailOn, FailNth and Delay.
+func NewMockDB() *store {
+	return NewMemoryDB()
+}
+
+// FailOn makes the operation op, a method of DB, Outbox or Exports, fail with ErrInjected for the address a, or for all when a is empty.
+func (db *store) FailOn(op, a string) *store {
+	db.plan.FailOn(op, a, fmt.Errorf("%w: %s %s", ErrInjected, op, a))
+	return db
+}
+
+// FailNth makes the nth call of the operation op, counted from 1, fail with err, ErrInjected when nil.
+func (db *store) FailNth(op string, n int, err error) *store {
+	if err == nil {
+		err = fmt.Errorf("%w: call %d of %s", ErrInjected, n, op)
+	}
+	db.plan.FailNth(op, n, err)
+	return db
+}
+
+// Delay slows every call of the operation op by d, without holding the store.
+func (db *store) Delay(op string, d time.Duration) *store {
+	db.plan.Delay(op, d)
+	return db
+}
+
+// Calls returns the number of calls of the operation op.
+func (db *store) Calls(op string) int {
+	return db.plan.Calls(op)
+}
+
+// failure records a call of op for a, delayed as planned, and returns the failure injected in it, nil when none.
+func (db *store) failure(op, a string) error {
+	err := db.plan.Call(op, a)
+	if err != nil {
+		logger.Debug("🔥 injected failure", "op", op, "address", a)
+	}
+	return err
+}
+
+// update applies f to the state and writes it to the file, the state being restored when f or the write fails.
+func (db *store) update(f func(s *state) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	err := f(db.s)
+	if db.write == nil {
+		return err // in memory, f changes nothing when it fails
+	}
+	if err == nil {
+		var b []byte
+		if b, err = json.Marshal(db.s); err == nil {
+			if err = db.write(b); err == nil {
+				db.saved = b
+				return nil
+			}
+		}
+	}
+	if db.saved == nil {
+		db.s = newState()
+	} else if rerr := db.restore(db.saved); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// read applies f to the state, which it must not change.
+func (db *store) read(f func(s *state) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return f(db.s)
+}
+
+func (db *store) HashEmail(e string) string {
+	return EmailHash(e, db.ek)
+}
+
+// user returns the decrypted copy of the stored user u.
+func (db *store) user(u *storedUser) (*User, error) {
+	c := u.User
+	c.EmailHash = u.EmailHash
+	if c.Genesis {
+		return &c, nil
+	}
+	e, err := decryptor(c.Email, db.ek, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	c.Email = e
+	if c.Meta, err = openMeta(u.Meta, c.Address, db.decryptBound); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (db *store) encryptBound(text, ad string) (string, error) {
+	return cipher.EncryptBound(text, db.ek, ad)
+}
+
+func (db *store) decryptBound(ctext, ad string) (string, error) {
+	return decryptor(ctext, db.ek, ad)
+}
+
+// prepare returns the user to store for u, with a new UUID and timestamp, activated now, and the email encrypted.
+func (db *store) prepare(u *User) (*User, *storedUser, error) {
+	if err := checkUser(u); err != nil {
+		return nil, nil, err
+	}
+	if u.Genesis {
+		u2 := u.saved(NewGenesisUser(u.Address)) // no email to protect
+		return u2, &storedUser{User: *u2}, nil
+	}
+	encEmail, err := cipher.EncryptBound(u.Email, db.ek, u.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+	u2 := u.saved(NewUser(u.Address, u.Email, u.Sponsor))
+	u2.Lang = u.Lang
+	u2.EmailHash = EmailHash(u.Email, db.ek)
+	u2.InviteCode = u.InviteCode
+	u2.Meta = u.Meta.saved(db.ek)
+	meta, err := sealMeta(u2.Meta, u2.Address, db.encryptBound)
+	if err != nil {
+		return nil, nil, err
+	}
+	stored := *u2
+	stored.Email, stored.EmailHash, stored.Meta = encEmail, "", nil
+	return u2, &storedUser{User: stored, EmailHash: u2.EmailHash, Meta: meta}, nil
+}
+
+func (db *store) Save(u *User) error {
+	if u != nil {
+		if err := db.failure("Save", u.Address); err != nil {
+			return err
+		}
+	}
+	u2, stored, err := db.prepare(u)
+	if err != nil {
+		return err
+	}
+	err = db.update(func(s *state) error {
+		s.Users[u2.Address] = stored
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*u = *u2 // copy saved user, its email in clear
+	return nil
+}
+
+func (db *store) SaveBatch(users []*User) []error {
+	errs := make([]error, len(users))
+	saved := map[int]*User{}
+	stored := map[string]*storedUser{}
+	for i, u := range users {
+		if u != nil {
+			if errs[i] = db.failure("SaveBatch", u.Address); errs[i] != nil {
+				continue
+			}
+		}
+		u2, f, err := db.prepare(u)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		saved[i], stored[u2.Address] = u2, f
+	}
+	err := db.update(func(s *state) error {
+		for a, f := range stored {
+			s.Users[a] = f
+		}
+		return nil
+	})
+	for i, u2 := range saved {
+		if errs[i] = err; err == nil {
+			*users[i] = *u2
+		}
+	}
+	return errs
+}
+
+// List returns the users in activation order, paged by an offset and a max.
+func (db *store) List(options ...int) ([]*User, error) {
+	if err := db.failure("List", ""); err != nil {
+		return nil, err
+	}
+	var users []*User
+	err := db.read(func(s *state) error {
+		for _, f := range s.Users {
+			if !f.live() {
+				continue
+			}
+			u, err := db.user(f)
+			if err != nil {
+				return err
+			}
+			users = append(users, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Timestamp != users[j].Timestamp {
+			return users[i].Timestamp < users[j].Timestamp
+		}
+		return users[i].Address < users[j].Address
+	})
+	return Page(users, options...)
+}
+
+func (db *store) ListAddresses() (map[string]int64, error) {
+	if err := db.failure("ListAddresses", ""); err != nil {
+		return nil, err
+	}
+	m := map[string]int64{}
+	err := db.read(func(s *state) error {
+		for a, f := range s.Users {
+			if f.live() {
+				m[a] = f.Timestamp
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (db *store) IsPresent(a string) (bool, error) {
+	if err := db.failure("IsPresent", a); err != nil {
+		return false, err
+	}
+	var ok bool
+	err := db.read(func(s *state) error {
+		ok = s.Users[a].live()
+		return nil
+	})
+	return ok, err
+}
+
+func (db *store) Get(a string) (u *User, err error) {
+	if err := db.failure("Get", a); err != nil {
+		return nil, err
+	}
+	err = db.read(func(s *state) error {
+		if f := s.Users[a]; f.live() {
+			u, err = db.user(f)
+		}
+		return err
+	})
+	return
+}
+
+func (db *store) Delete(a string) error {
+	if err := db.failure("Delete", a); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		f := s.Users[a]
+		if !f.live() {
+			return ErrUserNotFound
+		}
+		f2 := *f
+		f2.DeletedAt = time.Now().UnixMilli()
+		s.Users[a] = &f2
+		return nil
+	})
+}
+
+func (db *store) Restore(a string) (u *User, err error) {
+	if err := db.failure("Restore", a); err != nil {
+		return nil, err
+	}
+	err = db.update(func(s *state) error {
+		f := s.Users[a]
+		if f == nil || f.live() {
+			return ErrUserNotFound
+		}
+		f2 := *f
+		f2.DeletedAt = 0
+		s.Users[a] = &f2
+		u, err = db.user(&f2)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (db *store) Purge(before time.Time) ([]*User, error) {
+	if err := db.failure("Purge", ""); err != nil {
+		return nil, err
+	}
+	purged := []*User{}
+	err := db.update(func(s *state) error {
+		for a, f := range s.Users {
+			if f.live() || f.DeletedAt >= before.UnixMilli() {
+				continue
+			}
+			u, err := db.user(f)
+			if err != nil {
+				return err
+			}
+			delete(s.Users, a)
+			purged = append(purged, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+func (db *store) Anonymize(a string) (u *User, err error) {
+	if err := db.failure("Anonymize", a); err != nil {
+		return nil, err
+	}
+	encEmail, err := cipher.EncryptBound(AnonymizedEmail, db.ek, a)
+	if err != nil {
+		return nil, err
+	}
+	err = db.update(func(s *state) error {
+		f := s.Users[a]
+		if !f.live() || f.Genesis || f.AnonymizedAt != 0 {
+			return ErrUserNotFound
+		}
+		f2 := *f
+		f2.Email, f2.Lang, f2.EmailHash, f2.Meta = encEmail, "", "", ""
+		f2.AnonymizedAt = time.Now().UnixMilli()
+		s.Users[a] = &f2
+		u, err = db.user(&f2)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (db *store) UpdateEmail(a, e string) (u *User, err error) {
+	if err := db.failure("UpdateEmail", a); err != nil {
+		return nil, err
+	}
+	encEmail, err := cipher.EncryptBound(e, db.ek, a)
+	if err != nil {
+		return nil, err
+	}
+	err = db.update(func(s *state) error {
+		f := s.Users[a]
+		if !f.live() || f.Genesis || f.AnonymizedAt != 0 {
+			return ErrUserNotFound
+		}
+		f2 := *f
+		f2.Email, f2.EmailHash = encEmail, EmailHash(e, db.ek)
+		s.Users[a] = &f2
+		u, err = db.user(&f2)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (db *store) FindByEmail(e string) (u *User, err error) {
+	if err := db.failure("FindByEmail", ""); err != nil {
+		return nil, err
+	}
+	h := EmailHash(e, db.ek)
+	err = db.read(func(s *state) error {
+		for _, f := range s.Users {
+			if f.live() && f.EmailHash == h {
+				u, err = db.user(f)
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (db *store) Suppress(e string) error {
+	if err := db.failure("Suppress", ""); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		s.Suppressed[EmailHash(e, db.ek)] = time.Now().UnixMilli()
+		return nil
+	})
+}
+
+func (db *store) IsSuppressed(e string) (bool, error) {
+	if err := db.failure("IsSuppressed", ""); err != nil {
+		return false, err
+	}
+	var ok bool
+	err := db.read(func(s *state) error {
+		_, ok = s.Suppressed[EmailHash(e, db.ek)]
+		return nil
+	})
+	return ok, err
+}
+
+func (db *store) CountBySponsor(sp string) (int, error) {
+	if err := db.failure("CountBySponsor", sp); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := db.read(func(s *state) error {
+		for _, f := range s.Users {
+			if f.live() && f.Sponsor == sp {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+func (db *store) ListBySponsor(sp string) ([]*User, error) {
+	if err := db.failure("ListBySponsor", sp); err != nil {
+		return nil, err
+	}
+	users := []*User{}
+	err := db.read(func(s *state) error {
+		for _, f := range s.Users {
+			if !f.live() || f.Sponsor != sp {
+				continue
+			}
+			u, err := db.user(f)
+			if err != nil {
+				return err
+			}
+			users = append(users, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (db *store) ClaimReferral(sp string, seed, max int) error {
+	if err := db.failure("ClaimReferral", sp); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		n, ok := s.Referrals[sp]
+		if !ok {
+			n = seed
+		}
+		if n >= max {
+			return ErrReferralLimit
+		}
+		s.Referrals[sp] = n + 1
+		return nil
+	})
+}
+
+func (db *store) ReleaseReferral(sp string) error {
+	if err := db.failure("ReleaseReferral", sp); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		if s.Referrals[sp] > 0 {
+			s.Referrals[sp]--
+		}
+		return nil
+	})
+}
+
+func (db *store) ClaimSeat(seed, max int) error {
+	if err := db.failure("ClaimSeat", ""); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		n := seed
+		if s.Seats != nil {
+			n = *s.Seats
+		}
+		if n >= max {
+			return ErrWaitlistFull
+		}
+		n++
+		s.Seats = &n
+		return nil
+	})
+}
+
+func (db *store) ReleaseSeat() error {
+	if err := db.failure("ReleaseSeat", ""); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		if s.Seats != nil && *s.Seats > 0 {
+			n := *s.Seats - 1
+			s.Seats = &n
+		}
+		return nil
+	})
+}
+
+func (db *store) CreateInvite(i *Invite) error {
+	if err := db.failure("CreateInvite", i.Creator); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		if _, ok := s.Invites[i.Code]; ok {
+			return fmt.Errorf("invite code %s already exists", i.Code) // never reset the uses of a code
+		}
+		c := *i
+		s.Invites[i.Code] = &c
+		return nil
+	})
+}
+
+func (db *store) RedeemInvite(code string, t time.Time) (i *Invite, err error) {
+	if err := db.failure("RedeemInvite", ""); err != nil {
+		return nil, err
+	}
+	err = db.update(func(s *state) error {
+		stored, ok := s.Invites[code]
+		if !ok {
+			return ErrInviteNotFound
+		}
+		if err := stored.check(t); err != nil {
+			return err
+		}
+		c := *stored
+		c.Uses++
+		s.Invites[code] = &c
+		i = &c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := *i
+	return &c, nil
+}
+
+func (db *store) AppendEvent(e Event) error {
+	if err := db.failure("AppendEvent", e.Address); err != nil {
+		return err
+	}
+	e.hash(db.ek)
+	return db.update(func(s *state) error {
+		s.Events[e.Address] = append(s.Events[e.Address], e)
+		return nil
+	})
+}
+
+func (db *store) ListEvents(a string, limit int) ([]Event, error) {
+	if err := db.failure("ListEvents", a); err != nil {
+		return nil, err
+	}
+	var l []Event
+	db.read(func(s *state) error {
+		l = make([]Event, 0, len(s.Events[a]))
+		for i := len(s.Events[a]) - 1; i >= 0; i-- { // most recent first
+			l = append(l, s.Events[a][i])
+		}
+		return nil
+	})
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Timestamp > l[j].Timestamp })
+	if limit > 0 && len(l) > limit {
+		l = l[:limit]
+	}
+	return l, nil
+}
+
+func (db *store) AcquireLock(name, owner string, ttl time.Duration) (bool, error) {
+	if err := db.failure("AcquireLock", ""); err != nil {
+		return false, err
+	}
+	ok := false
+	err := db.update(func(s *state) error {
+		now := time.Now()
+		if s.Locks[name].held(owner, now) {
+			return nil
+		}
+		s.Locks[name], ok = lock{owner, now.Add(ttl).UnixMilli()}, true
+		return nil
+	})
+	return ok, err
+}
+
+func (db *store) LastDigests() (map[string]int64, error) {
+	if err := db.failure("LastDigests", ""); err != nil {
+		return nil, err
+	}
+	m := map[string]int64{}
+	db.read(func(s *state) error {
+		for sp, t := range s.Digests {
+			m[sp] = t
+		}
+		return nil
+	})
+	return m, nil
+}
+
+func (db *store) SetLastDigest(sp string, t int64) error {
+	if err := db.failure("SetLastDigest", sp); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		s.Digests[sp] = t
+		return nil
+	})
+}
+
+func (db *store) Maintenance() (Maintenance, error) {
+	if err := db.failure("Maintenance", ""); err != nil {
+		return Maintenance{}, err
+	}
+	var m Maintenance
+	err := db.read(func(s *state) error {
+		m = s.Maintenance
+		return nil
+	})
+	return m, err
+}
+
+func (db *store) SetMaintenance(m Maintenance) error {
+	if err := db.failure("SetMaintenance", ""); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		s.Maintenance = m
+		return nil
+	})
+}
+
+func (db *store) RecordDelivery(e string, d Delivery) error {
+	if err := db.failure("RecordDelivery", ""); err != nil {
+		return err
+	}
+	h := EmailHash(e, db.ek)
+	return db.update(func(s *state) error {
+		s.Deliveries[h] = latest(append(s.Deliveries[h], d))
+		return nil
+	})
+}
+
+func (db *store) Deliveries(e string) ([]Delivery, error) {
+	if err := db.failure("Deliveries", ""); err != nil {
+		return nil, err
+	}
+	var l []Delivery
+	err := db.read(func(s *state) error {
+		l = append([]Delivery(nil), s.Deliveries[EmailHash(e, db.ek)]...)
+		return nil
+	})
+	return l, err
+}
+
+// putOutbox stores e, its recipient encrypted, failing with ErrOutboxNotFound when it must exist and does not.
+func (db *store) putOutbox(e *OutboxEmail, exists bool) error {
+	r, err := cipher.EncryptBound(e.Recipient, db.ek, outboxPrefix+e.ID)
+	if err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		if _, ok := s.Outbox[e.ID]; exists && !ok {
+			return ErrOutboxNotFound
+		}
+		c := *e
+		c.Recipient = r
+		s.Outbox[e.ID] = &c
+		return nil
+	})
+}
+
+func (db *store) Enqueue(e *OutboxEmail) error {
+	if err := db.failure("Enqueue", ""); err != nil {
+		return err
+	}
+	return db.putOutbox(e, false)
+}
+
+func (db *store) Update(e *OutboxEmail) error {
+	if err := db.failure("Update", ""); err != nil {
+		return err
+	}
+	return db.putOutbox(e, true)
+}
+
+func (db *store) Pending() ([]*OutboxEmail, error) {
+	if err := db.failure("Pending", ""); err != nil {
+		return nil, err
+	}
+	l := []*OutboxEmail{}
+	db.read(func(s *state) error {
+		for _, e := range s.Outbox {
+			if e.Status != OutboxPending {
+				continue
+			}
+			r, err := decryptor(e.Recipient, db.ek, outboxPrefix+e.ID)
+			if err != nil {
+				continue
+			}
+			c := *e
+			c.Recipient = r
+			l = append(l, &c)
+		}
+		return nil
+	})
+	sort.Slice(l, func(i, j int) bool { return l[i].CreatedAt < l[j].CreatedAt })
+	return l, nil
+}
+
+func (db *store) CreateExport(j *ExportJob) error {
+	if err := db.failure("CreateExport", ""); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		c := *j
+		s.Exports[j.ID] = &c
+		return nil
+	})
+}
+
+func (db *store) GetExport(id string) (*ExportJob, error) {
+	if err := db.failure("GetExport", ""); err != nil {
+		return nil, err
+	}
+	var j *ExportJob
+	db.read(func(s *state) error {
+		if e, ok := s.Exports[id]; ok {
+			c := *e
+			j = &c
+		}
+		return nil
+	})
+	if j == nil {
+		return nil, ErrExportNotFound
+	}
+	return j, nil
+}
+
+func (db *store) UpdateExport(j *ExportJob) error {
+	if err := db.failure("UpdateExport", ""); err != nil {
+		return err
+	}
+	return db.update(func(s *state) error {
+		e, ok := s.Exports[j.ID]
+		switch {
+		case !ok:
+			return ErrExportNotFound
+		case e.Finished():
+			return ErrExportFinished
+		}
+		c := *j
+		s.Exports[j.ID] = &c
+		return nil
+	})
+}
+
+func (db *store) PendingExports() ([]*ExportJob, error) {
+	if err := db.failure("PendingExports", ""); err != nil {
+		return nil, err
+	}
+	l := []*ExportJob{}
+	db.read(func(s *state) error {
+		for _, e := range s.Exports {
+			if !e.Finished() {
+				c := *e
+				l = append(l, &c)
+			}
+		}
+		return nil
+	})
+	sort.Slice(l, func(i, j int) bool { return l[i].CreatedAt < l[j].CreatedAt })
+	return l, nil
+}
+
+func (db *store) ScanUsers(f func(users []*User) error) error {
+	if err := db.failure("ScanUsers", ""); err != nil {
+		return err
+	}
+	users, err := db.List()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(users); i += exportPage {
+		if err := f(users[i:min(i+exportPage, len(users))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestMemoryDB(t *testing.T) {
+	var db DB = NewMemoryDB()
+	sponsor := solana.NewWallet().PublicKey().String()
+	u := &User{Address: solana.NewWallet().PublicKey().String(), Email: "john.doe@mailservice.com", Sponsor: sponsor}
+	if err := db.Save(u); err != nil || u.UUID == "" {
+		t.Errorf("cannot save the user: %v", err)
+		t.FailNow()
+	}
+	if ok, err := db.IsPresent(u.Address); !ok || err != nil {
+		t.Errorf("the saved user must be present, got %v %v", ok, err)
+		t.FailNow()
+	}
+	if l, err := db.List(); len(l) != 1 || err != nil || l[0].Email != u.Email {
+		t.Errorf("incorrect list, got %v %v", l, err)
+		t.FailNow()
+	}
+	if n, _ := db.CountBySponsor(sponsor); n != 1 {
+		t.Errorf("incorrect count by sponsor, got %d", n)
+		t.FailNow()
+	}
+	if err := db.Delete(u.Address); err != nil {
+		t.Errorf("cannot delete the user: %v", err)
+		t.FailNow()
+	}
+	if err := db.Delete(u.Address); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("deleting an absent user must fail, got %v", err)
+		t.FailNow()
+	}
+	if n, _ := db.CountBySponsor(sponsor); n != 0 {
+		t.Errorf("the deleted user must not be counted, got %d", n)
+		t.FailNow()
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	dir := t.TempDir()
+	fs, _ := NewFileStore(dir, ek)
+	sponsor := solana.NewWallet().PublicKey().String()
+	u := NewUser(solana.NewWallet().PublicKey().String(), "john.doe@mailservice.com", sponsor)
+	fs.Save(u)
+	if err := fs.Delete(u.Address); err != nil {
+		t.Errorf("cannot delete the user: %v", err)
+		t.FailNow()
+	}
+	fs, _ = NewFileStore(dir, ek) // restart
+	get, _ := fs.Get(u.Address)
+	present, _ := fs.IsPresent(u.Address)
+	l, _ := fs.List()
+	found, _ := fs.FindByEmail(u.Email)
+	referrals, _ := fs.ListBySponsor(sponsor)
+	if get != nil || present || len(l) != 0 || found != nil || len(referrals) != 0 {
+		t.Errorf("a deleted user must be hidden, got %v %v %v %v %v", get, present, l, found, referrals)
+		t.FailNow()
+	}
+	if _, err := fs.UpdateEmail(u.Address, "jane.doe@mailservice.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("the email of a deleted user must not be updated, got %v", err)
+		t.FailNow()
+	}
+
+	if r, err := fs.Restore(u.Address); err != nil || r.Email != u.Email || r.Timestamp != u.Timestamp {
+		t.Errorf("cannot restore the user, got %v: %v", r, err)
+		t.FailNow()
+	}
+	if ok, _ := fs.IsPresent(u.Address); !ok {
+		t.Error("the restored user must be present")
+		t.FailNow()
+	}
+	if _, err := fs.Restore(u.Address); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("a user not deleted must not be restored, got %v", err)
+		t.FailNow()
+	}
+	if _, err := fs.Restore(solana.NewWallet().PublicKey().String()); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("an absent user must not be restored, got %v", err)
+		t.FailNow()
+	}
+
+	kept := NewUser(solana.NewWallet().PublicKey().String(), "jane.doe@mailservice.com", sponsor)
+	fs.Save(kept)
+	fs.Delete(u.Address)
+	if l, _ := fs.Purge(time.Now().Add(-time.Hour)); len(l) != 0 {
+		t.Errorf("the users deleted after the cutoff must be kept, got %v", l)
+		t.FailNow()
+	}
+	if l, _ := fs.Purge(time.Now().Add(time.Millisecond)); len(l) != 1 || l[0].Address != u.Address {
+		t.Errorf("the users deleted before the cutoff must be purged, got %v", l)
+		t.FailNow()
+	}
+	if _, err := fs.Restore(u.Address); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("a purged user must not be restored, got %v", err)
+		t.FailNow()
+	}
+	if ok, _ := fs.IsPresent(kept.Address); !ok {
+		t.Error("the users not deleted must not be purged")
+		t.FailNow()
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	dir := t.TempDir()
+	fs, _ := NewFileStore(dir, ek)
+	sponsor := solana.NewWallet().PublicKey().String()
+	u := NewUser(solana.NewWallet().PublicKey().String(), "john.doe@mailservice.com", sponsor)
+	u.Lang = "fr"
+	u.Meta = &ClientMeta{IP: "203.0.113.7", UserAgent: "Mozilla/5.0", Country: "FR"}
+	fs.Save(u)
+	a, err := fs.Anonymize(u.Address)
+	if err != nil || !a.Anonymized() || a.Lang != "" || a.Meta != nil || a.EmailHash != "" {
+		t.Errorf("the email and client metadata must be erased, got %+v: %v", a, err)
+		t.FailNow()
+	}
+	fs, _ = NewFileStore(dir, ek) // restart
+	get, _ := fs.Get(u.Address)
+	if get == nil || !get.Anonymized() || get.UUID != u.UUID || get.Timestamp != u.Timestamp || get.Sponsor != sponsor {
+		t.Errorf("the anonymized user must keep its uuid, timestamp and sponsor, got %+v", get)
+		t.FailNow()
+	}
+	l, _ := fs.List()
+	n, _ := fs.CountBySponsor(sponsor)
+	if len(l) != 1 || n != 1 {
+		t.Errorf("the anonymized user must still count, got %v and %d referrals", l, n)
+		t.FailNow()
+	}
+	if found, _ := fs.FindByEmail(u.Email); found != nil {
+		t.Errorf("the anonymized user must not be found by its email, got %v", found)
+		t.FailNow()
+	}
+	if _, err := fs.UpdateEmail(u.Address, "jane.doe@mailservice.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("the email of an anonymized user must not be set again, got %v", err)
+		t.FailNow()
+	}
+	if _, err := fs.Anonymize(u.Address); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("a user must be anonymized once, got %v", err)
+		t.FailNow()
+	}
+	g := NewGenesisUser(solana.NewWallet().PublicKey().String())
+	fs.Save(g)
+	if _, err := fs.Anonymize(g.Address); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("a genesis user must not be anonymized, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestMemoryDBFailOn(t *testing.T) {
+	a, b := solana.NewWallet().PublicKey().String(), solana.NewWallet().PublicKey().String()
+	db := NewMemoryDB().FailOn("Save", a).FailOn("List", "")
+	if err := db.Save(&User{Address: a, Email: "john.doe@mailservice.com", Sponsor: b}); !errors.Is(err, ErrInjected) {
+		t.Errorf("the save of %s must fail, got %v", a, err)
+		t.FailNow()
+	}
+	if ok, _ := db.IsPresent(a); ok {
+		t.Error("the failed save must not be stored")
+		t.FailNow()
+	}
+	if err := db.Save(&User{Address: b, Email: "jane.doe@mailservice.com", Sponsor: a}); err != nil {
+		t.Errorf("the saves of the other addresses must succeed, got %v", err)
+		t.FailNow()
+	}
+	if _, err := db.List(); !errors.Is(err, ErrInjected) {
+		t.Errorf("the list must fail for every address, got %v", err)
+		t.FailNow()
+	}
+
+	users := []*User{
+		{Address: a, Email: "john.doe@mailservice.com", Sponsor: b},
+		{Address: solana.NewWallet().PublicKey().String(), Email: "jim.doe@mailservice.com", Sponsor: b},
+	}
+	db.FailOn("SaveBatch", a)
+	errs := db.SaveBatch(users)
+	if !errors.Is(errs[0], ErrInjected) || errs[1] != nil {
+		t.Errorf("the batch must fail for %s only, got %v", a, errs)
+		t.FailNow()
+	}
+}
+
+func TestMockDBFailNth(t *testing.T) {
+	full := errors.New("disk full")
+	db := NewMockDB().FailNth("Save", 2, nil).FailNth("Save", 3, full).Delay("Get", 20*time.Millisecond)
+	var errs []error
+	for i := 0; i < 4; i++ {
+		errs = append(errs, db.Save(NewUser(solana.NewWallet().PublicKey().String(), "john.doe@mailservice.com", solana.NewWallet().PublicKey().String())))
+	}
+	if errs[0] != nil || !errors.Is(errs[1], ErrInjected) || errs[2] != full || errs[3] != nil || db.Calls("Save") != 4 {
+		t.Errorf("the 2nd and 3rd saves must fail, got %v", errs)
+		t.FailNow()
+	}
+	start := time.Now()
+	db.Get(solana.NewWallet().PublicKey().String())
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("the get must be delayed, took %s", d)
+		t.FailNow()
+	}
+}
+
+func TestMemoryDBConcurrency(t *testing.T) {
+	db := NewMemoryDB()
+	sponsor := solana.NewWallet().PublicKey().String()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u := &User{Address: solana.NewWallet().PublicKey().String(), Email: fmt.Sprintf("john.doe+%d@mailservice.com", i), Sponsor: sponsor}
+			if err := db.Save(u); err != nil {
+				t.Errorf("cannot save the user: %v", err)
+			}
+			db.IsPresent(u.Address)
+			db.List()
+			db.ClaimReferral(sponsor, 0, 10)
+		}()
+	}
+	wg.Wait()
+	if n, _ := db.CountBySponsor(sponsor); n != 50 {
+		t.Errorf("every save must be stored, got %d users", n)
+		t.FailNow()
+	}
+	if err := db.ClaimReferral(sponsor, 0, 10); !errors.Is(err, ErrReferralLimit) {
+		t.Errorf("the referrals must be claimed atomically, got %v", err)
+		t.FailNow()
+	}
+}
+
+// countDecryptions replaces the decryptor by one counting its calls, until the end of tb.
+func countDecryptions(tb testing.TB) *int {
+	n := new(int)
+	d := decryptor
+	decryptor = func(ctext, ks, ad string) (string, error) {
+		*n++
+		return d(ctext, ks, ad)
+	}
+	tb.Cleanup(func() { decryptor = d })
+	return n
+}
+
+func TestListAddresses(t *testing.T) {
+	db := NewMemoryDB()
+	sponsor := solana.NewWallet().PublicKey().String()
+	var users []*User
+	for i := range 3 {
+		u := NewUser(solana.NewWallet().PublicKey().String(), fmt.Sprintf("user%d@domain.com", i), sponsor)
+		if err := db.Save(u); err != nil {
+			t.Errorf("cannot save the user: %v", err)
+			t.FailNow()
+		}
+		users = append(users, u)
+	}
+	db.Delete(users[2].Address)
+
+	n := countDecryptions(t)
+	m, err := db.ListAddresses()
+	if err != nil || len(m) != 2 || m[users[0].Address] != users[0].Timestamp || m[users[1].Address] != users[1].Timestamp {
+		t.Errorf("the live users must be listed by address, got %v %v", m, err)
+		t.FailNow()
+	}
+	if *n != 0 {
+		t.Errorf("no email must be decrypted, got %d decryptions", *n)
+		t.FailNow()
+	}
+}
+
+func TestDeliveries(t *testing.T) {
+	db := NewMemoryDB()
+	for i := range maxDeliveries + 1 {
+		if err := db.RecordDelivery("John.Doe@mailservice.com", Delivery{Template: "activation", Status: DeliveryFailed, Timestamp: int64(i + 1)}); err != nil {
+			t.Errorf("cannot record the delivery: %v", err)
+			t.FailNow()
+		}
+	}
+	l, err := db.Deliveries("john.doe@mailservice.com")
+	if err != nil || len(l) != maxDeliveries || l[0].Timestamp != 2 || l[maxDeliveries-1].Timestamp != maxDeliveries+1 {
+		t.Errorf("the last deliveries must be kept by normalized email, oldest first, got %d: %v", len(l), err)
+		t.FailNow()
+	}
+	if _, ok := db.s.Deliveries[EmailHash("john.doe@mailservice.com", db.ek)]; !ok || len(db.s.Deliveries) != 1 {
+		t.Errorf("the deliveries must be kept by email hash, got %v", db.s.Deliveries)
+		t.FailNow()
+	}
+	if l, err := db.Deliveries("jane.doe@mailservice.com"); err != nil || len(l) != 0 {
+		t.Errorf("no delivery must be found for another email, got %v: %v", l, err)
+		t.FailNow()
+	}
+}
+
+// benchmarkList reports the decryptions of list over a DB of 1000 users.
+func benchmarkList(b *testing.B, list func(DB) error) {
+	db := NewMemoryDB()
+	sponsor := solana.NewWallet().PublicKey().String()
+	for i := range 1000 {
+		db.Save(NewUser(solana.NewWallet().PublicKey().String(), fmt.Sprintf("user%d@domain.com", i), sponsor))
+	}
+	n := countDecryptions(b)
+	for b.Loop() {
+		if err := list(db); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(*n)/float64(b.N), "decryptions/op")
+}
+
+func BenchmarkList(b *testing.B) {
+	benchmarkList(b, func(db DB) error {
+		_, err := db.List()
+		return err
+	})
+}
+
+func BenchmarkListAddresses(b *testing.B) {
+	benchmarkList(b, func(db DB) error {
+		_, err := db.ListAddresses()
+		return err
+	})
+}
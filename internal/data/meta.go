@@ -0,0 +1,71 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// maxUserAgent bounds the user agents kept, the longer ones being truncated.
+const maxUserAgent = 256
+
+// ClientMeta is the client that activated a user, kept for fraud analysis. It is stored encrypted,
+// never carried by the tokens nor returned with the user.
+type ClientMeta struct {
+	IP        string `json:"-"` // hashed into IPHash when saved, never stored
+	IPHash    string `json:"ip_hash,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Country   string `json:"country,omitempty"` // ISO 3166-1 alpha-2 code, empty when unknown
+}
+
+// IPHash returns the keyed hash of the IP ip, so that users activated from the same IP can be found
+// without storing it.
+func IPHash(ip, k string) string {
+	m := hmac.New(sha256.New, []byte(k))
+	m.Write([]byte(ip))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// saved returns the copy of m as stored, its IP replaced by its hash keyed by k, nil when m is.
+func (m *ClientMeta) saved(k string) *ClientMeta {
+	if m == nil {
+		return nil
+	}
+	s := *m
+	if s.IP != "" {
+		s.IPHash, s.IP = IPHash(s.IP, k), ""
+	}
+	if len(s.UserAgent) > maxUserAgent {
+		s.UserAgent = s.UserAgent[:maxUserAgent]
+	}
+	return &s
+}
+
+// sealMeta returns m in JSON encrypted by encrypt, bound to the address a, empty when m is nil.
+func sealMeta(m *ClientMeta, a string, encrypt func(text, ad string) (string, error)) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return encrypt(string(b), a)
+}
+
+// openMeta returns the metadata sealed by sealMeta in s, nil when s is empty.
+func openMeta(s, a string, decrypt func(ctext, ad string) (string, error)) (*ClientMeta, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := decrypt(s, a)
+	if err != nil {
+		return nil, err
+	}
+	m := &ClientMeta{}
+	if err := json.Unmarshal([]byte(b), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
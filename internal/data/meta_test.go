@@ -0,0 +1,100 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+const userAgent = "Mozilla/5.0 (X11; Linux x86_64)"
+
+func newMetaUser() *User {
+	u := NewUser(solana.NewWallet().PublicKey().String(), "john.doe@mailservice.com", solana.NewWallet().PublicKey().String())
+	u.Meta = &ClientMeta{IP: "203.0.113.7", UserAgent: userAgent, Country: "FR"}
+	return u
+}
+
+// checkMeta fails t unless m is the client metadata of newMetaUser, as saved.
+func checkMeta(t *testing.T, m *ClientMeta) {
+	want := ClientMeta{IPHash: IPHash("203.0.113.7", ek), UserAgent: userAgent, Country: "FR"}
+	if m == nil || *m != want {
+		t.Errorf("incorrect client metadata, got %+v, want %+v", m, want)
+		t.FailNow()
+	}
+}
+
+func TestClientMetaFileStore(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := NewFileStore(dir, ek)
+	u := newMetaUser()
+	if err := db.Save(u); err != nil {
+		t.Errorf("cannot save the user: %v", err)
+		t.FailNow()
+	}
+	checkMeta(t, u.Meta)
+	b, _ := os.ReadFile(filepath.Join(dir, fileStoreName))
+	if strings.Contains(string(b), "Mozilla") || strings.Contains(string(b), "203.0.113.7") || !strings.Contains(string(b), `"meta":`) {
+		t.Errorf("the client metadata must be encrypted in the file, got %s", b)
+		t.FailNow()
+	}
+
+	db, _ = NewFileStore(dir, ek)
+	g, err := db.Get(u.Address)
+	if err != nil {
+		t.Errorf("cannot get the user: %v", err)
+		t.FailNow()
+	}
+	checkMeta(t, g.Meta)
+	if g, _ := db.UpdateEmail(u.Address, "jane.doe@mailservice.com"); g == nil {
+		t.Error("cannot update the email")
+		t.FailNow()
+	} else {
+		checkMeta(t, g.Meta)
+	}
+}
+
+func TestClientMetaDynamoDB(t *testing.T) {
+	db := &dynamoDB{ek: ek}
+	u := newMetaUser()
+	_, av, err := db.prepare(u)
+	if err != nil {
+		t.Errorf("cannot prepare the user: %v", err)
+		t.FailNow()
+	}
+	if m := av["meta"]; m == nil || m.S == nil || strings.Contains(*m.S, "Mozilla") {
+		t.Errorf("the client metadata must be stored encrypted, got %v", m)
+		t.FailNow()
+	}
+	g, err := db.user(av)
+	if err != nil {
+		t.Errorf("cannot read the user: %v", err)
+		t.FailNow()
+	}
+	checkMeta(t, g.Meta)
+
+	u.Meta = nil
+	_, av, _ = db.prepare(u)
+	if g, err := db.user(av); err != nil || g.Meta != nil || av["meta"] != nil {
+		t.Errorf("a user activated before the client metadata must have none, got %+v %v", g, err)
+		t.FailNow()
+	}
+}
+
+func TestClientMetaSaved(t *testing.T) {
+	m := (&ClientMeta{IP: "203.0.113.7", UserAgent: strings.Repeat("a", 1000)}).saved(ek)
+	if m.IP != "" || m.IPHash != IPHash("203.0.113.7", ek) || len(m.UserAgent) != maxUserAgent {
+		t.Errorf("incorrect saved metadata, got %+v", m)
+		t.FailNow()
+	}
+	if m := (&ClientMeta{UserAgent: userAgent}).saved(ek); m.IPHash != "" {
+		t.Errorf("an unknown IP must not be hashed, got %+v", m)
+		t.FailNow()
+	}
+	if (*ClientMeta)(nil).saved(ek) != nil {
+		t.Error("no metadata must stay none")
+		t.FailNow()
+	}
+}
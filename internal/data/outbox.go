@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/unleaktrade/waitlist/internal/tracing"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"  // too many attempts, given up
+	OutboxDropped = "dropped" // scheduled for a user deleted before it was due
+)
+
+var ErrOutboxNotFound = errors.New("outbox email not found")
+
+// OutboxEmail is an email waiting to be sent (or already sent) by the outbox worker.
+type OutboxEmail struct {
+	ID        string            `json:"id"`
+	Recipient string            `json:"recipient"`
+	Template  string            `json:"template"`
+	Payload   map[string]string `json:"payload,omitempty"`
+	Attempts  int               `json:"attempts"`
+	Status    string            `json:"status"`
+	CreatedAt int64             `json:"created_at"`
+	SentAt    int64             `json:"sent_at,omitempty"`
+	SendAt    int64             `json:"send_at,omitempty"` // not sent before, right away when 0
+	User      string            `json:"user,omitempty"`    // address the scheduled email is about, dropped once deleted
+	Trace     string            `json:"trace,omitempty"`   // W3C traceparent of the request enqueuing it
+}
+
+func NewOutboxEmail(recipient, template string, payload map[string]string) *OutboxEmail {
+	return &OutboxEmail{
+		ID:        uuid.New().String(),
+		Recipient: recipient,
+		Template:  template,
+		Payload:   payload,
+		Status:    OutboxPending,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+}
+
+// Schedule delays e until t for the user of address a.
+func (e *OutboxEmail) Schedule(a string, t time.Time) *OutboxEmail {
+	e.User, e.SendAt = a, t.UnixMilli()
+	return e
+}
+
+// WithTrace records the trace of ctx in e, so its delivery is a span of the request enqueuing it.
+func (e *OutboxEmail) WithTrace(ctx context.Context) *OutboxEmail {
+	e.Trace = tracing.Inject(ctx)
+	return e
+}
+
+// Due reports whether e can be sent at t.
+func (e *OutboxEmail) Due(t time.Time) bool {
+	return e.SendAt <= t.UnixMilli()
+}
+
+// Outbox persists emails so they survive restarts between the request and the delivery.
+type Outbox interface {
+	Enqueue(e *OutboxEmail) error
+	Pending() ([]*OutboxEmail, error) // oldest first
+	Update(e *OutboxEmail) error
+}
+
+// MOCK
+type mockOutbox struct {
+	mu sync.Mutex
+	m  map[string]OutboxEmail
+}
+
+func NewMockOutbox() *mockOutbox {
+	return &mockOutbox{m: make(map[string]OutboxEmail)}
+}
+
+func (o *mockOutbox) Enqueue(e *OutboxEmail) error {
+	o.mu.Lock()
+	o.m[e.ID] = *e
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *mockOutbox) Pending() ([]*OutboxEmail, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	l := []*OutboxEmail{}
+	for _, e := range o.m {
+		if e.Status == OutboxPending {
+			e := e
+			l = append(l, &e)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].CreatedAt < l[j].CreatedAt })
+	return l, nil
+}
+
+func (o *mockOutbox) Update(e *OutboxEmail) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.m[e.ID]; !ok {
+		return ErrOutboxNotFound
+	}
+	o.m[e.ID] = *e
+	return nil
+}
+
+// Get returns a copy of the stored email.
+func (o *mockOutbox) Get(id string) (OutboxEmail, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e, ok := o.m[id]
+	return e, ok
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMockOutbox(t *testing.T) {
+	o := NewMockOutbox()
+	e1 := NewOutboxEmail("john.doe@mailservice.com", "activation", map[string]string{"hash": "hA5h"})
+	e1.CreatedAt = time.Now().Add(-time.Minute).UnixMilli()
+	e2 := NewOutboxEmail("jane.doe@mailservice.com", "confirmation", nil)
+	if e1.ID == "" || e1.ID == e2.ID {
+		t.Errorf("outbox emails must have distinct ids")
+		t.FailNow()
+	}
+	o.Enqueue(e2)
+	o.Enqueue(e1)
+
+	l, _ := o.Pending()
+	if len(l) != 2 || l[0].ID != e1.ID {
+		t.Errorf("pending emails must be sorted oldest first, got %v", l)
+		t.FailNow()
+	}
+
+	e1.Status = OutboxSent
+	if err := o.Update(e1); err != nil {
+		t.Errorf("cannot update email: %v", err)
+		t.FailNow()
+	}
+	l, _ = o.Pending()
+	if len(l) != 1 || l[0].ID != e2.ID {
+		t.Errorf("sent emails cannot be pending, got %v", l)
+		t.FailNow()
+	}
+
+	if err := o.Update(NewOutboxEmail("x@y.z", "confirmation", nil)); !errors.Is(err, ErrOutboxNotFound) {
+		t.Errorf("incorrect error, got %v, want %v", err, ErrOutboxNotFound)
+		t.FailNow()
+	}
+}
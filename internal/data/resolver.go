@@ -0,0 +1,166 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/cache"
+)
+
+var (
+	ErrNameNotFound = errors.New("name not registered")
+	// ErrResolverUnavailable is wrapped by the errors of a resolution that could not complete, the name being neither found nor missing.
+	ErrResolverUnavailable = errors.New("name resolution unavailable")
+)
+
+// Resolver resolves a name, as toly.sol, to the Solana address it points to.
+type Resolver interface {
+	Resolve(name string) (string, error)
+}
+
+// SNSTimeout bounds the RPC call of a resolution.
+const SNSTimeout = 2 * time.Second
+
+var (
+	// snsProgram is the Solana Name Service program, owning the name accounts.
+	snsProgram = solana.MustPublicKeyFromBase58("namesLPneVptA9Z5rqUDD9tMTWEJwofgaYwp8cawRkX")
+	// solTLD is the name account of the .sol top-level domain, the parent of the .sol names.
+	solTLD = solana.MustPublicKeyFromBase58("58PwtjSDuFHuUkYjH9BYnnQKHfwo9reZhC2zMJv9JPkx")
+)
+
+// snsHashPrefix prefixes the names hashed into the seeds of their accounts.
+const snsHashPrefix = "SPL Name Service"
+
+// SNS resolves the .sol names of the Solana Name Service to their owner, reading their account from an RPC endpoint.
+// The resolved and the unregistered names are cached for the TTL.
+type SNS struct {
+	endpoint string
+	client   *http.Client
+	timeout  time.Duration
+	cache    *cache.Cache[string]
+}
+
+func NewSNS(endpoint string, ttl time.Duration) *SNS {
+	return newSNS(endpoint, cache.WithTTL(ttl), cache.WithNegativeTTL(ttl))
+}
+
+func newSNS(endpoint string, opts ...cache.Option) *SNS {
+	return &SNS{
+		endpoint: endpoint,
+		client:   &http.Client{},
+		timeout:  SNSTimeout,
+		cache:    cache.NewOf[string](opts...),
+	}
+}
+
+// Close stops the janitor of the cache.
+func (s *SNS) Close() {
+	s.cache.Close()
+}
+
+// snsKey returns the address of the name account of the .sol name n, without its extension.
+func snsKey(n string) (solana.PublicKey, error) {
+	h := sha256.Sum256([]byte(snsHashPrefix + n))
+	k, _, err := solana.FindProgramAddress([][]byte{h[:], make([]byte, 32), solTLD[:]}, snsProgram)
+	return k, err
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+type accountInfoResponse struct {
+	Result *struct {
+		Value *struct {
+			Data  [2]string `json:"data"`
+			Owner string    `json:"owner"`
+		} `json:"value"`
+	} `json:"result"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Resolve returns the owner of the .sol name n, ErrNameNotFound when it is not registered.
+// Only the domains are resolved, not their subdomains.
+func (s *SNS) Resolve(n string) (string, error) {
+	n = strings.ToLower(strings.TrimSpace(n))
+	if a, ok := s.cache.Get(n); ok {
+		return a, nil
+	}
+	if s.cache.IsMissing(n) {
+		return "", ErrNameNotFound
+	}
+	label, ok := strings.CutSuffix(n, ".sol")
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return "", fmt.Errorf("%w: %s is not a .sol domain", ErrNameNotFound, n)
+	}
+	a, err := s.owner(label)
+	switch {
+	case errors.Is(err, ErrNameNotFound):
+		s.cache.AddMissing(n)
+	case err == nil:
+		s.cache.Add(n, a)
+	}
+	return a, err
+}
+
+// owner reads the owner of the name account of label from the RPC endpoint.
+func (s *SNS) owner(label string) (string, error) {
+	k, err := snsKey(label)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrResolverUnavailable, err)
+	}
+	body, _ := json.Marshal(rpcRequest{"2.0", 1, "getAccountInfo", []any{k.String(), map[string]string{"encoding": "base64"}}})
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrResolverUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrResolverUnavailable, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: status %d", ErrResolverUnavailable, res.StatusCode)
+	}
+	var r accountInfoResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&r); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrResolverUnavailable, err)
+	}
+	switch {
+	case r.Error != nil:
+		return "", fmt.Errorf("%w: %d %s", ErrResolverUnavailable, r.Error.Code, r.Error.Message)
+	case r.Result == nil:
+		return "", fmt.Errorf("%w: no result", ErrResolverUnavailable)
+	case r.Result.Value == nil || r.Result.Value.Owner != snsProgram.String():
+		return "", ErrNameNotFound
+	}
+	// the header of a name account: its parent, its owner then its class
+	b, err := base64.StdEncoding.DecodeString(r.Result.Value.Data[0])
+	if err != nil || len(b) < 64 {
+		return "", fmt.Errorf("%w: malformed name account", ErrResolverUnavailable)
+	}
+	owner := solana.PublicKeyFromBytes(b[32:64])
+	if owner.IsZero() {
+		return "", ErrNameNotFound
+	}
+	return owner.String(), nil
+}
@@ -0,0 +1,145 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/unleaktrade/waitlist/internal/cache"
+)
+
+// rpcNode stubs the getAccountInfo of an RPC endpoint, the name accounts being keyed by their label.
+// It counts the calls it answers.
+func rpcNode(t *testing.T, names map[string]solana.PublicKey, calls *atomic.Int32) *httptest.Server {
+	accounts := map[string]string{}
+	for n, owner := range names {
+		k, err := snsKey(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 96)
+		copy(b[:32], solTLD[:])
+		copy(b[32:64], owner[:])
+		accounts[k.String()] = base64.StdEncoding.EncodeToString(b)
+	}
+	slow, _ := snsKey("slow")
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct {
+			Method string `json:"method"`
+			Params []any  `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "getAccountInfo" || len(req.Params) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		k, _ := req.Params[0].(string)
+		if k == slow.String() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		d, ok := accounts[k]
+		if !ok {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":1},"value":null}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": map[string]any{
+			"context": map[string]any{"slot": 1},
+			"value":   map[string]any{"data": []string{d, "base64"}, "owner": snsProgram.String()},
+		}})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSNSKey(t *testing.T) {
+	k, err := snsKey("bonfida")
+	if err != nil || k.String() != "Crf8hzfthWGbGbLTVCiqRqV5MVnbpHB1L9KQMd6gsinb" {
+		t.Errorf("incorrect name account of bonfida.sol, got %s, %v", k, err)
+		t.FailNow()
+	}
+}
+
+func TestSNS(t *testing.T) {
+	toly := solana.NewWallet().PublicKey()
+	var calls atomic.Int32
+	node := rpcNode(t, map[string]solana.PublicKey{"toly": toly}, &calls)
+	s := NewSNS(node.URL, time.Hour)
+	s.timeout = 50 * time.Millisecond
+	defer s.Close()
+	tt := []struct {
+		name, domain string
+		address      string
+		err          error
+	}{
+		{"registered", "toly.sol", toly.String(), nil},
+		{"case insensitive", "Toly.SOL", toly.String(), nil},
+		{"unregistered", "nobody.sol", "", ErrNameNotFound},
+		{"subdomain", "sub.toly.sol", "", ErrNameNotFound},
+		{"not a .sol", "toly.eth", "", ErrNameNotFound},
+		{"timeout", "slow.sol", "", ErrResolverUnavailable},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := s.Resolve(tc.domain)
+			if !errors.Is(err, tc.err) || a != tc.address {
+				t.Errorf("incorrect resolution of %s, got %q, %v, want %q, %v", tc.domain, a, err, tc.address, tc.err)
+				t.FailNow()
+			}
+		})
+	}
+
+	s = NewSNS("http://127.0.0.1:1", time.Hour)
+	defer s.Close()
+	if _, err := s.Resolve("toly.sol"); !errors.Is(err, ErrResolverUnavailable) {
+		t.Errorf("an unreachable endpoint must be unavailable, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestSNSCache(t *testing.T) {
+	toly := solana.NewWallet().PublicKey()
+	var calls atomic.Int32
+	node := rpcNode(t, map[string]solana.PublicKey{"toly": toly}, &calls)
+	now := time.Now()
+	s := newSNS(node.URL, cache.WithTTL(time.Minute), cache.WithNegativeTTL(time.Minute), cache.WithClock(func() time.Time { return now }))
+	defer s.Close()
+	s.timeout = 50 * time.Millisecond
+
+	for range 3 {
+		if a, err := s.Resolve("toly.sol"); err != nil || a != toly.String() {
+			t.Errorf("cannot resolve toly.sol, got %q, %v", a, err)
+			t.FailNow()
+		}
+		if _, err := s.Resolve("nobody.sol"); !errors.Is(err, ErrNameNotFound) {
+			t.Errorf("nobody.sol must not be found, got %v", err)
+			t.FailNow()
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("the resolutions must be cached, got %d calls", n)
+		t.FailNow()
+	}
+	if _, err := s.Resolve("slow.sol"); !errors.Is(err, ErrResolverUnavailable) {
+		t.Errorf("slow.sol must time out, got %v", err)
+		t.FailNow()
+	}
+	s.Resolve("slow.sol")
+	if n := calls.Load(); n != 4 {
+		t.Errorf("the failed resolutions must not be cached, got %d calls", n)
+		t.FailNow()
+	}
+
+	now = now.Add(time.Minute)
+	s.Resolve("toly.sol")
+	s.Resolve("nobody.sol")
+	if n := calls.Load(); n != 6 {
+		t.Errorf("the resolutions must expire after the TTL, got %d calls", n)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/unleaktrade/waitlist/internal/metrics"
+)
+
+// RetryPolicy bounds the retries of the DynamoDB calls failing on throttling or transient errors.
+type RetryPolicy struct {
+	Attempts int           // calls of an operation, the first one included
+	Backoff  time.Duration // pause before the first retry, doubled at each retry
+	Budget   time.Duration // total pause of an operation, no bound when 0
+}
+
+var DefaultRetryPolicy = RetryPolicy{Attempts: 5, Backoff: 50 * time.Millisecond, Budget: 2 * time.Second}
+
+// WithRetry retries the DynamoDB calls with p instead of the SDK retryer, counting the retries by operation in r.
+func WithRetry(p RetryPolicy, r *metrics.Registry) Option {
+	if p.Attempts < 1 {
+		p.Attempts = 1
+	}
+	return func(db *dynamoDB) {
+		db.retrier = &retrier{p, r, sleep}
+	}
+}
+
+type retrier struct {
+	p     RetryPolicy
+	r     *metrics.Registry // nil when the retries are not counted
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// sleep pauses for d, returning the error of ctx when it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// delay returns the pause before retry n (starting at 0): backoff * 2^n plus up to 50% jitter.
+func (r *retrier) delay(n int) time.Duration {
+	d := r.p.Backoff << n
+	if d <= 0 {
+		return 0
+	}
+	return d + rand.N(d/2+1)
+}
+
+// retryable reports whether err is a throttling, a server or a network error, the others failing the same on retry.
+func retryable(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	var rf awserr.RequestFailure
+	if errors.As(err, &rf) && rf.StatusCode() >= 500 {
+		return true
+	}
+	return request.IsErrorThrottle(aerr) || request.IsErrorRetryable(aerr)
+}
+
+func (r *retrier) do(ctx context.Context, op string, call func() error) error {
+	var spent time.Duration
+	for i := 0; ; i++ {
+		err := call()
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		d := r.delay(i)
+		if i == r.p.Attempts-1 || (r.p.Budget > 0 && spent+d > r.p.Budget) {
+			logger.Error("🔥 DynamoDB giving up", "op", op, "attempts", i+1, slog.Any("error", err))
+			return fmt.Errorf("DynamoDB %s: giving up after %d attempts: %w", op, i+1, err)
+		}
+		if r.r != nil {
+			r.r.Counter(fmt.Sprintf("waitlist_dynamodb_retries_total{operation=%q}", op), "DynamoDB calls retried on throttling or transient errors").Inc()
+		}
+		if err := r.sleep(ctx, d); err != nil {
+			return fmt.Errorf("DynamoDB %s: %w", op, err)
+		}
+		spent += d
+	}
+}
+
+// call retries f on in as operation op.
+func call[I, O any](ctx aws.Context, r *retrier, op string, f func(aws.Context, I, ...request.Option) (O, error), in I, opts []request.Option) (O, error) {
+	var out O
+	err := r.do(ctx, op, func() (err error) {
+		out, err = f(ctx, in, opts...)
+		return
+	})
+	return out, err
+}
+
+// retryingClient decorates a DynamoDB client, retrying the operations of the data layer,
+// page by page for the paginated ones. The calls without context are made in the background one.
+type retryingClient struct {
+	dynamodbiface.DynamoDBAPI
+	r *retrier
+}
+
+func (c *retryingClient) GetItemWithContext(ctx aws.Context, in *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return call(ctx, c.r, "GetItem", c.DynamoDBAPI.GetItemWithContext, in, opts)
+}
+
+func (c *retryingClient) GetItem(in *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return c.GetItemWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) PutItemWithContext(ctx aws.Context, in *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	return call(ctx, c.r, "PutItem", c.DynamoDBAPI.PutItemWithContext, in, opts)
+}
+
+func (c *retryingClient) PutItem(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	return c.PutItemWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) UpdateItemWithContext(ctx aws.Context, in *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	return call(ctx, c.r, "UpdateItem", c.DynamoDBAPI.UpdateItemWithContext, in, opts)
+}
+
+func (c *retryingClient) UpdateItem(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	return c.UpdateItemWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) DeleteItemWithContext(ctx aws.Context, in *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	return call(ctx, c.r, "DeleteItem", c.DynamoDBAPI.DeleteItemWithContext, in, opts)
+}
+
+func (c *retryingClient) DeleteItem(in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return c.DeleteItemWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) BatchWriteItemWithContext(ctx aws.Context, in *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	return call(ctx, c.r, "BatchWriteItem", c.DynamoDBAPI.BatchWriteItemWithContext, in, opts)
+}
+
+func (c *retryingClient) BatchWriteItem(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	return c.BatchWriteItemWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) DescribeTableWithContext(ctx aws.Context, in *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	return call(ctx, c.r, "DescribeTable", c.DynamoDBAPI.DescribeTableWithContext, in, opts)
+}
+
+func (c *retryingClient) DescribeTable(in *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	return c.DescribeTableWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) CreateTableWithContext(ctx aws.Context, in *dynamodb.CreateTableInput, opts ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	return call(ctx, c.r, "CreateTable", c.DynamoDBAPI.CreateTableWithContext, in, opts)
+}
+
+func (c *retryingClient) CreateTable(in *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	return c.CreateTableWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) ScanWithContext(ctx aws.Context, in *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	return call(ctx, c.r, "Scan", c.DynamoDBAPI.ScanWithContext, in, opts)
+}
+
+func (c *retryingClient) Scan(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	return c.ScanWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) ScanPagesWithContext(ctx aws.Context, in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	p := *in
+	for {
+		out, err := c.ScanWithContext(ctx, &p, opts...)
+		if err != nil {
+			return err
+		}
+		last := len(out.LastEvaluatedKey) == 0
+		if !fn(out, last) || last {
+			return nil
+		}
+		p.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+func (c *retryingClient) ScanPages(in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	return c.ScanPagesWithContext(aws.BackgroundContext(), in, fn)
+}
+
+func (c *retryingClient) QueryWithContext(ctx aws.Context, in *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	return call(ctx, c.r, "Query", c.DynamoDBAPI.QueryWithContext, in, opts)
+}
+
+func (c *retryingClient) Query(in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	return c.QueryWithContext(aws.BackgroundContext(), in)
+}
+
+func (c *retryingClient) QueryPagesWithContext(ctx aws.Context, in *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
+	p := *in
+	for {
+		out, err := c.QueryWithContext(ctx, &p, opts...)
+		if err != nil {
+			return err
+		}
+		last := len(out.LastEvaluatedKey) == 0
+		if !fn(out, last) || last {
+			return nil
+		}
+		p.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+func (c *retryingClient) QueryPages(in *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+	return c.QueryPagesWithContext(aws.BackgroundContext(), in, fn)
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/unleaktrade/waitlist/internal/metrics"
+)
+
+// failingStub fails its first failures calls with err, succeeding afterwards.
+type failingStub struct {
+	dynamodbiface.DynamoDBAPI
+	failures int
+	err      error
+	calls    int
+}
+
+func (s *failingStub) fail() error {
+	s.calls++
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *failingStub) GetItemWithContext(ctx aws.Context, in *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{"address": in.Key["address"]}}, nil
+}
+
+func (s *failingStub) UpdateItemWithContext(ctx aws.Context, in *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	return &dynamodb.UpdateItemOutput{}, s.fail()
+}
+
+func (s *failingStub) ScanWithContext(ctx aws.Context, in *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	if in.ExclusiveStartKey == nil {
+		return &dynamodb.ScanOutput{LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"address": {S: aws.String("a")}}}, nil
+	}
+	return &dynamodb.ScanOutput{}, nil
+}
+
+var throttled = awserr.NewRequestFailure(awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "The level of configured provisioned throughput for the table was exceeded", nil), 400, "req")
+
+// retryingDB returns a DB of s retrying with p, without pausing, and the pauses it would have made.
+func retryingDB(s dynamodbiface.DynamoDBAPI, p RetryPolicy, r *metrics.Registry) (*dynamoDB, *[]time.Duration) {
+	db, _ := NewDynamoDB(tableName, ek, withClient(s), WithRetry(p, r))
+	var pauses []time.Duration
+	db.retrier.sleep = func(ctx context.Context, d time.Duration) error {
+		pauses = append(pauses, d)
+		return ctx.Err()
+	}
+	return db, &pauses
+}
+
+func TestRetry(t *testing.T) {
+	p := RetryPolicy{Attempts: 4, Backoff: 10 * time.Millisecond}
+	tt := []struct {
+		name     string
+		failures int
+		err      error
+		calls    int
+		ok       bool
+	}{
+		{"no failure", 0, nil, 1, true},
+		{"throttled twice", 2, throttled, 3, true},
+		{"server error", 1, awserr.NewRequestFailure(awserr.New(dynamodb.ErrCodeInternalServerError, "Internal server error", nil), 500, "req"), 2, true},
+		{"network error", 1, awserr.New(request.ErrCodeRequestError, "send request failed", errors.New("connection reset by peer")), 2, true},
+		{"always throttled", 10, throttled, 4, false},
+		{"validation", 10, awserr.NewRequestFailure(awserr.New("ValidationException", "invalid key", nil), 400, "req"), 1, false},
+		{"unknown error", 10, errors.New("boom"), 1, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &failingStub{failures: tc.failures, err: tc.err}
+			r := metrics.NewRegistry()
+			db, pauses := retryingDB(s, p, r)
+			ok, err := db.IsPresent("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF")
+			if s.calls != tc.calls || ok != tc.ok || len(*pauses) != tc.calls-1 {
+				t.Errorf("incorrect retries, got %d calls, %d pauses, %v %v, want %d calls", s.calls, len(*pauses), ok, err, tc.calls)
+				t.FailNow()
+			}
+			if !tc.ok && !errors.Is(err, tc.err) {
+				t.Errorf("the error must wrap the cause, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+			for i, d := range *pauses {
+				if min := p.Backoff << i; d < min || d > min+min/2 {
+					t.Errorf("incorrect pause %d, got %v, want %v plus up to 50%%", i, d, min)
+					t.FailNow()
+				}
+			}
+			var b bytes.Buffer
+			r.WriteTo(&b)
+			if tc.calls > 1 && !strings.Contains(b.String(), fmt.Sprintf(`waitlist_dynamodb_retries_total{operation="GetItem"} %d`, tc.calls-1)) {
+				t.Errorf("the retries must be counted, got %s", b.String())
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestRetryAlwaysThrottled(t *testing.T) {
+	s := &failingStub{failures: 10, err: throttled}
+	db, _ := retryingDB(s, RetryPolicy{Attempts: 3, Backoff: time.Millisecond}, nil)
+	_, err := db.IsPresent("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF")
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) || aerr.Code() != dynamodb.ErrCodeProvisionedThroughputExceededException || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Errorf("the final error must wrap the throttling, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	s := &failingStub{failures: 10, err: throttled}
+	db, pauses := retryingDB(s, RetryPolicy{Attempts: 10, Backoff: 10 * time.Millisecond, Budget: 50 * time.Millisecond}, nil)
+	if _, err := db.IsPresent("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"); !errors.Is(err, throttled) || s.calls >= 10 {
+		t.Errorf("the retries must stop once the budget is spent, got %d calls %v", s.calls, err)
+		t.FailNow()
+	}
+	var total time.Duration
+	for _, d := range *pauses {
+		total += d
+	}
+	if total > 50*time.Millisecond {
+		t.Errorf("the pauses must fit the budget, got %v", total)
+		t.FailNow()
+	}
+}
+
+func TestRetryConditionalFailure(t *testing.T) {
+	s := &failingStub{failures: 1, err: awserr.NewRequestFailure(awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil), 400, "req")}
+	db, _ := retryingDB(s, DefaultRetryPolicy, nil)
+	if err := db.ClaimSeat(0, 10); !errors.Is(err, ErrWaitlistFull) || s.calls != 1 {
+		t.Errorf("the conditional failures must not be retried, got %d calls %v", s.calls, err)
+		t.FailNow()
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	s := &failingStub{failures: 10, err: throttled}
+	db, _ := NewDynamoDB(tableName, ek, withClient(s), WithRetry(RetryPolicy{Attempts: 5, Backoff: time.Hour}, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := db.client().GetItemWithContext(ctx, &dynamodb.GetItemInput{})
+	if !errors.Is(err, context.Canceled) || s.calls != 1 {
+		t.Errorf("the cancellation must stop the retries, got %d calls %v", s.calls, err)
+		t.FailNow()
+	}
+}
+
+func TestTracedContext(t *testing.T) {
+	s := &failingStub{failures: 10, err: throttled}
+	db, _ := NewDynamoDB(tableName, ek, withClient(s), WithRetry(RetryPolicy{Attempts: 5, Backoff: time.Hour}, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	td := Traced(ctx, db)
+	if _, err := td.Get("a"); !errors.Is(err, context.Canceled) || s.calls != 1 {
+		t.Errorf("the context of the traced calls must cancel them, got %d calls %v", s.calls, err)
+		t.FailNow()
+	}
+	if _, err := td.IsPresent("a"); !errors.Is(err, context.Canceled) || s.calls != 1 {
+		t.Errorf("the calls once the context is done must fail without calling DynamoDB, got %d calls %v", s.calls, err)
+		t.FailNow()
+	}
+	if db.ctx != nil {
+		t.Errorf("the DB must not be bound to the context of its traced calls")
+		t.FailNow()
+	}
+}
+
+func TestRetryPages(t *testing.T) {
+	s := &failingStub{failures: 1, err: throttled}
+	db, _ := retryingDB(s, DefaultRetryPolicy, nil)
+	pages := 0
+	err := db.client().ScanPages(&dynamodb.ScanInput{}, func(page *dynamodb.ScanOutput, last bool) bool {
+		pages++
+		return true
+	})
+	if err != nil || pages != 2 || s.calls != 3 {
+		t.Errorf("the pages must be retried one by one, got %d pages, %d calls %v", pages, s.calls, err)
+		t.FailNow()
+	}
+}
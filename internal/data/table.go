@@ -0,0 +1,142 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var (
+	ErrTableNotFound = errors.New("DynamoDB table not found")
+	ErrTableSchema   = errors.New("DynamoDB table does not match the schema")
+)
+
+// emailHashIndex is the global secondary index of the users by email hash, projecting all their attributes.
+const emailHashIndex = "email-hash-index"
+
+// tableIndexes are the global secondary indexes of the table, by name, with their partition key.
+var tableIndexes = map[string]string{
+	sponsorIndex:   "sponsor",
+	emailHashIndex: "email_hash",
+}
+
+// EnsureTable checks at creation that the table has the expected key schema and indexes,
+// creating it, on demand and waiting for it to be active, when create is set and it is missing.
+func EnsureTable(create bool) Option {
+	return func(db *dynamoDB) {
+		db.ensure = true
+		db.create = create
+	}
+}
+
+// ensureTable checks the schema of the table when asked by EnsureTable, creating it first when missing.
+func (db *dynamoDB) ensureTable() error {
+	if !db.ensure {
+		return nil
+	}
+	svc := db.client()
+	r, err := svc.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(db.tn)})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		if !db.create {
+			return fmt.Errorf("%w: %s", ErrTableNotFound, db.tn)
+		}
+		if _, err := svc.CreateTable(db.createTableInput()); err != nil {
+			return fmt.Errorf("cannot create DynamoDB table %s: %w", db.tn, err)
+		}
+		if err := svc.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(db.tn)}); err != nil {
+			return fmt.Errorf("DynamoDB table %s not active: %w", db.tn, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot describe DynamoDB table %s: %w", db.tn, err)
+	}
+	if l := schemaMismatches(r.Table); len(l) > 0 {
+		return fmt.Errorf("%w %s: %s", ErrTableSchema, db.tn, strings.Join(l, "; "))
+	}
+	return nil
+}
+
+// createTableInput returns the creation of the table, billed on demand, with its indexes.
+func (db *dynamoDB) createTableInput() *dynamodb.CreateTableInput {
+	attrs := []*dynamodb.AttributeDefinition{{AttributeName: aws.String("address"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}}
+	var indexes []*dynamodb.GlobalSecondaryIndex
+	for _, n := range sortedIndexes() {
+		k := tableIndexes[n]
+		attrs = append(attrs, &dynamodb.AttributeDefinition{AttributeName: aws.String(k), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)})
+		indexes = append(indexes, &dynamodb.GlobalSecondaryIndex{
+			IndexName:  aws.String(n),
+			KeySchema:  []*dynamodb.KeySchemaElement{{AttributeName: aws.String(k), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+			Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+		})
+	}
+	return &dynamodb.CreateTableInput{
+		TableName:              aws.String(db.tn),
+		AttributeDefinitions:   attrs,
+		KeySchema:              []*dynamodb.KeySchemaElement{{AttributeName: aws.String("address"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+		GlobalSecondaryIndexes: indexes,
+		BillingMode:            aws.String(dynamodb.BillingModePayPerRequest),
+	}
+}
+
+func sortedIndexes() []string {
+	l := make([]string, 0, len(tableIndexes))
+	for n := range tableIndexes {
+		l = append(l, n)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// schemaMismatches lists the differences of t with the expected schema, none when it matches.
+func schemaMismatches(t *dynamodb.TableDescription) []string {
+	types := map[string]string{}
+	for _, a := range t.AttributeDefinitions {
+		types[aws.StringValue(a.AttributeName)] = aws.StringValue(a.AttributeType)
+	}
+	var l []string
+	key := func(what string, ks []*dynamodb.KeySchemaElement, want string) {
+		if len(ks) != 1 || aws.StringValue(ks[0].KeyType) != dynamodb.KeyTypeHash || aws.StringValue(ks[0].AttributeName) != want {
+			l = append(l, fmt.Sprintf("%s key is %s, want the partition key %s", what, keySchema(ks), want))
+			return
+		}
+		if types[want] != dynamodb.ScalarAttributeTypeS {
+			l = append(l, fmt.Sprintf("%s key %s is of type %q, want S", what, want, types[want]))
+		}
+	}
+	key("table", t.KeySchema, "address")
+
+	indexes := map[string]*dynamodb.GlobalSecondaryIndexDescription{}
+	for _, i := range t.GlobalSecondaryIndexes {
+		indexes[aws.StringValue(i.IndexName)] = i
+	}
+	for _, n := range sortedIndexes() {
+		i, ok := indexes[n]
+		if !ok {
+			l = append(l, fmt.Sprintf("index %s is missing", n))
+			continue
+		}
+		key("index "+n, i.KeySchema, tableIndexes[n])
+		if p := i.Projection; p == nil || aws.StringValue(p.ProjectionType) != dynamodb.ProjectionTypeAll {
+			l = append(l, fmt.Sprintf("index %s does not project all the attributes", n))
+		}
+	}
+	return l
+}
+
+func keySchema(ks []*dynamodb.KeySchemaElement) string {
+	if len(ks) == 0 {
+		return "none"
+	}
+	l := make([]string, len(ks))
+	for i, k := range ks {
+		l[i] = fmt.Sprintf("%s (%s)", aws.StringValue(k.AttributeName), aws.StringValue(k.KeyType))
+	}
+	return strings.Join(l, ", ")
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// tableStub describes the table t, not found when nil, and records its creation.
+type tableStub struct {
+	dynamodbiface.DynamoDBAPI
+	t       *dynamodb.TableDescription
+	created *dynamodb.CreateTableInput
+	waited  bool
+}
+
+func (s *tableStub) DescribeTable(in *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	if s.t == nil {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil)
+	}
+	return &dynamodb.DescribeTableOutput{Table: s.t}, nil
+}
+
+func (s *tableStub) CreateTable(in *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	s.created = in
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (s *tableStub) WaitUntilTableExists(in *dynamodb.DescribeTableInput) error {
+	s.waited = true
+	return nil
+}
+
+// describe returns the description of the table created by in.
+func describe(in *dynamodb.CreateTableInput) *dynamodb.TableDescription {
+	t := &dynamodb.TableDescription{TableName: in.TableName, KeySchema: in.KeySchema, AttributeDefinitions: in.AttributeDefinitions}
+	for _, i := range in.GlobalSecondaryIndexes {
+		t.GlobalSecondaryIndexes = append(t.GlobalSecondaryIndexes, &dynamodb.GlobalSecondaryIndexDescription{IndexName: i.IndexName, KeySchema: i.KeySchema, Projection: i.Projection})
+	}
+	return t
+}
+
+func TestEnsureTable(t *testing.T) {
+	s := &tableStub{}
+	if _, err := NewDynamoDB(tableName, ek, withClient(s), EnsureTable(false)); !errors.Is(err, ErrTableNotFound) || s.created != nil {
+		t.Errorf("a missing table must fail without autocreation, got %v", err)
+		t.FailNow()
+	}
+
+	if _, err := NewDynamoDB(tableName, ek, withClient(s), EnsureTable(true)); err != nil || s.created == nil || !s.waited {
+		t.Errorf("a missing table must be created and waited for, got %v", err)
+		t.FailNow()
+	}
+	in := s.created
+	if aws.StringValue(in.TableName) != tableName || aws.StringValue(in.BillingMode) != dynamodb.BillingModePayPerRequest ||
+		keySchema(in.KeySchema) != "address (HASH)" || len(in.AttributeDefinitions) != 3 || len(in.GlobalSecondaryIndexes) != 2 {
+		t.Errorf("incorrect table creation, got %v", in)
+		t.FailNow()
+	}
+	for i, n := range []string{emailHashIndex, sponsorIndex} {
+		g := in.GlobalSecondaryIndexes[i]
+		if aws.StringValue(g.IndexName) != n || keySchema(g.KeySchema) != tableIndexes[n]+" (HASH)" || aws.StringValue(g.Projection.ProjectionType) != dynamodb.ProjectionTypeAll {
+			t.Errorf("incorrect index %s, got %v", n, g)
+			t.FailNow()
+		}
+	}
+
+	s = &tableStub{t: describe(in)}
+	if _, err := NewDynamoDB(tableName, ek, withClient(s), EnsureTable(true)); err != nil || s.created != nil {
+		t.Errorf("a table with the schema must be accepted, got %v", err)
+		t.FailNow()
+	}
+
+	s.t.KeySchema = []*dynamodb.KeySchemaElement{{AttributeName: aws.String("address"), KeyType: aws.String(dynamodb.KeyTypeHash)}, {AttributeName: aws.String("timestamp"), KeyType: aws.String(dynamodb.KeyTypeRange)}}
+	s.t.GlobalSecondaryIndexes = s.t.GlobalSecondaryIndexes[1:]
+	s.t.GlobalSecondaryIndexes[0].Projection = &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeKeysOnly)}
+	_, err := NewDynamoDB(tableName, ek, withClient(s), EnsureTable(true))
+	want := "table key is address (HASH), timestamp (RANGE), want the partition key address; index email-hash-index is missing; index sponsor-index does not project all the attributes"
+	if !errors.Is(err, ErrTableSchema) || !strings.HasSuffix(err.Error(), want) || s.created != nil {
+		t.Errorf("the mismatches must fail the creation, got %v, want %s", err, want)
+		t.FailNow()
+	}
+
+	if _, err := NewDynamoDB(tableName, ek, withClient(&tableStub{})); err != nil {
+		t.Errorf("the table must not be checked without EnsureTable, got %v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,344 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceable is a DB describing itself in the spans of its calls, as its system and table.
+type traceable interface {
+	traceAttributes() []attribute.KeyValue
+}
+
+func (db *dynamoDB) traceAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("db.system.name", "dynamodb"), attribute.String("db.collection.name", db.tn)}
+}
+
+func (db *store) traceAttributes() []attribute.KeyValue {
+	if db.path != "" {
+		return []attribute.KeyValue{attribute.String("db.system.name", "file")}
+	}
+	return []attribute.KeyValue{attribute.String("db.system.name", "memory")}
+}
+
+func (db mockDB) traceAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("db.system.name", "mock")}
+}
+
+// tracedDB is a DB whose calls are spans of the trace of its context.
+// The spans name the operation, never its arguments, as the emails.
+type tracedDB struct {
+	db  DB
+	ctx context.Context
+}
+
+// contextual is a DB whose calls can be cancelled, as the ones to DynamoDB.
+type contextual interface {
+	WithContext(ctx context.Context) DB
+}
+
+// Traced returns db with its calls traced as children of the span of ctx, the request they are made for.
+// They fail with the error of ctx once it is done, the calls in progress being cancelled when db supports it.
+func Traced(ctx context.Context, db DB) DB {
+	if d, ok := db.(contextual); ok {
+		db = d.WithContext(ctx)
+	}
+	return tracedDB{db, ctx}
+}
+
+// start starts the span of operation op, ended with its error by the returned function.
+func (td tracedDB) start(op string) func(err error) {
+	attrs := []attribute.KeyValue{attribute.String("db.operation.name", op)}
+	if d, ok := td.db.(traceable); ok {
+		attrs = append(attrs, d.traceAttributes()...)
+	}
+	_, span := tracing.Tracer("data").Start(td.ctx, "db."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return func(err error) { tracing.End(span, err) }
+}
+
+func (td tracedDB) Save(u *User) (err error) {
+	end := td.start("Save")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Save(u)
+}
+
+func (td tracedDB) SaveBatch(users []*User) []error {
+	end := td.start("SaveBatch")
+	defer end(nil) // the errors are by user
+	if err := td.ctx.Err(); err != nil {
+		errs := make([]error, len(users))
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	return td.db.SaveBatch(users)
+}
+
+func (td tracedDB) List(options ...int) (_ []*User, err error) {
+	end := td.start("List")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.List(options...)
+}
+
+func (td tracedDB) ListAddresses() (_ map[string]int64, err error) {
+	end := td.start("ListAddresses")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.ListAddresses()
+}
+
+func (td tracedDB) IsPresent(a string) (_ bool, err error) {
+	end := td.start("IsPresent")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.IsPresent(a)
+}
+
+func (td tracedDB) Get(a string) (_ *User, err error) {
+	end := td.start("Get")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Get(a)
+}
+
+func (td tracedDB) Delete(a string) (err error) {
+	end := td.start("Delete")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Delete(a)
+}
+
+func (td tracedDB) Restore(a string) (_ *User, err error) {
+	end := td.start("Restore")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Restore(a)
+}
+
+func (td tracedDB) Purge(before time.Time) (_ []*User, err error) {
+	end := td.start("Purge")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Purge(before)
+}
+
+func (td tracedDB) Anonymize(a string) (_ *User, err error) {
+	end := td.start("Anonymize")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Anonymize(a)
+}
+
+func (td tracedDB) FindByEmail(e string) (_ *User, err error) {
+	end := td.start("FindByEmail")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.FindByEmail(e)
+}
+
+func (td tracedDB) Suppress(e string) (err error) {
+	end := td.start("Suppress")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Suppress(e)
+}
+
+func (td tracedDB) IsSuppressed(e string) (_ bool, err error) {
+	end := td.start("IsSuppressed")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.IsSuppressed(e)
+}
+
+func (td tracedDB) UpdateEmail(a, e string) (_ *User, err error) {
+	end := td.start("UpdateEmail")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.UpdateEmail(a, e)
+}
+
+func (td tracedDB) CountBySponsor(s string) (_ int, err error) {
+	end := td.start("CountBySponsor")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.CountBySponsor(s)
+}
+
+func (td tracedDB) ListBySponsor(s string) (_ []*User, err error) {
+	end := td.start("ListBySponsor")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.ListBySponsor(s)
+}
+
+func (td tracedDB) ClaimReferral(s string, seed, max int) (err error) {
+	end := td.start("ClaimReferral")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.ClaimReferral(s, seed, max)
+}
+
+func (td tracedDB) ReleaseReferral(s string) (err error) {
+	end := td.start("ReleaseReferral")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.ReleaseReferral(s)
+}
+
+func (td tracedDB) ClaimSeat(seed, max int) (err error) {
+	end := td.start("ClaimSeat")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.ClaimSeat(seed, max)
+}
+
+func (td tracedDB) ReleaseSeat() (err error) {
+	end := td.start("ReleaseSeat")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.ReleaseSeat()
+}
+
+func (td tracedDB) CreateInvite(i *Invite) (err error) {
+	end := td.start("CreateInvite")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.CreateInvite(i)
+}
+
+func (td tracedDB) RedeemInvite(code string, t time.Time) (_ *Invite, err error) {
+	end := td.start("RedeemInvite")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.RedeemInvite(code, t)
+}
+
+func (td tracedDB) AppendEvent(e Event) (err error) {
+	end := td.start("AppendEvent")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.AppendEvent(e)
+}
+
+func (td tracedDB) ListEvents(a string, limit int) (_ []Event, err error) {
+	end := td.start("ListEvents")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.ListEvents(a, limit)
+}
+
+func (td tracedDB) AcquireLock(name, owner string, ttl time.Duration) (_ bool, err error) {
+	end := td.start("AcquireLock")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.AcquireLock(name, owner, ttl)
+}
+
+func (td tracedDB) LastDigests() (_ map[string]int64, err error) {
+	end := td.start("LastDigests")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.LastDigests()
+}
+
+func (td tracedDB) SetLastDigest(s string, t int64) (err error) {
+	end := td.start("SetLastDigest")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.SetLastDigest(s, t)
+}
+
+func (td tracedDB) Maintenance() (_ Maintenance, err error) {
+	end := td.start("Maintenance")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Maintenance()
+}
+
+func (td tracedDB) SetMaintenance(m Maintenance) (err error) {
+	end := td.start("SetMaintenance")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.SetMaintenance(m)
+}
+
+func (td tracedDB) RecordDelivery(e string, d Delivery) (err error) {
+	end := td.start("RecordDelivery")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.RecordDelivery(e, d)
+}
+
+func (td tracedDB) Deliveries(e string) (_ []Delivery, err error) {
+	end := td.start("Deliveries")
+	defer func() { end(err) }()
+	if err = td.ctx.Err(); err != nil {
+		return
+	}
+	return td.db.Deliveries(e)
+}
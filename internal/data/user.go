@@ -2,41 +2,130 @@ package data
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/mr-tron/base58"
 )
 
 type User struct {
-	Address   string `json:"address" binding:"required,solana_addr" validate:"required,solana_addr"`
-	Email     string `json:"email" binding:"required,email" validate:"required,email"`
-	UUID      string `json:"uuid,omitempty" validate:"required,uuid"`
-	Timestamp int64  `json:"timestamp,omitempty" validate:"gt=0"`
-	Sponsor   string `json:"sponsor" binding:"required,solana_addr" validate:"required,solana_addr"`
+	Address    string      `json:"address" binding:"required,solana_addr" validate:"required,solana_addr"`
+	Email      string      `json:"email" binding:"required,email" validate:"required_without=Genesis,omitempty,email"`
+	UUID       string      `json:"uuid,omitempty" validate:"required,uuid"`
+	Timestamp  int64       `json:"timestamp,omitempty" validate:"gt=0"` // of the save, as ActivatedAt, kept for the clients of the first records
+	Sponsor    string      `json:"sponsor" binding:"excluded_with=InviteCode,omitempty,solana_addr" validate:"omitempty,solana_addr"`
+	Lang       string      `json:"lang,omitempty" binding:"omitempty,oneof=en fr es" validate:"omitempty,oneof=en fr es"`
+	EmailHash  string      `json:"-" dynamodbav:"email_hash,omitempty"`                                                            // keyed hash of the normalized email
+	InviteCode string      `json:"invite_code,omitempty" binding:"omitempty,alphanum,max=32" validate:"omitempty,alphanum,max=32"` // instead of Sponsor, whose creator becomes the sponsor at activation
+	Genesis    bool        `json:"genesis,omitempty" binding:"isdefault"`                                                          // seeded sponsor, without email nor sponsor
+	Meta       *ClientMeta `json:"-" dynamodbav:"-"`                                                                               // client of the activation, stored encrypted
+	// unix ms of the registration, as the issue of the activation token, and of the activation, none for the records saved before
+	RegisteredAt int64 `json:"registered_at_ms,omitempty" dynamodbav:"registered_at,omitempty" validate:"omitempty,gt=0"`
+	ActivatedAt  int64 `json:"activated_at_ms,omitempty" dynamodbav:"activated_at,omitempty" validate:"omitempty,gtefield=RegisteredAt"`
+}
+
+// Activated returns the unix ms of the activation of u, its timestamp for the records saved without ActivatedAt.
+func (u *User) Activated() int64 {
+	if u.ActivatedAt == 0 {
+		return u.Timestamp
+	}
+	return u.ActivatedAt
+}
+
+// saved returns the user saved for u2, a new user to store for u, activated at its timestamp.
+func (u *User) saved(u2 *User) *User {
+	u2.RegisteredAt, u2.ActivatedAt = u.RegisteredAt, u2.Timestamp
+	return u2
+}
+
+// AnonymizedEmail is the tombstone replacing the email of the anonymized users.
+const AnonymizedEmail = "anonymized@erased.invalid"
+
+// Anonymized reports whether the email of u was erased, so it is neither exported nor sent anything.
+func (u *User) Anonymized() bool {
+	return u.Email == AnonymizedEmail
 }
 
 var validate = validator.New()
 
 func init() {
 	validate.RegisterValidation("solana_addr", validateSolanaAddress)
+	validate.RegisterStructValidation(requireSponsor("Sponsor", "required_without_all", "InviteCode Genesis", func(u *User) bool {
+		return u.InviteCode != "" || u.Genesis
+	}), User{})
 
 	// Register with Gin's validator
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("solana_addr", validateSolanaAddress)
+		v.RegisterStructValidation(requireSponsor("sponsor", "required_without", "InviteCode", func(u *User) bool {
+			return u.InviteCode != ""
+		}), User{})
 	}
 }
 
-func validateSolanaAddress(fl validator.FieldLevel) bool {
-	address := fl.Field().String()
-	pubkey, err := solana.PublicKeyFromBase58(address)
+// openWave accepts the users without sponsor nor invite code, set by OpenWave.
+var openWave bool
+
+// OpenWave accepts the users registered without sponsor nor invite code, for a launch wave open to all, when b is true.
+// The users saved during the wave stay without sponsor once it is closed.
+func OpenWave(b bool) {
+	openWave = b
+}
+
+// IsOpenWave reports whether the users without sponsor nor invite code are accepted.
+func IsOpenWave() bool {
+	return openWave
+}
+
+// requireSponsor returns the struct-level validation failing the users without sponsor, unless referred otherwise or in an open wave.
+// It is reported on field with rule and param, as the tag it replaces.
+func requireSponsor(field, rule, param string, referred func(u *User) bool) validator.StructLevelFunc {
+	return func(sl validator.StructLevel) {
+		u := sl.Current().Interface().(User)
+		if u.Sponsor == "" && !referred(&u) && !openWave {
+			sl.ReportError(u.Sponsor, field, "Sponsor", rule, param)
+		}
+	}
+}
+
+// Why ValidateSolanaAddress rejects an address.
+var (
+	ErrNotBase58       = errors.New("not base58")
+	ErrAddressLength   = errors.New("not 32 bytes long")
+	ErrAddressOffCurve = errors.New("not on the ed25519 curve, as a PDA")
+)
+
+// allowOffCurve accepts the addresses off the ed25519 curve, set by AllowOffCurve.
+var allowOffCurve bool
+
+// AllowOffCurve accepts the addresses off the ed25519 curve, as the PDAs of the multisigs, when b is true.
+// Their users cannot sign, so cannot prove they own them.
+func AllowOffCurve(b bool) {
+	allowOffCurve = b
+}
+
+// ValidateSolanaAddress returns why a is not a Solana address, nil when it is.
+func ValidateSolanaAddress(a string) error {
+	b, err := base58.Decode(a)
 	if err != nil {
-		return false
+		return ErrNotBase58
 	}
-	return solana.IsOnCurve(pubkey[:])
+	if len(b) != solana.PublicKeyLength {
+		return ErrAddressLength
+	}
+	if !allowOffCurve && !solana.IsOnCurve(b) {
+		return ErrAddressOffCurve
+	}
+	return nil
+}
+
+func validateSolanaAddress(fl validator.FieldLevel) bool {
+	return ValidateSolanaAddress(fl.Field().String()) == nil
 }
 
 func (u *User) Setup() {
@@ -54,27 +143,61 @@ func NewUser(a, e, s string) *User {
 	return u
 }
 
+// NewGenesisUser returns a sponsor-only user, seeded so the first users can be sponsored.
+func NewGenesisUser(a string) *User {
+	u := &User{
+		Address: a,
+		Genesis: true,
+	}
+	u.Setup()
+	return u
+}
+
 // IsValid tests if all fields are valid
 func (u *User) IsValid() bool {
 	return nil == validate.Struct(u)
 }
 
+// Validate returns the validation error of the required fields, if any
+func (u *User) Validate() error {
+	return validate.StructExcept(u, "UUID", "Timestamp", "RegisteredAt", "ActivatedAt")
+}
+
 // IsSet tests if only required fields are valid
 func (u *User) IsSet() bool {
-	err := validate.StructExcept(u, "UUID", "Timestamp")
-	if err != nil {
-		log.Print(err)
+	return nil == u.Validate()
+}
+
+// checkUser returns ErrInvalidUser, wrapping the validation error, when u is nil or not set.
+func checkUser(u *User) error {
+	if u == nil {
+		return ErrInvalidUser
+	}
+	if err := u.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUser, err)
 	}
-	return nil == err
+	return nil
 }
 
 func (u User) String() string {
 	r, _ := json.Marshal(&struct {
 		*User
-		Timestamp string `json:"timestamp"`
+		Timestamp    string `json:"timestamp"`
+		RegisteredAt string `json:"registered_at,omitempty"`
+		ActivatedAt  string `json:"activated_at,omitempty"`
 	}{
-		User:      &u,
-		Timestamp: time.UnixMilli(u.Timestamp).Format(time.RFC3339Nano),
+		User:         &u,
+		Timestamp:    time.UnixMilli(u.Timestamp).Format(time.RFC3339Nano),
+		RegisteredAt: formatMilli(u.RegisteredAt),
+		ActivatedAt:  formatMilli(u.ActivatedAt),
 	})
 	return string(r)
 }
+
+// formatMilli returns the unix ms ms in RFC 3339, none when 0.
+func formatMilli(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).Format(time.RFC3339Nano)
+}
@@ -1,7 +1,13 @@
 package data
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -76,7 +82,7 @@ func TestNewUser(t *testing.T) {
 		},
 		{"missing_email",
 			NewUser(validAddress, "", sponsor),
-			&errorDetails{"Email", "required", ""},
+			&errorDetails{"Email", "required_without", ""},
 			false, false,
 		},
 		{"invalid_sponsor",
@@ -86,7 +92,13 @@ func TestNewUser(t *testing.T) {
 		},
 		{"missing_sponsor",
 			NewUser(validAddress, "john.doemail@service.com", ""),
-			&errorDetails{"Sponsor", "required", ""},
+			&errorDetails{"Sponsor", "required_without_all", ""},
+			false, false,
+		},
+		{"genesis_user", NewGenesisUser(validAddress), nil, true, true},
+		{"invalid_genesis_user",
+			NewGenesisUser("9nagS3kGYjmCwyktyBqcAxxYy4G32vUKuCNEUdpAySPk"),
+			&errorDetails{"Address", "solana_addr", "9nagS3kGYjmCwyktyBqcAxxYy4G32vUKuCNEUdpAySPk"},
 			false, false,
 		},
 		{"missing_uuid",
@@ -142,6 +154,133 @@ func TestNewUser(t *testing.T) {
 
 }
 
+func TestValidate(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogger(logger)
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	u := NewUser("HFcC6HuJzd7uGLMJ9YqTmLYLXbBwYn43JFCwExHEBw8r", "john.doe", sponsor)
+	var ve validator.ValidationErrors
+	if err := u.Validate(); !errors.As(err, &ve) || ve[0].Field() != "Email" {
+		t.Errorf("the invalid email must fail the validation, got %v", err)
+		t.FailNow()
+	}
+	if u.IsSet() || buf.Len() != 0 {
+		t.Errorf("IsSet must fail without logging, got %q", buf.String())
+		t.FailNow()
+	}
+	if err := NewMemoryDB().Save(u); !errors.Is(err, ErrInvalidUser) || !strings.Contains(err.Error(), "Email") {
+		t.Errorf("the save must fail with the validation error, got %v", err)
+		t.FailNow()
+	}
+	if err := NewUser(u.Address, "john.doe@mailservice.com", sponsor).Validate(); err != nil {
+		t.Errorf("the valid user must pass the validation, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestValidateSolanaAddress(t *testing.T) {
+	pda := "KMRDchZ8HabAeR5kWpgw1dNkSAeFq4Db5aKS6ePo7hB" // of the system program, seeded with "waitlist"
+	tt := []struct {
+		name, address string
+		err, offCurve error // off the curve allowed
+	}{
+		{"wallet", "HFcC6HuJzd7uGLMJ9YqTmLYLXbBwYn43JFCwExHEBw8r", nil, nil},
+		{"not base58", "HFcC6HuJzd7uGLMJ9YqTmLYLXbBwYn43JFCwExHEBw0O", ErrNotBase58, ErrNotBase58},
+		{"too short", "HFcC6HuJzd7uGLMJ9YqTmLYLX", ErrAddressLength, ErrAddressLength},
+		{"too long", "HFcC6HuJzd7uGLMJ9YqTmLYLXbBwYn43JFCwExHEBw8rHFcC", ErrAddressLength, ErrAddressLength},
+		{"PDA", pda, ErrAddressOffCurve, nil},
+	}
+	defer AllowOffCurve(false)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			AllowOffCurve(false)
+			if err := ValidateSolanaAddress(tc.address); err != tc.err {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+			AllowOffCurve(true)
+			if err := ValidateSolanaAddress(tc.address); err != tc.offCurve {
+				t.Errorf("incorrect error off the curve allowed, got %v, want %v", err, tc.offCurve)
+				t.FailNow()
+			}
+		})
+	}
+
+	u := NewUser(pda, "john.doe@mailservice.com", sponsor)
+	AllowOffCurve(false)
+	if u.IsSet() {
+		t.Error("a PDA must be rejected by default")
+		t.FailNow()
+	}
+	AllowOffCurve(true)
+	if err := u.Validate(); err != nil {
+		t.Errorf("a PDA must be accepted when allowed, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestOpenWave(t *testing.T) {
+	address := "HFcC6HuJzd7uGLMJ9YqTmLYLXbBwYn43JFCwExHEBw8r"
+	sponsorless := NewUser(address, "john.doe@mailservice.com", "")
+	tt := []struct {
+		name       string
+		u          *User
+		closed     string // the field and rule failing out of an open wave, none when valid
+		open, both bool   // valid in an open wave, whatever the wave
+	}{
+		{"sponsor", NewUser(address, "john.doe@mailservice.com", sponsor), "", true, true},
+		{"no sponsor", sponsorless, "Sponsor required_without_all", true, false},
+		{"invalid sponsor", NewUser(address, "john.doe@mailservice.com", "not-an-address"), "Sponsor solana_addr", false, false},
+		{"no sponsor nor email", NewUser(address, "", ""), "Email required_without", false, false},
+		{"invite", &User{Address: address, Email: "john.doe@mailservice.com", InviteCode: "LAUNCH", UUID: sponsorless.UUID, Timestamp: 1}, "", true, true},
+		{"genesis", NewGenesisUser(address), "", true, true},
+	}
+	defer OpenWave(false)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			OpenWave(false)
+			var ve validator.ValidationErrors
+			err := tc.u.Validate()
+			switch {
+			case tc.closed == "" && err != nil:
+				t.Errorf("the user must be valid out of an open wave, got %v", err)
+				t.FailNow()
+			case tc.closed != "" && (!errors.As(err, &ve) || ve[0].Field()+" "+ve[0].Tag() != tc.closed):
+				t.Errorf("incorrect validation out of an open wave, got %v, want %v", err, tc.closed)
+				t.FailNow()
+			}
+			if tc.u.IsSet() != tc.both || tc.u.IsValid() != tc.both {
+				t.Errorf("incorrect validation out of an open wave, got %v, want %v", tc.u.IsSet(), tc.both)
+				t.FailNow()
+			}
+			OpenWave(true)
+			if tc.u.IsSet() != tc.open || tc.u.IsValid() != tc.open {
+				t.Errorf("incorrect validation in an open wave, got %v, want %v", tc.u.IsSet(), tc.open)
+				t.FailNow()
+			}
+		})
+	}
+
+	OpenWave(true)
+	db := NewMemoryDB()
+	if err := db.Save(sponsorless); err != nil {
+		t.Errorf("a user without sponsor must be saved in an open wave, got %v", err)
+		t.FailNow()
+	}
+	OpenWave(false)
+	if err := db.Save(NewUser(sponsor, "jane.doe@mailservice.com", "")); !errors.Is(err, ErrInvalidUser) {
+		t.Errorf("a user without sponsor must not be saved out of an open wave, got %v", err)
+		t.FailNow()
+	}
+	if u, err := db.Get(address); err != nil || u == nil || u.Sponsor != "" {
+		t.Errorf("the users saved in the open wave must be kept, got %v: %v", u, err)
+		t.FailNow()
+	}
+}
+
 func TestMarshalling(t *testing.T) {
 	address := "HFcC6HuJzd7uGLMJ9YqTmLYLXbBwYn43JFCwExHEBw8r"
 	email := "john.doe@mailservice.com"
@@ -190,47 +329,47 @@ func TestString(t *testing.T) {
 	}{
 		{
 			"valid_user1",
-			&User{a1, e1, id1, int64(tm1), s1},
+			&User{a1, e1, id1, int64(tm1), s1, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"0CWE15QhD8pQYhHshhKphoLAYNZxr5phFLNJnrmC6oFTy\",\"email\":\"user1@domain.com\",\"uuid\":\"4a8e9808-563e-4761-a8fa-305fef099a3e\",\"sponsor\":\"B7oeZae4KhWnbrsBYczPvU2iWhVungSdEzTBKD6pfpHo\",\"timestamp\":\"2023-05-12T18:00:20.519+02:00\"}",
 		},
 		{
 			"valid_user2",
-			&User{a2, e2, id2, int64(tm2), s2},
+			&User{a2, e2, id2, int64(tm2), s2, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"FZR973wQgXGTDg3TXDTAuuE1jNeSWgHCBZFYmF34gBTJ\",\"email\":\"user2@domain.com\",\"uuid\":\"942a5811-926d-4014-baff-ef707f38407e\",\"sponsor\":\"B4RRVRTrPoE5PmPkoRG7L3Ae7EmWkqbC6D9Zf3fx4mGH\",\"timestamp\":\"2023-05-11T14:13:10.432+02:00\"}",
 		},
 		{
 			"empty_address",
-			&User{"", e2, id2, int64(tm2), s2},
+			&User{"", e2, id2, int64(tm2), s2, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"\",\"email\":\"user2@domain.com\",\"uuid\":\"942a5811-926d-4014-baff-ef707f38407e\",\"sponsor\":\"B4RRVRTrPoE5PmPkoRG7L3Ae7EmWkqbC6D9Zf3fx4mGH\",\"timestamp\":\"2023-05-11T14:13:10.432+02:00\"}",
 		},
 		{
 			"empty_address_empty_sponsor",
-			&User{"", e2, id2, int64(tm2), ""},
+			&User{"", e2, id2, int64(tm2), "", "", "", "", false, nil, 0, 0},
 			"{\"address\":\"\",\"email\":\"user2@domain.com\",\"uuid\":\"942a5811-926d-4014-baff-ef707f38407e\",\"sponsor\":\"\",\"timestamp\":\"2023-05-11T14:13:10.432+02:00\"}",
 		},
 		{
 			"no_email",
-			&User{a2, "", id2, int64(tm2), s2},
+			&User{a2, "", id2, int64(tm2), s2, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"FZR973wQgXGTDg3TXDTAuuE1jNeSWgHCBZFYmF34gBTJ\",\"uuid\":\"942a5811-926d-4014-baff-ef707f38407e\",\"sponsor\":\"B4RRVRTrPoE5PmPkoRG7L3Ae7EmWkqbC6D9Zf3fx4mGH\",\"timestamp\":\"2023-05-11T14:13:10.432+02:00\"}",
 		},
 		{
 			"no_uuid",
-			&User{a2, e2, "", int64(tm2), s2},
+			&User{a2, e2, "", int64(tm2), s2, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"FZR973wQgXGTDg3TXDTAuuE1jNeSWgHCBZFYmF34gBTJ\",\"email\":\"user2@domain.com\",\"sponsor\":\"B4RRVRTrPoE5PmPkoRG7L3Ae7EmWkqbC6D9Zf3fx4mGH\",\"timestamp\":\"2023-05-11T14:13:10.432+02:00\"}",
 		},
 		{
 			"no_uuid_no_type",
-			&User{a2, e2, "", int64(tm2), s2},
+			&User{a2, e2, "", int64(tm2), s2, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"FZR973wQgXGTDg3TXDTAuuE1jNeSWgHCBZFYmF34gBTJ\",\"email\":\"user2@domain.com\",\"sponsor\":\"B4RRVRTrPoE5PmPkoRG7L3Ae7EmWkqbC6D9Zf3fx4mGH\",\"timestamp\":\"2023-05-11T14:13:10.432+02:00\"}",
 		},
 		{
 			"epoch_T0_no_timestamp",
-			&User{a1, e1, id1, 0, s1},
+			&User{a1, e1, id1, 0, s1, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"0CWE15QhD8pQYhHshhKphoLAYNZxr5phFLNJnrmC6oFTy\",\"email\":\"user1@domain.com\",\"uuid\":\"4a8e9808-563e-4761-a8fa-305fef099a3e\",\"sponsor\":\"B7oeZae4KhWnbrsBYczPvU2iWhVungSdEzTBKD6pfpHo\"}",
 		},
 		{
 			"epoch_T0",
-			&User{a1, e1, id1, 0, s1},
+			&User{a1, e1, id1, 0, s1, "", "", "", false, nil, 0, 0},
 			"{\"address\":\"0CWE15QhD8pQYhHshhKphoLAYNZxr5phFLNJnrmC6oFTy\",\"email\":\"user1@domain.com\",\"uuid\":\"4a8e9808-563e-4761-a8fa-305fef099a3e\",\"sponsor\":\"B7oeZae4KhWnbrsBYczPvU2iWhVungSdEzTBKD6pfpHo\",\"timestamp\":\"1970-01-01T00:00:00.000+00:00\"}",
 		},
 	}
@@ -286,3 +425,40 @@ func TestString(t *testing.T) {
 		})
 	}
 }
+
+func TestActivationTimes(t *testing.T) {
+	registered := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	u := NewUser("HFcC6HuJzd7uGLMJ9YqTmLYLXbBwYn43JFCwExHEBw8r", "john.doe@mailservice.com", sponsor)
+	u.RegisteredAt = registered.UnixMilli()
+	db := NewMemoryDB()
+	if err := db.Save(u); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := db.Get(u.Address)
+	if saved.RegisteredAt != registered.UnixMilli() || saved.ActivatedAt != saved.Timestamp || saved.Activated() != saved.ActivatedAt || !saved.IsValid() {
+		t.Errorf("the user must be saved with its registration and activation times, got %+v", saved)
+		t.FailNow()
+	}
+	if s := saved.String(); !strings.Contains(s, `"registered_at":"`+registered.Local().Format(time.RFC3339Nano)+`"`) || !strings.Contains(s, `"activated_at":"`) {
+		t.Errorf("the times must be shown in RFC 3339, got %s", s)
+		t.FailNow()
+	}
+
+	// saved before the activation times were
+	old := NewMockDBContent([]string{sponsor, u.Address})
+	o, _ := old.Get(u.Address)
+	if o.ActivatedAt != 0 || o.RegisteredAt != 0 || o.Activated() != o.Timestamp || !o.IsValid() {
+		t.Errorf("an old record must be activated at its timestamp, got %+v", o)
+		t.FailNow()
+	}
+	if s := o.String(); strings.Contains(s, "registered_at") || strings.Contains(s, "activated_at") {
+		t.Errorf("an old record must show no activation times, got %s", s)
+		t.FailNow()
+	}
+
+	saved.ActivatedAt = saved.RegisteredAt - 1
+	if saved.IsValid() {
+		t.Errorf("a user must not be activated before its registration")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+var ErrUnsupportedARN = errors.New("events ARN must be an SNS topic or an SQS queue")
+
+// SNSAPI is the part of the SNS client publishing the messages, a recording stub in the tests.
+type SNSAPI interface {
+	PublishWithContext(ctx aws.Context, in *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error)
+}
+
+// SQSAPI is the part of the SQS client sending the messages, a recording stub in the tests.
+type SQSAPI interface {
+	SendMessageWithContext(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error)
+}
+
+// SNS publishes the events to a topic.
+type SNS struct {
+	svc   SNSAPI
+	topic string // ARN
+}
+
+func NewSNS(svc SNSAPI, topic string) *SNS {
+	return &SNS{svc, topic}
+}
+
+func (p *SNS) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = p.svc.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topic),
+		Message:  aws.String(string(b)),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			TypeAttribute:    {DataType: aws.String("String"), StringValue: aws.String(e.Event)},
+			AddressAttribute: {DataType: aws.String("String"), StringValue: aws.String(e.Address)},
+		},
+	})
+	return err
+}
+
+// SQS sends the events to a queue.
+type SQS struct {
+	svc   SQSAPI
+	queue string // URL
+}
+
+func NewSQS(svc SQSAPI, queue string) *SQS {
+	return &SQS{svc, queue}
+}
+
+func (p *SQS) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = p.svc.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queue),
+		MessageBody: aws.String(string(b)),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			TypeAttribute:    {DataType: aws.String("String"), StringValue: aws.String(e.Event)},
+			AddressAttribute: {DataType: aws.String("String"), StringValue: aws.String(e.Address)},
+		},
+	})
+	return err
+}
+
+// ParseARN checks that s is the ARN of an SNS topic or an SQS queue.
+func ParseARN(s string) (arn.ARN, error) {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return a, fmt.Errorf("%w: %w", ErrUnsupportedARN, err)
+	}
+	if a.Service != sns.ServiceName && a.Service != sqs.ServiceName {
+		return a, fmt.Errorf("%w, got %s", ErrUnsupportedARN, a.Service)
+	}
+	return a, nil
+}
+
+// QueueURL returns the URL of the SQS queue a, as SQS addresses the queues.
+func QueueURL(a arn.ARN) string {
+	return fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", a.Region, a.AccountID, a.Resource)
+}
+
+// NewAWS returns the Sink to the SNS topic or the SQS queue of the ARN s, in its region.
+func NewAWS(sess *session.Session, s string) (Sink, error) {
+	a, err := ParseARN(s)
+	if err != nil {
+		return nil, err
+	}
+	cfg := aws.NewConfig().WithRegion(a.Region)
+	if a.Service == sqs.ServiceName {
+		return NewSQS(sqs.New(sess, cfg), QueueURL(a)), nil
+	}
+	return NewSNS(sns.New(sess, cfg), s), nil
+}
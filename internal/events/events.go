@@ -0,0 +1,115 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/faults"
+)
+
+// Types of the events, the webhooks delivering the activations.
+const (
+	UserActivated = "user.activated"
+	UserDeleted   = "user.deleted"
+	UserRestored  = "user.restored"
+)
+
+// SchemaVersion versions the serialization of the events, bumped when a field changes meaning or is removed.
+const SchemaVersion = 1
+
+// Attributes of the messages, for the subscriptions and the consumers to filter on.
+const (
+	TypeAttribute    = "event_type"
+	AddressAttribute = "address"
+)
+
+// Event is an event about a user, never its email, serialized in JSON by every sink and webhook.
+type Event struct {
+	SchemaVersion int    `json:"schema_version"`
+	Event         string `json:"event"`
+	Address       string `json:"address"`
+	Sponsor       string `json:"sponsor"`
+	Timestamp     int64  `json:"timestamp"` // of the event, unix ms
+	UUID          string `json:"uuid"`
+}
+
+// NewEvent returns the event e about u, happened at t.
+func NewEvent(e string, u *data.User, t time.Time) Event {
+	return Event{SchemaVersion, e, u.Address, u.Sponsor, t.UnixMilli(), u.UUID}
+}
+
+// ID identifies e among the events, for the sinks deduplicating the ones published again.
+func (e Event) ID() string {
+	return fmt.Sprintf("%s:%s:%d", e.Event, e.Address, e.Timestamp)
+}
+
+// Payload returns the outbox payload of e.
+func (e Event) Payload() map[string]string {
+	return map[string]string{
+		"schema_version": strconv.Itoa(e.SchemaVersion),
+		"event":          e.Event,
+		"address":        e.Address,
+		"sponsor":        e.Sponsor,
+		"timestamp":      strconv.FormatInt(e.Timestamp, 10),
+		"uuid":           e.UUID,
+	}
+}
+
+// EventOf returns the event of the outbox payload p, of the first schema when unversioned.
+func EventOf(p map[string]string) (Event, error) {
+	t, err := strconv.ParseInt(p["timestamp"], 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("incorrect event timestamp: %w", err)
+	}
+	v := 1
+	if s, ok := p["schema_version"]; ok {
+		if v, err = strconv.Atoi(s); err != nil {
+			return Event{}, fmt.Errorf("incorrect event schema version: %w", err)
+		}
+	}
+	return Event{v, p["event"], p["address"], p["sponsor"], t, p["uuid"]}, nil
+}
+
+// Sink publishes the events, once each unless published again after a failure.
+type Sink interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// MockSink records the events published, failing as scripted.
+type MockSink struct {
+	plan faults.Plan
+
+	mu        sync.Mutex
+	published []Event
+}
+
+func NewMockSink() *MockSink {
+	return &MockSink{}
+}
+
+// FailNth fails the nth publication with err.
+func (p *MockSink) FailNth(n int, err error) *MockSink {
+	p.plan.FailNth("Publish", n, err)
+	return p
+}
+
+func (p *MockSink) Publish(ctx context.Context, e Event) error {
+	if err := p.plan.Call("Publish", e.Address); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, e)
+	return nil
+}
+
+// Published returns the events published, in order.
+func (p *MockSink) Published() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event(nil), p.published...)
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+const (
+	topic = "arn:aws:sns:eu-west-1:123456789012:waitlist-events"
+	queue = "arn:aws:sqs:eu-west-1:123456789012:airdrop"
+)
+
+// recordingStub records the messages published to SNS and sent to SQS.
+type recordingStub struct {
+	published []*sns.PublishInput
+	sent      []*sqs.SendMessageInput
+}
+
+func (s *recordingStub) PublishWithContext(ctx aws.Context, in *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+	s.published = append(s.published, in)
+	return &sns.PublishOutput{}, nil
+}
+
+func (s *recordingStub) SendMessageWithContext(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	s.sent = append(s.sent, in)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func activated() Event {
+	u := data.NewUser("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "john.doe@mailservice.com", "9mf2bkJf5TebjCYQYq3WcK61ruHTs3bpeQwW2s6WWj3A")
+	return NewEvent(UserActivated, u, time.UnixMilli(1700000000000))
+}
+
+// checkBody fails unless body is m in JSON, without the email.
+func checkBody(t *testing.T, body string, m Event) {
+	var got Event
+	if err := json.Unmarshal([]byte(body), &got); err != nil || got != m || strings.Contains(body, "@") {
+		t.Errorf("incorrect body, got %s, want %+v", body, m)
+		t.FailNow()
+	}
+}
+
+func TestSNS(t *testing.T) {
+	s := &recordingStub{}
+	m := activated()
+	if err := NewSNS(s, topic).Publish(context.Background(), m); err != nil || len(s.published) != 1 {
+		t.Errorf("the message must be published, got %d: %v", len(s.published), err)
+		t.FailNow()
+	}
+	in := s.published[0]
+	if *in.TopicArn != topic || *in.MessageAttributes[TypeAttribute].StringValue != UserActivated || *in.MessageAttributes[AddressAttribute].StringValue != m.Address {
+		t.Errorf("incorrect publication, got %v", in)
+		t.FailNow()
+	}
+	checkBody(t, *in.Message, m)
+}
+
+func TestSQS(t *testing.T) {
+	s := &recordingStub{}
+	a, _ := ParseARN(queue)
+	m := activated()
+	if err := NewSQS(s, QueueURL(a)).Publish(context.Background(), m); err != nil || len(s.sent) != 1 {
+		t.Errorf("the message must be sent, got %d: %v", len(s.sent), err)
+		t.FailNow()
+	}
+	in := s.sent[0]
+	if *in.QueueUrl != "https://sqs.eu-west-1.amazonaws.com/123456789012/airdrop" || *in.MessageAttributes[TypeAttribute].StringValue != UserActivated || *in.MessageAttributes[AddressAttribute].StringValue != m.Address {
+		t.Errorf("incorrect message, got %v", in)
+		t.FailNow()
+	}
+	checkBody(t, *in.MessageBody, m)
+}
+
+func TestParseARN(t *testing.T) {
+	for s, ok := range map[string]bool{
+		topic:                          true,
+		queue:                          true,
+		"arn:aws:s3:::waitlist-events": false,
+		"waitlist-events":              false,
+	} {
+		if _, err := ParseARN(s); (err == nil) != ok || (err != nil && !errors.Is(err, ErrUnsupportedARN)) {
+			t.Errorf("incorrect parsing of %s, got %v", s, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	m := activated()
+	if got, err := EventOf(m.Payload()); err != nil || got != m {
+		t.Errorf("the message must survive the outbox, got %+v: %v", got, err)
+		t.FailNow()
+	}
+	if got, err := EventOf(map[string]string{"event": UserDeleted, "timestamp": "1700000000000"}); err != nil || got.SchemaVersion != 1 {
+		t.Errorf("an unversioned payload must be of the first schema, got %+v: %v", got, err)
+		t.FailNow()
+	}
+	if _, err := EventOf(map[string]string{"event": UserDeleted}); err == nil {
+		t.Errorf("a payload without timestamp must be rejected")
+		t.FailNow()
+	}
+}
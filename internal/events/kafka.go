@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaWriter is the part of the Kafka writer sending the messages, a recording stub in the tests.
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Kafka publishes the events to a topic, keyed by address so the events of a user keep their order.
+type Kafka struct {
+	w KafkaWriter
+}
+
+func NewKafka(w KafkaWriter) *Kafka {
+	return &Kafka{w}
+}
+
+// NewKafkaWriter returns the writer to topic on brokers, each event acknowledged by all the in-sync replicas.
+func NewKafkaWriter(brokers []string, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond, // one event at a time, not batched
+		WriteTimeout: 10 * time.Second,
+	}
+}
+
+func (p *Kafka) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(e.Address),
+		Value: b,
+		Headers: []kafka.Header{
+			{Key: TypeAttribute, Value: []byte(e.Event)},
+			{Key: AddressAttribute, Value: []byte(e.Address)},
+		},
+	})
+}
+
+// Close flushes the writer, then closes it.
+func (p *Kafka) Close() error {
+	return p.w.Close()
+}
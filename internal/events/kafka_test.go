@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// recordingWriter records the messages written to Kafka, failing with err.
+type recordingWriter struct {
+	written []kafka.Message
+	err     error
+	closed  bool
+}
+
+func (w *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestKafka(t *testing.T) {
+	w := &recordingWriter{}
+	p := NewKafka(w)
+	m := activated()
+	if err := p.Publish(context.Background(), m); err != nil || len(w.written) != 1 {
+		t.Errorf("the event must be written, got %d: %v", len(w.written), err)
+		t.FailNow()
+	}
+	msg := w.written[0]
+	headers := map[string]string{}
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if string(msg.Key) != m.Address || headers[TypeAttribute] != UserActivated || headers[AddressAttribute] != m.Address {
+		t.Errorf("incorrect message, got key %s and headers %v", msg.Key, headers)
+		t.FailNow()
+	}
+	checkBody(t, string(msg.Value), m)
+
+	w.err = kafka.LeaderNotAvailable
+	if err := p.Publish(context.Background(), m); !errors.Is(err, kafka.LeaderNotAvailable) {
+		t.Errorf("the failure of the writer must be returned, got %v", err)
+		t.FailNow()
+	}
+	if p.Close(); !w.closed {
+		t.Errorf("the writer must be closed with the sink")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATS publishes the events to a subject of JetStream, acknowledged once stored by the stream capturing it.
+// The events published again are deduplicated by the stream within its duplicate window.
+type NATS struct {
+	nc      *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+// NewNATS returns the Sink to subject on the NATS servers of url, connected in the background:
+// the events fail until the connection is made, then are published again from the outbox.
+func NewNATS(url, subject string) (*NATS, error) {
+	nc, err := nats.Connect(url, nats.Name("waitlist"), nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &NATS{nc, js, subject}, nil
+}
+
+func (p *NATS) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	m := nats.NewMsg(p.subject)
+	m.Data = b
+	m.Header.Set(TypeAttribute, e.Event)
+	m.Header.Set(AddressAttribute, e.Address)
+	_, err = p.js.PublishMsg(ctx, m, jetstream.WithMsgID(e.ID()))
+	return err
+}
+
+// Close flushes the connection, then closes it.
+func (p *NATS) Close() error {
+	return p.nc.Drain()
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const subject = "waitlist.events"
+
+// startNATS starts an embedded NATS server with JetStream, stopped at the end of the test.
+func startNATS(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Errorf("cannot create the NATS server: %v", err)
+		t.FailNow()
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Errorf("the NATS server must be ready")
+		t.FailNow()
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestNATS(t *testing.T) {
+	s := startNATS(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Errorf("cannot connect to the NATS server: %v", err)
+		t.FailNow()
+	}
+	defer nc.Close()
+	js, _ := jetstream.New(nc)
+	stream, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "WAITLIST", Subjects: []string{subject}})
+	if err != nil {
+		t.Errorf("cannot create the stream: %v", err)
+		t.FailNow()
+	}
+
+	p, err := NewNATS(s.ClientURL(), subject)
+	if err != nil {
+		t.Errorf("cannot create the sink: %v", err)
+		t.FailNow()
+	}
+	defer p.Close()
+	m := activated()
+	// published again by the outbox after a lost acknowledgement
+	for i := 0; i < 2; i++ {
+		if err := p.Publish(ctx, m); err != nil {
+			t.Errorf("the event must be published, got %v", err)
+			t.FailNow()
+		}
+	}
+	if info, _ := stream.Info(ctx); info.State.Msgs != 1 {
+		t.Errorf("the event published again must be deduplicated, got %d messages", info.State.Msgs)
+		t.FailNow()
+	}
+
+	msg, err := stream.GetLastMsgForSubject(ctx, subject)
+	if err != nil {
+		t.Errorf("the event must be stored, got %v", err)
+		t.FailNow()
+	}
+	if msg.Header.Get(TypeAttribute) != UserActivated || msg.Header.Get(AddressAttribute) != m.Address || msg.Header.Get(jetstream.MsgIDHeader) != m.ID() {
+		t.Errorf("incorrect headers, got %v", msg.Header)
+		t.FailNow()
+	}
+	checkBody(t, string(msg.Data), m)
+}
+
+func TestNATSWithoutStream(t *testing.T) {
+	s := startNATS(t)
+	p, err := NewNATS(s.ClientURL(), subject)
+	if err != nil {
+		t.Errorf("cannot create the sink: %v", err)
+		t.FailNow()
+	}
+	defer p.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Publish(ctx, activated()); err == nil {
+		t.Errorf("an event stored by no stream must fail, to be published again")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,80 @@
+package faults
+
+import (
+	"sync"
+	"time"
+)
+
+// Plan scripts the failures and delays of the operations of a mock, to test the retries, timeouts and shutdowns.
+// Its zero value injects nothing; it is safe for concurrent use.
+type Plan struct {
+	mu     sync.Mutex
+	calls  map[string]int              // calls by operation
+	always map[string]map[string]error // failures by operation then key, "" for every key
+	nth    map[string]map[int]error    // failures by operation then call, from 1
+	delays map[string]time.Duration    // before every call of the operation
+}
+
+// FailOn fails every call of op about key with err, every call of op when key is empty.
+func (p *Plan) FailOn(op, key string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.always == nil {
+		p.always = map[string]map[string]error{}
+	}
+	if p.always[op] == nil {
+		p.always[op] = map[string]error{}
+	}
+	p.always[op][key] = err
+}
+
+// FailNth fails the nth call of op with err, counting from 1 the calls about any key.
+func (p *Plan) FailNth(op string, n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.nth == nil {
+		p.nth = map[string]map[int]error{}
+	}
+	if p.nth[op] == nil {
+		p.nth[op] = map[int]error{}
+	}
+	p.nth[op][n] = err
+}
+
+// Delay slows every call of op by d.
+func (p *Plan) Delay(op string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.delays == nil {
+		p.delays = map[string]time.Duration{}
+	}
+	p.delays[op] = d
+}
+
+// Call records a call of op about key, then waits for its delay and returns its failure, nil when none.
+func (p *Plan) Call(op, key string) error {
+	p.mu.Lock()
+	if p.calls == nil {
+		p.calls = map[string]int{}
+	}
+	p.calls[op]++
+	n, d := p.calls[op], p.delays[op]
+	err := p.nth[op][n]
+	if err == nil {
+		if err = p.always[op][key]; err == nil {
+			err = p.always[op][""]
+		}
+	}
+	p.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d) // unlocked, the other operations go on
+	}
+	return err
+}
+
+// Calls returns the number of calls of op.
+func (p *Plan) Calls(op string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[op]
+}
@@ -0,0 +1,67 @@
+package faults
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	var p Plan
+	if err := p.Call("Save", "a"); err != nil {
+		t.Errorf("the zero plan must inject nothing, got %v", err)
+		t.FailNow()
+	}
+
+	second, always, all := errors.New("second"), errors.New("always"), errors.New("all")
+	p.FailNth("Save", 3, second)
+	p.FailOn("Get", "a", always)
+	p.FailOn("List", "", all)
+	for i, want := range []error{nil, second, nil} { // calls 2 to 4
+		if err := p.Call("Save", "b"); err != want {
+			t.Errorf("incorrect failure of call %d, got %v, want %v", i+2, err, want)
+			t.FailNow()
+		}
+	}
+	if err := p.Call("Get", "a"); err != always {
+		t.Errorf("the calls about a must fail, got %v", err)
+		t.FailNow()
+	}
+	if err := p.Call("Get", "b"); err != nil {
+		t.Errorf("the calls about the other keys must succeed, got %v", err)
+		t.FailNow()
+	}
+	if err := p.Call("List", "b"); err != all {
+		t.Errorf("the calls about every key must fail, got %v", err)
+		t.FailNow()
+	}
+	if p.Calls("Save") != 4 || p.Calls("Get") != 2 || p.Calls("Delete") != 0 {
+		t.Errorf("incorrect calls, got %d, %d and %d", p.Calls("Save"), p.Calls("Get"), p.Calls("Delete"))
+		t.FailNow()
+	}
+}
+
+func TestPlanDelay(t *testing.T) {
+	var p Plan
+	p.Delay("IsPresent", 50*time.Millisecond)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Call("IsPresent", "a")
+		}()
+	}
+	p.Call("Get", "a")
+	if d := time.Since(start); d >= 50*time.Millisecond {
+		t.Errorf("the operations not delayed must not wait, got %s", d)
+		t.FailNow()
+	}
+	wg.Wait()
+	if d := time.Since(start); d < 50*time.Millisecond || d >= 200*time.Millisecond {
+		t.Errorf("the delayed calls must wait concurrently, got %s", d)
+		t.FailNow()
+	}
+}
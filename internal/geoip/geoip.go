@@ -0,0 +1,49 @@
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Locator returns the country of an IP, as an ISO 3166-1 alpha-2 code, empty when unknown.
+type Locator interface {
+	Country(ip string) string
+}
+
+// MMDB locates the IPs with a MaxMind database, as GeoLite2-Country, memory-mapped.
+type MMDB struct {
+	r *maxminddb.Reader
+}
+
+// Open loads the MaxMind database of the file path.
+func Open(path string) (*MMDB, error) {
+	r, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDB{r}, nil
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func (m *MMDB) Country(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	var r countryRecord
+	if err := m.r.Lookup(addr, &r); err != nil {
+		return ""
+	}
+	return r.Country.ISOCode
+}
+
+// Close releases the database.
+func (m *MMDB) Close() error {
+	return m.r.Close()
+}
@@ -0,0 +1,21 @@
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Open(filepath.Join(dir, "GeoLite2-Country.mmdb")); err == nil {
+		t.Error("a missing database must not be opened")
+		t.FailNow()
+	}
+	p := filepath.Join(dir, "garbage.mmdb")
+	os.WriteFile(p, []byte("not a MaxMind database"), 0o600)
+	if _, err := Open(p); err == nil {
+		t.Error("a file not in the MaxMind format must not be opened")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Window counts the successes and failures of the last d, in n buckets.
+type Window struct {
+	mu      sync.Mutex
+	bucket  time.Duration
+	buckets []bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	i          int64 // index of the period counted, since the epoch
+	ok, failed int
+}
+
+func NewWindow(d time.Duration, n int) *Window {
+	if n < 1 {
+		n = 1
+	}
+	b := d / time.Duration(n)
+	if b <= 0 {
+		b = 1
+	}
+	return &Window{bucket: b, buckets: make([]bucket, n), now: time.Now}
+}
+
+func (w *Window) index() int64 {
+	return w.now().UnixNano() / int64(w.bucket)
+}
+
+// Record counts a success when err is nil, a failure otherwise.
+func (w *Window) Record(err error) {
+	i := w.index()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b := &w.buckets[i%int64(len(w.buckets))]
+	if b.i != i {
+		*b = bucket{i: i}
+	}
+	if err == nil {
+		b.ok++
+	} else {
+		b.failed++
+	}
+}
+
+// Counts returns the successes and failures of the window.
+func (w *Window) Counts() (ok, failed int) {
+	i := w.index()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, b := range w.buckets {
+		if b.i > i-int64(len(w.buckets)) {
+			ok += b.ok
+			failed += b.failed
+		}
+	}
+	return
+}
+
+// FailureRate returns the share of failures of the window, 0 when empty.
+func (w *Window) FailureRate() float64 {
+	ok, failed := w.Counts()
+	if ok+failed == 0 {
+		return 0
+	}
+	return float64(failed) / float64(ok+failed)
+}
+
+// Statuses of a component and of the service.
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"  // component failing too often
+	StatusDegraded = "degraded" // service up, with a failing component
+	StatusDown     = "down"     // service not usable
+)
+
+// CriticalRate is the failure rate beyond which a component is failing.
+const CriticalRate = 0.5
+
+// Monitor tracks the failures of a component over a window, logging when it starts and stops failing.
+type Monitor struct {
+	name string
+	w    *Window
+	min  int     // calls below which the rate is not significant
+	down float64 // failure rate making the service down
+
+	mu      sync.Mutex
+	failing bool
+}
+
+func NewMonitor(name string, w *Window, min int, down float64) *Monitor {
+	return &Monitor{name: name, w: w, min: min, down: down}
+}
+
+// rate returns the failure rate of the window, 0 when not significant.
+func (m *Monitor) rate() (float64, int) {
+	ok, failed := m.w.Counts()
+	if ok+failed < m.min || ok+failed == 0 {
+		return 0, ok + failed
+	}
+	return float64(failed) / float64(ok+failed), ok + failed
+}
+
+// Record counts the outcome of a call of the component.
+func (m *Monitor) Record(err error) {
+	m.w.Record(err)
+	r, n := m.rate()
+	failing := r >= CriticalRate
+	m.mu.Lock()
+	changed := failing != m.failing
+	m.failing = failing
+	m.mu.Unlock()
+	switch {
+	case changed && failing:
+		slog.Error("🚨 CRITICAL dependency failing", "name", m.name, "failure_rate", r, "calls", n)
+	case changed:
+		slog.Info("✅ dependency recovered", "name", m.name, "failure_rate", r, "calls", n)
+	}
+}
+
+// Status returns the status of the component and the one it gives to the service.
+func (m *Monitor) Status() (component, service string) {
+	r, _ := m.rate()
+	switch {
+	case m.down > 0 && r >= m.down:
+		return StatusFailing, StatusDown
+	case r >= CriticalRate:
+		return StatusFailing, StatusDegraded
+	}
+	return StatusOK, StatusOK
+}
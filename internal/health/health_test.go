@@ -0,0 +1,88 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errSend = errors.New("smtp: 535 authentication failed")
+
+// clock returns a window of d in n buckets, and a function moving its time forward.
+func clock(d time.Duration, n int) (*Window, func(time.Duration)) {
+	now := time.Now()
+	w := NewWindow(d, n)
+	w.now = func() time.Time { return now }
+	return w, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestWindow(t *testing.T) {
+	w, advance := clock(time.Minute, 6)
+	if r := w.FailureRate(); r != 0 {
+		t.Errorf("empty window must have no failure, got %v", r)
+		t.FailNow()
+	}
+	w.Record(nil)
+	w.Record(errSend)
+	advance(30 * time.Second)
+	w.Record(errSend)
+	w.Record(errSend)
+	if ok, failed := w.Counts(); ok != 1 || failed != 3 {
+		t.Errorf("incorrect counts, got %d ok, %d failed, want 1 and 3", ok, failed)
+		t.FailNow()
+	}
+	if r := w.FailureRate(); r != 0.75 {
+		t.Errorf("incorrect failure rate, got %v, want 0.75", r)
+		t.FailNow()
+	}
+
+	advance(40 * time.Second) // first calls out of the window
+	if ok, failed := w.Counts(); ok != 0 || failed != 2 {
+		t.Errorf("incorrect counts, got %d ok, %d failed, want 0 and 2", ok, failed)
+		t.FailNow()
+	}
+	advance(time.Hour) // buckets reused
+	w.Record(nil)
+	if ok, failed := w.Counts(); ok != 1 || failed != 0 {
+		t.Errorf("incorrect counts, got %d ok, %d failed, want 1 and 0", ok, failed)
+		t.FailNow()
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	w, advance := clock(time.Minute, 6)
+	m := NewMonitor("mailer", w, 4, 0.9)
+	status := func(component, service string) {
+		t.Helper()
+		if c, s := m.Status(); c != component || s != service {
+			t.Errorf("incorrect status, got %s/%s, want %s/%s", c, s, component, service)
+			t.FailNow()
+		}
+	}
+
+	status(StatusOK, StatusOK)
+	for i := 0; i < 3; i++ {
+		m.Record(errSend)
+	}
+	status(StatusOK, StatusOK) // not enough calls to tell
+	m.Record(nil)
+	status(StatusFailing, StatusDegraded) // 75%
+	for i := 0; i < 6; i++ {
+		m.Record(errSend)
+	}
+	status(StatusFailing, StatusDown) // 90%
+	if !m.failing {
+		t.Errorf("monitor must be failing")
+		t.FailNow()
+	}
+
+	advance(2 * time.Minute)
+	for i := 0; i < 4; i++ {
+		m.Record(nil)
+	}
+	status(StatusOK, StatusOK)
+	if m.failing {
+		t.Errorf("monitor must have recovered")
+		t.FailNow()
+	}
+}
@@ -1,15 +1,51 @@
 package limiter
 
 import (
+	"io"
+	"log/slog"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 )
 
+// logger is the logger of the limiters, replaced by SetLogger.
+var logger = slog.Default()
+
+// SetLogger replaces the logger of the limiters by l.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// Allower allows an access, or not when limited.
+type Allower interface {
+	Allow() bool
+}
+
+// Limiter limits the accesses by key, as the IP of the client.
+type Limiter interface {
+	GetAccess(key string) Allower
+	Cleanup(t time.Duration) // drops the keys not accessed for t
+	Snapshot(w io.Writer) error
+	Restore(r io.Reader, ttl time.Duration) error
+	Len() int              // keys tracked
+	TopN(n int) []KeyStats // the n keys with the most accesses
+}
+
 type Access struct {
+	rl      *RateLimiter
 	lat     time.Time //last access tieme
 	limiter *rate.Limiter
+	counts
+}
+
+// Allow takes a token of the bucket of the key, counting the access.
+func (a *Access) Allow() bool {
+	ok := a.limiter.Allow()
+	a.rl.Lock()
+	a.count(ok)
+	a.rl.Unlock()
+	return ok
 }
 
 type RateLimiter struct {
@@ -31,31 +67,50 @@ func NewUnlimited() *RateLimiter {
 	return New(rate.Inf, 0)
 }
 
-func (rl *RateLimiter) GetAccess(ip string) *rate.Limiter {
+func (rl *RateLimiter) GetAccess(ip string) Allower {
 	rl.Lock()
 	defer rl.Unlock()
 
 	a, ok := rl.access[ip]
 	if !ok {
-		l := rate.NewLimiter(rl.limit, rl.burst)
-		rl.access[ip] = &Access{
+		a = &Access{
+			rl:      rl,
 			lat:     time.Now(),
-			limiter: l,
+			limiter: rate.NewLimiter(rl.limit, rl.burst),
 		}
-		return l
+		rl.access[ip] = a
+		return a
 	}
 	a.lat = time.Now()
-	return a.limiter
+	return a
 }
 
 func (rl *RateLimiter) Cleanup(t time.Duration) {
 	rl.Lock()
 	defer rl.Unlock()
 
+	n := len(rl.access)
 	for ip, a := range rl.access {
 		if time.Since(a.lat) > t {
 			delete(rl.access, ip)
 		}
 	}
+	logger.Debug("rate limiter cleaned up", "dropped", n-len(rl.access), "keys", len(rl.access))
+}
 
+func (rl *RateLimiter) Len() int {
+	rl.Lock()
+	defer rl.Unlock()
+	return len(rl.access)
+}
+
+func (rl *RateLimiter) TopN(n int) []KeyStats {
+	rl.Lock()
+	defer rl.Unlock()
+
+	l := make([]KeyStats, 0, len(rl.access))
+	for ip, a := range rl.access {
+		l = append(l, a.stats(ip))
+	}
+	return top(l, n)
 }
@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindow allows n accesses per key over any rolling window, without the bursts of the token buckets.
+// The times of the last n accesses of a key are kept in a ring, so its memory is bounded.
+type SlidingWindow struct {
+	n      int
+	window time.Duration
+	keys   map[string]*window
+	now    func() time.Time
+	sync.Mutex
+}
+
+// window is the ring of the last accesses allowed to a key, unix nanos.
+type window struct {
+	sw    *SlidingWindow
+	times []int64
+	next  int   // oldest access once the ring is full
+	lat   int64 // last access time
+	counts
+}
+
+func NewSlidingWindow(n int, d time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		n:      n,
+		window: d,
+		keys:   make(map[string]*window),
+		now:    time.Now,
+	}
+}
+
+func (sw *SlidingWindow) GetAccess(key string) Allower {
+	sw.Lock()
+	defer sw.Unlock()
+
+	now := sw.now().UnixNano()
+	w, ok := sw.keys[key]
+	if !ok {
+		w = &window{sw: sw, times: make([]int64, 0, sw.n)}
+		sw.keys[key] = w
+	}
+	w.lat = now
+	return w
+}
+
+// Allow records the access when fewer than n were allowed over the last window, the denied ones are not counted.
+func (w *window) Allow() bool {
+	w.sw.Lock()
+	defer w.sw.Unlock()
+
+	ok := w.allow(w.sw.now().UnixNano())
+	w.count(ok)
+	return ok
+}
+
+func (w *window) allow(now int64) bool {
+	if len(w.times) < w.sw.n {
+		w.times = append(w.times, now)
+		return true
+	}
+	if w.sw.n == 0 || now-w.times[w.next] < int64(w.sw.window) {
+		return false
+	}
+	w.times[w.next] = now
+	w.next = (w.next + 1) % w.sw.n
+	return true
+}
+
+func (sw *SlidingWindow) Cleanup(t time.Duration) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	now, n := sw.now().UnixNano(), len(sw.keys)
+	for key, w := range sw.keys {
+		if now-w.lat > int64(t) {
+			delete(sw.keys, key)
+		}
+	}
+	logger.Debug("sliding window cleaned up", "dropped", n-len(sw.keys), "keys", len(sw.keys))
+}
+
+func (sw *SlidingWindow) Len() int {
+	sw.Lock()
+	defer sw.Unlock()
+	return len(sw.keys)
+}
+
+func (sw *SlidingWindow) TopN(n int) []KeyStats {
+	sw.Lock()
+	defer sw.Unlock()
+
+	l := make([]KeyStats, 0, len(sw.keys))
+	for key, w := range sw.keys {
+		l = append(l, w.stats(key))
+	}
+	return top(l, n)
+}
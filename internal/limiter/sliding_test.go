@@ -0,0 +1,128 @@
+package limiter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ Limiter = NewSlidingWindow(1, time.Minute)
+var _ Limiter = New(1, 1)
+
+func TestSlidingWindow(t *testing.T) {
+	ip := "10.10.10.10"
+	now := time.Now()
+	sw := NewSlidingWindow(3, time.Minute)
+	sw.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !sw.GetAccess(ip).Allow() {
+			t.Errorf("access %d within the limit must be allowed", i)
+			t.FailNow()
+		}
+		now = now.Add(10 * time.Second)
+	}
+	if sw.GetAccess(ip).Allow() {
+		t.Error("the access over the limit must be denied")
+		t.FailNow()
+	}
+	if !sw.GetAccess("10.10.10.11").Allow() {
+		t.Error("the keys must be limited independently")
+		t.FailNow()
+	}
+
+	now = now.Add(29 * time.Second) // 59s after the first access
+	if sw.GetAccess(ip).Allow() {
+		t.Error("the window must be rolling, without any burst")
+		t.FailNow()
+	}
+	now = now.Add(time.Second)
+	if !sw.GetAccess(ip).Allow() {
+		t.Error("the access must be allowed once the first one left the window")
+		t.FailNow()
+	}
+	if sw.GetAccess(ip).Allow() {
+		t.Error("only the access leaving the window must be replaced")
+		t.FailNow()
+	}
+	if w := sw.keys[ip]; len(w.times) != 3 || cap(w.times) != 3 {
+		t.Errorf("the accesses kept must be bounded by the limit, got %d", cap(w.times))
+		t.FailNow()
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !sw.GetAccess(ip).Allow() {
+			t.Errorf("access %d must be allowed once the window is over", i)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSlidingWindowCleanup(t *testing.T) {
+	now := time.Now()
+	sw := NewSlidingWindow(3, time.Minute)
+	sw.now = func() time.Time { return now }
+	sw.GetAccess("10.10.10.10").Allow()
+	now = now.Add(5 * time.Minute)
+	sw.GetAccess("10.10.10.11").Allow()
+
+	sw.Cleanup(time.Minute)
+	if _, ok := sw.keys["10.10.10.10"]; ok {
+		t.Error("the idle key must be dropped")
+		t.FailNow()
+	}
+	if _, ok := sw.keys["10.10.10.11"]; !ok {
+		t.Error("the active key must be kept")
+		t.FailNow()
+	}
+}
+
+func TestSlidingWindowConcurrency(t *testing.T) {
+	sw := NewSlidingWindow(10, time.Minute)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sw.GetAccess("10.10.10.10").Allow() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 10 {
+		t.Errorf("incorrect allowed accesses, got %d, want %d", allowed, 10)
+		t.FailNow()
+	}
+}
+
+// benchmarkLimiter accesses 10k keys concurrently.
+func benchmarkLimiter(b *testing.B, l Limiter) {
+	const n = 10_000
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			l.GetAccess(keys[i%n]).Allow()
+			i++
+		}
+	})
+}
+
+func BenchmarkTokenBucket(b *testing.B) {
+	benchmarkLimiter(b, New(1, 10))
+}
+
+func BenchmarkSlidingWindow(b *testing.B) {
+	benchmarkLimiter(b, NewSlidingWindow(10, 10*time.Second))
+}
@@ -0,0 +1,120 @@
+package limiter
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// snapshotVersion is bumped when the encoding of the snapshots changes.
+const snapshotVersion = 1
+
+var ErrInvalidSnapshot = errors.New("invalid limiter snapshot")
+
+type snapshot struct {
+	Version int
+	Time    int64 // unix nanos
+	Entries map[string]entry
+}
+
+// entry is the state of a key.
+type entry struct {
+	LastAccess int64   // unix nanos
+	Tokens     float64 // left in a token bucket at the time of the snapshot
+	Times      []int64 // of the accesses allowed by a sliding window, oldest first
+}
+
+// decode returns the snapshot written to r, failing with ErrInvalidSnapshot.
+func decode(r io.Reader) (*snapshot, error) {
+	var s snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, ErrInvalidSnapshot
+	}
+	return &s, nil
+}
+
+// Snapshot writes the tokens left to each key and its last access to w.
+func (rl *RateLimiter) Snapshot(w io.Writer) error {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := time.Now()
+	s := snapshot{snapshotVersion, now.UnixNano(), make(map[string]entry, len(rl.access))}
+	for ip, a := range rl.access {
+		s.Entries[ip] = entry{LastAccess: a.lat.UnixNano(), Tokens: a.limiter.TokensAt(now)}
+	}
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// Restore adds the keys of a snapshot written by Snapshot, but those not accessed for ttl.
+// The tokens consumed are rounded up, and refilled since the snapshot.
+// The limiter is left untouched when the snapshot cannot be decoded.
+func (rl *RateLimiter) Restore(r io.Reader, ttl time.Duration) error {
+	s, err := decode(r)
+	if err != nil {
+		return err
+	}
+	rl.Lock()
+	defer rl.Unlock()
+
+	now, at := time.Now(), time.Unix(0, s.Time)
+	for ip, e := range s.Entries {
+		lat := time.Unix(0, e.LastAccess)
+		if now.Sub(lat) > ttl {
+			continue
+		}
+		l := rate.NewLimiter(rl.limit, rl.burst)
+		if n := min(int(math.Ceil(float64(rl.burst)-e.Tokens)), rl.burst); n > 0 {
+			l.AllowN(at, n)
+		}
+		rl.access[ip] = &Access{rl: rl, lat: lat, limiter: l}
+	}
+	return nil
+}
+
+// Snapshot writes the accesses allowed to each key and its last access to w.
+func (sw *SlidingWindow) Snapshot(w io.Writer) error {
+	sw.Lock()
+	defer sw.Unlock()
+
+	s := snapshot{snapshotVersion, sw.now().UnixNano(), make(map[string]entry, len(sw.keys))}
+	for key, win := range sw.keys {
+		times := make([]int64, 0, len(win.times))
+		times = append(times, win.times[win.next:]...)
+		times = append(times, win.times[:win.next]...)
+		s.Entries[key] = entry{LastAccess: win.lat, Times: times}
+	}
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// Restore adds the keys of a snapshot written by Snapshot, but those not accessed for ttl,
+// keeping their last n accesses.
+// The limiter is left untouched when the snapshot cannot be decoded.
+func (sw *SlidingWindow) Restore(r io.Reader, ttl time.Duration) error {
+	s, err := decode(r)
+	if err != nil {
+		return err
+	}
+	sw.Lock()
+	defer sw.Unlock()
+
+	now := sw.now().UnixNano()
+	for key, e := range s.Entries {
+		if now-e.LastAccess > int64(ttl) {
+			continue
+		}
+		times := e.Times[max(len(e.Times)-sw.n, 0):]
+		w := &window{sw: sw, times: make([]int64, len(times), sw.n), lat: e.LastAccess}
+		copy(w.times, times) // oldest first, so next is 0
+		sw.keys[key] = w
+	}
+	return nil
+}
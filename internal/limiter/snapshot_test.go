@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestSnapshotRestart(t *testing.T) {
+	ip, other := "10.10.10.10", "10.10.10.11"
+	tt := []struct {
+		name string
+		new  func() Limiter
+	}{
+		{"token bucket", func() Limiter { return New(rate.Every(time.Hour), 3) }},
+		{"sliding window", func() Limiter { return NewSlidingWindow(3, time.Hour) }},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l := tc.new()
+			for i := 0; i < 3; i++ {
+				l.GetAccess(ip).Allow()
+			}
+			if l.GetAccess(ip).Allow() {
+				t.Error("the key must be throttled before the restart")
+				t.FailNow()
+			}
+			l.GetAccess(other).Allow()
+
+			var b bytes.Buffer
+			if err := l.Snapshot(&b); err != nil {
+				t.Errorf("cannot snapshot the limiter: %v", err)
+				t.FailNow()
+			}
+			restarted := tc.new()
+			if err := restarted.Restore(&b, 10*time.Minute); err != nil {
+				t.Errorf("cannot restore the limiter: %v", err)
+				t.FailNow()
+			}
+			if restarted.GetAccess(ip).Allow() {
+				t.Error("the key throttled before the restart must remain throttled")
+				t.FailNow()
+			}
+			for i := 0; i < 2; i++ {
+				if !restarted.GetAccess(other).Allow() {
+					t.Errorf("access %d left to the other key must be allowed", i)
+					t.FailNow()
+				}
+			}
+			if restarted.GetAccess(other).Allow() {
+				t.Error("the accesses of the other key must be restored")
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestSnapshotTTL(t *testing.T) {
+	ip := "10.10.10.10"
+	l := New(rate.Every(time.Hour), 1)
+	l.GetAccess(ip).Allow()
+	l.access[ip].lat = time.Now().Add(-time.Hour) // idle
+	var b bytes.Buffer
+	l.Snapshot(&b)
+
+	restarted := New(rate.Every(time.Hour), 1)
+	restarted.Restore(&b, 10*time.Minute)
+	if _, ok := restarted.access[ip]; ok {
+		t.Error("the keys idle for longer than the TTL must be discarded")
+		t.FailNow()
+	}
+
+	now := time.Now()
+	sw := NewSlidingWindow(1, time.Hour)
+	sw.now = func() time.Time { return now }
+	sw.GetAccess(ip).Allow()
+	b.Reset()
+	sw.Snapshot(&b)
+	now = now.Add(time.Hour)
+	sw.keys = map[string]*window{}
+	sw.Restore(&b, 10*time.Minute)
+	if _, ok := sw.keys[ip]; ok {
+		t.Error("the keys idle for longer than the TTL must be discarded")
+		t.FailNow()
+	}
+}
+
+func TestSnapshotSmallerWindow(t *testing.T) {
+	ip := "10.10.10.10"
+	now := time.Now()
+	sw := NewSlidingWindow(5, time.Hour)
+	sw.now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		sw.GetAccess(ip).Allow()
+		now = now.Add(time.Minute)
+	}
+	var b bytes.Buffer
+	sw.Snapshot(&b)
+
+	restarted := NewSlidingWindow(2, time.Hour) // limit lowered by the deploy
+	restarted.now = sw.now
+	restarted.Restore(&b, 10*time.Minute)
+	if w := restarted.keys[ip]; len(w.times) != 2 || cap(w.times) != 2 {
+		t.Errorf("the accesses kept must be bounded by the new limit, got %v", w.times)
+		t.FailNow()
+	}
+	if restarted.GetAccess(ip).Allow() {
+		t.Error("the key must remain throttled")
+		t.FailNow()
+	}
+}
+
+func TestSnapshotCorrupted(t *testing.T) {
+	for _, l := range []Limiter{NewUnlimited(), NewSlidingWindow(1, time.Minute)} {
+		if err := l.Restore(bytes.NewReader([]byte("garbage")), time.Minute); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("Restore must fail with %v, got %v", ErrInvalidSnapshot, err)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package limiter
+
+import "sort"
+
+// KeyStats is the use of a key since it is tracked, its counters dropped with it by Cleanup.
+type KeyStats struct {
+	Key     string `json:"key"`
+	Allowed int64  `json:"allowed"`
+	Denied  int64  `json:"denied"`
+}
+
+// counts are the accesses of a key, updated under the lock of its limiter.
+type counts struct {
+	allowed, denied int64
+}
+
+func (c *counts) count(ok bool) {
+	if ok {
+		c.allowed++
+	} else {
+		c.denied++
+	}
+}
+
+func (c *counts) stats(key string) KeyStats {
+	return KeyStats{key, c.allowed, c.denied}
+}
+
+// top returns the n stats of l with the most accesses, the denied ones first on a tie, then by key.
+func top(l []KeyStats, n int) []KeyStats {
+	sort.Slice(l, func(i, j int) bool {
+		ti, tj := l[i].Allowed+l[i].Denied, l[j].Allowed+l[j].Denied
+		switch {
+		case ti != tj:
+			return ti > tj
+		case l[i].Denied != l[j].Denied:
+			return l[i].Denied > l[j].Denied
+		}
+		return l[i].Key < l[j].Key
+	})
+	return l[:min(max(n, 0), len(l))]
+}
@@ -0,0 +1,88 @@
+package limiter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTopN(t *testing.T) {
+	for name, l := range map[string]Limiter{
+		"token bucket":   New(0.001, 2),
+		"sliding window": NewSlidingWindow(2, time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for i, n := range []int{5, 1, 3} {
+				for j := 0; j < n; j++ {
+					l.GetAccess(fmt.Sprintf("10.10.10.%d", i)).Allow()
+				}
+			}
+			if l.Len() != 3 {
+				t.Errorf("incorrect keys, got %d, want %d", l.Len(), 3)
+				t.FailNow()
+			}
+			got := l.TopN(2)
+			want := []KeyStats{{"10.10.10.0", 2, 3}, {"10.10.10.2", 2, 1}}
+			if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+				t.Errorf("incorrect top keys, got %v, want %v", got, want)
+				t.FailNow()
+			}
+			if got := l.TopN(10); len(got) != 3 {
+				t.Errorf("the top keys must be bounded by the keys tracked, got %v", got)
+				t.FailNow()
+			}
+			if got := l.TopN(0); len(got) != 0 {
+				t.Errorf("no key must be returned for n=0, got %v", got)
+				t.FailNow()
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			l.Cleanup(time.Millisecond)
+			if l.Len() != 0 || len(l.TopN(10)) != 0 {
+				t.Errorf("the counters must be dropped with the keys, got %v", l.TopN(10))
+				t.FailNow()
+			}
+			if !l.GetAccess("10.10.10.0").Allow() || l.TopN(1)[0] != (KeyStats{"10.10.10.0", 1, 0}) {
+				t.Errorf("a key tracked again must count from zero, got %v", l.TopN(1))
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestTopNConcurrency(t *testing.T) {
+	for name, l := range map[string]Limiter{
+		"token bucket":   New(0.001, 10),
+		"sliding window": NewSlidingWindow(10, time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					l.GetAccess(fmt.Sprintf("10.10.10.%d", i%4)).Allow()
+				}()
+				go func() {
+					defer wg.Done()
+					l.TopN(2)
+					l.Len()
+					if i%10 == 0 {
+						l.Cleanup(time.Hour)
+					}
+				}()
+			}
+			wg.Wait()
+			var allowed, denied int64
+			for _, s := range l.TopN(4) {
+				allowed += s.Allowed
+				denied += s.Denied
+			}
+			if allowed != 40 || denied != 60 {
+				t.Errorf("incorrect counters, got %d allowed and %d denied, want 40 and 60", allowed, denied)
+				t.FailNow()
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// Dispatcher runs the email jobs on a fixed number of workers, so bursts of
+// registrations never open more than n connections to the mail provider.
+type Dispatcher struct {
+	jobs    chan task
+	wg      *sync.WaitGroup
+	workers sync.WaitGroup
+	ctx     context.Context // given to the jobs, done when they are abandoned
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	closed  bool
+	next    uint64
+	pending map[uint64]string // names of the jobs queued or running
+}
+
+type task struct {
+	id   uint64
+	name string
+	job  func(ctx context.Context)
+}
+
+// NewDispatcher starts n workers consuming a queue of size jobs.
+// The workers are tracked by wg, which is done once Close is called and the queue is drained.
+func NewDispatcher(n, size int, wg *sync.WaitGroup) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		jobs:    make(chan task, size),
+		wg:      wg,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(map[uint64]string),
+	}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		d.workers.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	defer d.workers.Done()
+	for t := range d.jobs {
+		if d.ctx.Err() != nil {
+			continue // abandoned, left pending
+		}
+		d.run(t)
+	}
+}
+
+// run runs the job of t, a panic failing the job only, not the worker and the wait group tracking it.
+func (d *Dispatcher) run(t task) {
+	defer func() {
+		if v := recover(); v != nil {
+			logger.Error("🔥 mail job panicked", "job", t.name, "panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+		}
+		d.mu.Lock()
+		delete(d.pending, t.id)
+		d.mu.Unlock()
+	}()
+	t.job(d.ctx)
+}
+
+// Submit queues the job named name without blocking the caller.
+// It returns false and the job is dropped when the queue is full or the dispatcher closed.
+// The job should return early once its context is done, when Shutdown gives up on it.
+func (d *Dispatcher) Submit(name string, job func(ctx context.Context)) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		logger.Warn("⚠️ mail dispatcher is closed, job dropped", "job", name)
+		return false
+	}
+	d.next++
+	select {
+	case d.jobs <- task{d.next, name, job}:
+		d.pending[d.next] = name
+		return true
+	default:
+		logger.Warn("⚠️ mail queue is full, job dropped", "job", name, "capacity", cap(d.jobs))
+		return false
+	}
+}
+
+// Len returns the number of jobs waiting for a worker.
+func (d *Dispatcher) Len() int {
+	return len(d.jobs)
+}
+
+// Close stops accepting jobs, the workers exit once the queued jobs are done.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.closed = true
+		close(d.jobs)
+	}
+}
+
+// Shutdown closes the dispatcher and waits for the queued jobs until ctx is done.
+// Then the jobs left are abandoned: the running ones see their context done, the queued ones are skipped.
+// It returns the sorted names of the abandoned jobs.
+func (d *Dispatcher) Shutdown(ctx context.Context) []string {
+	d.Close()
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	d.cancel()
+	names := make([]string, 0, len(d.pending))
+	for _, n := range d.pending {
+		names = append(names, n)
+	}
+	d.mu.Unlock()
+	sort.Strings(names)
+	return names
+}
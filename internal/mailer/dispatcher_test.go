@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingMailer records the maximum number of concurrent sends.
+type countingMailer struct {
+	cur, max atomic.Int64
+	sent     atomic.Int64
+}
+
+func (m *countingMailer) send() error {
+	c := m.cur.Add(1)
+	for {
+		x := m.max.Load()
+		if c <= x || m.max.CompareAndSwap(x, c) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	m.cur.Add(-1)
+	m.sent.Add(1)
+	return nil
+}
+
+func (m *countingMailer) SendActivationEmail(e, u, h, uu, l string) error    { return m.send() }
+func (m *countingMailer) SendConfirmationEmail(e, l string) error            { return m.send() }
+func (m *countingMailer) SendWelcomeEmail(e, r, l string) error              { return m.send() }
+func (m *countingMailer) SendDigestEmail(e string, d Digest, l string) error { return m.send() }
+
+func TestDispatcherConcurrency(t *testing.T) {
+	const workers, jobs = 3, 30
+	var wg sync.WaitGroup
+	m := &countingMailer{}
+	d := NewDispatcher(workers, jobs, &wg)
+	for i := 0; i < jobs; i++ {
+		if !d.Submit("confirmation", func(context.Context) { m.SendConfirmationEmail(email, DefaultLang) }) {
+			t.Errorf("job %d should be queued", i)
+			t.FailNow()
+		}
+	}
+	d.Close()
+	wg.Wait()
+
+	if s := m.sent.Load(); s != jobs {
+		t.Errorf("all queued jobs must be done before wg is released, got %d, want %d", s, jobs)
+		t.FailNow()
+	}
+	if x := m.max.Load(); x > workers {
+		t.Errorf("too many concurrent sends, got %d, want at most %d", x, workers)
+		t.FailNow()
+	}
+}
+
+func TestDispatcherFull(t *testing.T) {
+	var wg sync.WaitGroup
+	d := NewDispatcher(1, 1, &wg)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.Submit("busy", func(context.Context) { close(started); <-release })
+	<-started // the worker is busy
+
+	if !d.Submit("noop", func(context.Context) {}) {
+		t.Errorf("job should be queued")
+		t.FailNow()
+	}
+	if d.Len() != 1 {
+		t.Errorf("incorrect queue depth, got %d, want 1", d.Len())
+		t.FailNow()
+	}
+	if d.Submit("noop", func(context.Context) {}) {
+		t.Errorf("job should be dropped when the queue is full")
+		t.FailNow()
+	}
+
+	close(release)
+	d.Close()
+	wg.Wait()
+	if d.Submit("noop", func(context.Context) {}) {
+		t.Errorf("job should be dropped when the dispatcher is closed")
+		t.FailNow()
+	}
+}
+
+func TestDispatcherShutdown(t *testing.T) {
+	var wg sync.WaitGroup
+	d := NewDispatcher(1, 10, &wg)
+	d.Submit("fast", func(context.Context) {})
+	if names := d.Shutdown(context.Background()); len(names) != 0 {
+		t.Errorf("no job must be abandoned when drained in time, got %v", names)
+		t.FailNow()
+	}
+	wg.Wait()
+
+	d = NewDispatcher(1, 10, &wg)
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	d.Submit("slow", func(ctx context.Context) { close(started); <-ctx.Done(); close(cancelled) })
+	d.Submit("queued", func(context.Context) { t.Errorf("an abandoned job must not run") })
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	names := d.Shutdown(ctx)
+	if len(names) != 2 || names[0] != "queued" || names[1] != "slow" {
+		t.Errorf("incorrect abandoned jobs, got %v, want [queued slow]", names)
+		t.FailNow()
+	}
+	<-cancelled // the running job sees its context done
+	wg.Wait()
+}
+
+func TestDispatcherPanic(t *testing.T) {
+	var wg sync.WaitGroup
+	var done atomic.Int64
+	d := NewDispatcher(1, 10, &wg)
+	d.Submit("boom", func(context.Context) { panic("boom") })
+	for i := 0; i < 3; i++ {
+		d.Submit("confirmation", func(context.Context) { done.Add(1) })
+	}
+	d.Close()
+	wg.Wait() // released although a job panicked
+
+	if n := done.Load(); n != 3 {
+		t.Errorf("the jobs after a panic must be done, got %d, want 3", n)
+		t.FailNow()
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("the panicked job must not be left pending, got %v", d.pending)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// logMailerSize is the number of rendered emails kept in memory by the LogMailer.
+const logMailerSize = 50
+
+// Rendered is an email rendered but not delivered.
+type Rendered struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Text    string    `json:"text"`
+	HTML    string    `json:"html"`
+	Date    time.Time `json:"date"`
+}
+
+// Recorder gives access to the last rendered emails.
+type Recorder interface {
+	Recent(n int) []Rendered
+}
+
+// LogMailer never sends emails, it writes them to the log and, when dir is set, as .eml files.
+type LogMailer struct {
+	base
+	dir string
+
+	mu   sync.Mutex
+	seq  int
+	last []Rendered // most recent last
+}
+
+func NewLog(dir string) *LogMailer {
+	m := &LogMailer{dir: dir}
+	m.base = newBase(m.write)
+	return m
+}
+
+func (m *LogMailer) write(msg *message) (string, error) {
+	raw, err := msg.mime()
+	if err != nil {
+		return "", err
+	}
+	logger.Info("📝 email not sent (log mode)", slog.String("message", string(raw)))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	r := Rendered{msg.to, msg.subject, string(msg.text), string(msg.html), time.Now()}
+	m.last = append(m.last, r)
+	if len(m.last) > logMailerSize {
+		m.last = m.last[len(m.last)-logMailerSize:]
+	}
+
+	if m.dir != "" {
+		n := filepath.Join(m.dir, fmt.Sprintf("%s-%04d.eml", r.Date.Format("20060102-150405"), m.seq))
+		if err := os.WriteFile(n, raw, 0o600); err != nil {
+			return "", err
+		}
+	}
+	return msg.id, nil
+}
+
+// Recent returns the last n rendered emails, most recent first.
+func (m *LogMailer) Recent(n int) []Rendered {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n <= 0 || n > len(m.last) {
+		n = len(m.last)
+	}
+	l := make([]Rendered, 0, n)
+	for i := len(m.last) - 1; i >= len(m.last)-n; i-- {
+		l = append(l, m.last[i])
+	}
+	return l
+}
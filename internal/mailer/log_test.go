@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := NewLog(dir)
+	url := "https://unleak.trade/activate/" + token
+	if err := m.SendActivationEmail(email, url, hash, unsubscribe, DefaultLang); err != nil {
+		t.Errorf("cannot send activation email: %v", err)
+		t.FailNow()
+	}
+	if err := m.SendConfirmationEmail(email, DefaultLang); err != nil {
+		t.Errorf("cannot send confirmation email: %v", err)
+		t.FailNow()
+	}
+
+	l := m.Recent(10)
+	if len(l) != 2 {
+		t.Errorf("incorrect number of emails, got %d, want 2", len(l))
+		t.FailNow()
+	}
+	if !strings.Contains(l[1].Text, url) || !strings.Contains(l[1].HTML, url) || l[1].To != email {
+		t.Errorf("activation email must contain the activation url %q", url)
+		t.FailNow()
+	}
+	if l[0].Subject != "All set — you’re officially on the waitlist" {
+		t.Errorf("most recent email must be first, got %q", l[0].Subject)
+		t.FailNow()
+	}
+	if l := m.Recent(1); len(l) != 1 {
+		t.Errorf("incorrect number of emails, got %d, want 1", len(l))
+		t.FailNow()
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Errorf("incorrect number of .eml files, got %d, want 2", len(files))
+		t.FailNow()
+	}
+	b, _ := os.ReadFile(files[0])
+	if _, p := parts(t, b); !strings.Contains(p["text/plain"], url) {
+		t.Errorf(".eml file must contain the activation url %q", url)
+		t.FailNow()
+	}
+}
+
+func TestLogMailerSize(t *testing.T) {
+	m := NewLog("") // log only
+	for i := 0; i < logMailerSize+5; i++ {
+		m.SendConfirmationEmail(email, DefaultLang)
+	}
+	if l := m.Recent(0); len(l) != logMailerSize {
+		t.Errorf("incorrect number of emails kept, got %d, want %d", len(l), logMailerSize)
+		t.FailNow()
+	}
+}
@@ -3,19 +3,205 @@ package mailer
 import (
 	"bytes"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
+	"log/slog"
+	"net/mail"
 	"net/smtp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
 	"time"
-)
 
-const (
-	headers = "MIME-Version: 1.0\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+	"github.com/google/uuid"
+	"github.com/unleaktrade/waitlist/internal/faults"
 )
 
+// logger is the logger of the mailers, replaced by SetLogger.
+var logger = slog.Default()
+
+// SetLogger replaces the logger of the mailers by l.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// sender is the From address of every email
+const sender = "julien@unleak.trade"
+
+// Mailer sends the emails in language l, falling back to DefaultLang for missing translations.
 type Mailer interface {
-	SendActivationEmail(e, u, h string) error
-	SendConfirmationEmail(e string) error
+	SendActivationEmail(e, u, h, uu, l string) error
+	SendConfirmationEmail(e, l string) error
+	SendWelcomeEmail(e, r, l string) error // r is the referral link of the user
+	SendDigestEmail(e string, d Digest, l string) error
+}
+
+// SendResult is the outcome of a send, MessageID identifying the message at the provider once accepted.
+type SendResult struct {
+	MessageID string
+	Err       error
+}
+
+// ResultMailer is a Mailer also returning the SendResult of its sends, for their deliveries to be tracked.
+type ResultMailer interface {
+	Mailer
+	SendActivationEmailResult(e, u, h, uu, l string) SendResult
+	SendConfirmationEmailResult(e, l string) SendResult
+	SendWelcomeEmailResult(e, r, l string) SendResult
+	SendDigestEmailResult(e string, d Digest, l string) SendResult
+}
+
+const DefaultLang = "en"
+
+//go:embed templates
+var tfs embed.FS
+
+type templates struct {
+	t  *template.Template     // html parts
+	tt *texttemplate.Template // plain text fallbacks
+}
+
+func newTemplates() *templates {
+	return &templates{
+		template.Must(template.ParseFS(tfs, "templates/*.html", "templates/*/*.html")),
+		texttemplate.Must(texttemplate.ParseFS(tfs, "templates/*.txt", "templates/*/*.txt")),
+	}
+}
+
+// localized returns the name of the translation of template n in language l, or n when missing.
+// Translations are defined as n+"."+l in templates/<l>/.
+func localized(n, l string, lookup func(string) bool) string {
+	if l == "" || l == DefaultLang || !lookup(n+"."+l) {
+		return n
+	}
+	return n + "." + l
+}
+
+// message is a rendered email, independent of the provider delivering it
+type message struct {
+	id            string // Message-ID header, the message ID of the providers not giving their own
+	from, replyTo *mail.Address
+	to, subject   string
+	text, html    []byte
+}
+
+// mime returns the complete MIME encoding of the message.
+func (m *message) mime() ([]byte, error) {
+	return buildMessage(m.id, m.from, m.replyTo, m.to, m.subject, m.text, m.html)
+}
+
+// base implements ResultMailer for every provider, which only needs to deliver the rendered messages,
+// returning the ID given to the message.
+type base struct {
+	*templates
+	opts    *settings
+	deliver func(m *message) (string, error)
+}
+
+func newBase(deliver func(m *message) (string, error)) base {
+	return base{newTemplates(), defaultSettings, deliver}
+}
+
+// message renders template n (html) and n+"Text" (plain text) in language l.
+func (b *base) message(e, s, n, l string, data any) (*message, error) {
+	var html, text bytes.Buffer
+	hn := localized(n, l, func(n string) bool { return b.t.Lookup(n) != nil })
+	if err := b.t.ExecuteTemplate(&html, hn, data); err != nil {
+		return nil, err
+	}
+	tn := localized(n+"Text", l, func(n string) bool { return b.tt.Lookup(n) != nil })
+	if err := b.tt.ExecuteTemplate(&text, tn, data); err != nil {
+		return nil, err
+	}
+	return &message{messageID(b.opts.from), b.opts.from, b.opts.replyTo, e, s, text.Bytes(), html.Bytes()}, nil
+}
+
+// messageID returns a new Message-ID in the domain of from.
+func messageID(from *mail.Address) string {
+	_, domain, _ := strings.Cut(from.Address, "@")
+	return "<" + uuid.NewString() + "@" + domain + ">"
+}
+
+// send renders template n in language l with its configured subject and delivers it.
+func (b *base) send(e, n, l string, data any) SendResult {
+	s, err := b.opts.subject(n, l)
+	if err != nil {
+		return SendResult{Err: err}
+	}
+	m, err := b.message(e, s, n, l, data)
+	if err != nil {
+		return SendResult{Err: err}
+	}
+	id, err := b.deliver(m)
+	return SendResult{id, err}
+}
+
+// activation is the data of the activation templates, UnsubscribeUrl being optional.
+type activation struct {
+	Hash           string
+	Url            string
+	UnsubscribeUrl string
+}
+
+func (b *base) SendActivationEmail(e, u, h, uu, l string) error {
+	return b.SendActivationEmailResult(e, u, h, uu, l).Err
+}
+
+func (b *base) SendActivationEmailResult(e, u, h, uu, l string) (r SendResult) {
+	r = b.send(e, "emailActivation", l,
+		activation{
+			Hash:           h,
+			Url:            u,
+			UnsubscribeUrl: uu,
+		})
+	logEmailSent(e, "emailActivation", r.Err)
+	return
+}
+
+func (b *base) SendConfirmationEmail(e, l string) error {
+	return b.SendConfirmationEmailResult(e, l).Err
+}
+
+func (b *base) SendConfirmationEmailResult(e, l string) (r SendResult) {
+	r = b.send(e, "emailConfirmation", l,
+		struct{}{})
+	logEmailSent(e, "emailConfirmation", r.Err)
+	return
+}
+
+// welcome is the data of the welcome templates.
+type welcome struct {
+	ReferralUrl string
+}
+
+func (b *base) SendWelcomeEmail(e, r, l string) error {
+	return b.SendWelcomeEmailResult(e, r, l).Err
+}
+
+func (b *base) SendWelcomeEmailResult(e, ref, l string) (r SendResult) {
+	r = b.send(e, "emailWelcome", l, welcome{ref})
+	logEmailSent(e, "emailWelcome", r.Err)
+	return
+}
+
+// Digest is the data of the digest templates, the referrals of a sponsor since its last digest.
+type Digest struct {
+	New         int // referrals since the last digest
+	Total       int // referrals since the activation
+	Position    int // of the sponsor in the waitlist
+	ReferralUrl string
+}
+
+func (b *base) SendDigestEmail(e string, d Digest, l string) error {
+	return b.SendDigestEmailResult(e, d, l).Err
+}
+
+func (b *base) SendDigestEmailResult(e string, d Digest, l string) (r SendResult) {
+	r = b.send(e, "emailDigest", l, d)
+	logEmailSent(e, "emailDigest", r.Err)
+	return
 }
 
 type smtpConfig struct {
@@ -28,92 +214,198 @@ type smtpConfig struct {
 
 type SmtpMailer struct {
 	*smtpConfig
-	t *template.Template
+	base
 }
 
-//go:embed templates/*.html
-var tfs embed.FS
-
 func New(from, password, host string, port int) *SmtpMailer {
-	t := template.Must(template.ParseFS(tfs, "templates/*"))
-	return &SmtpMailer{&smtpConfig{
+	m := &SmtpMailer{smtpConfig: &smtpConfig{
 		from:     from,
 		password: password,
 		host:     host,
 		port:     port,
 		server:   fmt.Sprintf("%s:%d", host, port),
-	}, t}
+	}}
+	m.base = newBase(m.sendMail)
+	return m
 }
 
-func sendEmail(m *SmtpMailer, e, s, n string, data any) (err error) {
-	to := []string{e}
+// render builds the complete MIME message of template n (html) and n+"Text" (plain text).
+func (m *SmtpMailer) render(e, s, n string, data any) ([]byte, error) {
+	msg, err := m.message(e, s, n, DefaultLang, data)
+	if err != nil {
+		return nil, err
+	}
+	return msg.mime()
+}
+
+// sendMail makes a single delivery attempt, retries are done by the Retrying decorator.
+// The server does not give its queue ID, the message is identified by its Message-ID.
+func (m *SmtpMailer) sendMail(msg *message) (string, error) {
 	auth := smtp.PlainAuth("", m.from, m.password, m.host)
 
-	var body bytes.Buffer
-	body.Write([]byte(fmt.Sprintf(`From: %s
-To: %s
-Subject: %s
-%s
-`, "julien@unleak.trade",
-		e,
-		s,
-		headers)))
-
-	m.t.ExecuteTemplate(&body, n, data)
-
-	fmt.Println("Sending email...")
-	r := 3
-	for i := 0; i < r; i++ {
-		err = smtp.SendMail(m.server, auth, "julien@unleak.trade", to, body.Bytes())
-		if nil == err {
-			break
-		}
-		fmt.Printf("failed %d/%d, retrying in 500ms...\n", i+1, r)
-		time.Sleep(500 * time.Millisecond)
+	body, err := msg.mime()
+	if err != nil {
+		return "", err
 	}
-	return
+
+	logger.Debug("sending email", "server", m.server)
+	return msg.id, smtp.SendMail(m.server, auth, msg.from.Address, []string{msg.to}, body)
+}
+
+// logEmailSent logs the outcome of sending template t to e, whose local part is redacted.
+func logEmailSent(e, t string, err error) {
+	if err != nil {
+		logger.Warn("⚠️ email not sent", "template", t, "email", redact(e), slog.Any("error", err))
+		return
+	}
+	logger.Info("💌 email sent", "template", t, "email", redact(e))
+}
+
+// MOCK
+var ErrMockSend = errors.New("🔥 mock mailer failure")
+
+// Call is a send attempted on the mock mailer, with its arguments in the order of its method.
+type Call struct {
+	Method string
+	Args   []string
+	Err    error
+}
+
+type mockSmtpMailer struct {
+	failures int64 // number of calls failing before sends succeed, < 0 to always fail
+	calls    atomic.Int64
+	plan     faults.Plan // failures and delays by method
+
+	once    sync.Once
+	b       base
+	mu      sync.Mutex
+	last    *message // last message sent
+	history []Call
+}
+
+// NewMockSmtpMailer returns a mock failing the first n sends (all of them when n < 0).
+func NewMockSmtpMailer(n int) *mockSmtpMailer {
+	return &mockSmtpMailer{failures: int64(n)}
+}
+
+// FailOn makes every call of the method, as SendActivationEmail, fail with err.
+func (m *mockSmtpMailer) FailOn(method string, err error) *mockSmtpMailer {
+	m.plan.FailOn(method, "", err)
+	return m
+}
+
+// FailNth makes the nth call of the method, counted from 1, fail with err, ErrMockSend when nil.
+func (m *mockSmtpMailer) FailNth(method string, n int, err error) *mockSmtpMailer {
+	if err == nil {
+		err = ErrMockSend
+	}
+	m.plan.FailNth(method, n, err)
+	return m
+}
+
+// Delay slows every call of the method by d.
+func (m *mockSmtpMailer) Delay(method string, d time.Duration) *mockSmtpMailer {
+	m.plan.Delay(method, d)
+	return m
 }
 
-func (m *SmtpMailer) SendActivationEmail(e, u, h string) (err error) {
-	err = sendEmail(m, e, "Confirm your email to join the UnleakTrade waitlist", "emailActivation",
-		struct {
-			Hash string
-			Url  string
-		}{
-			Hash: h,
-			Url:  u,
+// call records the call of method with args, delayed and failing as planned, then as the first failures.
+func (m *mockSmtpMailer) call(method string, args ...string) error {
+	c := m.calls.Add(1)
+	err := m.plan.Call(method, "")
+	if err == nil && (m.failures < 0 || c <= m.failures) {
+		err = ErrMockSend
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = append(m.history, Call{method, args, err})
+	return err
+}
+
+// capture renders the message like a real provider but keeps it instead of delivering it.
+func (m *mockSmtpMailer) capture(e, n, l string, data any) SendResult {
+	m.once.Do(func() {
+		m.b = newBase(func(msg *message) (string, error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.last = msg
+			return msg.id, nil
 		})
-	logEmailSent(e, fmt.Sprintf("💌 Email to %q: [ \033[1;32mSent\033[0m ]\n🧬 Hash: %s\n", e, h), err)
-	return
+	})
+	return m.b.send(e, n, l, data)
 }
 
-func (m *SmtpMailer) SendConfirmationEmail(e string) (err error) {
-	err = sendEmail(m, e, "All set — you’re officially on the waitlist", "emailConfirmation",
-		struct{}{})
-	logEmailSent(e, fmt.Sprintf("💌 Email to %q: [ \033[1;32mSent\033[0m ]\n", e), err)
+// Calls returns the number of send attempts.
+func (m *mockSmtpMailer) Calls() int {
+	return int(m.calls.Load())
+}
+
+// History returns the calls in the order they were made, failed ones included.
+func (m *mockSmtpMailer) History() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call{}, m.history...)
+}
+
+// Last returns the recipient, subject and plain text body of the last message sent.
+func (m *mockSmtpMailer) Last() (to, subject, body string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last == nil {
+		return
+	}
+	return m.last.to, m.last.subject, string(m.last.text)
+}
+
+func (m *mockSmtpMailer) SendActivationEmail(e, u, h, uu, l string) error {
+	return m.SendActivationEmailResult(e, u, h, uu, l).Err
+}
+
+func (m *mockSmtpMailer) SendActivationEmailResult(e, u, h, uu, l string) (r SendResult) {
+	// do nothing just log
+	if r.Err = m.call("SendActivationEmail", e, u, h, uu, l); r.Err == nil {
+		r = m.capture(e, "emailActivation", l, activation{h, u, uu})
+	}
+	logEmailSent(e, "emailActivation", r.Err)
 	return
 }
 
-func logEmailSent(e, m string, err error) {
-	if err != nil {
-		fmt.Printf("Error sending email to %q: %v", e, err)
-	} else {
-		fmt.Print(m)
+func (m *mockSmtpMailer) SendConfirmationEmail(e, l string) error {
+	return m.SendConfirmationEmailResult(e, l).Err
+}
+
+func (m *mockSmtpMailer) SendConfirmationEmailResult(e, l string) (r SendResult) {
+	// do nothing just log
+	if r.Err = m.call("SendConfirmationEmail", e, l); r.Err == nil {
+		r = m.capture(e, "emailConfirmation", l, struct{}{})
 	}
+	logEmailSent(e, "emailConfirmation", r.Err)
+	return
 }
 
-// MOCK
-type mockSmtpMailer struct{}
+func (m *mockSmtpMailer) SendWelcomeEmail(e, r, l string) error {
+	return m.SendWelcomeEmailResult(e, r, l).Err
+}
 
-func (m *mockSmtpMailer) SendActivationEmail(e, u, h string) (err error) {
+func (m *mockSmtpMailer) SendWelcomeEmailResult(e, ref, l string) (r SendResult) {
 	// do nothing just log
-	logEmailSent(e, "📧 Activation Email Sent !!!", err)
+	if r.Err = m.call("SendWelcomeEmail", e, ref, l); r.Err == nil {
+		r = m.capture(e, "emailWelcome", l, welcome{ref})
+	}
+	logEmailSent(e, "emailWelcome", r.Err)
 	return
 }
 
-func (m *mockSmtpMailer) SendConfirmationEmail(e string) (err error) {
+func (m *mockSmtpMailer) SendDigestEmail(e string, d Digest, l string) error {
+	return m.SendDigestEmailResult(e, d, l).Err
+}
+
+func (m *mockSmtpMailer) SendDigestEmailResult(e string, d Digest, l string) (r SendResult) {
 	// do nothing just log
-	logEmailSent(e, "📧 Confirmation Email Sent !!!", err)
+	if r.Err = m.call("SendDigestEmail", e, l); r.Err == nil {
+		r = m.capture(e, "emailDigest", l, d)
+	}
+	logEmailSent(e, "emailDigest", r.Err)
 	return
 }
 
@@ -1,18 +1,21 @@
 package mailer
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 )
 
 const (
-	host     = "smtp.mailtrap.io"
-	port     = 2525
-	tmplPath = "templates/**"
-	email    = "john.doe@domain.com"
-	token    = "T0k3n"
-	hash     = "hA5h"
+	host        = "smtp.mailtrap.io"
+	port        = 2525
+	tmplPath    = "templates/**"
+	email       = "john.doe@domain.com"
+	token       = "T0k3n"
+	hash        = "hA5h"
+	unsubscribe = "https://unleak.trade/unsubscribe/T0k3n"
 )
 
 var (
@@ -34,7 +37,7 @@ func TestNewMailer(t *testing.T) {
 
 func TestSendActivationEmail(t *testing.T) {
 	m := New(from, password, host, port)
-	if err := m.SendActivationEmail(email, fmt.Sprintf("https://unleak.trade/activate/%s", token), hash); err != nil {
+	if err := m.SendActivationEmail(email, fmt.Sprintf("https://unleak.trade/activate/%s", token), hash, unsubscribe, DefaultLang); err != nil {
 		t.Errorf("error sending activation email : %v", err)
 		t.FailNow()
 	}
@@ -42,8 +45,54 @@ func TestSendActivationEmail(t *testing.T) {
 
 func TestSendConfirmationEmail(t *testing.T) {
 	m := New(from, password, host, port)
-	if err := m.SendConfirmationEmail(email); err != nil {
+	if err := m.SendConfirmationEmail(email, DefaultLang); err != nil {
 		t.Errorf("error sending confirmation email : %v", err)
 		t.FailNow()
 	}
 }
+
+func TestMockSmtpMailerPlan(t *testing.T) {
+	bounced := errors.New("550 mailbox unavailable")
+	m := NewMockSmtpMailer(0).FailNth("SendConfirmationEmail", 2, nil).FailOn("SendWelcomeEmail", bounced)
+	m.SendConfirmationEmail(email, DefaultLang)
+	m.SendConfirmationEmail("jane.doe@domain.com", "fr")
+	m.SendActivationEmail(email, "https://unleak.trade/activate/"+token, hash, unsubscribe, DefaultLang)
+	m.SendWelcomeEmail(email, "https://unleak.trade/?sponsor=s", DefaultLang)
+
+	h := m.History()
+	want := []struct {
+		method, to string
+		err        error
+	}{
+		{"SendConfirmationEmail", email, nil},
+		{"SendConfirmationEmail", "jane.doe@domain.com", ErrMockSend},
+		{"SendActivationEmail", email, nil},
+		{"SendWelcomeEmail", email, bounced},
+	}
+	if len(h) != len(want) || m.Calls() != len(want) {
+		t.Errorf("incorrect history, got %v", h)
+		t.FailNow()
+	}
+	for i, w := range want {
+		if h[i].Method != w.method || h[i].Args[0] != w.to || !errors.Is(h[i].Err, w.err) {
+			t.Errorf("incorrect call %d, got %+v, want %+v", i, h[i], w)
+			t.FailNow()
+		}
+	}
+	if h[1].Args[1] != "fr" || h[2].Args[2] != hash {
+		t.Errorf("the arguments must be recorded, got %v and %v", h[1].Args, h[2].Args)
+		t.FailNow()
+	}
+	if to, _, _ := m.Last(); to != email {
+		t.Errorf("the failed sends must not be captured, got %s", to)
+		t.FailNow()
+	}
+
+	m = NewMockSmtpMailer(0).Delay("SendDigestEmail", 50*time.Millisecond)
+	start := time.Now()
+	m.SendDigestEmail(email, Digest{}, DefaultLang)
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("the send must be delayed, took %s", d)
+		t.FailNow()
+	}
+}
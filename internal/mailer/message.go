@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"time"
+)
+
+// buildMessage assembles a multipart/alternative email (text first, html last as preferred part),
+// each part being quoted-printable encoded, with the Message-ID id unless empty.
+func buildMessage(id string, from, replyTo *mail.Address, to, subject string, text, html []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	if replyTo != nil {
+		fmt.Fprintf(&b, "Reply-To: %s\r\n", replyTo)
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if id != "" {
+		fmt.Fprintf(&b, "Message-ID: %s\r\n", id)
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", w.Boundary())
+
+	for _, p := range []struct {
+		ct   string
+		body []byte
+	}{
+		{"text/plain; charset=\"UTF-8\"", text},
+		{"text/html; charset=\"UTF-8\"", html},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.ct},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write(p.body); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
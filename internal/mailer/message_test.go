@@ -0,0 +1,161 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// parts parses a rendered message and returns the decoded body of each part indexed by media type.
+func parts(t *testing.T, msg []byte) (*mail.Message, map[string]string) {
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Errorf("cannot parse message: %v", err)
+		t.FailNow()
+	}
+	mt, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Errorf("cannot parse Content-Type: %v", err)
+		t.FailNow()
+	}
+	if mt != "multipart/alternative" {
+		t.Errorf("incorrect media type, got %q, want %q", mt, "multipart/alternative")
+		t.FailNow()
+	}
+
+	r := multipart.NewReader(m.Body, params["boundary"])
+	res := map[string]string{}
+	for {
+		p, err := r.NextPart() // quoted-printable is transparently decoded
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Errorf("cannot read part: %v", err)
+			t.FailNow()
+		}
+		b, _ := io.ReadAll(p)
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		res[ct] = string(b)
+	}
+	return m, res
+}
+
+func TestRenderActivation(t *testing.T) {
+	m := New(from, password, host, port)
+	url := "https://unleak.trade/activate/" + token
+	msg, err := m.render(email, "Confirm your email", "emailActivation", activation{hash, url, unsubscribe})
+	if err != nil {
+		t.Errorf("cannot render activation email: %v", err)
+		t.FailNow()
+	}
+	if !bytes.Contains(msg, []byte("Content-Transfer-Encoding: quoted-printable")) {
+		t.Errorf("parts must be quoted-printable encoded")
+		t.FailNow()
+	}
+
+	h, p := parts(t, msg)
+	if h.Header.Get("To") != email {
+		t.Errorf("incorrect To header, got %q, want %q", h.Header.Get("To"), email)
+		t.FailNow()
+	}
+	if len(p) != 2 {
+		t.Errorf("incorrect number of parts, got %d, want 2", len(p))
+		t.FailNow()
+	}
+	for _, ct := range []string{"text/plain", "text/html"} {
+		body, ok := p[ct]
+		if !ok {
+			t.Errorf("missing %s part", ct)
+			t.FailNow()
+		}
+		if !strings.Contains(body, url) {
+			t.Errorf("%s part must contain activation url %q", ct, url)
+			t.FailNow()
+		}
+		if !strings.Contains(body, hash) {
+			t.Errorf("%s part must contain hash %q", ct, hash)
+			t.FailNow()
+		}
+		if !strings.Contains(body, unsubscribe) {
+			t.Errorf("%s part must contain unsubscribe url %q", ct, unsubscribe)
+			t.FailNow()
+		}
+	}
+
+	msg, _ = m.render(email, "Confirm your email", "emailActivation", activation{Hash: hash, Url: url})
+	if bytes.Contains(msg, []byte("unsubscribe")) {
+		t.Errorf("unsubscribe link must be optional")
+		t.FailNow()
+	}
+}
+
+func TestRenderConfirmation(t *testing.T) {
+	m := New(from, password, host, port)
+	msg, err := m.render(email, "All set", "emailConfirmation", struct{}{})
+	if err != nil {
+		t.Errorf("cannot render confirmation email: %v", err)
+		t.FailNow()
+	}
+	_, p := parts(t, msg)
+	if p["text/plain"] == "" || p["text/html"] == "" {
+		t.Errorf("both text and html parts must be set")
+		t.FailNow()
+	}
+}
+
+func TestRenderWelcome(t *testing.T) {
+	m := New(from, password, host, port)
+	r := "https://unleak.trade/?sponsor=5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+	msg, err := m.render(email, "Invite your friends", "emailWelcome", welcome{r})
+	if err != nil {
+		t.Errorf("cannot render welcome email: %v", err)
+		t.FailNow()
+	}
+	_, p := parts(t, msg)
+	if !strings.Contains(p["text/plain"], r) || !strings.Contains(p["text/html"], r) {
+		t.Errorf("both parts must include the referral link, got %v", p)
+		t.FailNow()
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	m := New(from, password, host, port)
+	var got *message
+	m.deliver = func(msg *message) (string, error) {
+		got = msg
+		return msg.id, nil
+	}
+	d := Digest{New: 3, Total: 12, Position: 42, ReferralUrl: "https://unleak.trade/?sponsor=5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"}
+	for _, l := range []string{"", "fr", "es"} {
+		if err := m.SendDigestEmail(email, d, l); err != nil {
+			t.Errorf("cannot send digest email in %q: %v", l, err)
+			t.FailNow()
+		}
+		for _, s := range []string{"3", "12", "42", d.ReferralUrl} {
+			if !strings.Contains(string(got.text), s) || !strings.Contains(string(got.html), s) {
+				t.Errorf("both parts in %q must include %s, got %s", l, s, got.text)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestBuildMessageSubject(t *testing.T) {
+	s := "All set — you’re officially on the waitlist"
+	msg, err := buildMessage("", &mail.Address{Address: "from@unleak.trade"}, nil, email, s, []byte("text"), []byte("<p>html</p>"))
+	if err != nil {
+		t.Errorf("cannot build message: %v", err)
+		t.FailNow()
+	}
+	h, _ := parts(t, msg)
+	d, err := new(mime.WordDecoder).DecodeHeader(h.Header.Get("Subject"))
+	if err != nil || d != s {
+		t.Errorf("incorrect subject, got %q (%v), want %q", d, err, s)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,35 @@
+package mailer
+
+// Monitored decorates a Mailer, reporting the outcome of every send to record.
+type Monitored struct {
+	m      Mailer
+	record func(error)
+}
+
+func NewMonitored(m Mailer, record func(error)) *Monitored {
+	return &Monitored{m, record}
+}
+
+func (m *Monitored) SendActivationEmail(e, u, h, uu, l string) error {
+	err := m.m.SendActivationEmail(e, u, h, uu, l)
+	m.record(err)
+	return err
+}
+
+func (m *Monitored) SendConfirmationEmail(e, l string) error {
+	err := m.m.SendConfirmationEmail(e, l)
+	m.record(err)
+	return err
+}
+
+func (m *Monitored) SendWelcomeEmail(e, r, l string) error {
+	err := m.m.SendWelcomeEmail(e, r, l)
+	m.record(err)
+	return err
+}
+
+func (m *Monitored) SendDigestEmail(e string, d Digest, l string) error {
+	err := m.m.SendDigestEmail(e, d, l)
+	m.record(err)
+	return err
+}
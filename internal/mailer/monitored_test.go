@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMonitored(t *testing.T) {
+	var errs []error
+	m := NewMonitored(NewMockSmtpMailer(1), func(err error) { errs = append(errs, err) })
+	if err := m.SendActivationEmail(email, "https://unleak.trade/activate/"+token, hash, unsubscribe, DefaultLang); !errors.Is(err, ErrMockSend) {
+		t.Errorf("incorrect error, got %v, want %v", err, ErrMockSend)
+		t.FailNow()
+	}
+	if err := m.SendConfirmationEmail(email, DefaultLang); err != nil {
+		t.Errorf("incorrect error, got %v, want nil", err)
+		t.FailNow()
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], ErrMockSend) || errs[1] != nil {
+		t.Errorf("every outcome must be recorded, got %v", errs)
+		t.FailNow()
+	}
+}
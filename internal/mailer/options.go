@@ -0,0 +1,139 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	texttemplate "text/template"
+)
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// Options are the editable headers of the emails, empty fields keep their default value.
+// Subjects are text templates where {{.Product}} is replaced by the product name.
+type Options struct {
+	FromName, FromAddress string
+	ReplyTo               string
+	Product               string
+	ActivationSubject     string
+	ConfirmationSubject   string
+	WelcomeSubject        string
+	DigestSubject         string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		FromName:            "UnleakTrade",
+		FromAddress:         sender,
+		Product:             "UnleakTrade",
+		ActivationSubject:   "Confirm your email to join the {{.Product}} waitlist",
+		ConfirmationSubject: "All set — you’re officially on the waitlist",
+		WelcomeSubject:      "Invite your friends to the {{.Product}} waitlist",
+		DigestSubject:       "Your weekly referrals on the {{.Product}} waitlist",
+	}
+}
+
+// localizedSubjects are the subjects of the translations, Options only apply to DefaultLang.
+var localizedSubjects = map[string]map[string]string{
+	"fr": {
+		"emailActivation":   "Confirmez votre email pour rejoindre la liste d'attente {{.Product}}",
+		"emailConfirmation": "C'est fait — vous êtes officiellement sur la liste d'attente",
+		"emailWelcome":      "Invitez vos amis sur la liste d'attente {{.Product}}",
+		"emailDigest":       "Vos parrainages de la semaine sur la liste d'attente {{.Product}}",
+	},
+	"es": {
+		"emailActivation":   "Confirma tu correo para unirte a la lista de espera de {{.Product}}",
+		"emailConfirmation": "¡Listo! Ya estás oficialmente en la lista de espera",
+		"emailWelcome":      "Invita a tus amigos a la lista de espera de {{.Product}}",
+		"emailDigest":       "Tus referidos de la semana en la lista de espera de {{.Product}}",
+	},
+}
+
+// settings are the validated Options.
+type settings struct {
+	from     *mail.Address
+	replyTo  *mail.Address // optional
+	product  string
+	subjects map[string]*texttemplate.Template // by html template name, suffixed by the language for translations
+}
+
+var defaultSettings = func() *settings {
+	s, err := DefaultOptions().compile()
+	if err != nil {
+		panic(err)
+	}
+	return s
+}()
+
+func (o Options) compile() (*settings, error) {
+	d := DefaultOptions()
+	for _, f := range []struct{ v, d *string }{
+		{&o.FromName, &d.FromName},
+		{&o.FromAddress, &d.FromAddress},
+		{&o.Product, &d.Product},
+		{&o.ActivationSubject, &d.ActivationSubject},
+		{&o.ConfirmationSubject, &d.ConfirmationSubject},
+		{&o.WelcomeSubject, &d.WelcomeSubject},
+		{&o.DigestSubject, &d.DigestSubject},
+	} {
+		if *f.v == "" {
+			*f.v = *f.d
+		}
+	}
+
+	from, err := mail.ParseAddress(o.FromAddress)
+	if err != nil || from.Name != "" {
+		return nil, fmt.Errorf("%w: from %q", ErrInvalidAddress, o.FromAddress)
+	}
+	from.Name = o.FromName
+	s := &settings{from: from, product: o.Product, subjects: map[string]*texttemplate.Template{}}
+	if o.ReplyTo != "" {
+		if s.replyTo, err = mail.ParseAddress(o.ReplyTo); err != nil {
+			return nil, fmt.Errorf("%w: reply-to %q", ErrInvalidAddress, o.ReplyTo)
+		}
+	}
+	subjects := map[string]string{
+		"emailActivation":   o.ActivationSubject,
+		"emailConfirmation": o.ConfirmationSubject,
+		"emailWelcome":      o.WelcomeSubject,
+		"emailDigest":       o.DigestSubject,
+	}
+	for l, ls := range localizedSubjects {
+		for n, subject := range ls {
+			subjects[n+"."+l] = subject
+		}
+	}
+	for n, subject := range subjects {
+		t, err := texttemplate.New(n).Parse(subject)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subject %q: %w", subject, err)
+		}
+		if err := t.Execute(io.Discard, struct{ Product string }{s.product}); err != nil {
+			return nil, fmt.Errorf("invalid subject: %w", err)
+		}
+		s.subjects[n] = t
+	}
+	return s, nil
+}
+
+// subject returns the subject line of template n in language l.
+func (s *settings) subject(n, l string) (string, error) {
+	var b bytes.Buffer
+	n = localized(n, l, func(n string) bool { return s.subjects[n] != nil })
+	if err := s.subjects[n].Execute(&b, struct{ Product string }{s.product}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// SetOptions validates and applies the options to the mailer.
+func (b *base) SetOptions(o Options) error {
+	s, err := o.compile()
+	if err != nil {
+		return err
+	}
+	b.opts = s
+	return nil
+}
@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"errors"
+	"mime"
+	"strings"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	tt := []struct {
+		name    string
+		o       Options
+		invalid bool
+		err     error // when invalid
+	}{
+		{"defaults", Options{}, false, nil},
+		{"custom", Options{FromName: "Marketing", FromAddress: "news@unleak.trade", ReplyTo: "Support <support@unleak.trade>"}, false, nil},
+		{"invalid from", Options{FromAddress: "news.unleak.trade"}, true, ErrInvalidAddress},
+		{"named from", Options{FromAddress: "Marketing <news@unleak.trade>"}, true, ErrInvalidAddress},
+		{"invalid reply-to", Options{ReplyTo: "support@"}, true, ErrInvalidAddress},
+		{"invalid subject", Options{ActivationSubject: "Join {{.Product"}, true, nil},
+		{"unknown placeholder", Options{ConfirmationSubject: "Welcome to {{.Name}}"}, true, nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.o.compile()
+			if tc.invalid != (err != nil) {
+				t.Errorf("incorrect validation, got error %v, want invalid %t", err, tc.invalid)
+				t.FailNow()
+			}
+			if tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestMessageHeaders(t *testing.T) {
+	m := New(from, password, host, port)
+	if err := m.SetOptions(Options{
+		FromName:          "Équipe Marketing",
+		FromAddress:       "news@unleak.trade",
+		ReplyTo:           "support@unleak.trade",
+		Product:           "unleak.trade",
+		ActivationSubject: "Activate your {{.Product}} waitlist spot",
+	}); err != nil {
+		t.Errorf("cannot set options: %v", err)
+		t.FailNow()
+	}
+
+	var raw []byte
+	m.deliver = func(msg *message) (_ string, err error) {
+		raw, err = msg.mime()
+		return msg.id, err
+	}
+	if err := m.SendActivationEmail(email, "https://unleak.trade/activate/"+token, hash, unsubscribe, DefaultLang); err != nil {
+		t.Errorf("cannot send activation email: %v", err)
+		t.FailNow()
+	}
+
+	h, _ := parts(t, raw)
+	dec := new(mime.WordDecoder)
+	for _, tc := range []struct{ header, want string }{
+		{"From", "Équipe Marketing <news@unleak.trade>"},
+		{"Reply-To", "<support@unleak.trade>"},
+		{"Subject", "Activate your unleak.trade waitlist spot"},
+	} {
+		got, err := dec.DecodeHeader(h.Header.Get(tc.header))
+		if err != nil || got != tc.want {
+			t.Errorf("incorrect %s header, got %q (%v), want %q", tc.header, got, err, tc.want)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	m := New(from, password, host, port)
+	var raw []byte
+	m.deliver = func(msg *message) (_ string, err error) {
+		raw, err = msg.mime()
+		return msg.id, err
+	}
+	m.SendConfirmationEmail(email, DefaultLang)
+	h, _ := parts(t, raw)
+	if h.Header.Get("Reply-To") != "" {
+		t.Errorf("Reply-To must not be set by default")
+		t.FailNow()
+	}
+	if a, err := h.Header.AddressList("From"); err != nil || a[0].Address != sender {
+		t.Errorf("incorrect From header, got %q, want %q", h.Header.Get("From"), sender)
+		t.FailNow()
+	}
+	if id := h.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@unleak.trade>") {
+		t.Errorf("incorrect Message-ID header, got %q", id)
+		t.FailNow()
+	}
+}
+
+func TestLocalizedMessage(t *testing.T) {
+	tt := []struct {
+		lang, subject, text string
+	}{
+		{"", "Confirm your email to join the UnleakTrade waitlist", "Activation code:"},
+		{DefaultLang, "Confirm your email to join the UnleakTrade waitlist", "Activation code:"},
+		{"fr", "Confirmez votre email pour rejoindre la liste d'attente UnleakTrade", "Code d'activation :"},
+		{"es", "Confirma tu correo para unirte a la lista de espera de UnleakTrade", "Código de activación:"},
+		{"de", "Confirm your email to join the UnleakTrade waitlist", "Activation code:"}, // missing translation
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.lang, func(t *testing.T) {
+			m := New(from, password, host, port)
+			var got *message
+			m.deliver = func(msg *message) (string, error) {
+				got = msg
+				return msg.id, nil
+			}
+			if err := m.SendActivationEmail(email, "https://unleak.trade/activate/"+token, hash, unsubscribe, tc.lang); err != nil {
+				t.Errorf("cannot send activation email: %v", err)
+				t.FailNow()
+			}
+			if got.subject != tc.subject {
+				t.Errorf("incorrect subject, got %q, want %q", got.subject, tc.subject)
+				t.FailNow()
+			}
+			if !strings.Contains(string(got.text), tc.text) || !strings.Contains(string(got.html), hash) {
+				t.Errorf("incorrect body, text must contain %q, got %s", tc.text, got.text)
+				t.FailNow()
+			}
+		})
+	}
+}
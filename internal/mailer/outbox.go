@@ -0,0 +1,285 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/events"
+	"github.com/unleaktrade/waitlist/internal/metrics"
+	"github.com/unleaktrade/waitlist/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TemplateActivation   = "activation"
+	TemplateConfirmation = "confirmation"
+	TemplateWelcome      = "welcome"
+	TemplateDigest       = "digest"
+	TemplateEvent        = "event" // not an email, an event of the user published to the sink named by its payload
+
+	// SinkAWS is the sink of the events enqueued without sink, before there were several.
+	SinkAWS = "aws"
+
+	outboxMaxAttempts = 5
+)
+
+var errNoSink = errors.New("no sink of the events")
+
+// Users tells whether the users are still registered, for the emails scheduled for them.
+type Users interface {
+	Get(a string) (*data.User, error) // nil when absent
+}
+
+// OutboxWorker delivers the emails persisted in the outbox.
+// Each tick sends the due emails enqueued by this process; emails due for longer
+// than the stale threshold (left by a crashed or stopped replica) are recovered
+// at startup and then every stale period.
+type OutboxWorker struct {
+	o        data.Outbox
+	m        Mailer
+	r        *metrics.Registry
+	u        Users                  // nil when the scheduled emails are never dropped
+	sinks    map[string]events.Sink // of the events by name
+	provider string                 // of m, in the spans of the sends
+	interval time.Duration
+	stale    time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	local map[string]*data.OutboxEmail
+	kick  chan struct{}
+}
+
+func NewOutboxWorker(o data.Outbox, m Mailer, r *metrics.Registry, interval, stale time.Duration) *OutboxWorker {
+	return &OutboxWorker{
+		o:        o,
+		m:        m,
+		r:        r,
+		interval: interval,
+		stale:    stale,
+		now:      time.Now,
+		local:    make(map[string]*data.OutboxEmail),
+		sinks:    make(map[string]events.Sink),
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// WithUsers drops the scheduled emails of the users deleted from u, or anonymized, before they are due.
+func (w *OutboxWorker) WithUsers(u Users) *OutboxWorker {
+	w.u = u
+	return w
+}
+
+// WithSink publishes the events enqueued in the outbox for the sink name to s, at least once.
+func (w *OutboxWorker) WithSink(name string, s events.Sink) *OutboxWorker {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sinks[name] = s
+	return w
+}
+
+// WithProvider names the mail provider of the worker in the spans of the sends.
+func (w *OutboxWorker) WithProvider(p string) *OutboxWorker {
+	w.provider = p
+	return w
+}
+
+// Enqueue persists the email and wakes the worker up.
+func (w *OutboxWorker) Enqueue(e *data.OutboxEmail) error {
+	if err := w.o.Enqueue(e); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.local[e.ID] = e
+	w.mu.Unlock()
+	select {
+	case w.kick <- struct{}{}:
+	default: // already kicked
+	}
+	return nil
+}
+
+// Run drains the outbox until ctx is done.
+func (w *OutboxWorker) Run(ctx context.Context) {
+	w.Recover()
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	lr := w.now()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("📭 outbox worker stopped", "pending", w.Len())
+			return
+		case <-t.C:
+		case <-w.kick:
+		}
+		w.Tick()
+		if w.now().Sub(lr) >= w.stale {
+			w.Recover()
+			lr = w.now()
+		}
+	}
+}
+
+// Len returns the number of emails enqueued by this process not sent yet, scheduled ones included.
+func (w *OutboxWorker) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.local)
+}
+
+// Tick sends the due emails enqueued by this process.
+func (w *OutboxWorker) Tick() {
+	now := w.now()
+	w.mu.Lock()
+	l := make([]*data.OutboxEmail, 0, len(w.local))
+	for _, e := range w.local {
+		if e.Due(now) {
+			l = append(l, e)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, e := range l {
+		w.process(e)
+	}
+}
+
+// Recover sends the pending emails due for longer than the stale threshold.
+func (w *OutboxWorker) Recover() {
+	l, err := w.o.Pending()
+	if err != nil {
+		logger.Error("🔥 cannot list pending outbox emails", slog.Any("error", err))
+		return
+	}
+	for _, e := range l {
+		w.mu.Lock()
+		_, ok := w.local[e.ID]
+		w.mu.Unlock()
+		if !ok && w.now().Sub(time.UnixMilli(max(e.CreatedAt, e.SendAt))) >= w.stale {
+			w.process(e)
+		}
+	}
+}
+
+func (w *OutboxWorker) send(ctx context.Context, e *data.OutboxEmail) error {
+	switch e.Template {
+	case TemplateActivation:
+		return w.m.SendActivationEmail(e.Recipient, e.Payload["url"], e.Payload["hash"], e.Payload["unsubscribe"], e.Payload["lang"])
+	case TemplateConfirmation:
+		return w.m.SendConfirmationEmail(e.Recipient, e.Payload["lang"])
+	case TemplateWelcome:
+		return w.m.SendWelcomeEmail(e.Recipient, e.Payload["referral"], e.Payload["lang"])
+	case TemplateDigest:
+		d, err := digestOf(e.Payload)
+		if err != nil {
+			return err
+		}
+		return w.m.SendDigestEmail(e.Recipient, d, e.Payload["lang"])
+	case TemplateEvent:
+		name := e.Payload["sink"]
+		if name == "" {
+			name = SinkAWS
+		}
+		w.mu.Lock()
+		s := w.sinks[name]
+		w.mu.Unlock()
+		if s == nil {
+			return fmt.Errorf("%w %q", errNoSink, name)
+		}
+		ev, err := events.EventOf(e.Payload)
+		if err != nil {
+			return err
+		}
+		return s.Publish(ctx, ev)
+	default:
+		return fmt.Errorf("unknown email template %q", e.Template)
+	}
+}
+
+// deleted reports whether the user e is scheduled for is deleted or anonymized.
+func (w *OutboxWorker) deleted(e *data.OutboxEmail) (bool, error) {
+	if e.User == "" || w.u == nil {
+		return false, nil
+	}
+	u, err := w.u.Get(e.User)
+	return err == nil && (u == nil || u.Anonymized()), err
+}
+
+func (w *OutboxWorker) process(e *data.OutboxEmail) {
+	switch d, err := w.deleted(e); {
+	case err != nil: // never sent to a user who may be deleted, retried on the next tick
+		logger.Warn("⚠️ cannot check the user of the outbox email", "template", e.Template, "id", e.ID, slog.Any("error", err))
+		return
+	case d:
+		e.Status = data.OutboxDropped
+		logger.Info("🗑️ outbox email dropped, its user is deleted or anonymized", "template", e.Template, "id", e.ID)
+		w.update(e)
+		return
+	}
+	ctx, span := tracing.Tracer("mailer").Start(tracing.Extract(context.Background(), e.Trace), "mailer.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("email.template", e.Template),
+			attribute.String("mail.provider", w.provider),
+			attribute.Int("outbox.attempt", e.Attempts+1),
+		))
+	err := w.send(ctx, e)
+	tracing.End(span, err)
+	e.Attempts++
+	switch {
+	case err == nil:
+		e.Status = data.OutboxSent
+		e.SentAt = w.now().UnixMilli()
+	case e.Attempts >= outboxMaxAttempts:
+		e.Status = data.OutboxFailed
+		logger.Error("🔥 outbox email not delivered", "template", e.Template, "id", e.ID, "attempts", e.Attempts, slog.Any("error", err))
+		w.r.Counter(fmt.Sprintf("waitlist_emails_failed_total{email=%q}", e.Template), "Emails not delivered by the mail provider").Inc()
+	}
+
+	w.update(e)
+}
+
+// update persists e, which leaves the local queue once sent, failed or dropped.
+func (w *OutboxWorker) update(e *data.OutboxEmail) {
+	if err := w.o.Update(e); err != nil {
+		logger.Warn("⚠️ cannot update the outbox email", "id", e.ID, slog.Any("error", err))
+	}
+	if e.Status != data.OutboxPending {
+		w.mu.Lock()
+		delete(w.local, e.ID)
+		w.mu.Unlock()
+	}
+}
+
+// Payload returns the outbox payload of the digest d in language l.
+func (d Digest) Payload(l string) map[string]string {
+	return map[string]string{
+		"new":      strconv.Itoa(d.New),
+		"total":    strconv.Itoa(d.Total),
+		"position": strconv.Itoa(d.Position),
+		"referral": d.ReferralUrl,
+		"lang":     l,
+	}
+}
+
+// digestOf returns the digest of the outbox payload p.
+func digestOf(p map[string]string) (d Digest, err error) {
+	for _, f := range []struct {
+		k string
+		v *int
+	}{{"new", &d.New}, {"total", &d.Total}, {"position", &d.Position}} {
+		if *f.v, err = strconv.Atoi(p[f.k]); err != nil {
+			return d, fmt.Errorf("incorrect digest %s: %w", f.k, err)
+		}
+	}
+	d.ReferralUrl = p["referral"]
+	return d, nil
+}
@@ -0,0 +1,260 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/events"
+	"github.com/unleaktrade/waitlist/internal/metrics"
+)
+
+func TestOutboxRetryOnNextTick(t *testing.T) {
+	o := data.NewMockOutbox()
+	m := NewMockSmtpMailer(1) // first send fails
+	w := NewOutboxWorker(o, m, metrics.NewRegistry(), time.Hour, time.Hour)
+
+	e := data.NewOutboxEmail(email, TemplateActivation, map[string]string{"url": "https://unleak.trade/activate/" + token, "hash": hash})
+	if err := w.Enqueue(e); err != nil {
+		t.Errorf("cannot enqueue email: %v", err)
+		t.FailNow()
+	}
+
+	w.Tick()
+	s, _ := o.Get(e.ID)
+	if s.Status != data.OutboxPending || s.Attempts != 1 {
+		t.Errorf("email should still be pending after 1 failed attempt, got %s after %d attempts", s.Status, s.Attempts)
+		t.FailNow()
+	}
+	if w.Len() != 1 {
+		t.Errorf("incorrect local queue length, got %d, want 1", w.Len())
+		t.FailNow()
+	}
+
+	w.Tick()
+	s, _ = o.Get(e.ID)
+	if s.Status != data.OutboxSent || s.Attempts != 2 || s.SentAt == 0 {
+		t.Errorf("email should be sent on the next tick, got %s after %d attempts", s.Status, s.Attempts)
+		t.FailNow()
+	}
+	if w.Len() != 0 || m.Calls() != 2 {
+		t.Errorf("incorrect state, got %d queued and %d calls, want 0 and 2", w.Len(), m.Calls())
+		t.FailNow()
+	}
+}
+
+func TestOutboxGiveUp(t *testing.T) {
+	o := data.NewMockOutbox()
+	r := metrics.NewRegistry()
+	w := NewOutboxWorker(o, NewMockSmtpMailer(-1), r, time.Hour, time.Hour)
+	e := data.NewOutboxEmail(email, TemplateConfirmation, nil)
+	w.Enqueue(e)
+	for i := 0; i < outboxMaxAttempts+2; i++ {
+		w.Tick()
+	}
+	s, _ := o.Get(e.ID)
+	if s.Status != data.OutboxFailed || s.Attempts != outboxMaxAttempts {
+		t.Errorf("incorrect state, got %s after %d attempts, want %s after %d", s.Status, s.Attempts, data.OutboxFailed, outboxMaxAttempts)
+		t.FailNow()
+	}
+	if c := r.Counter(`waitlist_emails_failed_total{email="confirmation"}`, "").Value(); c != 1 {
+		t.Errorf("incorrect failure count, got %d, want 1", c)
+		t.FailNow()
+	}
+}
+
+func TestOutboxEvents(t *testing.T) {
+	o := data.NewMockOutbox()
+	m := NewMockSmtpMailer(0)
+	s := events.NewMockSink().FailNth(1, errors.New("nats: no responders available for request"))
+	w := NewOutboxWorker(o, m, metrics.NewRegistry(), time.Hour, time.Hour).WithSink("nats", s)
+
+	ev := events.NewEvent(events.UserDeleted, data.NewUser("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", email, ""), time.Now())
+	p := ev.Payload()
+	p["sink"] = "nats"
+	e := data.NewOutboxEmail("", TemplateEvent, p)
+	w.Enqueue(e)
+	w.Tick()
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxPending || s.Attempts != 1 {
+		t.Errorf("a failed publication must be retried, got %s after %d attempts", s.Status, s.Attempts)
+		t.FailNow()
+	}
+	w.Tick()
+	if st, _ := o.Get(e.ID); st.Status != data.OutboxSent || len(s.Published()) != 1 || s.Published()[0] != ev || m.Calls() != 0 {
+		t.Errorf("the event must be published on the next tick, not emailed, got %s: %v", st.Status, s.Published())
+		t.FailNow()
+	}
+
+	// enqueued before the sinks were named
+	a := events.NewMockSink()
+	w.WithSink(SinkAWS, a)
+	e = data.NewOutboxEmail("", TemplateEvent, map[string]string{"event": events.UserDeleted, "address": ev.Address, "timestamp": "1700000000000"})
+	w.Enqueue(e)
+	w.Tick()
+	if l := a.Published(); len(l) != 1 || l[0].SchemaVersion != 1 || l[0].Address != ev.Address {
+		t.Errorf("an unnamed event must be published to the AWS sink, got %v", l)
+		t.FailNow()
+	}
+
+	// to a sink not configured anymore, given up
+	p["sink"] = "kafka"
+	e = data.NewOutboxEmail("", TemplateEvent, p)
+	w.Enqueue(e)
+	for i := 0; i < outboxMaxAttempts; i++ {
+		w.Tick()
+	}
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxFailed {
+		t.Errorf("an event without its sink must fail, got %s", s.Status)
+		t.FailNow()
+	}
+}
+
+func TestOutboxRecover(t *testing.T) {
+	o := data.NewMockOutbox()
+	now := time.Now()
+	stale := data.NewOutboxEmail(email, TemplateConfirmation, nil) // left by a previous process
+	stale.CreatedAt = now.Add(-2 * time.Minute).UnixMilli()
+	fresh := data.NewOutboxEmail(email, TemplateConfirmation, nil) // probably owned by another replica
+	o.Enqueue(stale)
+	o.Enqueue(fresh)
+
+	m := NewMockSmtpMailer(0)
+	w := NewOutboxWorker(o, m, metrics.NewRegistry(), time.Hour, time.Minute)
+	w.Recover()
+
+	if s, _ := o.Get(stale.ID); s.Status != data.OutboxSent {
+		t.Errorf("stale email should be sent, got %s", s.Status)
+		t.FailNow()
+	}
+	if s, _ := o.Get(fresh.ID); s.Status != data.OutboxPending {
+		t.Errorf("fresh email should be left pending, got %s", s.Status)
+		t.FailNow()
+	}
+	if m.Calls() != 1 {
+		t.Errorf("incorrect number of calls, got %d, want 1", m.Calls())
+		t.FailNow()
+	}
+}
+
+func TestOutboxScheduled(t *testing.T) {
+	a, deleted, anonymized := "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg", "7EYnhQoR9YM3N7UoaKRoA44Uy8JeaZV3qyouov87awMs"
+	o := data.NewMockOutbox()
+	m := NewMockSmtpMailer(0)
+	db := data.NewMockDBContent([]string{a, anonymized})
+	db.Anonymize(anonymized)
+	w := NewOutboxWorker(o, m, metrics.NewRegistry(), time.Hour, time.Minute).WithUsers(db)
+	now := time.Now()
+	w.now = func() time.Time { return now }
+
+	r := "https://unleak.trade/?sponsor=" + a
+	e := data.NewOutboxEmail(email, TemplateWelcome, map[string]string{"referral": r}).Schedule(a, now.Add(48*time.Hour))
+	d := data.NewOutboxEmail(email, TemplateWelcome, map[string]string{"referral": "https://unleak.trade/?sponsor=" + deleted}).Schedule(deleted, now.Add(48*time.Hour))
+	n := data.NewOutboxEmail(email, TemplateWelcome, map[string]string{"referral": "https://unleak.trade/?sponsor=" + anonymized}).Schedule(anonymized, now.Add(48*time.Hour))
+	w.Enqueue(e)
+	w.Enqueue(d)
+	w.Enqueue(n)
+
+	w.Tick()
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxPending || m.Calls() != 0 || w.Len() != 3 {
+		t.Errorf("the scheduled emails must wait until they are due, got %s after %d calls", s.Status, m.Calls())
+		t.FailNow()
+	}
+
+	now = now.Add(48*time.Hour + time.Second)
+	w.Tick()
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxSent || m.Calls() != 1 {
+		t.Errorf("the due email must be sent, got %s after %d calls", s.Status, m.Calls())
+		t.FailNow()
+	}
+	if _, _, body := m.Last(); !strings.Contains(body, r) {
+		t.Errorf("the welcome email must include the referral link, got %s", body)
+		t.FailNow()
+	}
+	if s, _ := o.Get(d.ID); s.Status != data.OutboxDropped || s.Attempts != 0 || w.Len() != 0 {
+		t.Errorf("the email of a deleted user must be dropped, got %s after %d attempts", s.Status, s.Attempts)
+		t.FailNow()
+	}
+	if s, _ := o.Get(n.ID); s.Status != data.OutboxDropped || s.Attempts != 0 {
+		t.Errorf("the email of an anonymized user must be dropped, got %s after %d attempts", s.Status, s.Attempts)
+		t.FailNow()
+	}
+}
+
+func TestOutboxRecoverScheduled(t *testing.T) {
+	o := data.NewMockOutbox()
+	now := time.Now()
+	e := data.NewOutboxEmail(email, TemplateWelcome, nil).Schedule("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", now.Add(time.Hour))
+	e.CreatedAt = now.Add(-time.Hour).UnixMilli() // left by a previous process
+	o.Enqueue(e)
+
+	m := NewMockSmtpMailer(0)
+	w := NewOutboxWorker(o, m, metrics.NewRegistry(), time.Hour, time.Minute)
+	w.now = func() time.Time { return now }
+	w.Recover()
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxPending || m.Calls() != 0 {
+		t.Errorf("the email must not be recovered before it is due, got %s", s.Status)
+		t.FailNow()
+	}
+	now = now.Add(time.Hour + 2*time.Minute)
+	w.Recover()
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxSent {
+		t.Errorf("the email must be recovered once due for longer than the stale threshold, got %s", s.Status)
+		t.FailNow()
+	}
+}
+
+func TestOutboxRun(t *testing.T) {
+	o := data.NewMockOutbox()
+	m := NewMockSmtpMailer(0)
+	w := NewOutboxWorker(o, m, metrics.NewRegistry(), time.Hour, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	e := data.NewOutboxEmail(email, TemplateConfirmation, nil)
+	w.Enqueue(e) // kicks the worker, no need to wait for the ticker
+	for i := 0; i < 100 && w.Len() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxSent {
+		t.Errorf("email should be sent, got %s", s.Status)
+		t.FailNow()
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("worker should stop when the context is cancelled")
+		t.FailNow()
+	}
+}
+
+func TestOutboxDigest(t *testing.T) {
+	o := data.NewMockOutbox()
+	m := NewMockSmtpMailer(0)
+	w := NewOutboxWorker(o, m, metrics.NewRegistry(), time.Hour, time.Minute)
+	d := Digest{New: 2, Total: 5, Position: 7, ReferralUrl: "https://unleak.trade/?sponsor=5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"}
+	e := data.NewOutboxEmail(email, TemplateDigest, d.Payload("fr"))
+	w.Enqueue(e)
+	w.Tick()
+	if s, _ := o.Get(e.ID); s.Status != data.OutboxSent || m.Calls() != 1 {
+		t.Errorf("the digest must be sent, got %s after %d calls", s.Status, m.Calls())
+		t.FailNow()
+	}
+	if _, _, body := m.Last(); !strings.Contains(body, "parrainé 5 traders") || !strings.Contains(body, d.ReferralUrl) {
+		t.Errorf("the digest must be rendered from the payload, got %s", body)
+		t.FailNow()
+	}
+
+	if _, err := digestOf(map[string]string{"new": "2", "total": "x", "position": "7"}); err == nil {
+		t.Error("an incorrect payload must fail")
+		t.FailNow()
+	}
+}
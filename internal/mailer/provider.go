@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sesv2"
+)
+
+const (
+	ProviderSMTP     = "smtp"
+	ProviderSES      = "ses"
+	ProviderSendGrid = "sendgrid"
+	ProviderLog      = "log"
+)
+
+var (
+	ErrUnknownProvider    = errors.New("unknown mail provider")
+	ErrMissingSendGridKey = errors.New("sendgrid api key is missing")
+)
+
+type Config struct {
+	Provider string // smtp (default), ses, sendgrid or log
+
+	// smtp
+	User, Password, Host string
+	Port                 int
+
+	// sendgrid
+	SendGridKey string
+
+	// log, optional directory of the .eml files
+	LogDir string
+
+	Options Options // headers and subjects
+}
+
+// NewProvider returns the Mailer of the configured provider.
+func NewProvider(c Config) (Mailer, error) {
+	var m interface {
+		Mailer
+		SetOptions(o Options) error
+	}
+	switch c.Provider {
+	case "", ProviderSMTP:
+		m = New(c.User, c.Password, c.Host, c.Port)
+	case ProviderSES:
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		m = NewSES(sesv2.New(sess))
+	case ProviderSendGrid:
+		if c.SendGridKey == "" {
+			return nil, ErrMissingSendGridKey
+		}
+		m = NewSendGrid(c.SendGridKey)
+	case ProviderLog:
+		m = NewLog(c.LogDir)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, c.Provider)
+	}
+	if err := m.SetOptions(c.Options); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
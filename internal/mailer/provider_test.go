@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewProvider(t *testing.T) {
+	tt := []struct {
+		name string
+		c    Config
+		err  error
+	}{
+		{"default", Config{Host: host, Port: port}, nil},
+		{"smtp", Config{Provider: ProviderSMTP, Host: host, Port: port}, nil},
+		{"ses", Config{Provider: ProviderSES}, nil},
+		{"sendgrid", Config{Provider: ProviderSendGrid, SendGridKey: "SG.k3y"}, nil},
+		{"sendgrid no key", Config{Provider: ProviderSendGrid}, ErrMissingSendGridKey},
+		{"log", Config{Provider: ProviderLog}, nil},
+		{"unknown", Config{Provider: "pigeon"}, ErrUnknownProvider},
+		{"invalid from", Config{Options: Options{FromAddress: "julien"}}, ErrInvalidAddress},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewProvider(tc.c)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+			if err == nil && m == nil {
+				t.Errorf("mailer cannot be nil")
+				t.FailNow()
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Retrying decorates a Mailer, retrying failed sends with exponential backoff and jitter.
+type Retrying struct {
+	m        Mailer
+	attempts int
+	backoff  time.Duration
+	sleep    func(time.Duration)
+}
+
+func NewRetrying(m Mailer, attempts int, backoff time.Duration) *Retrying {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Retrying{m, attempts, backoff, time.Sleep}
+}
+
+// delay returns the pause before retry n (starting at 0): backoff * 2^n plus up to 50% jitter.
+func (r *Retrying) delay(n int) time.Duration {
+	d := r.backoff << n
+	if d <= 0 {
+		return 0
+	}
+	return d + rand.N(d/2+1)
+}
+
+func (r *Retrying) retry(e string, send func() error) (err error) {
+	for i := 0; i < r.attempts; i++ {
+		if err = send(); err == nil {
+			return nil
+		}
+		if i < r.attempts-1 {
+			d := r.delay(i)
+			logger.Debug("email not sent, retrying", "attempt", i+1, "attempts", r.attempts, "delay", d)
+			r.sleep(d)
+		}
+	}
+	logger.Error("🔥 giving up sending email", "email", redact(e), "attempts", r.attempts, slog.Any("error", err))
+	return fmt.Errorf("giving up after %d attempts: %w", r.attempts, err)
+}
+
+func (r *Retrying) SendActivationEmail(e, u, h, uu, l string) error {
+	return r.retry(e, func() error { return r.m.SendActivationEmail(e, u, h, uu, l) })
+}
+
+func (r *Retrying) SendConfirmationEmail(e, l string) error {
+	return r.retry(e, func() error { return r.m.SendConfirmationEmail(e, l) })
+}
+
+func (r *Retrying) SendWelcomeEmail(e, ref, l string) error {
+	return r.retry(e, func() error { return r.m.SendWelcomeEmail(e, ref, l) })
+}
+
+func (r *Retrying) SendDigestEmail(e string, d Digest, l string) error {
+	return r.retry(e, func() error { return r.m.SendDigestEmail(e, d, l) })
+}
+
+// redact hides the local part of an email, keeping the domain for troubleshooting.
+func redact(e string) string {
+	i := strings.LastIndexByte(e, '@')
+	if i < 0 {
+		return "***"
+	}
+	return "***" + e[i:]
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetrying(t *testing.T) {
+	tt := []struct {
+		name     string
+		failures int
+		attempts int
+		calls    int
+		err      error
+	}{
+		{"success", 0, 3, 1, nil},
+		{"success after 2 failures", 2, 3, 3, nil},
+		{"give up after 3 attempts", -1, 3, 3, ErrMockSend},
+		{"single attempt", -1, 1, 1, ErrMockSend},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMockSmtpMailer(tc.failures)
+			r := NewRetrying(m, tc.attempts, time.Millisecond)
+			var delays []time.Duration
+			r.sleep = func(d time.Duration) { delays = append(delays, d) }
+
+			err := r.SendActivationEmail(email, "https://unleak.trade/activate/"+token, hash, unsubscribe, DefaultLang)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+			if m.Calls() != tc.calls {
+				t.Errorf("incorrect number of attempts, got %d, want %d", m.Calls(), tc.calls)
+				t.FailNow()
+			}
+			if len(delays) != tc.calls-1 {
+				t.Errorf("incorrect number of pauses, got %d, want %d", len(delays), tc.calls-1)
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("confirmation", func(t *testing.T) {
+		m := NewMockSmtpMailer(-1)
+		r := NewRetrying(m, 3, 0)
+		if err := r.SendConfirmationEmail(email, DefaultLang); !errors.Is(err, ErrMockSend) {
+			t.Errorf("incorrect error, got %v, want %v", err, ErrMockSend)
+			t.FailNow()
+		}
+		if m.Calls() != 3 {
+			t.Errorf("incorrect number of attempts, got %d, want %d", m.Calls(), 3)
+			t.FailNow()
+		}
+	})
+}
+
+func TestRetryingLog(t *testing.T) {
+	var buf bytes.Buffer
+	defer SetLogger(logger)
+	SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	r := NewRetrying(NewMockSmtpMailer(-1), 2, 0)
+	r.SendConfirmationEmail(email, DefaultLang)
+	var recs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Errorf("incorrect JSON record %q: %v", line, err)
+			t.FailNow()
+		}
+		recs = append(recs, rec)
+	}
+	last := recs[len(recs)-1]
+	if last["level"] != "ERROR" || last["email"] != redact(email) || last["attempts"] != float64(2) || last["error"] == nil {
+		t.Errorf("incorrect giving up record, got %v", last)
+		t.FailNow()
+	}
+	if strings.Contains(buf.String(), email) {
+		t.Errorf("the emails must be redacted, got %q", buf.String())
+		t.FailNow()
+	}
+}
+
+func TestDelay(t *testing.T) {
+	b := 100 * time.Millisecond
+	r := NewRetrying(&MockSmtpMailer, 5, b)
+	for n := 0; n < 4; n++ {
+		min := b << n
+		max := min + min/2
+		for i := 0; i < 50; i++ {
+			if d := r.delay(n); d < min || d > max {
+				t.Errorf("incorrect delay for retry %d, got %v, want [%v, %v]", n, d, min, max)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tt := map[string]string{
+		"john.doe@domain.com": "***@domain.com",
+		"j@d.io":              "***@d.io",
+		"nodomain":            "***",
+		"":                    "***",
+	}
+	for e, want := range tt {
+		if got := redact(e); got != want {
+			t.Errorf("incorrect redact(%q), got %q, want %q", e, got, want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGridMailer delivers messages with the SendGrid v3 HTTP API.
+type SendGridMailer struct {
+	base
+	key string
+	url string
+	c   *http.Client
+}
+
+func NewSendGrid(key string) *SendGridMailer {
+	m := &SendGridMailer{
+		key: key,
+		url: sendGridURL,
+		c:   &http.Client{Timeout: 10 * time.Second},
+	}
+	m.base = newBase(m.post)
+	return m
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridRequest struct {
+	Personalizations []struct {
+		To []sendGridAddress `json:"to"`
+	} `json:"personalizations"`
+	From    sendGridAddress   `json:"from"`
+	ReplyTo *sendGridAddress  `json:"reply_to,omitempty"`
+	Subject string            `json:"subject"`
+	Content []sendGridContent `json:"content"`
+}
+
+func (m *SendGridMailer) post(msg *message) (string, error) {
+	r := sendGridRequest{
+		From:    sendGridAddress{msg.from.Address, msg.from.Name},
+		Subject: msg.subject,
+		Content: []sendGridContent{
+			{"text/plain", string(msg.text)},
+			{"text/html", string(msg.html)},
+		},
+	}
+	r.Personalizations = append(r.Personalizations, struct {
+		To []sendGridAddress `json:"to"`
+	}{[]sendGridAddress{{Email: msg.to}}})
+	if msg.replyTo != nil {
+		r.ReplyTo = &sendGridAddress{msg.replyTo.Address, msg.replyTo.Name}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.url, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.key)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := m.c.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sendgrid: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return "", fmt.Errorf("sendgrid: status %d: %s", res.StatusCode, body)
+	}
+	id := res.Header.Get("X-Message-Id")
+	logger.Debug("📨 SendGrid message sent", "message_id", id)
+	return id, nil
+}
@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendGridSendActivationEmail(t *testing.T) {
+	key := "SG.k3y"
+	var got sendGridRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+key {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Message-Id", "sg-1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	m := NewSendGrid(key)
+	m.url = srv.URL
+	url := "https://unleak.trade/activate/" + token
+	if r := m.SendActivationEmailResult(email, url, hash, unsubscribe, DefaultLang); r.Err != nil || r.MessageID != "sg-1" {
+		t.Errorf("error sending activation email, got %q: %v", r.MessageID, r.Err)
+		t.FailNow()
+	}
+	if len(got.Personalizations) != 1 || got.Personalizations[0].To[0].Email != email {
+		t.Errorf("incorrect personalizations, got %v", got.Personalizations)
+		t.FailNow()
+	}
+	if got.From.Email != sender {
+		t.Errorf("incorrect from, got %s, want %s", got.From.Email, sender)
+		t.FailNow()
+	}
+	if len(got.Content) != 2 {
+		t.Errorf("incorrect content, got %d parts, want 2", len(got.Content))
+		t.FailNow()
+	}
+	for _, c := range got.Content {
+		if !strings.Contains(c.Value, url) {
+			t.Errorf("%s content must contain activation url", c.Type)
+			t.FailNow()
+		}
+	}
+}
+
+func TestSendGridDeliveryError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errors":[{"message":"bad key"}]}`))
+	}))
+	defer srv.Close()
+
+	m := NewSendGrid("wrong")
+	m.url = srv.URL
+	err := m.SendConfirmationEmail(email, DefaultLang)
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("incorrect error, got %v, want status 401", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sesv2"
+	"github.com/aws/aws-sdk-go/service/sesv2/sesv2iface"
+)
+
+// SESMailer delivers raw MIME messages with Amazon SES (v2 API).
+type SESMailer struct {
+	base
+	c sesv2iface.SESV2API
+}
+
+func NewSES(c sesv2iface.SESV2API) *SESMailer {
+	m := &SESMailer{c: c}
+	m.base = newBase(m.sendEmail)
+	return m
+}
+
+func (m *SESMailer) sendEmail(msg *message) (string, error) {
+	raw, err := msg.mime()
+	if err != nil {
+		return "", err
+	}
+	r, err := m.c.SendEmail(&sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(msg.from.String()),
+		Destination: &sesv2.Destination{
+			ToAddresses: []*string{aws.String(msg.to)},
+		},
+		Content: &sesv2.EmailContent{
+			Raw: &sesv2.RawMessage{Data: raw},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("ses: %w", err)
+	}
+	id := aws.StringValue(r.MessageId)
+	logger.Debug("📨 SES message sent", "message_id", id)
+	return id, nil
+}
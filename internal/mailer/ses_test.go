@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sesv2"
+	"github.com/aws/aws-sdk-go/service/sesv2/sesv2iface"
+)
+
+type sesStub struct {
+	sesv2iface.SESV2API
+	inputs []*sesv2.SendEmailInput
+	err    error
+}
+
+func (s *sesStub) SendEmail(in *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+	s.inputs = append(s.inputs, in)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &sesv2.SendEmailOutput{MessageId: aws.String("ses-1")}, nil
+}
+
+func (s *sesStub) SendEmailWithContext(ctx aws.Context, in *sesv2.SendEmailInput, _ ...request.Option) (*sesv2.SendEmailOutput, error) {
+	return s.SendEmail(in)
+}
+
+func TestSESSendActivationEmail(t *testing.T) {
+	c := &sesStub{}
+	m := NewSES(c)
+	url := "https://unleak.trade/activate/" + token
+	if r := m.SendActivationEmailResult(email, url, hash, unsubscribe, DefaultLang); r.Err != nil || r.MessageID != "ses-1" {
+		t.Errorf("error sending activation email, got %q: %v", r.MessageID, r.Err)
+		t.FailNow()
+	}
+	if len(c.inputs) != 1 {
+		t.Errorf("incorrect number of SendEmail calls, got %d, want 1", len(c.inputs))
+		t.FailNow()
+	}
+	in := c.inputs[0]
+	if aws.StringValue(in.Destination.ToAddresses[0]) != email {
+		t.Errorf("incorrect destination, got %s, want %s", aws.StringValue(in.Destination.ToAddresses[0]), email)
+		t.FailNow()
+	}
+	if in.Content.Raw == nil || !bytes.Contains(in.Content.Raw.Data, []byte("multipart/alternative")) {
+		t.Errorf("content must be a raw multipart message")
+		t.FailNow()
+	}
+	_, p := parts(t, in.Content.Raw.Data)
+	if len(p) != 2 {
+		t.Errorf("incorrect number of parts, got %d, want 2", len(p))
+		t.FailNow()
+	}
+}
+
+func TestSESDeliveryError(t *testing.T) {
+	cause := errors.New("MessageRejected")
+	m := NewSES(&sesStub{err: cause})
+	if err := m.SendConfirmationEmail(email, DefaultLang); !errors.Is(err, cause) {
+		t.Errorf("incorrect error, got %v, want %v", err, cause)
+		t.FailNow()
+	}
+}
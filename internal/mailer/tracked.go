@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// Deliveries records the delivery attempts of the emails, the DB in production.
+type Deliveries interface {
+	RecordDelivery(e string, d data.Delivery) error
+}
+
+// Tracked decorates a Mailer, recording every send in d with the message ID of the provider.
+// Under a Retrying, each attempt is recorded.
+type Tracked struct {
+	m ResultMailer
+	d Deliveries
+}
+
+func NewTracked(m Mailer, d Deliveries) *Tracked {
+	rm, ok := m.(ResultMailer)
+	if !ok {
+		rm = errorsOnly{m}
+	}
+	return &Tracked{rm, d}
+}
+
+// track records the result r of sending template t to e, whose address is redacted from the errors, and returns its error.
+// A failure to record never fails the send.
+func (t *Tracked) track(e, template string, r SendResult) error {
+	d := data.Delivery{Template: template, Status: data.DeliverySent, MessageID: r.MessageID, Timestamp: time.Now().UnixMilli()}
+	if r.Err != nil {
+		d.Status, d.Error = data.DeliveryFailed, strings.ReplaceAll(r.Err.Error(), e, redact(e))
+	}
+	if err := t.d.RecordDelivery(e, d); err != nil {
+		logger.Warn("⚠️ delivery not recorded", "template", template, "email", redact(e), slog.Any("error", err))
+	}
+	return r.Err
+}
+
+func (t *Tracked) SendActivationEmail(e, u, h, uu, l string) error {
+	return t.track(e, TemplateActivation, t.m.SendActivationEmailResult(e, u, h, uu, l))
+}
+
+func (t *Tracked) SendConfirmationEmail(e, l string) error {
+	return t.track(e, TemplateConfirmation, t.m.SendConfirmationEmailResult(e, l))
+}
+
+func (t *Tracked) SendWelcomeEmail(e, r, l string) error {
+	return t.track(e, TemplateWelcome, t.m.SendWelcomeEmailResult(e, r, l))
+}
+
+func (t *Tracked) SendDigestEmail(e string, d Digest, l string) error {
+	return t.track(e, TemplateDigest, t.m.SendDigestEmailResult(e, d, l))
+}
+
+// errorsOnly is the ResultMailer of a Mailer not returning SendResults, without message IDs.
+type errorsOnly struct {
+	Mailer
+}
+
+func (m errorsOnly) SendActivationEmailResult(e, u, h, uu, l string) SendResult {
+	return SendResult{Err: m.SendActivationEmail(e, u, h, uu, l)}
+}
+
+func (m errorsOnly) SendConfirmationEmailResult(e, l string) SendResult {
+	return SendResult{Err: m.SendConfirmationEmail(e, l)}
+}
+
+func (m errorsOnly) SendWelcomeEmailResult(e, r, l string) SendResult {
+	return SendResult{Err: m.SendWelcomeEmail(e, r, l)}
+}
+
+func (m errorsOnly) SendDigestEmailResult(e string, d Digest, l string) SendResult {
+	return SendResult{Err: m.SendDigestEmail(e, d, l)}
+}
@@ -0,0 +1,80 @@
+package mailer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+func TestTracked(t *testing.T) {
+	tt := []struct {
+		name     string
+		mock     *mockSmtpMailer
+		statuses []string
+		err      error
+	}{
+		{"success", NewMockSmtpMailer(0), []string{data.DeliverySent}, nil},
+		{"success after a retry",
+			NewMockSmtpMailer(0).FailNth("SendActivationEmail", 1, errors.New("451 mailbox of "+email+" busy")),
+			[]string{data.DeliveryFailed, data.DeliverySent}, nil,
+		},
+		{"permanent failure", NewMockSmtpMailer(-1), []string{data.DeliveryFailed, data.DeliveryFailed, data.DeliveryFailed}, ErrMockSend},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := data.NewMemoryDB()
+			r := NewRetrying(NewTracked(tc.mock, db), 3, 0)
+			r.sleep = func(time.Duration) {}
+			start := time.Now().UnixMilli()
+
+			if err := r.SendActivationEmail(email, "https://unleak.trade/activate/"+token, hash, unsubscribe, DefaultLang); !errors.Is(err, tc.err) {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+			l, err := db.Deliveries(email)
+			if err != nil || len(l) != len(tc.statuses) {
+				t.Errorf("every attempt must be recorded, got %v: %v", l, err)
+				t.FailNow()
+			}
+			for i, d := range l {
+				if d.Template != TemplateActivation || d.Status != tc.statuses[i] || d.Timestamp < start {
+					t.Errorf("incorrect attempt %d, got %+v, want %s", i+1, d, tc.statuses[i])
+					t.FailNow()
+				}
+				if sent := d.Status == data.DeliverySent; sent != (d.MessageID != "") || sent != (d.Error == "") {
+					t.Errorf("the sent attempts must have a message ID, the failed ones an error, got %+v", d)
+					t.FailNow()
+				}
+				if strings.Contains(d.Error, email) {
+					t.Errorf("the email must be redacted from the errors, got %q", d.Error)
+					t.FailNow()
+				}
+			}
+		})
+	}
+
+	t.Run("without results", func(t *testing.T) {
+		db := data.NewMemoryDB()
+		m := NewTracked(NewMonitored(NewMockSmtpMailer(0), func(error) {}), db)
+		if err := m.SendConfirmationEmail(email, DefaultLang); err != nil {
+			t.Errorf("incorrect error, got %v, want nil", err)
+			t.FailNow()
+		}
+		if l, _ := db.Deliveries(email); len(l) != 1 || l[0].Template != TemplateConfirmation || l[0].Status != data.DeliverySent || l[0].MessageID != "" {
+			t.Errorf("the send must be recorded without message ID, got %v", l)
+			t.FailNow()
+		}
+	})
+
+	t.Run("not recorded", func(t *testing.T) {
+		m := NewTracked(NewMockSmtpMailer(0), data.NewMockDB().FailOn("RecordDelivery", ""))
+		if err := m.SendWelcomeEmail(email, "https://unleak.trade/?sponsor=x", DefaultLang); err != nil {
+			t.Errorf("a failure to record must not fail the send, got %v", err)
+			t.FailNow()
+		}
+	})
+}
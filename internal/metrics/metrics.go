@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+type metric struct {
+	help, kind string
+	value      func() float64
+}
+
+// Registry holds the metrics exposed in the Prometheus text format.
+// Names may carry labels, e.g. `waitlist_emails_failed_total{provider="ses"}`.
+type Registry struct {
+	mu       sync.RWMutex
+	counters map[string]*Counter
+	metrics  map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		counters: make(map[string]*Counter),
+		metrics:  make(map[string]metric),
+	}
+}
+
+// Counter returns the counter registered as name, creating it if needed.
+func (r *Registry) Counter(name, help string) *Counter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.counters[name]; ok {
+		return c
+	}
+	c := &Counter{}
+	r.counters[name] = c
+	r.metrics[name] = metric{help, "counter", func() float64 { return float64(c.Value()) }}
+	return c
+}
+
+// GaugeFunc registers a gauge whose value is read from f at scrape time.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.mu.Lock()
+	r.metrics[name] = metric{help, "gauge", f}
+	r.mu.Unlock()
+}
+
+// CounterFunc registers a counter maintained elsewhere whose value is read from f at scrape time.
+func (r *Registry) CounterFunc(name, help string, f func() float64) {
+	r.mu.Lock()
+	r.metrics[name] = metric{help, "counter", f}
+	r.mu.Unlock()
+}
+
+func family(name string) string {
+	if i := strings.IndexByte(name, '{'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// WriteTo writes all the metrics, sorted by name, in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for n := range r.metrics {
+		names = append(names, n)
+	}
+	ms := make(map[string]metric, len(r.metrics))
+	for n, m := range r.metrics {
+		ms[n] = m
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	var total int64
+	last := ""
+	for _, n := range names {
+		m := ms[n]
+		if f := family(n); f != last {
+			c, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f, m.help, f, m.kind)
+			total += int64(c)
+			if err != nil {
+				return total, err
+			}
+			last = f
+		}
+		c, err := fmt.Fprintf(w, "%s %g\n", n, m.value())
+		total += int64(c)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
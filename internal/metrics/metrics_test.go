@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("emails_failed_total", "Emails that could not be delivered")
+	if r.Counter("emails_failed_total", "dup") != c {
+		t.Errorf("Counter must return the already registered counter")
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Inc()
+		}()
+	}
+	wg.Wait()
+	c.Add(10)
+	if c.Value() != 110 {
+		t.Errorf("incorrect value, got %d, want %d", c.Value(), 110)
+		t.FailNow()
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.Counter(`emails_failed_total{provider="smtp"}`, "Emails that could not be delivered").Add(2)
+	r.Counter(`emails_failed_total{provider="ses"}`, "Emails that could not be delivered").Inc()
+	r.GaugeFunc("queue_depth", "Pending jobs", func() float64 { return 7 })
+	r.CounterFunc("cache_hits_total", "Cache hits", func() float64 { return 3 })
+
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Errorf("cannot write metrics: %v", err)
+		t.FailNow()
+	}
+	want := `# HELP cache_hits_total Cache hits
+# TYPE cache_hits_total counter
+cache_hits_total 3
+# HELP emails_failed_total Emails that could not be delivered
+# TYPE emails_failed_total counter
+emails_failed_total{provider="ses"} 1
+emails_failed_total{provider="smtp"} 2
+# HELP queue_depth Pending jobs
+# TYPE queue_depth gauge
+queue_depth 7
+`
+	if b.String() != want {
+		t.Errorf("incorrect exposition, got\n%s\nwant\n%s", b.String(), want)
+		t.FailNow()
+	}
+	if strings.Count(b.String(), "# TYPE emails_failed_total") != 1 {
+		t.Errorf("a family must be described once")
+	}
+}
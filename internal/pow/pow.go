@@ -0,0 +1,132 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/cache"
+)
+
+var (
+	ErrInvalidChallenge = errors.New("invalid challenge")
+	ErrExpired          = errors.New("challenge expired")
+	ErrWrongSolution    = errors.New("wrong solution")
+	ErrReplayed         = errors.New("challenge already solved")
+)
+
+// Challenge is a signed nonce, solved by finding a solution such that
+// sha256(nonce + ":" + solution) starts with difficulty zero bits.
+type Challenge struct {
+	Nonce      string    `json:"nonce"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Issuer issues and verifies the challenges, each one being accepted once.
+// Issuers sharing the secret accept the solutions of each other's challenges, not their replays.
+type Issuer struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu     sync.Mutex
+	solved *cache.Cache[bool] // nonces accepted, until they expire
+}
+
+func New(secret []byte, difficulty int, ttl time.Duration) *Issuer {
+	return &Issuer{
+		secret:     secret,
+		difficulty: difficulty,
+		ttl:        ttl,
+		now:        time.Now,
+		solved:     cache.NewOf[bool](cache.WithTTL(ttl)),
+	}
+}
+
+func (i *Issuer) sign(payload string) string {
+	m := hmac.New(sha256.New, i.secret)
+	m.Write([]byte(payload))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Issue returns a new challenge: expiry, difficulty, random part and their HMAC, separated by dots.
+func (i *Issuer) Issue() Challenge {
+	r := make([]byte, 16)
+	rand.Read(r)
+	exp := i.now().Add(i.ttl)
+	payload := strconv.FormatInt(exp.Unix(), 10) + "." + strconv.Itoa(i.difficulty) + "." + hex.EncodeToString(r)
+	return Challenge{payload + "." + i.sign(payload), i.difficulty, exp.Truncate(time.Second)}
+}
+
+// Verify checks the signature, expiry and solution of nonce, then burns it.
+func (i *Issuer) Verify(nonce, solution string) error {
+	payload, sig, ok := cutLast(nonce, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(i.sign(payload))) {
+		return ErrInvalidChallenge
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return ErrInvalidChallenge
+	}
+	exp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	if !i.now().Before(time.Unix(exp, 0)) {
+		return ErrExpired
+	}
+	if ZeroBits(nonce, solution) < difficulty {
+		return ErrWrongSolution
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.solved.IsPresent(nonce) {
+		return ErrReplayed
+	}
+	i.solved.Add(nonce, true)
+	return nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	k := strings.LastIndex(s, sep)
+	if k < 0 {
+		return s, "", false
+	}
+	return s[:k], s[k+len(sep):], true
+}
+
+// ZeroBits returns the number of leading zero bits of sha256(nonce + ":" + solution).
+func ZeroBits(nonce, solution string) int {
+	h := sha256.Sum256([]byte(nonce + ":" + solution))
+	n := 0
+	for _, b := range h {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Solve returns a solution of the challenge, as a client would compute it.
+func Solve(c Challenge) string {
+	for k := 0; ; k++ {
+		s := strconv.Itoa(k)
+		if ZeroBits(c.Nonce, s) >= c.Difficulty {
+			return s
+		}
+	}
+}
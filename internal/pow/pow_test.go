@@ -0,0 +1,78 @@
+package pow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestIssuer(difficulty int) (*Issuer, *time.Time) {
+	now := time.Now()
+	i := New([]byte("s3cr3t"), difficulty, time.Minute)
+	i.now = func() time.Time { return now }
+	return i, &now
+}
+
+func TestVerify(t *testing.T) {
+	i, now := newTestIssuer(8)
+	c := i.Issue()
+	if c.Difficulty != 8 || !c.ExpiresAt.After(*now) {
+		t.Errorf("incorrect challenge, got %+v", c)
+		t.FailNow()
+	}
+	s := Solve(c)
+	wrong := "nope"
+	for ZeroBits(c.Nonce, wrong) >= c.Difficulty {
+		wrong += "!"
+	}
+
+	tt := []struct {
+		name            string
+		nonce, solution string
+		err             error
+	}{
+		{"wrong solution", c.Nonce, wrong, ErrWrongSolution},
+		{"valid", c.Nonce, s, nil},
+		{"replayed", c.Nonce, s, ErrReplayed},
+		{"tampered", strings.Replace(c.Nonce, ".8.", ".0.", 1), s, ErrInvalidChallenge},
+		{"unsigned", "1.2.3", s, ErrInvalidChallenge},
+		{"empty", "", "", ErrInvalidChallenge},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := i.Verify(tc.nonce, tc.solution); !errors.Is(err, tc.err) {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.err)
+				t.FailNow()
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		c := i.Issue()
+		s := Solve(c)
+		*now = now.Add(time.Minute)
+		if err := i.Verify(c.Nonce, s); !errors.Is(err, ErrExpired) {
+			t.Errorf("incorrect error, got %v, want %v", err, ErrExpired)
+			t.FailNow()
+		}
+	})
+
+	t.Run("another secret", func(t *testing.T) {
+		c := New([]byte("other"), 8, time.Minute).Issue()
+		if err := i.Verify(c.Nonce, Solve(c)); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("incorrect error, got %v, want %v", err, ErrInvalidChallenge)
+			t.FailNow()
+		}
+	})
+}
+
+func TestZeroBits(t *testing.T) {
+	for _, d := range []int{0, 4, 12} {
+		c := Challenge{Nonce: "n", Difficulty: d}
+		if z := ZeroBits(c.Nonce, Solve(c)); z < d {
+			t.Errorf("solution of difficulty %d has %d zero bits", d, z)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Reporter reports the internal errors to a tracker, with the request of ctx when set by WithRequest.
+type Reporter interface {
+	Report(ctx context.Context, err error, tags map[string]string)
+}
+
+// Noop is a Reporter dropping every error, the default when no tracker is configured.
+type Noop struct{}
+
+func (Noop) Report(context.Context, error, map[string]string) {}
+
+// request is the request of an error, as set in its context by WithRequest.
+type request struct {
+	r     *http.Request
+	route string
+}
+
+type requestKey struct{}
+
+// WithRequest returns ctx with the request r, served by route, reported with its errors.
+func WithRequest(ctx context.Context, r *http.Request, route string) context.Context {
+	return context.WithValue(ctx, requestKey{}, request{r, route})
+}
+
+// reportedHeaders are the only headers reported, the others may hold API keys, tokens or cookies.
+var reportedHeaders = []string{"Accept", "Content-Length", "Content-Type", "Origin", "User-Agent", "X-Request-Id"}
+
+var (
+	emailRegexp = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	tokenRegexp = regexp.MustCompile(`[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}|\b[0-9a-fA-F]{32,}\b`)
+)
+
+// Scrub returns s without the emails and the tokens it contains.
+func Scrub(s string) string {
+	s = emailRegexp.ReplaceAllString(s, "[email]")
+	return tokenRegexp.ReplaceAllString(s, "[token]")
+}
+
+// Sentry reports the errors to Sentry, scrubbed of the emails and the tokens.
+// The environment and the release are read from SENTRY_ENVIRONMENT and SENTRY_RELEASE.
+type Sentry struct {
+	client *sentry.Client
+}
+
+// NewSentry returns a Sentry reporting to the project of dsn through t, nil for the HTTP transport of the SDK.
+func NewSentry(dsn string, t sentry.Transport) (*Sentry, error) {
+	if dsn == "" {
+		return nil, errors.New("sentry DSN missing")
+	}
+	c, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:        dsn,
+		Transport:  t,
+		BeforeSend: func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event { return scrub(e) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Sentry{client: c}, nil
+}
+
+func (s *Sentry) Report(ctx context.Context, err error, tags map[string]string) {
+	scope := sentry.NewScope()
+	scope.SetTags(tags)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		scope.SetTag("trace_id", sc.TraceID().String())
+	}
+	if r, ok := ctx.Value(requestKey{}).(request); ok {
+		req := newRequest(r)
+		scope.AddEventProcessor(func(e *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+			e.Request = req
+			return e
+		})
+	}
+	sentry.NewHub(s.client, scope).CaptureException(err)
+}
+
+// Flush waits for the pending reports to be sent, until timeout. It returns false if some are not.
+func (s *Sentry) Flush(timeout time.Duration) bool {
+	return s.client.Flush(timeout)
+}
+
+// newRequest returns the reported data of r, its URL being its route not to report the tokens of the path.
+func newRequest(r request) *sentry.Request {
+	route := r.route
+	if route == "" {
+		route = "unknown"
+	}
+	scheme := "http"
+	if r.r.TLS != nil {
+		scheme = "https"
+	}
+	headers := map[string]string{}
+	for _, h := range reportedHeaders {
+		if v := r.r.Header.Get(h); v != "" {
+			headers[h] = v
+		}
+	}
+	return &sentry.Request{
+		URL:         scheme + "://" + r.r.Host + route,
+		Method:      r.r.Method,
+		QueryString: r.r.URL.RawQuery,
+		Headers:     headers,
+	}
+}
+
+// scrub removes the emails and the tokens from the messages, the tags and the request of e.
+func scrub(e *sentry.Event) *sentry.Event {
+	e.Message = Scrub(e.Message)
+	for i := range e.Exception {
+		e.Exception[i].Value = Scrub(e.Exception[i].Value)
+	}
+	for k, v := range e.Tags {
+		e.Tags[k] = Scrub(v)
+	}
+	if r := e.Request; r != nil {
+		q, err := url.ParseQuery(r.QueryString)
+		if err != nil {
+			q = url.Values{}
+		}
+		for _, vs := range q {
+			for i, v := range vs {
+				vs[i] = Scrub(v)
+			}
+		}
+		r.QueryString = q.Encode()
+		r.Cookies = ""
+		r.Data = ""
+		r.Env = nil
+		for k, v := range r.Headers {
+			r.Headers[k] = Scrub(v)
+		}
+	}
+	e.User = sentry.User{}
+	return e
+}
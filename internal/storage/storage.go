@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Uploader writes the objects of the exports and signs their download URLs.
+type Uploader interface {
+	// Upload writes the object key with the content of r until EOF, aborted when r fails or ctx is done.
+	Upload(ctx context.Context, key, contentType string, r io.Reader) error
+	// URL returns a link downloading the object key during ttl, without credentials.
+	URL(key string, ttl time.Duration) (string, error)
+}
+
+// S3 is an Uploader to a bucket, the keys under a prefix. The objects are encrypted at rest with the
+// key of the bucket (SSE-S3), or with a KMS key when set.
+type S3 struct {
+	svc      *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+	kmsKey   string
+}
+
+// NewS3 returns the S3 Uploader to bucket, the keys prefixed by prefix, encrypted with the KMS key kmsKey
+// unless empty.
+func NewS3(sess *session.Session, bucket, prefix, kmsKey string) *S3 {
+	svc := s3.New(sess)
+	return &S3{
+		svc:      svc,
+		uploader: s3manager.NewUploaderWithClient(svc),
+		bucket:   bucket,
+		prefix:   prefix,
+		kmsKey:   kmsKey,
+	}
+}
+
+func (s *S3) Upload(ctx context.Context, key, contentType string, r io.Reader) error {
+	input := &s3manager.UploadInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(s.prefix + key),
+		Body:                 r,
+		ContentType:          aws.String(contentType),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	}
+	if s.kmsKey != "" {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(s.kmsKey)
+	}
+	_, err := s.uploader.UploadWithContext(ctx, input) // the parts already sent are discarded on failure
+	return err
+}
+
+func (s *S3) URL(key string, ttl time.Duration) (string, error) {
+	req, _ := s.svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + key),
+	})
+	return req.Presign(ttl)
+}
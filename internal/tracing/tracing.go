@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator carries the trace from a request to the work it defers, as the outbox emails.
+var propagator = propagation.TraceContext{}
+
+// Enabled reports whether an OTLP endpoint is set in the standard OTEL_EXPORTER_OTLP_* env variables.
+func Enabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup exports the spans over OTLP/HTTP, as configured by the OTEL_EXPORTER_OTLP_* env variables,
+// and propagates the W3C trace context of the requests. OTEL_SERVICE_NAME overrides the service name.
+// It returns the shutdown of the exporter, flushing the pending spans.
+func Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", service)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer of the package named n, from the global provider set by Setup.
+func Tracer(n string) trace.Tracer {
+	return otel.Tracer("github.com/unleaktrade/waitlist/" + n)
+}
+
+// End ends span, failed with err when not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject returns the W3C traceparent of the span of ctx, empty when ctx has none.
+func Inject(ctx context.Context) string {
+	c := propagation.MapCarrier{}
+	propagator.Inject(ctx, c)
+	return c.Get("traceparent")
+}
+
+// Extract returns ctx with the remote span of the W3C traceparent tp, ctx itself when tp is empty or invalid.
+func Extract(ctx context.Context, tp string) context.Context {
+	if tp == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": tp})
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtract(t *testing.T) {
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	tp := Inject(ctx)
+	if tp == "" {
+		t.Error("the trace of the span must be injected")
+		t.FailNow()
+	}
+	sc := trace.SpanContextFromContext(Extract(context.Background(), tp))
+	if !sc.IsRemote() || sc.TraceID() != span.SpanContext().TraceID() || sc.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("incorrect extracted span, got %v, want %v", sc, span.SpanContext())
+		t.FailNow()
+	}
+
+	if tp := Inject(context.Background()); tp != "" {
+		t.Errorf("no trace must be injected without span, got %q", tp)
+		t.FailNow()
+	}
+	for _, tp := range []string{"", "00-invalid"} {
+		if sc := trace.SpanContextFromContext(Extract(context.Background(), tp)); sc.IsValid() {
+			t.Errorf("traceparent %q must be ignored, got %v", tp, sc)
+			t.FailNow()
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if Enabled() {
+		t.Error("tracing must be disabled without endpoint")
+		t.FailNow()
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://tempo:4318/v1/traces")
+	if !Enabled() {
+		t.Error("tracing must be enabled by the traces endpoint")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+	"github.com/unleaktrade/waitlist/internal/events"
+)
+
+const (
+	EventActivated = events.UserActivated
+	// SignatureHeader carries "sha256=" followed by the hex HMAC-SHA256 of the body, keyed by the shared secret.
+	SignatureHeader = "UNLK-Signature"
+)
+
+var ErrNoSecret = errors.New("webhook secret is missing")
+
+// Event is the body of the deliveries, as the events published to the sinks.
+type Event = events.Event
+
+func Activated(u *data.User) Event {
+	return events.NewEvent(EventActivated, u, time.UnixMilli(u.Timestamp))
+}
+
+// Submitter runs jobs in the background, like mailer.Dispatcher.
+type Submitter interface {
+	Submit(name string, job func(ctx context.Context)) bool
+}
+
+// Notifier posts the events to every URL, retrying failed deliveries with exponential backoff and jitter.
+type Notifier struct {
+	urls     []string
+	secret   string
+	d        Submitter
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	sleep    func(time.Duration)
+}
+
+func New(urls []string, secret string, d Submitter) (*Notifier, error) {
+	if secret == "" {
+		return nil, ErrNoSecret
+	}
+	return &Notifier{
+		urls:     urls,
+		secret:   secret,
+		d:        d,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		attempts: 3,
+		backoff:  500 * time.Millisecond,
+		sleep:    time.Sleep,
+	}, nil
+}
+
+// Sign returns the value of SignatureHeader for body.
+func Sign(body []byte, secret string) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Notify queues the delivery of e to every URL, it never blocks the caller.
+func (n *Notifier) Notify(e Event) {
+	for _, u := range n.urls {
+		job := func(ctx context.Context) { n.Deliver(ctx, u, e) }
+		if !n.d.Submit("webhook "+e.Event+" to "+u, job) {
+			slog.Warn("⚠️ webhook dropped", "event", e.Event, "url", u)
+		}
+	}
+}
+
+// delay returns the pause before retry i (starting at 0): backoff * 2^i plus up to 50% jitter.
+func (n *Notifier) delay(i int) time.Duration {
+	d := n.backoff << i
+	if d <= 0 {
+		return 0
+	}
+	return d + rand.N(d/2+1)
+}
+
+// Deliver posts e to url until it is accepted, the attempts are exhausted or ctx is done.
+func (n *Notifier) Deliver(ctx context.Context, url string, e Event) (err error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n.attempts; i++ {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+		var retry bool
+		if retry, err = n.post(ctx, url, body); err == nil || !retry {
+			break
+		}
+		if i < n.attempts-1 {
+			n.sleep(n.delay(i))
+		}
+	}
+	if err != nil {
+		slog.Error("🔥 giving up webhook", "event", e.Event, "url", url, slog.Any("error", err))
+	}
+	return err
+}
+
+// post returns whether a failed delivery is worth retrying.
+func (n *Notifier) post(ctx context.Context, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(body, n.secret))
+	res, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook status %d", res.StatusCode)
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+const secret = "sh4r3d-s3cr3t"
+
+// inline runs the jobs synchronously.
+type inline struct{}
+
+func (inline) Submit(name string, job func(ctx context.Context)) bool {
+	job(context.Background())
+	return true
+}
+
+func newTestNotifier(t *testing.T, urls ...string) *Notifier {
+	n, err := New(urls, secret, inline{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.sleep = func(time.Duration) {}
+	return n
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New([]string{"http://localhost"}, "", inline{}); err != ErrNoSecret {
+		t.Errorf("incorrect error, got %v, want %v", err, ErrNoSecret)
+		t.FailNow()
+	}
+}
+
+func TestSignature(t *testing.T) {
+	u := data.NewUser("5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF", "john.doe@mailservice.com", "9mf2bkJf5TebjCYQYq3WcK61ruHTs3bpeQwW2s6WWj3A")
+	var got Event
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign(body, secret) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		json.Unmarshal(body, &got)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	n := newTestNotifier(t, srv.URL)
+	n.Notify(Activated(u))
+	mu.Lock()
+	defer mu.Unlock()
+	want := Event{SchemaVersion: 1, Event: EventActivated, Address: u.Address, Sponsor: u.Sponsor, Timestamp: u.Timestamp, UUID: u.UUID}
+	if got != want {
+		t.Errorf("incorrect event, got %+v, want %+v", got, want)
+		t.FailNow()
+	}
+	if body := []byte(`{}`); Sign(body, "wrong") == Sign(body, secret) {
+		t.Errorf("signature must depend on the secret")
+		t.FailNow()
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	tt := []struct {
+		name     string
+		failures int32 // responses in error before a success
+		status   int
+		calls    int32
+		ok       bool
+	}{
+		{"success", 0, http.StatusInternalServerError, 1, true},
+		{"retry on 500", 2, http.StatusInternalServerError, 3, true},
+		{"give up", 5, http.StatusInternalServerError, 3, false},
+		{"no retry on 400", 5, http.StatusBadRequest, 1, false},
+		{"retry on 429", 1, http.StatusTooManyRequests, 2, true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tc.failures {
+					w.WriteHeader(tc.status)
+				}
+			}))
+			defer srv.Close()
+
+			n := newTestNotifier(t, srv.URL)
+			err := n.Deliver(context.Background(), srv.URL, Event{Event: EventActivated})
+			if (err == nil) != tc.ok {
+				t.Errorf("incorrect result, got %v, want success %v", err, tc.ok)
+				t.FailNow()
+			}
+			if calls.Load() != tc.calls {
+				t.Errorf("incorrect number of calls, got %d, want %d", calls.Load(), tc.calls)
+				t.FailNow()
+			}
+		})
+	}
+}
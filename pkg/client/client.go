@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+// Client calls the waitlist API at its base URL with an API key.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	secret     string // signs the requests when set
+	adminToken string // of the admin routes
+	http       *http.Client
+	retries    int
+	backoff    time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with h instead of a client timing out after 10 seconds.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.http = h }
+}
+
+// WithSecret signs the requests with secret, for the API keys configured as signed.
+func WithSecret(secret string) Option {
+	return func(c *Client) { c.secret = secret }
+}
+
+// WithAdminToken authenticates the calls of the admin routes with the admin token t, see waitlistctl admin-token.
+func WithAdminToken(t string) Option {
+	return func(c *Client) { c.adminToken = t }
+}
+
+// WithRetries retries the rate limited and failed requests n times, waiting backoff then twice longer each time.
+// The default is 3 retries from 1 second, a signed request needing a new timestamp to be sent again.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = n, backoff }
+}
+
+func New(baseURL, apiKey string, options ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		retries: 3,
+		backoff: time.Second,
+	}
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
+// do sends the request, retried on 429 and 5xx, and decodes the JSON response into v when its status is ok.
+// It returns the status of the response, an *Error for the other ones.
+func (c *Client) do(ctx context.Context, method, path string, header http.Header, body []byte, v any, ok ...int) (int, error) {
+	wait := c.backoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		req.Header.Set("UNLK-API-KEY", c.apiKey)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.secret != "" {
+			if err := Sign(req, c.secret, time.Now()); err != nil {
+				return 0, err
+			}
+		}
+		res, err := c.http.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+		for _, s := range ok {
+			if res.StatusCode == s {
+				if v == nil {
+					return s, nil
+				}
+				return s, json.Unmarshal(b, v)
+			}
+		}
+		e := parseError(res, b)
+		if attempt >= c.retries || (res.StatusCode != http.StatusTooManyRequests && res.StatusCode < 500) {
+			return res.StatusCode, e
+		}
+		t := time.NewTimer(max(wait, e.RetryAfter))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return 0, ctx.Err()
+		case <-t.C:
+		}
+		wait *= 2
+	}
+}
+
+// Register registers u, returning the hash of the activation email sent, or of the one pending.
+// Its retries are safe, sent with the same Idempotency-Key.
+func (c *Client) Register(ctx context.Context, u *data.User) (string, error) {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return "", err
+	}
+	k := make([]byte, 16)
+	rand.Read(k)
+	var res struct {
+		Hash string `json:"hash"`
+	}
+	h := http.Header{"Idempotency-Key": {hex.EncodeToString(k)}}
+	if _, err := c.do(ctx, http.MethodPost, "/register", h, b, &res, http.StatusAccepted, http.StatusOK); err != nil {
+		return "", err
+	}
+	return res.Hash, nil
+}
+
+// Activate activates the registration of the activation token and its hash, returning the user saved.
+func (c *Client) Activate(ctx context.Context, token, hash string) (*data.User, error) {
+	u := &data.User{}
+	if _, err := c.do(ctx, http.MethodPost, "/activate/"+url.PathEscape(token)+"/"+url.PathEscape(hash), nil, nil, u, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// CheckWallet returns whether address is registered, and when.
+func (c *Client) CheckWallet(ctx context.Context, address string) (bool, time.Time, error) {
+	var res struct {
+		Registered   bool   `json:"registered"`
+		RegisteredAt string `json:"registered_at"`
+	}
+	s, err := c.do(ctx, http.MethodGet, "/check-wallet/"+url.PathEscape(address), nil, nil, &res, http.StatusOK, http.StatusNotFound)
+	if err != nil || s == http.StatusNotFound {
+		return false, time.Time{}, err
+	}
+	at, err := time.Parse(time.RFC3339, res.RegisteredAt)
+	if err != nil {
+		return false, time.Time{}, fmt.Errorf("invalid registration time %q: %w", res.RegisteredAt, err)
+	}
+	return res.Registered, at, nil
+}
+
+// ListOptions pages the list of the users, all of them when Max is 0.
+type ListOptions struct {
+	Offset     int
+	Max        int
+	IncludePII bool // emails in clear, with the pii scope, redacted otherwise
+}
+
+// List returns the activated users, most recent first, with the admin token of WithAdminToken.
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]*data.User, error) {
+	path := "/admin/list"
+	q := url.Values{}
+	if opts.Offset > 0 || opts.Max > 0 {
+		q.Set("offset", strconv.Itoa(opts.Offset))
+		if opts.Max > 0 {
+			q.Set("max", strconv.Itoa(opts.Max))
+		}
+	}
+	if opts.IncludePII {
+		q.Set("include_pii", "true")
+	}
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var res struct {
+		Users []*data.User `json:"users"`
+	}
+	h := http.Header{"Authorization": {"Bearer " + c.adminToken}}
+	if _, err := c.do(ctx, http.MethodGet, path, h, nil, &res, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return res.Users, nil
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/unleaktrade/waitlist/internal/data"
+)
+
+const address = "5tsrsspeS4ARKhPzLpzqaMjwu2KzhvktoJFW1Lv7pqVF"
+
+// respond answers each request with the next of responses, the last one being repeated.
+func respond(t *testing.T, responses ...func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *atomic.Int64) {
+	calls := &atomic.Int64{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		responses[min(n, len(responses)-1)](w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s, calls
+}
+
+func status(code int, body string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		fmt.Fprint(w, body)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tt := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+		code   string
+	}{
+		{"conflict", http.StatusConflict, `{"error":{"code":"conflict","message":"already activated"},"request_id":"r1"}`, ErrConflict, "conflict"},
+		{"unauthorized", http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"Unauthorized"}}`, ErrUnauthorized, "unauthorized"},
+		{"insufficient scope", http.StatusForbidden, `{"error":{"code":"insufficient_scope","message":"API key without the check scope"}}`, ErrForbidden, "insufficient_scope"},
+		{"validation", http.StatusBadRequest, `{"error":{"code":"validation_failed","message":"invalid email","fields":[{"field":"email","rule":"email"}]}}`, ErrInvalid, "validation_failed"},
+		{"expired", http.StatusGone, `{"error":{"code":"activation_expired","message":"activation link expired, register again to receive a new one"}}`, ErrExpired, "activation_expired"},
+		{"full", http.StatusGone, `{"error":{"code":"waitlist_full","message":"waitlist full"}}`, ErrWaitlistFull, "waitlist_full"},
+		{"closed", http.StatusForbidden, `{"error":{"code":"waitlist_closed","message":"waitlist closed"}}`, ErrClosed, "waitlist_closed"},
+		{"legacy", http.StatusConflict, `{"error":"already activated"}`, ErrConflict, ""},
+		{"not JSON", http.StatusUnauthorized, `Unauthorized`, ErrUnauthorized, ""},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			s, calls := respond(t, status(tc.status, tc.body))
+			_, err := New(s.URL, "k", WithRetries(3, time.Millisecond)).Activate(context.Background(), "a.b.c", "H")
+			var e *Error
+			if !errors.Is(err, tc.want) || !errors.As(err, &e) || e.Code != tc.code || e.Status != tc.status {
+				t.Errorf("incorrect error, got %v, want %v", err, tc.want)
+				t.FailNow()
+			}
+			if calls.Load() != 1 {
+				t.Errorf("client errors must not be retried, got %d calls", calls.Load())
+				t.FailNow()
+			}
+		})
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ok := status(http.StatusAccepted, `{"hash":"H4SH"}`)
+	unavailable := status(http.StatusServiceUnavailable, `{"error":{"code":"internal_error","message":"internal error"}}`)
+	limited := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		status(http.StatusTooManyRequests, `{"error":{"code":"too_many_requests","message":"Too Many Requests"}}`)(w, r)
+	}
+
+	t.Run("recovered", func(t *testing.T) {
+		keys := map[string]bool{}
+		s, calls := respond(t, func(w http.ResponseWriter, r *http.Request) {
+			keys[r.Header.Get("Idempotency-Key")] = true
+			unavailable(w, r)
+		}, ok)
+		h, err := New(s.URL, "k", WithRetries(3, time.Millisecond)).Register(context.Background(), data.NewUser(address, "john.doe@mailservice.com", ""))
+		if err != nil || h != "H4SH" || calls.Load() != 2 || len(keys) != 1 {
+			t.Errorf("incorrect registration, got %q, %v after %d calls", h, err, calls.Load())
+			t.FailNow()
+		}
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		s, calls := respond(t, unavailable)
+		_, err := New(s.URL, "k", WithRetries(2, time.Millisecond)).Register(context.Background(), data.NewUser(address, "john.doe@mailservice.com", ""))
+		if !errors.Is(err, ErrServer) || calls.Load() != 3 {
+			t.Errorf("incorrect error, got %v after %d calls", err, calls.Load())
+			t.FailNow()
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		s, calls := respond(t, limited)
+		start := time.Now()
+		_, _, err := New(s.URL, "k", WithRetries(1, time.Millisecond)).CheckWallet(context.Background(), address)
+		var e *Error
+		if !errors.Is(err, ErrRateLimited) || !errors.As(err, &e) || e.RetryAfter != time.Second || calls.Load() != 2 {
+			t.Errorf("incorrect error, got %v after %d calls", err, calls.Load())
+			t.FailNow()
+		}
+		if time.Since(start) < time.Second {
+			t.Errorf("the client must wait the Retry-After delay, waited %v", time.Since(start))
+			t.FailNow()
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		s, _ := respond(t, limited)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, _, err := New(s.URL, "k").CheckWallet(ctx, address)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("the retries must stop with the context, got %v", err)
+			t.FailNow()
+		}
+	})
+}
+
+func TestRequests(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s, _ := respond(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("UNLK-API-KEY") != "k" || r.Header.Get(SignatureHeader) != Signature("s3cr3t", r.Method, r.URL.RequestURI(), r.Header.Get(TimestampHeader), nil) {
+			status(http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"Unauthorized"}}`)(w, r)
+			return
+		}
+		switch r.URL.RequestURI() {
+		case "/check-wallet/" + address:
+			status(http.StatusOK, `{"registered":true,"registered_at":"2026-01-02T03:04:05Z","position":1}`)(w, r)
+		case "/admin/list?include_pii=true&max=10&offset=20":
+			if r.Header.Get("Authorization") != "Bearer adm1n" {
+				status(http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"admin token required"}}`)(w, r)
+				return
+			}
+			status(http.StatusOK, `{"users":[{"address":"`+address+`"}],"count":1}`)(w, r)
+		default:
+			status(http.StatusNotFound, `{"registered":false}`)(w, r)
+		}
+	})
+	c := New(s.URL, "k", WithSecret("s3cr3t"), WithAdminToken("adm1n"))
+
+	ok, got, err := c.CheckWallet(context.Background(), address)
+	if err != nil || !ok || !got.Equal(at) {
+		t.Errorf("incorrect wallet, got %v %v %v", ok, got, err)
+		t.FailNow()
+	}
+	ok, got, err = c.CheckWallet(context.Background(), "Ggw2mrnWemEpJLYmGxBbMarEYsYTeQkToZcLVWsvk5Qg")
+	if err != nil || ok || !got.IsZero() {
+		t.Errorf("the unknown wallets must not be registered, got %v %v %v", ok, got, err)
+		t.FailNow()
+	}
+	users, err := c.List(context.Background(), ListOptions{Offset: 20, Max: 10, IncludePII: true})
+	if err != nil || len(users) != 1 || users[0].Address != address {
+		t.Errorf("incorrect list, got %v %v", users, err)
+		t.FailNow()
+	}
+}
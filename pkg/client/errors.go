@@ -0,0 +1,131 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Errors of the API responses, matched by errors.Is on the *Error returned.
+var (
+	ErrInvalid      = errors.New("invalid request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrWaitlistFull = errors.New("waitlist full")
+	ErrExpired      = errors.New("activation link expired") // register again for a new one
+	ErrClosed       = errors.New("waitlist closed")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+)
+
+// codes maps the codes of the error responses to the errors of the package.
+var codes = map[string]error{
+	"bad_request":          ErrInvalid,
+	"validation_failed":    ErrInvalid,
+	"payload_too_large":    ErrInvalid,
+	"idempotency_conflict": ErrConflict,
+	"pow_failed":           ErrInvalid,
+	"captcha_failed":       ErrInvalid,
+	"ownership_failed":     ErrInvalid,
+	"sponsor_unresolvable": ErrInvalid,
+	"unauthorized":         ErrUnauthorized,
+	"forbidden":            ErrForbidden,
+	"insufficient_scope":   ErrForbidden,
+	"not_found":            ErrNotFound,
+	"conflict":             ErrConflict,
+	"waitlist_full":        ErrWaitlistFull,
+	"activation_expired":   ErrExpired,
+	"waitlist_closed":      ErrClosed,
+	"too_many_requests":    ErrRateLimited,
+	"internal_error":       ErrServer,
+}
+
+// Field is an invalid field of a request.
+type Field struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+}
+
+// Error is an error response of the API.
+type Error struct {
+	Status     int
+	Code       string // empty with the legacy error responses
+	Message    string
+	Fields     []Field
+	RequestID  string
+	RetryAfter time.Duration // of the rate limited responses, 0 when the API gives none
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("waitlist: %d %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("waitlist: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Is matches the error of the code of e, or of its status when the code is unknown.
+func (e *Error) Is(target error) bool {
+	if err, ok := codes[e.Code]; ok {
+		return err == target
+	}
+	switch {
+	case e.Status == http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case e.Status == http.StatusForbidden:
+		return target == ErrForbidden
+	case e.Status == http.StatusNotFound:
+		return target == ErrNotFound
+	case e.Status == http.StatusConflict:
+		return target == ErrConflict
+	case e.Status == http.StatusGone:
+		return target == ErrWaitlistFull
+	case e.Status == http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	case e.Status >= 500:
+		return target == ErrServer
+	}
+	return target == ErrInvalid
+}
+
+// parseError returns the error of the response res, whose body is b.
+func parseError(res *http.Response, b []byte) *Error {
+	e := &Error{Status: res.StatusCode, Message: http.StatusText(res.StatusCode), RetryAfter: retryAfter(res.Header.Get("Retry-After"))}
+	var envelope struct {
+		Error     json.RawMessage `json:"error"`
+		RequestID string          `json:"request_id"`
+	}
+	if json.Unmarshal(b, &envelope) != nil || envelope.Error == nil {
+		return e
+	}
+	var body struct {
+		Code    string  `json:"code"`
+		Message string  `json:"message"`
+		Fields  []Field `json:"fields"`
+	}
+	if json.Unmarshal(envelope.Error, &body) == nil {
+		e.Code, e.Message, e.Fields = body.Code, body.Message, body.Fields
+	} else {
+		json.Unmarshal(envelope.Error, &e.Message) // legacy {"error": message}
+	}
+	e.RequestID = envelope.RequestID
+	return e
+}
+
+// retryAfter returns the delay of the Retry-After header v, in seconds or as an HTTP date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
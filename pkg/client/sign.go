@@ -0,0 +1,47 @@
+// Package client calls the waitlist API.
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of the signed requests, sent along the UNLK-API-KEY header naming the key.
+const (
+	TimestampHeader = "X-UNLK-Timestamp"
+	SignatureHeader = "X-UNLK-Signature"
+)
+
+// Signature returns the hex HMAC-SHA256, keyed by secret, of the method, path with query,
+// Unix timestamp in seconds and body of a request, separated by newlines.
+func Signature(secret, method, path, timestamp string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(m, method+"\n"+path+"\n"+timestamp+"\n")
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Sign sets the timestamp and signature headers of req, signed with secret at t.
+// The body of req is read, then replaced by a copy.
+func Sign(req *http.Request, secret string, t time.Time) error {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	ts := strconv.FormatInt(t.Unix(), 10)
+	req.Header.Set(TimestampHeader, ts)
+	req.Header.Set(SignatureHeader, Signature(secret, req.Method, req.URL.RequestURI(), ts, body))
+	return nil
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	req, _ := http.NewRequest("POST", "https://waitlist.unleak.trade/register?lang=fr", strings.NewReader(`{"address":"a"}`))
+	if err := Sign(req, "s3cr3t", at); err != nil {
+		t.Fatal(err)
+	}
+	if ts := req.Header.Get(TimestampHeader); ts != "1700000000" {
+		t.Errorf("incorrect timestamp, got %s", ts)
+		t.FailNow()
+	}
+	want := Signature("s3cr3t", "POST", "/register?lang=fr", "1700000000", []byte(`{"address":"a"}`))
+	if sig := req.Header.Get(SignatureHeader); sig != want || len(sig) != 64 {
+		t.Errorf("incorrect signature, got %s, want %s", sig, want)
+		t.FailNow()
+	}
+	if b, _ := io.ReadAll(req.Body); string(b) != `{"address":"a"}` {
+		t.Errorf("the body must be kept, got %s", b)
+		t.FailNow()
+	}
+
+	for name, sig := range map[string]string{
+		"method":    Signature("s3cr3t", "GET", "/register?lang=fr", "1700000000", []byte(`{"address":"a"}`)),
+		"path":      Signature("s3cr3t", "POST", "/register", "1700000000", []byte(`{"address":"a"}`)),
+		"timestamp": Signature("s3cr3t", "POST", "/register?lang=fr", "1700000001", []byte(`{"address":"a"}`)),
+		"body":      Signature("s3cr3t", "POST", "/register?lang=fr", "1700000000", []byte(`{"address":"b"}`)),
+		"secret":    Signature("0th3r", "POST", "/register?lang=fr", "1700000000", []byte(`{"address":"a"}`)),
+	} {
+		if sig == want {
+			t.Errorf("the signature must depend on the %s", name)
+			t.FailNow()
+		}
+	}
+}